@@ -37,6 +37,13 @@ type TokenManager interface {
 
 	// CheckToken checks the validity of the token and returns relevant data.
 	CheckToken(token []byte, k TokenKind) (TokenData, error)
+
+	// GetShareToken produces a capability token for the given share zettel.
+	GetShareToken(share id.Zid, expires time.Time) ([]byte, error)
+
+	// CheckShareToken checks the validity of a share token and returns the
+	// zettel identifier of the share zettel.
+	CheckShareToken(token []byte) (id.Zid, error)
 }
 
 // TokenKind specifies for which application / usage a token is/was requested.
@@ -47,6 +54,7 @@ const (
 	_ TokenKind = iota
 	KindAPI
 	KindwebUI
+	KindShare
 )
 
 // TokenData contains some important elements from a token.
@@ -63,12 +71,16 @@ type TokenData struct {
 type AuthzManager interface {
 	BaseManager
 
-	// Owner returns the zettel identifier of the owner.
-	Owner() id.Zid
+	// Owners returns the zettel identifiers of all owners.
+	Owners() []id.Zid
 
-	// IsOwner returns true, if the given zettel identifier is that of the owner.
+	// IsOwner returns true, if the given zettel identifier is that of an owner.
 	IsOwner(zid id.Zid) bool
 
+	// IsAdmin returns true, if the given user is allowed to administer the
+	// Zettelstore, i.e. if it is an owner or an delegated administrator.
+	IsAdmin(user *meta.Meta) bool
+
 	// Returns true if authentication is enabled.
 	WithAuth() bool
 
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"hash/fnv"
 	"io"
+	"slices"
 	"time"
 
 	"t73f.de/r/sx"
@@ -34,15 +35,15 @@ import (
 
 type myAuth struct {
 	readonly bool
-	owner    id.Zid
+	owners   []id.Zid
 	secret   []byte
 }
 
 // New creates a new auth object.
-func New(readonly bool, owner id.Zid, extSecret string) auth.Manager {
+func New(readonly bool, owners []id.Zid, extSecret string) auth.Manager {
 	return &myAuth{
 		readonly: readonly,
-		owner:    owner,
+		owners:   slices.Clone(owners),
 		secret:   calcSecret(extSecret),
 	}
 }
@@ -148,13 +149,56 @@ func setupTokenData(obj sx.Object, k auth.TokenKind, tokenData *auth.TokenData)
 	return nil
 }
 
-func (a *myAuth) Owner() id.Zid { return a.owner }
+// GetShareToken returns a capability token for a share zettel.
+func (a *myAuth) GetShareToken(share id.Zid, expires time.Time) ([]byte, error) {
+	if !share.IsValid() {
+		return nil, ErrNoZid
+	}
+	sClaim := sx.MakeList(
+		sx.Int64(auth.KindShare),
+		sx.Int64(share),
+		sx.Int64(expires.Unix()),
+	)
+	return sign(sClaim, a.secret)
+}
+
+// CheckShareToken checks the validity of a share token.
+func (a *myAuth) CheckShareToken(tok []byte) (id.Zid, error) {
+	obj, err := check(tok, a.secret)
+	if err != nil {
+		return id.Invalid, err
+	}
+	vals, err := sexp.ParseList(obj, "iii")
+	if err != nil {
+		return id.Invalid, ErrMalformedToken
+	}
+	if auth.TokenKind(vals[0].(sx.Int64)) != auth.KindShare {
+		return id.Invalid, ErrOtherKind
+	}
+	if time.Unix(int64(vals[2].(sx.Int64)), 0).Before(time.Now()) {
+		return id.Invalid, ErrTokenExpired
+	}
+	zid := id.Zid(vals[1].(sx.Int64))
+	if !zid.IsValid() {
+		return id.Invalid, ErrNoZid
+	}
+	return zid, nil
+}
+
+func (a *myAuth) Owners() []id.Zid { return slices.Clone(a.owners) }
 
 func (a *myAuth) IsOwner(zid id.Zid) bool {
-	return zid.IsValid() && zid == a.owner
+	return zid.IsValid() && slices.Contains(a.owners, zid)
+}
+
+func (a *myAuth) IsAdmin(user *meta.Meta) bool {
+	if !a.WithAuth() {
+		return true
+	}
+	return user != nil && a.GetUserRole(user) >= meta.UserRoleAdmin
 }
 
-func (a *myAuth) WithAuth() bool { return a.owner != id.Invalid }
+func (a *myAuth) WithAuth() bool { return len(a.owners) > 0 }
 
 // GetUserRole role returns the user role of the given user zettel.
 func (a *myAuth) GetUserRole(user *meta.Meta) meta.UserRole {
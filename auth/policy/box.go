@@ -15,6 +15,8 @@ package policy
 
 import (
 	"context"
+	"io"
+	"slices"
 
 	"zettelstore.de/z/auth"
 	"zettelstore.de/z/box"
@@ -68,12 +70,27 @@ func (pp *polBox) GetZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, err
 		return zettel.Zettel{}, err
 	}
 	user := server.GetUser(ctx)
-	if pp.policy.CanRead(user, z.Meta) {
+	if pp.canRead(ctx, user, z.Meta) {
+		pp.filterDuplicates(ctx, user, z.Meta)
 		return z, nil
 	}
 	return zettel.Zettel{}, box.NewErrNotAllowed("GetZettel", user, zid)
 }
 
+func (pp *polBox) GetZettelStream(ctx context.Context, zid id.Zid) (*meta.Meta, *box.ContentStream, error) {
+	m, cs, err := pp.box.GetZettelStream(ctx, zid)
+	if err != nil {
+		return nil, nil, err
+	}
+	user := server.GetUser(ctx)
+	if pp.canRead(ctx, user, m) {
+		pp.filterDuplicates(ctx, user, m)
+		return m, cs, nil
+	}
+	cs.Close()
+	return nil, nil, box.NewErrNotAllowed("GetZettel", user, zid)
+}
+
 func (pp *polBox) GetAllZettel(ctx context.Context, zid id.Zid) ([]zettel.Zettel, error) {
 	return pp.box.GetAllZettel(ctx, zid)
 }
@@ -88,17 +105,80 @@ func (pp *polBox) GetMeta(ctx context.Context, zid id.Zid) (*meta.Meta, error) {
 		return nil, err
 	}
 	user := server.GetUser(ctx)
-	if pp.policy.CanRead(user, m) {
+	if pp.canRead(ctx, user, m) {
+		pp.filterDuplicates(ctx, user, m)
 		return m, nil
 	}
 	return nil, box.NewErrNotAllowed("GetMeta", user, zid)
 }
 
+func (pp *polBox) GetWords(ctx context.Context, zid id.Zid) ([]string, error) {
+	if _, err := pp.GetMeta(ctx, zid); err != nil {
+		return nil, err
+	}
+	return pp.box.GetWords(ctx, zid)
+}
+
+func (pp *polBox) SearchEqual(word string) *id.Set {
+	return pp.box.SearchEqual(word)
+}
+
 func (pp *polBox) SelectMeta(ctx context.Context, metaSeq []*meta.Meta, q *query.Query) ([]*meta.Meta, error) {
+	// Joins must only reference zettel that the user is allowed to read.
+	if err := q.ExecuteJoins(ctx, pp); err != nil {
+		return nil, err
+	}
 	user := server.GetUser(ctx)
 	canRead := pp.policy.CanRead
-	q = q.SetPreMatch(func(m *meta.Meta) bool { return canRead(user, m) })
-	return pp.box.SelectMeta(ctx, metaSeq, q)
+	if share := server.GetShare(ctx); share != nil && share.Zid == id.Invalid {
+		q = q.SetPreMatch(func(m *meta.Meta) bool { return canRead(user, m) || canRead(share.Creator, m) })
+	} else {
+		q = q.SetPreMatch(func(m *meta.Meta) bool { return canRead(user, m) })
+	}
+	result, err := pp.box.SelectMeta(ctx, metaSeq, q)
+	for _, m := range result {
+		pp.filterDuplicates(ctx, user, m)
+	}
+	return result, err
+}
+
+// filterDuplicates removes all zettel from the duplicates of a zettel, that
+// the user is not allowed to read. Otherwise the user could find out about
+// the content of these zettel.
+func (pp *polBox) filterDuplicates(ctx context.Context, user, m *meta.Meta) {
+	dups, found := m.GetList(meta.KeyDuplicates)
+	if !found {
+		return
+	}
+	readable := make([]string, 0, len(dups))
+	for _, val := range dups {
+		if zid, err := id.Parse(val); err == nil {
+			if dm, err2 := pp.box.GetMeta(ctx, zid); err2 == nil && pp.canRead(ctx, user, dm) {
+				readable = append(readable, val)
+			}
+		}
+	}
+	if len(readable) == 0 {
+		m.Delete(meta.KeyDuplicates)
+	} else if len(readable) < len(dups) {
+		m.SetList(meta.KeyDuplicates, readable)
+	}
+}
+
+// canRead checks whether the user is allowed to read the zettel. If the
+// request is based on a share, the user that created the share may grant
+// read access to the shared zettel. A shared query grants access only to the
+// zettel it starts with, all other results are checked by SelectMeta.
+func (pp *polBox) canRead(ctx context.Context, user, m *meta.Meta) bool {
+	if pp.policy.CanRead(user, m) {
+		return true
+	}
+	if share := server.GetShare(ctx); share != nil {
+		if share.Zid == m.Zid || (share.Zid == id.Invalid && slices.Contains(share.Zids, m.Zid)) {
+			return pp.policy.CanRead(share.Creator, m)
+		}
+	}
+	return false
 }
 
 func (pp *polBox) CanUpdateZettel(ctx context.Context, zettel zettel.Zettel) bool {
@@ -122,6 +202,24 @@ func (pp *polBox) UpdateZettel(ctx context.Context, zettel zettel.Zettel) error
 	return box.NewErrNotAllowed("Write", user, zid)
 }
 
+func (pp *polBox) UpdateZettelStream(ctx context.Context, m *meta.Meta, r io.Reader) error {
+	zid := m.Zid
+	user := server.GetUser(ctx)
+	if !zid.IsValid() {
+		return box.ErrInvalidZid{Zid: zid.String()}
+	}
+	// Only the metadata of the existing zettel is needed
+	oldMeta, cs, err := pp.box.GetZettelStream(ctx, zid)
+	if err != nil {
+		return err
+	}
+	cs.Close()
+	if pp.policy.CanWrite(user, oldMeta, m) {
+		return pp.box.UpdateZettelStream(ctx, m, r)
+	}
+	return box.NewErrNotAllowed("Write", user, zid)
+}
+
 func (pp *polBox) CanDeleteZettel(ctx context.Context, zid id.Zid) bool {
 	return pp.box.CanDeleteZettel(ctx, zid)
 }
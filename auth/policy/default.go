@@ -52,6 +52,8 @@ func (d *defaultPolicy) canChange(user, m *meta.Meta) bool {
 		return userRole > meta.UserRoleReader
 	case api.ValueUserRoleWriter:
 		return userRole > meta.UserRoleWriter
+	case meta.ValueUserRoleAdmin:
+		return userRole > meta.UserRoleAdmin
 	case api.ValueUserRoleOwner:
 		return userRole > meta.UserRoleOwner
 	}
@@ -30,7 +30,7 @@ func (o *ownerPolicy) CanCreate(user, newMeta *meta.Meta) bool {
 	if user == nil || !o.pre.CanCreate(user, newMeta) {
 		return false
 	}
-	return o.userIsOwner(user) || o.userCanCreate(user, newMeta)
+	return (o.userIsOwner(user) && o.adminCanChange(user, newMeta)) || o.userCanCreate(user, newMeta)
 }
 
 func (o *ownerPolicy) userCanCreate(user, newMeta *meta.Meta) bool {
@@ -40,6 +40,10 @@ func (o *ownerPolicy) userCanCreate(user, newMeta *meta.Meta) bool {
 	if _, ok := newMeta.Get(api.KeyUserID); ok {
 		return false
 	}
+	if creator, ok := newMeta.Get(meta.KeyShareCreator); ok && creator != user.Zid.String() {
+		// Only an owner may grant the rights of another user by a share.
+		return false
+	}
 	return true
 }
 
@@ -93,7 +97,7 @@ func (o *ownerPolicy) CanWrite(user, oldMeta, newMeta *meta.Meta) bool {
 		return res
 	}
 	if o.userIsOwner(user) {
-		return true
+		return o.adminCanChange(user, oldMeta) && o.adminCanChange(user, newMeta)
 	}
 	if !o.userCanRead(user, oldMeta, vis) {
 		return false
@@ -112,6 +116,10 @@ func (o *ownerPolicy) CanWrite(user, oldMeta, newMeta *meta.Meta) bool {
 	case meta.UserRoleReader, meta.UserRoleCreator:
 		return false
 	}
+	if creator, ok := oldMeta.Get(meta.KeyShareCreator); ok && creator != user.Zid.String() {
+		// Only the creator of a share, or an owner, may change it.
+		return false
+	}
 	return o.userCanCreate(user, newMeta)
 }
 
@@ -122,7 +130,7 @@ func (o *ownerPolicy) CanDelete(user, m *meta.Meta) bool {
 	if res, ok := o.checkVisibility(user, o.authConfig.GetVisibility(m)); ok {
 		return res
 	}
-	return o.userIsOwner(user)
+	return o.userIsOwner(user) && o.adminCanChange(user, m)
 }
 
 func (o *ownerPolicy) CanRefresh(user *meta.Meta) bool {
@@ -142,15 +150,23 @@ func (o *ownerPolicy) checkVisibility(user *meta.Meta, vis meta.Visibility) (boo
 	return false, false
 }
 
+// userIsOwner returns true, if the user has the rights of an owner. This is
+// also true for an administrator, which got the rights delegated by an owner.
 func (o *ownerPolicy) userIsOwner(user *meta.Meta) bool {
 	if user == nil {
 		return false
 	}
-	if o.manager.IsOwner(user.Zid) {
+	return o.manager.IsAdmin(user)
+}
+
+// adminCanChange returns false, if a delegated administrator wants to change
+// the user zettel of an owner, or wants to make another user an owner.
+func (o *ownerPolicy) adminCanChange(user, m *meta.Meta) bool {
+	if o.manager.GetUserRole(user) != meta.UserRoleAdmin {
 		return true
 	}
-	if val, ok := user.Get(api.KeyUserRole); ok && val == api.ValueUserRoleOwner {
+	if _, ok := m.Get(api.KeyUserID); !ok {
 		return true
 	}
-	return false
+	return !o.manager.IsOwner(m.Zid) && m.GetDefault(api.KeyUserRole, "") != api.ValueUserRoleOwner
 }
@@ -71,9 +71,16 @@ type testAuthzManager struct {
 }
 
 func (a *testAuthzManager) IsReadonly() bool      { return a.readOnly }
-func (*testAuthzManager) Owner() id.Zid           { return ownerZid }
+func (*testAuthzManager) Owners() []id.Zid        { return []id.Zid{ownerZid} }
 func (*testAuthzManager) IsOwner(zid id.Zid) bool { return zid == ownerZid }
 
+func (a *testAuthzManager) IsAdmin(user *meta.Meta) bool {
+	if !a.WithAuth() {
+		return true
+	}
+	return user != nil && a.GetUserRole(user) >= meta.UserRoleAdmin
+}
+
 func (a *testAuthzManager) WithAuth() bool { return a.withAuth }
 
 func (a *testAuthzManager) GetUserRole(user *meta.Meta) meta.UserRole {
@@ -511,12 +518,94 @@ func testRefresh(t *testing.T, pol auth.Policy, withAuth, expert, simple bool) {
 	}
 }
 
+func TestAdminPolicy(t *testing.T) {
+	t.Parallel()
+	pol := newPolicy(&testAuthzManager{withAuth: true}, &authConfig{})
+	admin := newAdmin()
+	owner := newOwner()
+	zettel := newZettel()
+	userZettel := newUserZettel()
+	ownerZettel := newOwnerZettel()
+	newOwnerUser := newUserZettel()
+	newOwnerUser.Set(api.KeyUserRole, api.ValueUserRoleOwner)
+
+	if !pol.CanRead(admin, ownerZettel) {
+		t.Error("admin must read owner zettel")
+	}
+	if !pol.CanWrite(admin, zettel, zettel) {
+		t.Error("admin must write zettel")
+	}
+	if !pol.CanWrite(admin, userZettel, userZettel) {
+		t.Error("admin must write user zettel")
+	}
+	if !pol.CanCreate(admin, userZettel) {
+		t.Error("admin must create user zettel")
+	}
+	if pol.CanCreate(admin, newOwnerUser) {
+		t.Error("admin must not create an owner")
+	}
+	if pol.CanWrite(admin, userZettel, newOwnerUser) {
+		t.Error("admin must not promote a user to owner")
+	}
+	if pol.CanWrite(admin, owner, owner) {
+		t.Error("admin must not change the owner")
+	}
+	if pol.CanDelete(admin, owner) {
+		t.Error("admin must not delete the owner")
+	}
+	if !pol.CanDelete(admin, zettel) {
+		t.Error("admin must delete zettel")
+	}
+}
+
+func TestSharePolicy(t *testing.T) {
+	t.Parallel()
+	pol := newPolicy(&testAuthzManager{withAuth: true}, &authConfig{})
+	writer := newWriter()
+	owner := newOwner()
+	newShare := func(creator id.Zid) *meta.Meta {
+		m := meta.New(zettelZid)
+		m.Set(api.KeyRole, "share")
+		m.Set(meta.KeyShareZettel, visZid.String())
+		m.Set(meta.KeyShareCreator, creator.String())
+		return m
+	}
+	writerShare := newShare(writerZid)
+	ownerShare := newShare(ownerZid)
+
+	if !pol.CanCreate(writer, writerShare) {
+		t.Error("writer must create own share")
+	}
+	if pol.CanCreate(writer, ownerShare) {
+		t.Error("writer must not create share with rights of owner")
+	}
+	if !pol.CanCreate(owner, writerShare) {
+		t.Error("owner must create share for other user")
+	}
+	if !pol.CanWrite(writer, writerShare, writerShare) {
+		t.Error("writer must update own share")
+	}
+	if pol.CanWrite(writer, writerShare, ownerShare) {
+		t.Error("writer must not grant rights of owner")
+	}
+	if pol.CanWrite(writer, ownerShare, ownerShare) {
+		t.Error("writer must not update share of owner")
+	}
+	if pol.CanWrite(writer, ownerShare, writerShare) {
+		t.Error("writer must not take over share of owner")
+	}
+	if !pol.CanWrite(owner, writerShare, writerShare) {
+		t.Error("owner must update share of writer")
+	}
+}
+
 const (
 	creatorZid = id.Zid(1013)
 	readerZid  = id.Zid(1013)
 	writerZid  = id.Zid(1015)
 	ownerZid   = id.Zid(1017)
 	owner2Zid  = id.Zid(1019)
+	adminZid   = id.Zid(1020)
 	zettelZid  = id.Zid(1021)
 	visZid     = id.Zid(1023)
 	userZid    = id.Zid(1025)
@@ -558,6 +647,13 @@ func newOwner2() *meta.Meta {
 	user.Set(api.KeyUserRole, api.ValueUserRoleOwner)
 	return user
 }
+func newAdmin() *meta.Meta {
+	user := meta.New(adminZid)
+	user.Set(api.KeyTitle, "Admin")
+	user.Set(api.KeyUserID, "admin")
+	user.Set(api.KeyUserRole, meta.ValueUserRoleAdmin)
+	return user
+}
 func newZettel() *meta.Meta {
 	m := meta.New(zettelZid)
 	m.Set(api.KeyTitle, "Any Zettel")
@@ -0,0 +1,200 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+// Package auditbox provides a persistent audit trail of all changes to zettel
+// and a read-only box to query it.
+package auditbox
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/manager"
+	"zettelstore.de/z/kernel"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func init() {
+	manager.Register(
+		" audit",
+		func(_ *url.URL, cdata *manager.ConnectData) (box.ManagedBox, error) {
+			trail := GetTrail()
+			if trail == nil {
+				return nil, nil
+			}
+			ab := &auditBox{
+				log: kernel.Main.GetLogger(kernel.BoxService).Clone().
+					Str("box", "audit").Int("boxnum", int64(cdata.Number)).Child(),
+				number:   cdata.Number,
+				enricher: cdata.Enricher,
+				trail:    trail,
+			}
+			if chci := cdata.Notify; chci != nil {
+				trail.setNotify(func(zid id.Zid) {
+					chci <- box.UpdateInfo{Box: ab, Reason: box.OnZettel, Zid: zid}
+				})
+			}
+			return ab, nil
+		})
+}
+
+var (
+	myMx    sync.Mutex
+	myTrail *Trail
+)
+
+// Setup opens the audit trail, if a file name was given. The trail is opened
+// only once, even if the box manager is restarted.
+func Setup(filename string, ci ContextInfo) error {
+	if filename == "" {
+		return nil
+	}
+	myMx.Lock()
+	defer myMx.Unlock()
+	if myTrail != nil {
+		return nil
+	}
+	trail, err := openTrail(
+		kernel.Main.GetLogger(kernel.BoxService).Clone().Str("box", "audit").Child(),
+		filename, ci)
+	if err != nil {
+		return err
+	}
+	myTrail = trail
+	return nil
+}
+
+// GetTrail returns the audit trail, or nil if no audit trail was set up.
+func GetTrail() *Trail {
+	myMx.Lock()
+	defer myMx.Unlock()
+	return myTrail
+}
+
+type auditBox struct {
+	log      *logger.Logger
+	number   int
+	enricher box.Enricher
+	trail    *Trail
+}
+
+func (ab *auditBox) Location() string { return "audit:" + ab.trail.filename }
+
+func (ab *auditBox) State() box.StartState {
+	if ab.trail.isOpen() {
+		return box.StartStateStarted
+	}
+	return box.StartStateStopped
+}
+
+func (ab *auditBox) Start(context.Context) error {
+	err := ab.trail.open()
+	ab.log.Trace().Err(err).Msg("Start")
+	return err
+}
+
+func (ab *auditBox) Stop(context.Context) {
+	if err := ab.trail.close(); err != nil {
+		ab.log.Error().Err(err).Msg("Unable to close audit trail")
+	}
+	ab.log.Trace().Msg("Stop")
+}
+
+func (ab *auditBox) GetZettel(_ context.Context, zid id.Zid) (zettel.Zettel, error) {
+	if m := ab.getMeta(zid); m != nil {
+		ab.log.Trace().Msg("GetZettel")
+		return zettel.Zettel{Meta: m}, nil
+	}
+	err := box.ErrZettelNotFound{Zid: zid}
+	ab.log.Trace().Err(err).Msg("GetZettel/Err")
+	return zettel.Zettel{}, err
+}
+
+func (ab *auditBox) HasZettel(_ context.Context, zid id.Zid) bool {
+	return ab.trail.get(zid) != nil
+}
+
+func (ab *auditBox) ApplyZid(_ context.Context, handle box.ZidFunc, constraint query.RetrievePredicate) error {
+	length := ab.trail.length()
+	ab.log.Trace().Int("entries", int64(length)).Msg("ApplyZid")
+	for i := 1; i <= length; i++ {
+		if zid := zidBase + id.Zid(i); constraint(zid) {
+			handle(zid)
+		}
+	}
+	return nil
+}
+
+func (ab *auditBox) ApplyMeta(ctx context.Context, handle box.MetaFunc, constraint query.RetrievePredicate) error {
+	length := ab.trail.length()
+	ab.log.Trace().Int("entries", int64(length)).Msg("ApplyMeta")
+	for i := 1; i <= length; i++ {
+		zid := zidBase + id.Zid(i)
+		if !constraint(zid) {
+			continue
+		}
+		if m := ab.getMeta(zid); m != nil {
+			ab.enricher.Enrich(ctx, m, ab.number)
+			handle(m)
+		}
+	}
+	return nil
+}
+
+func (*auditBox) CanDeleteZettel(context.Context, id.Zid) bool { return false }
+
+func (ab *auditBox) DeleteZettel(_ context.Context, zid id.Zid) (err error) {
+	if ab.trail.get(zid) != nil {
+		err = box.ErrReadOnly
+	} else {
+		err = box.ErrZettelNotFound{Zid: zid}
+	}
+	ab.log.Trace().Err(err).Msg("DeleteZettel")
+	return err
+}
+
+func (ab *auditBox) ReadStats(st *box.ManagedBoxStats) {
+	st.ReadOnly = true
+	st.Zettel = ab.trail.length()
+	ab.log.Trace().Int("zettel", int64(st.Zettel)).Msg("ReadStats")
+}
+
+// getMeta returns the metadata of an audit entry, completed with all values
+// that are not stored in the trail file.
+func (ab *auditBox) getMeta(zid id.Zid) *meta.Meta {
+	m := ab.trail.get(zid)
+	if m == nil {
+		return nil
+	}
+	op := m.GetDefault(KeyOperation, "")
+	title := "Audit " + op + " " + m.GetDefault(KeyZettel, "")
+	if userID, found := m.Get(KeyUser); found {
+		title += " by " + userID
+	}
+	m.Set(api.KeyTitle, title)
+	m.Set(api.KeyRole, ValueRoleAudit)
+	m.Set(api.KeySyntax, meta.SyntaxNone)
+	m.Set(api.KeyReadOnly, api.ValueTrue)
+	m.Set(api.KeyVisibility, api.ValueVisibilityOwner)
+	if created, found := m.Get(api.KeyCreated); found {
+		m.Set(api.KeyModified, created)
+	}
+	return m
+}
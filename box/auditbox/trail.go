@@ -0,0 +1,216 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package auditbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"t73f.de/r/zsc/input"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// Metadata keys of an audit entry.
+const (
+	KeyOperation = "audit-operation"
+	KeyZettel    = "audit-zettel"
+	KeyUser      = "audit-user"
+	KeyUserZid   = "audit-user-zid"
+	KeyClient    = "audit-client"
+	KeyKeys      = "audit-keys"
+	KeyContent   = "audit-content"
+)
+
+// ValueRoleAudit is the role of all audit entries.
+const ValueRoleAudit = "audit"
+
+// zidBase is the zettel identifier of the audit entry with sequence number zero.
+// Audit entries are numbered from 1 to maxEntries.
+const (
+	zidBase    = id.Zid(80000000)
+	maxEntries = 9999999
+)
+
+// ContextInfo allows to retrieve data about the acting user and its client.
+type ContextInfo interface {
+	GetUser(context.Context) *meta.Meta
+	GetClient(context.Context) string
+}
+
+// Trail is a persistent, append-only list of audit entries.
+//
+// Each entry is stored as a block of metadata lines, separated by an empty line.
+type Trail struct {
+	log      *logger.Logger
+	filename string
+	ci       ContextInfo
+	mx       sync.RWMutex // Protects the following fields
+	file     *os.File
+	entries  []*meta.Meta
+	notify   func(id.Zid)
+}
+
+// openTrail reads all existing entries of the audit trail file and prepares
+// it for appending new entries.
+func openTrail(log *logger.Logger, filename string, ci ContextInfo) (*Trail, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var entries []*meta.Meta
+	inp := input.NewInput(data)
+	for inp.Ch != input.EOS {
+		m := meta.NewFromInput(zidBase+id.Zid(len(entries)+1), inp)
+		if _, found := m.Get(KeyOperation); found {
+			entries = append(entries, m)
+		}
+	}
+	t := &Trail{
+		log:      log,
+		filename: filename,
+		ci:       ci,
+		entries:  entries,
+	}
+	if err = t.open(); err != nil {
+		return nil, err
+	}
+	log.Info().Str("file", filename).Int("entries", int64(len(entries))).Msg("Open audit trail")
+	return t, nil
+}
+
+// open prepares the trail file for appending new entries, if it is not
+// already open.
+func (t *Trail) open() error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.openLocked()
+}
+
+func (t *Trail) openLocked() error {
+	if t.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(t.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	t.file = file
+	return nil
+}
+
+// close closes the trail file. Entries already read are still available.
+// A later change will open the file again.
+func (t *Trail) close() error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// isOpen returns true, if the trail file is open for appending.
+func (t *Trail) isOpen() bool {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	return t.file != nil
+}
+
+// RecordChange stores that the current user changed the given zettel.
+//
+// It is allowed to call this method on a nil trail. Nothing will be recorded then.
+func (t *Trail) RecordChange(ctx context.Context, op string, zid id.Zid, keys []string, withContent bool) {
+	if t == nil {
+		return
+	}
+	t.mx.Lock()
+	if len(t.entries) >= maxEntries {
+		t.mx.Unlock()
+		t.log.Error().Zid(zid).Msg("Audit trail is full")
+		return
+	}
+	m := meta.New(zidBase + id.Zid(len(t.entries)+1))
+	m.Set(api.KeyCreated, time.Now().Local().Format(id.TimestampLayout))
+	m.Set(KeyOperation, op)
+	m.Set(KeyZettel, zid.String())
+	if user := t.ci.GetUser(ctx); user != nil {
+		m.Set(KeyUserZid, user.Zid.String())
+		if userID, found := user.Get(api.KeyUserID); found {
+			m.Set(KeyUser, userID)
+		}
+	}
+	m.SetNonEmpty(KeyClient, t.ci.GetClient(ctx))
+	if len(keys) > 0 {
+		m.SetList(KeyKeys, keys)
+	}
+	if withContent {
+		m.Set(KeyContent, api.ValueTrue)
+	}
+
+	var buf bytes.Buffer
+	_, _ = m.WriteComputed(&buf)
+	buf.WriteByte('\n')
+	err := t.openLocked()
+	if err == nil {
+		_, err = t.file.Write(buf.Bytes())
+	}
+	if err == nil {
+		err = t.file.Sync()
+	}
+	if err != nil {
+		t.mx.Unlock()
+		t.log.Error().Err(err).Zid(zid).Str("op", op).Msg("Unable to write audit entry")
+		return
+	}
+	t.entries = append(t.entries, m)
+	notify := t.notify
+	t.mx.Unlock()
+
+	if notify != nil {
+		notify(m.Zid)
+	}
+}
+
+// get returns a copy of the audit entry with the given zettel identifier.
+func (t *Trail) get(zid id.Zid) *meta.Meta {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	if zid <= zidBase || zid > zidBase+id.Zid(len(t.entries)) {
+		return nil
+	}
+	return t.entries[zid-zidBase-1].Clone()
+}
+
+// length returns the number of entries.
+func (t *Trail) length() int {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	return len(t.entries)
+}
+
+func (t *Trail) setNotify(notify func(id.Zid)) {
+	t.mx.Lock()
+	t.notify = notify
+	t.mx.Unlock()
+}
@@ -0,0 +1,257 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package auditbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+type testContextInfo struct {
+	user   *meta.Meta
+	client string
+}
+
+func (ci *testContextInfo) GetUser(context.Context) *meta.Meta { return ci.user }
+func (ci *testContextInfo) GetClient(context.Context) string   { return ci.client }
+
+type testEnricher struct{ calls int }
+
+func (te *testEnricher) Enrich(context.Context, *meta.Meta, int) { te.calls++ }
+
+func newTestUser() *meta.Meta {
+	user := meta.New(id.Zid(20241019100000))
+	user.Set(api.KeyUserID, "alice")
+	return user
+}
+
+func TestTrail(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	ci := &testContextInfo{user: newTestUser(), client: "192.0.2.1"}
+	trail, err := openTrail(nil, filename, ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notified []id.Zid
+	trail.setNotify(func(zid id.Zid) { notified = append(notified, zid) })
+
+	ctx := context.Background()
+	trail.RecordChange(ctx, "update", id.Zid(1), []string{api.KeyTags, api.KeyTitle}, true)
+	ci.user, ci.client = nil, ""
+	trail.RecordChange(ctx, "delete", id.Zid(2), nil, false)
+	trail.close()
+
+	if trail.length() != 2 {
+		t.Fatalf("expected two entries, but got %d", trail.length())
+	}
+	if len(notified) != 2 || notified[0] != zidBase+1 || notified[1] != zidBase+2 {
+		t.Errorf("unexpected notifications %v", notified)
+	}
+
+	// Entries must survive a restart.
+	trail, err = openTrail(nil, filename, ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trail.close()
+	if trail.length() != 2 {
+		t.Fatalf("expected two entries after reopen, but got %d", trail.length())
+	}
+	m := trail.get(zidBase + 1)
+	if m == nil {
+		t.Fatal("first entry not found")
+	}
+	exp := map[string]string{
+		KeyOperation: "update",
+		KeyZettel:    id.Zid(1).String(),
+		KeyUser:      "alice",
+		KeyUserZid:   "20241019100000",
+		KeyClient:    "192.0.2.1",
+		KeyKeys:      "tags title",
+		KeyContent:   api.ValueTrue,
+	}
+	for key, val := range exp {
+		if got := m.GetDefault(key, ""); got != val {
+			t.Errorf("key %q: expected %q, but got %q", key, val, got)
+		}
+	}
+	if _, err = time.Parse(id.TimestampLayout, m.GetDefault(api.KeyCreated, "")); err != nil {
+		t.Errorf("invalid created value: %v", err)
+	}
+
+	m = trail.get(zidBase + 2)
+	if m == nil {
+		t.Fatal("second entry not found")
+	}
+	for _, key := range []string{KeyUser, KeyUserZid, KeyClient, KeyKeys, KeyContent} {
+		if val, found := m.Get(key); found {
+			t.Errorf("key %q should not be set, but has value %q", key, val)
+		}
+	}
+	if trail.get(zidBase) != nil || trail.get(zidBase+3) != nil {
+		t.Error("entries outside of the trail must not be found")
+	}
+
+	// Changing a retrieved entry must not change the trail.
+	m.Set(KeyOperation, "create")
+	if got := trail.get(zidBase+2).GetDefault(KeyOperation, ""); got != "delete" {
+		t.Errorf("trail was changed: %q", got)
+	}
+}
+
+func TestTrailIgnoresGarbage(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	data := "audit-operation: create\naudit-zettel: 00000000000001\n\nsome garbage\n\naudit-operation: delete\n"
+	if err := os.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	trail, err := openTrail(nil, filename, &testContextInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trail.close()
+	if trail.length() != 2 {
+		t.Fatalf("expected two entries, but got %d", trail.length())
+	}
+	if got := trail.get(zidBase+2).GetDefault(KeyOperation, ""); got != "delete" {
+		t.Errorf("expected second entry to be a deletion, but got %q", got)
+	}
+}
+
+func TestNilTrail(*testing.T) {
+	var trail *Trail
+	trail.RecordChange(context.Background(), "create", id.Zid(1), nil, true)
+}
+
+func TestAuditBox(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	ci := &testContextInfo{user: newTestUser()}
+	trail, err := openTrail(nil, filename, ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trail.close()
+	ctx := context.Background()
+	trail.RecordChange(ctx, "create", id.Zid(1), []string{api.KeyTitle}, true)
+	trail.RecordChange(ctx, "delete", id.Zid(1), nil, false)
+
+	enricher := &testEnricher{}
+	ab := &auditBox{number: 1, enricher: enricher, trail: trail}
+
+	z, err := ab.GetZettel(ctx, zidBase+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := z.Meta
+	if got, exp := m.GetDefault(api.KeyTitle, ""), "Audit create 00000000000001 by alice"; got != exp {
+		t.Errorf("expected title %q, but got %q", exp, got)
+	}
+	if got := m.GetDefault(api.KeyRole, ""); got != ValueRoleAudit {
+		t.Errorf("expected role %q, but got %q", ValueRoleAudit, got)
+	}
+	if got := m.GetDefault(api.KeyVisibility, ""); got != api.ValueVisibilityOwner {
+		t.Errorf("audit entries must only be visible to the owner, but got %q", got)
+	}
+	if m.GetDefault(api.KeyModified, "") != m.GetDefault(api.KeyCreated, "-") {
+		t.Error("modified must be equal to created")
+	}
+	if _, err = ab.GetZettel(ctx, zidBase+3); !errors.As(err, &box.ErrZettelNotFound{}) {
+		t.Errorf("expected zettel not found, but got %v", err)
+	}
+
+	if !ab.HasZettel(ctx, zidBase+2) || ab.HasZettel(ctx, zidBase+3) {
+		t.Error("HasZettel returns wrong results")
+	}
+	var zids []id.Zid
+	ab.ApplyZid(ctx, func(zid id.Zid) { zids = append(zids, zid) }, func(zid id.Zid) bool { return zid != zidBase+1 })
+	if len(zids) != 1 || zids[0] != zidBase+2 {
+		t.Errorf("ApplyZid: unexpected zids %v", zids)
+	}
+	var metas []*meta.Meta
+	ab.ApplyMeta(ctx, func(m *meta.Meta) { metas = append(metas, m) }, func(id.Zid) bool { return true })
+	if len(metas) != 2 || enricher.calls != 2 {
+		t.Errorf("ApplyMeta: got %d metadata with %d enrichments", len(metas), enricher.calls)
+	}
+
+	if ab.CanDeleteZettel(ctx, zidBase+1) {
+		t.Error("audit entries must not be deletable")
+	}
+	if err = ab.DeleteZettel(ctx, zidBase+1); err != box.ErrReadOnly {
+		t.Errorf("expected read-only error, but got %v", err)
+	}
+	if err = ab.DeleteZettel(ctx, zidBase+3); !errors.As(err, &box.ErrZettelNotFound{}) {
+		t.Errorf("expected zettel not found, but got %v", err)
+	}
+	var st box.ManagedBoxStats
+	ab.ReadStats(&st)
+	if !st.ReadOnly || st.Zettel != 2 {
+		t.Errorf("unexpected statistics %v", st)
+	}
+}
+
+func TestAuditBoxStartStop(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	trail, err := openTrail(nil, filename, &testContextInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ab := &auditBox{number: 1, enricher: &testEnricher{}, trail: trail}
+	ctx := context.Background()
+	if got := ab.State(); got != box.StartStateStarted {
+		t.Errorf("opened trail must be started, but got %v", got)
+	}
+
+	ab.Stop(ctx)
+	if got := ab.State(); got != box.StartStateStopped {
+		t.Errorf("stopped box must be stopped, but got %v", got)
+	}
+	if trail.length() != 0 {
+		t.Errorf("no entries expected, but got %d", trail.length())
+	}
+
+	// A change while the box is stopped re-opens the trail file.
+	trail.RecordChange(ctx, "create", id.Zid(1), nil, true)
+	if trail.length() != 1 || !trail.isOpen() {
+		t.Fatalf("change must be recorded, got %d entries", trail.length())
+	}
+	ab.Stop(ctx)
+
+	if err = ab.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := ab.State(); got != box.StartStateStarted {
+		t.Errorf("started box must be started, but got %v", got)
+	}
+	trail.RecordChange(ctx, "delete", id.Zid(1), nil, false)
+	ab.Stop(ctx)
+	ab.Stop(ctx)
+
+	trail, err = openTrail(nil, filename, &testContextInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trail.close()
+	if trail.length() != 2 {
+		t.Errorf("expected two entries after restart, but got %d", trail.length())
+	}
+}
@@ -15,6 +15,7 @@
 package box
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -126,10 +127,59 @@ type Refresher interface {
 	Refresh(context.Context)
 }
 
+// ZidAssigner is implemented by boxes that always assign the identifier of a
+// new zettel, e.g. a remote Zettelstore. Such a box cannot store a zettel with
+// a given identifier, if it does not already contain it.
+type ZidAssigner interface {
+	// AssignsZid returns true, if the box assigns the identifier of new zettel.
+	AssignsZid() bool
+}
+
+// Overlayer is implemented by boxes that layer other boxes. A zettel of one
+// layer may shadow a zettel with the same identifier of another layer.
+type Overlayer interface {
+	// GetAllZettel retrieves a specific zettel from all layers. The first
+	// zettel shadows all others.
+	GetAllZettel(ctx context.Context, zid id.Zid) ([]zettel.Zettel, error)
+}
+
+// Streamer is implemented by boxes that are able to read and write the
+// content of a zettel without holding it completely in memory. This is
+// useful for zettel with large binary content.
+type Streamer interface {
+	// GetZettelStream retrieves the metadata and a stream of the content of
+	// a specific zettel. The caller must close the stream.
+	GetZettelStream(ctx context.Context, zid id.Zid) (*meta.Meta, *ContentStream, error)
+
+	// UpdateZettelStream updates an existing zettel, where the new content
+	// is read from the given reader.
+	UpdateZettelStream(ctx context.Context, m *meta.Meta, r io.Reader) error
+}
+
+// ContentStream allows to read the content of a zettel.
+type ContentStream struct {
+	io.ReadSeekCloser
+	Size    int64     // number of bytes of the content
+	ModTime time.Time // time of last modification, zero if not known
+}
+
+// NewContentStream returns a stream for content that is already in memory.
+func NewContentStream(content zettel.Content) *ContentStream {
+	return &ContentStream{
+		ReadSeekCloser: nopCloser{bytes.NewReader(content.AsBytes())},
+		Size:           int64(content.Length()),
+	}
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
 // Box is to be used outside the box package and its descendants.
 type Box interface {
 	BaseBox
 	WriteBox
+	Streamer
 
 	// FetchZids returns the set of all zettel identifer managed by the box.
 	FetchZids(ctx context.Context) (*id.Set, error)
@@ -137,6 +187,14 @@ type Box interface {
 	// GetMeta returns the metadata of the zettel with the given identifier.
 	GetMeta(context.Context, id.Zid) (*meta.Meta, error)
 
+	// GetWords returns the words of the zettel with the given identifier, as
+	// collected by the indexer.
+	GetWords(context.Context, id.Zid) ([]string, error)
+
+	// SearchEqual returns the set of all zettel identifier of zettel that
+	// contain the given word.
+	SearchEqual(word string) *id.Set
+
 	// SelectMeta returns a list of metadata that comply to the given selection criteria.
 	// If `metaSeq` is `nil`, the box assumes metadata of all available zettel.
 	SelectMeta(ctx context.Context, metaSeq []*meta.Meta, q *query.Query) ([]*meta.Meta, error)
@@ -306,6 +364,11 @@ var ErrStopped = errors.New("box is stopped")
 // ErrReadOnly is returned if there is an attepmt to write to a read-only box.
 var ErrReadOnly = errors.New("read-only box")
 
+// ErrNotStreamable is returned by a Streamer, if the content of a zettel
+// cannot be streamed, e.g. because it is encrypted. It is returned before
+// any content is read. The caller should use GetZettel / UpdateZettel instead.
+var ErrNotStreamable = errors.New("zettel content not streamable")
+
 // ErrZettelNotFound is returned if a zettel was not found in the box.
 type ErrZettelNotFound struct{ Zid id.Zid }
 
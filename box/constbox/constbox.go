@@ -157,7 +157,7 @@ var constZettelMap = map[id.Zid]constZettel{
 			api.KeyReadOnly:   api.ValueTrue,
 			api.KeyVisibility: api.ValueVisibilityPublic,
 			api.KeyCreated:    "20210504135842",
-			api.KeyModified:   "20240418095500",
+			api.KeyModified:   "20241018120000",
 		},
 		zettel.NewContent(contentDependencies)},
 	id.BaseTemplateZid: {
@@ -186,7 +186,7 @@ var constZettelMap = map[id.Zid]constZettel{
 			api.KeyRole:       api.ValueRoleConfiguration,
 			api.KeySyntax:     meta.SyntaxSxn,
 			api.KeyCreated:    "20230510155300",
-			api.KeyModified:   "20240826110000",
+			api.KeyModified:   "20241018120000",
 			api.KeyVisibility: api.ValueVisibilityExpert,
 		},
 		zettel.NewContent(contentZettelSxn)},
@@ -257,7 +257,7 @@ var constZettelMap = map[id.Zid]constZettel{
 			api.KeyRole:       api.ValueRoleConfiguration,
 			api.KeySyntax:     meta.SyntaxSxn,
 			api.KeyCreated:    "20230619132800",
-			api.KeyModified:   "20240826142000",
+			api.KeyModified:   "20241018120000",
 			api.KeyReadOnly:   api.ValueTrue,
 			api.KeyVisibility: api.ValueVisibilityExpert,
 			api.KeyPrecursor:  string(api.ZidSxnPrelude),
@@ -0,0 +1,255 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+// Package dbbox provides a box that stores all zettel in a single database file.
+package dbbox
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/manager"
+	"zettelstore.de/z/kernel"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func init() {
+	manager.Register("db", func(u *url.URL, cdata *manager.ConnectData) (box.ManagedBox, error) {
+		return &dbBox{
+			log: kernel.Main.GetLogger(kernel.BoxService).Clone().
+				Str("box", "db").Int("boxnum", int64(cdata.Number)).Child(),
+			number:   cdata.Number,
+			location: u.String(),
+			path:     getDBPath(u),
+			readonly: box.GetQueryBool(u, "readonly"),
+			enricher: cdata.Enricher,
+			notify:   cdata.Notify,
+		}, nil
+	})
+}
+
+func getDBPath(u *url.URL) string {
+	if u.Opaque != "" {
+		return filepath.Clean(u.Opaque)
+	}
+	return filepath.Clean(u.Path)
+}
+
+// dbBox stores all zettel in one file of an embedded key-value database.
+type dbBox struct {
+	log      *logger.Logger
+	number   int
+	location string
+	path     string
+	readonly bool
+	enricher box.Enricher
+	notify   chan<- box.UpdateInfo
+	mx       sync.RWMutex // Protects the following fields
+	db       *bolt.DB
+}
+
+func (dbb *dbBox) notifyChanged(zid id.Zid, reason box.UpdateReason) {
+	if chci := dbb.notify; chci != nil {
+		dbb.log.Trace().Zid(zid).Uint("reason", uint64(reason)).Msg("notifyChanged")
+		chci <- box.UpdateInfo{Box: dbb, Reason: reason, Zid: zid}
+	}
+}
+
+func (dbb *dbBox) Location() string { return dbb.location }
+
+func (dbb *dbBox) State() box.StartState {
+	dbb.mx.RLock()
+	defer dbb.mx.RUnlock()
+	if dbb.db == nil {
+		return box.StartStateStopped
+	}
+	return box.StartStateStarted
+}
+
+func (dbb *dbBox) Start(context.Context) error {
+	dbb.mx.Lock()
+	defer dbb.mx.Unlock()
+	if dbb.db != nil {
+		return box.ErrStarted
+	}
+	db, err := openDB(dbb.path, dbb.readonly)
+	if err != nil {
+		dbb.log.Error().Err(err).Str("path", dbb.path).Msg("Unable to open database")
+		return err
+	}
+	dbb.db = db
+	dbb.log.Trace().Str("path", dbb.path).Msg("Start Box")
+	return nil
+}
+
+func (dbb *dbBox) Stop(context.Context) {
+	dbb.mx.Lock()
+	defer dbb.mx.Unlock()
+	if db := dbb.db; db != nil {
+		dbb.db = nil
+		if err := db.Close(); err != nil {
+			dbb.log.Error().Err(err).Msg("Unable to close database")
+		}
+	}
+}
+
+// view executes the function within a read-only transaction.
+func (dbb *dbBox) view(fn func(*bolt.Tx) error) error {
+	dbb.mx.RLock()
+	defer dbb.mx.RUnlock()
+	if dbb.db == nil {
+		return box.ErrStopped
+	}
+	return dbb.db.View(fn)
+}
+
+// update executes the function within a read-write transaction. All changes
+// are committed, if the function returns no error.
+func (dbb *dbBox) update(fn func(*bolt.Tx) error) error {
+	if dbb.readonly {
+		return box.ErrReadOnly
+	}
+	dbb.mx.RLock()
+	defer dbb.mx.RUnlock()
+	if dbb.db == nil {
+		return box.ErrStopped
+	}
+	return dbb.db.Update(fn)
+}
+
+func (dbb *dbBox) CanCreateZettel(context.Context) bool { return !dbb.readonly }
+
+func (dbb *dbBox) CreateZettel(_ context.Context, zettel zettel.Zettel) (id.Zid, error) {
+	var newZid id.Zid
+	err := dbb.update(func(tx *bolt.Tx) error {
+		zid, err := box.GetNewZid(func(zid id.Zid) (bool, error) {
+			return !hasZettel(tx, zid), nil
+		})
+		if err != nil {
+			return err
+		}
+		m := zettel.Meta.Clone()
+		m.Zid = zid
+		zettel.Meta = m
+		if err = putZettel(tx, zettel); err != nil {
+			return err
+		}
+		newZid = zid
+		return nil
+	})
+	if err == nil {
+		dbb.notifyChanged(newZid, box.OnZettel)
+	}
+	dbb.log.Trace().Err(err).Zid(newZid).Msg("CreateZettel")
+	return newZid, err
+}
+
+func (dbb *dbBox) GetZettel(_ context.Context, zid id.Zid) (z zettel.Zettel, err error) {
+	err = dbb.view(func(tx *bolt.Tx) error {
+		z, err = getZettel(tx, zid)
+		return err
+	})
+	dbb.log.Trace().Zid(zid).Err(err).Msg("GetZettel")
+	return z, err
+}
+
+func (dbb *dbBox) HasZettel(_ context.Context, zid id.Zid) (found bool) {
+	dbb.view(func(tx *bolt.Tx) error {
+		found = hasZettel(tx, zid)
+		return nil
+	})
+	return found
+}
+
+func (dbb *dbBox) ApplyZid(_ context.Context, handle box.ZidFunc, constraint query.RetrievePredicate) error {
+	var zids id.Slice
+	err := dbb.view(func(tx *bolt.Tx) error {
+		zids = selectZid(tx, constraint)
+		return nil
+	})
+	dbb.log.Trace().Int("entries", int64(len(zids))).Err(err).Msg("ApplyZid")
+	for _, zid := range zids {
+		handle(zid)
+	}
+	return err
+}
+
+func (dbb *dbBox) ApplyMeta(ctx context.Context, handle box.MetaFunc, constraint query.RetrievePredicate) error {
+	// Metadata is collected first, so that the handler is not called within a
+	// transaction. Otherwise, it could not change the database.
+	var metas []*meta.Meta
+	err := dbb.view(func(tx *bolt.Tx) error {
+		metas = selectMeta(tx, constraint)
+		return nil
+	})
+	dbb.log.Trace().Int("entries", int64(len(metas))).Err(err).Msg("ApplyMeta")
+	for _, m := range metas {
+		dbb.enricher.Enrich(ctx, m, dbb.number)
+		handle(m)
+	}
+	return err
+}
+
+func (dbb *dbBox) CanUpdateZettel(_ context.Context, zettel zettel.Zettel) bool {
+	return !dbb.readonly && zettel.Meta.Zid.IsValid()
+}
+
+func (dbb *dbBox) UpdateZettel(_ context.Context, zettel zettel.Zettel) error {
+	m := zettel.Meta.Clone()
+	zid := m.Zid
+	if !zid.IsValid() {
+		return box.ErrInvalidZid{Zid: zid.String()}
+	}
+	zettel.Meta = m
+	err := dbb.update(func(tx *bolt.Tx) error { return putZettel(tx, zettel) })
+	if err == nil {
+		dbb.notifyChanged(zid, box.OnZettel)
+	}
+	dbb.log.Trace().Zid(zid).Err(err).Msg("UpdateZettel")
+	return err
+}
+
+func (dbb *dbBox) CanDeleteZettel(ctx context.Context, zid id.Zid) bool {
+	return !dbb.readonly && dbb.HasZettel(ctx, zid)
+}
+
+func (dbb *dbBox) DeleteZettel(_ context.Context, zid id.Zid) error {
+	err := dbb.update(func(tx *bolt.Tx) error {
+		if !hasZettel(tx, zid) {
+			return box.ErrZettelNotFound{Zid: zid}
+		}
+		return deleteZettel(tx, zid)
+	})
+	if err == nil {
+		dbb.notifyChanged(zid, box.OnDelete)
+	}
+	dbb.log.Trace().Zid(zid).Err(err).Msg("DeleteZettel")
+	return err
+}
+
+func (dbb *dbBox) ReadStats(st *box.ManagedBoxStats) {
+	st.ReadOnly = dbb.readonly
+	dbb.view(func(tx *bolt.Tx) error {
+		st.Zettel = countZettel(tx)
+		return nil
+	})
+	dbb.log.Trace().Int("zettel", int64(st.Zettel)).Msg("ReadStats")
+}
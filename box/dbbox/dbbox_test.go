@@ -0,0 +1,99 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package dbbox
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func makeTestZettel(zid id.Zid, title, content string) zettel.Zettel {
+	m := meta.New(zid)
+	m.Set(api.KeyTitle, title)
+	m.Set(api.KeySyntax, meta.SyntaxZmk)
+	return zettel.Zettel{Meta: m, Content: zettel.NewContent([]byte(content))}
+}
+
+func TestStore(t *testing.T) {
+	db, err := openDB(filepath.Join(t.TempDir(), "zettel.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	zids := id.Slice{20241018120002, 20241018120000, 20241018120001}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for i, zid := range zids {
+			if err1 := putZettel(tx, makeTestZettel(zid, zid.String(), string(rune('A'+i)))); err1 != nil {
+				return err1
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		if got := countZettel(tx); got != len(zids) {
+			t.Errorf("expected %d zettel, but got %d", len(zids), got)
+		}
+		z, err1 := getZettel(tx, 20241018120000)
+		if err1 != nil {
+			return err1
+		}
+		if got := z.Meta.GetDefault(api.KeyTitle, ""); got != "20241018120000" {
+			t.Errorf("expected title %q, but got %q", "20241018120000", got)
+		}
+		if got := z.Content.AsString(); got != "B" {
+			t.Errorf("expected content %q, but got %q", "B", got)
+		}
+		if _, err1 = getZettel(tx, 20241018120003); !errors.As(err1, &box.ErrZettelNotFound{}) {
+			t.Errorf("expected zettel not found, but got %v", err1)
+		}
+		metas := selectMeta(tx, func(zid id.Zid) bool { return zid != 20241018120001 })
+		if len(metas) != 2 || metas[0].Zid != 20241018120000 || metas[1].Zid != 20241018120002 {
+			t.Errorf("unexpected metadata selected: %v", metas)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error { return deleteZettel(tx, 20241018120001) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		if hasZettel(tx, 20241018120001) {
+			t.Error("deleted zettel still found")
+		}
+		if got := selectZid(tx, func(id.Zid) bool { return true }); len(got) != 2 {
+			t.Errorf("expected 2 zettel, but got %v", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
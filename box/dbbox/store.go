@@ -0,0 +1,223 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package dbbox
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"t73f.de/r/zsc/input"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/filebox"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// The database file contains two buckets. Both use the zettel identifier as
+// a string of 14 digits as key. Therefore, the keys are sorted by creation
+// time. Metadata is stored in the same format as a zettel file stores it.
+// Metadata is kept separately from content, so that it can be retrieved
+// without reading content.
+var (
+	bucketMeta    = []byte("meta")
+	bucketContent = []byte("content")
+)
+
+// fileMode to create a new database file: user, group, and all are allowed
+// to read and write. Typically, the umask will restrict this.
+const fileMode = 0666
+
+// openTimeout is the time to wait for the lock of the database file.
+const openTimeout = 5 * time.Second
+
+func openDB(path string, readonly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(path, fileMode, &bolt.Options{Timeout: openTimeout, ReadOnly: readonly})
+	if err != nil || readonly {
+		return db, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err1 := tx.CreateBucketIfNotExists(bucketMeta); err1 != nil {
+			return err1
+		}
+		_, err1 := tx.CreateBucketIfNotExists(bucketContent)
+		return err1
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// hasZettel returns true, if the zettel is stored in the database. A missing
+// bucket is treated as an empty one, because a read-only database file might
+// not be initialized.
+func hasZettel(tx *bolt.Tx, zid id.Zid) bool {
+	if b := tx.Bucket(bucketMeta); b != nil {
+		return b.Get(zid.Bytes()) != nil
+	}
+	return false
+}
+
+func getMeta(tx *bolt.Tx, zid id.Zid) *meta.Meta {
+	b := tx.Bucket(bucketMeta)
+	if b == nil {
+		return nil
+	}
+	if src := b.Get(zid.Bytes()); src != nil {
+		return parseMeta(zid, src)
+	}
+	return nil
+}
+
+func getZettel(tx *bolt.Tx, zid id.Zid) (zettel.Zettel, error) {
+	m := getMeta(tx, zid)
+	if m == nil {
+		return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+	}
+	var content []byte
+	if b := tx.Bucket(bucketContent); b != nil {
+		// Data returned by bolt is only valid within the transaction.
+		content = bytes.Clone(b.Get(zid.Bytes()))
+	}
+	content, err := filebox.DecryptContent(zid, content)
+	if err != nil {
+		return zettel.Zettel{}, err
+	}
+	return zettel.Zettel{Meta: m, Content: zettel.NewContent(content)}, nil
+}
+
+// selectMeta returns the metadata of all zettel that satisfy the given
+// constraint.
+func selectMeta(tx *bolt.Tx, constraint func(id.Zid) bool) []*meta.Meta {
+	b := tx.Bucket(bucketMeta)
+	if b == nil {
+		return nil
+	}
+	var result []*meta.Meta
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if zid, err := id.Parse(string(k)); err == nil && constraint(zid) {
+			result = append(result, parseMeta(zid, v))
+		}
+	}
+	return result
+}
+
+// selectZid returns the identifier of all zettel that satisfy the given
+// constraint.
+func selectZid(tx *bolt.Tx, constraint func(id.Zid) bool) id.Slice {
+	b := tx.Bucket(bucketMeta)
+	if b == nil {
+		return nil
+	}
+	var result id.Slice
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if zid, err := id.Parse(string(k)); err == nil && constraint(zid) {
+			result = append(result, zid)
+		}
+	}
+	return result
+}
+
+func parseMeta(zid id.Zid, src []byte) *meta.Meta {
+	return meta.NewFromInput(zid, input.NewInput(src))
+}
+
+func putZettel(tx *bolt.Tx, z zettel.Zettel) error {
+	m := z.Meta
+	key := m.Zid.Bytes()
+	content := z.Content.AsBytes()
+	if filebox.MustEncrypt(m) {
+		var err error
+		if content, err = filebox.EncryptContent(m.Zid, content); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := m.WriteComputed(&buf); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketMeta).Put(key, buf.Bytes()); err != nil {
+		return err
+	}
+	return tx.Bucket(bucketContent).Put(key, content)
+}
+
+func deleteZettel(tx *bolt.Tx, zid id.Zid) error {
+	key := zid.Bytes()
+	if err := tx.Bucket(bucketMeta).Delete(key); err != nil {
+		return err
+	}
+	return tx.Bucket(bucketContent).Delete(key)
+}
+
+func countZettel(tx *bolt.Tx) int {
+	if b := tx.Bucket(bucketMeta); b != nil {
+		return b.Stats().KeyN
+	}
+	return 0
+}
+
+// convertBatchSize is the number of zettel that are stored within one
+// transaction, when a box is converted.
+const convertBatchSize = 1000
+
+// Convert stores all zettel of the given box in the database file, which is
+// created if needed. Zettel already stored in the database file are replaced
+// if the box contains a zettel with the same identifier. Zettel identifier
+// are not changed. It returns the number of stored zettel.
+func Convert(ctx context.Context, src box.ManagedBox, path string) (int, error) {
+	var zids id.Slice
+	err := src.ApplyZid(ctx, func(zid id.Zid) { zids = append(zids, zid) }, func(id.Zid) bool { return true })
+	if err != nil {
+		return 0, err
+	}
+	slices.Sort(zids)
+
+	db, err := openDB(path, false)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for len(zids) > 0 {
+		batch := zids[:min(len(zids), convertBatchSize)]
+		zids = zids[len(batch):]
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, zid := range batch {
+				z, err1 := src.GetZettel(ctx, zid)
+				if err1 != nil {
+					return err1
+				}
+				if err1 = putZettel(tx, z); err1 != nil {
+					return err1
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			break
+		}
+		count += len(batch)
+	}
+	if err1 := db.Close(); err == nil {
+		err = err1
+	}
+	return count, err
+}
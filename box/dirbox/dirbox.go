@@ -17,12 +17,14 @@ package dirbox
 import (
 	"context"
 	"errors"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
 	"sync"
 
 	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/filebox"
 	"zettelstore.de/z/box/manager"
 	"zettelstore.de/z/box/notify"
 	"zettelstore.de/z/kernel"
@@ -43,6 +45,10 @@ func init() {
 		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
 			return nil, err
 		}
+		layout, err := getDirLayout(u.Query().Get("layout"))
+		if err != nil {
+			return nil, err
+		}
 		dp := dirBox{
 			log:        log,
 			number:     cdata.Number,
@@ -50,6 +56,7 @@ func init() {
 			readonly:   box.GetQueryBool(u, "readonly"),
 			cdata:      *cdata,
 			dir:        path,
+			layout:     layout,
 			notifySpec: getDirSrvInfo(log, u.Query().Get("type")),
 			fSrvs:      makePrime(uint32(box.GetQueryInt(u, "worker", 1, 7, 1499))),
 		}
@@ -121,6 +128,7 @@ type dirBox struct {
 	readonly   bool
 	cdata      manager.ConnectData
 	dir        string
+	layout     dirLayout
 	notifySpec notifyTypeSpec
 	dirSrv     *notify.DirService
 	fSrvs      uint32
@@ -151,6 +159,12 @@ func (dp *dirBox) State() box.StartState {
 }
 
 func (dp *dirBox) Start(context.Context) error {
+	if !dp.readonly {
+		if err := dp.layout.migrateOnce(dp.log, dp.dir); err != nil {
+			dp.log.Error().Err(err).Msg("Unable to move zettel files to directory layout")
+		}
+	}
+
 	dp.mxCmds.Lock()
 	defer dp.mxCmds.Unlock()
 	dp.fCmds = make([]chan fileCmd, 0, dp.fSrvs)
@@ -164,9 +178,9 @@ func (dp *dirBox) Start(context.Context) error {
 	var err error
 	switch dp.notifySpec {
 	case dirNotifySimple:
-		notifier, err = notify.NewSimpleDirNotifier(dp.log.Clone().Str("notify", "simple").Child(), dp.dir)
+		notifier, err = notify.NewSimpleDirNotifier(dp.log.Clone().Str("notify", "simple").Child(), dp.dir, dp.layout != layoutFlat)
 	default:
-		notifier, err = notify.NewFSDirNotifier(dp.log.Clone().Str("notify", "fs").Child(), dp.dir)
+		notifier, err = notify.NewFSDirNotifier(dp.log.Clone().Str("notify", "fs").Child(), dp.dir, dp.layout != layoutFlat)
 	}
 	if err != nil {
 		dp.log.Error().Err(err).Msg("Unable to create directory supervisor")
@@ -307,14 +321,13 @@ func (dp *dirBox) UpdateZettel(ctx context.Context, zettel zettel.Zettel) error
 	if !zid.IsValid() {
 		return box.ErrInvalidZid{Zid: zid.String()}
 	}
-	entry := dp.dirSrv.GetDirEntry(zid)
-	if !entry.IsValid() {
-		// Existing zettel, but new in this box.
-		entry = &notify.DirEntry{Zid: zid}
-	}
+	entry, prevEntry := dp.getUpdateEntries(meta)
 	dp.updateEntryFromMetaContent(entry, meta, zettel.Content)
 	dp.dirSrv.UpdateDirEntry(entry)
 	err := dp.srvSetZettel(ctx, entry, zettel)
+	if err == nil && prevEntry != nil {
+		err = dp.srvDeleteZettel(ctx, prevEntry, zid)
+	}
 	if err == nil {
 		dp.notifyChanged(zid, box.OnZettel)
 	}
@@ -322,8 +335,88 @@ func (dp *dirBox) UpdateZettel(ctx context.Context, zettel zettel.Zettel) error
 	return err
 }
 
+// getUpdateEntries returns the directory entry to store an updated zettel,
+// and the previous entry, if the files of the zettel must be moved.
+func (dp *dirBox) getUpdateEntries(m *meta.Meta) (entry, prevEntry *notify.DirEntry) {
+	zid := m.Zid
+	entry = dp.dirSrv.GetDirEntry(zid)
+	if !entry.IsValid() {
+		// Existing zettel, but new in this box.
+		return &notify.DirEntry{Zid: zid}, nil
+	}
+	if entryDir(entry) != dp.layout.subDir(m) {
+		// Sub-directory has changed, e.g. because of a new role.
+		return &notify.DirEntry{Zid: zid}, entry
+	}
+	return entry, nil
+}
+
 func (dp *dirBox) updateEntryFromMetaContent(entry *notify.DirEntry, m *meta.Meta, content zettel.Content) {
+	isNew := entry.MetaName == "" && entry.ContentName == ""
 	entry.SetupFromMetaContent(m, content, dp.cdata.Config.GetZettelFileSyntax)
+	if isNew {
+		dp.layout.placeEntry(entry, m)
+	}
+}
+
+func (dp *dirBox) GetZettelStream(ctx context.Context, zid id.Zid) (*meta.Meta, *box.ContentStream, error) {
+	entry := dp.dirSrv.GetDirEntry(zid)
+	if !entry.IsValid() {
+		return nil, nil, box.ErrZettelNotFound{Zid: zid}
+	}
+	if entry.HasMetaInContent() {
+		return nil, nil, box.ErrNotStreamable
+	}
+	m, err := dp.srvGetMeta(ctx, entry, zid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry.ContentName == "" {
+		return m, box.NewContentStream(zettel.NewContent(nil)), nil
+	}
+	cs, err := openContentStream(filepath.Join(dp.dir, entry.ContentName))
+	if err != nil {
+		return nil, nil, err
+	}
+	dp.log.Trace().Zid(zid).Int("size", cs.Size).Msg("GetZettelStream")
+	return m, cs, nil
+}
+
+func (dp *dirBox) UpdateZettelStream(ctx context.Context, m *meta.Meta, r io.Reader) error {
+	if dp.readonly {
+		return box.ErrReadOnly
+	}
+	zid := m.Zid
+	if !zid.IsValid() {
+		return box.ErrInvalidZid{Zid: zid.String()}
+	}
+	if filebox.MustEncrypt(m) {
+		return box.ErrNotStreamable
+	}
+	entry, prevEntry := dp.getUpdateEntries(m)
+	isNew := entry.MetaName == "" && entry.ContentName == ""
+	if !entry.SetupFromMetaStream(m, dp.cdata.Config.GetZettelFileSyntax) {
+		return box.ErrNotStreamable
+	}
+	if isNew {
+		dp.layout.placeEntry(entry, m)
+	}
+
+	// Reading the content may take a while. It is not done by a file service.
+	tempPath, err := writeTempContent(filepath.Join(dp.dir, entry.ContentName), r)
+	if err != nil {
+		return err
+	}
+	dp.dirSrv.UpdateDirEntry(entry)
+	err = dp.srvSetZettelStream(ctx, entry, m, tempPath)
+	if err == nil && prevEntry != nil {
+		err = dp.srvDeleteZettel(ctx, prevEntry, zid)
+	}
+	if err == nil {
+		dp.notifyChanged(zid, box.OnZettel)
+	}
+	dp.log.Trace().Zid(zid).Err(err).Msg("UpdateZettelStream")
+	return err
 }
 
 func (dp *dirBox) CanDeleteZettel(_ context.Context, zid id.Zid) bool {
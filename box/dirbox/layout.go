@@ -0,0 +1,230 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package dirbox
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box/notify"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// dirLayout specifies the sub-directory, where the files of a zettel are stored.
+type dirLayout uint8
+
+// Constants for dirLayout
+const (
+	layoutFlat  dirLayout = iota // All files are stored in the zettel directory
+	layoutYear                   // Sub-directory YYYY, based on the zettel identifier
+	layoutMonth                  // Sub-directory YYYY/MM, based on the zettel identifier
+	layoutRole                   // Sub-directory named after the role of the zettel
+)
+
+var mapLayout = map[string]dirLayout{
+	"":      layoutFlat,
+	"flat":  layoutFlat,
+	"year":  layoutYear,
+	"month": layoutMonth,
+	"role":  layoutRole,
+}
+
+// String returns the name of the layout.
+func (dl dirLayout) String() string {
+	switch dl {
+	case layoutYear:
+		return "year"
+	case layoutMonth:
+		return "month"
+	case layoutRole:
+		return "role"
+	}
+	return "flat"
+}
+
+func getDirLayout(val string) (dirLayout, error) {
+	if layout, found := mapLayout[val]; found {
+		return layout, nil
+	}
+	return layoutFlat, errors.New("unknown directory layout: " + val)
+}
+
+// subDir returns the sub-directory for the files of the given zettel, relative
+// to the zettel directory. An empty string denotes the zettel directory itself.
+func (dl dirLayout) subDir(m *meta.Meta) string {
+	switch dl {
+	case layoutYear:
+		return m.Zid.String()[:4]
+	case layoutMonth:
+		s := m.Zid.String()
+		return filepath.Join(s[:4], s[4:6])
+	case layoutRole:
+		if role, found := m.Get(api.KeyRole); found && isValidDirName(role) {
+			return role
+		}
+	}
+	return ""
+}
+
+func isValidDirName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\:`)
+}
+
+// placeEntry moves the files of a new entry into its sub-directory.
+func (dl dirLayout) placeEntry(entry *notify.DirEntry, m *meta.Meta) {
+	dir := dl.subDir(m)
+	if dir == "" {
+		return
+	}
+	if entry.MetaName != "" {
+		entry.MetaName = filepath.Join(dir, entry.MetaName)
+	}
+	if entry.ContentName != "" {
+		entry.ContentName = filepath.Join(dir, entry.ContentName)
+	}
+}
+
+// entryDir returns the sub-directory of the files of an existing entry.
+func entryDir(entry *notify.DirEntry) string {
+	name := entry.MetaName
+	if name == "" {
+		name = entry.ContentName
+	}
+	if dir := filepath.Dir(name); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// layoutMarker is the name of a file in the zettel directory, which stores the
+// name of the layout, the zettel files were migrated to.
+const layoutMarker = ".zettelstore-layout"
+
+// migrateOnce moves all zettel files into the sub-directories specified by the
+// layout, but only if they were not migrated to this layout before. After a
+// migration, the layout is recorded in the marker file. The flat layout
+// removes the marker, so that switching to another layout again will migrate
+// the zettel files.
+func (dl dirLayout) migrateOnce(log *logger.Logger, dirPath string) error {
+	markerPath := filepath.Join(dirPath, layoutMarker)
+	if dl == layoutFlat {
+		if err := os.Remove(markerPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	name := dl.String()
+	if data, err := os.ReadFile(markerPath); err == nil && strings.TrimSpace(string(data)) == name {
+		return nil
+	}
+	if err := dl.migrate(log, dirPath); err != nil {
+		return err
+	}
+	return os.WriteFile(markerPath, []byte(name+"\n"), fileMode)
+}
+
+// migrate moves all zettel files of the directory into the sub-directory
+// specified by the layout. Zettel identifier are not changed.
+func (dl dirLayout) migrate(log *logger.Logger, dirPath string) error {
+	files := map[id.Zid][]string{}
+	err := filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dirPath && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if zid := zidFromFileName(entry.Name()); zid.IsValid() {
+			name, errRel := filepath.Rel(dirPath, path)
+			if errRel != nil {
+				return errRel
+			}
+			files[zid] = append(files[zid], name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	moved := 0
+	for zid, names := range files {
+		dir := dl.subDir(readLayoutMeta(zid, dirPath, names))
+		for _, name := range names {
+			newName := filepath.Join(dir, filepath.Base(name))
+			if newName == name {
+				continue
+			}
+			newPath := filepath.Join(dirPath, newName)
+			if _, errStat := os.Lstat(newPath); errStat == nil {
+				log.Error().Str("name", name).Str("new", newName).Msg("Unable to move zettel file, target already exists")
+				continue
+			}
+			if err = os.MkdirAll(filepath.Dir(newPath), dirMode); err == nil {
+				err = os.Rename(filepath.Join(dirPath, name), newPath)
+			}
+			if err != nil {
+				return err
+			}
+			moved++
+		}
+	}
+	if moved > 0 {
+		log.Info().Int("files", int64(moved)).Msg("Zettel files moved to directory layout")
+	}
+	return nil
+}
+
+// readLayoutMeta returns the metadata of a zettel that is needed to determine
+// its sub-directory.
+func readLayoutMeta(zid id.Zid, dirPath string, names []string) *meta.Meta {
+	for _, name := range names {
+		path := filepath.Join(dirPath, name)
+		switch filepath.Ext(name) {
+		case "":
+			if m, err := parseMetaFile(zid, path); err == nil {
+				return m
+			}
+		case ".zettel":
+			if m, _, err := parseMetaContentFile(zid, path); err == nil {
+				return m
+			}
+		}
+	}
+	return meta.New(zid)
+}
+
+// zidFromFileName returns the zettel identifier at the start of a file name.
+func zidFromFileName(name string) id.Zid {
+	if len(name) < 14 {
+		return id.Invalid
+	}
+	zid, err := id.Parse(name[:14])
+	if err != nil {
+		return id.Invalid
+	}
+	return zid
+}
@@ -0,0 +1,128 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package dirbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func TestSubDir(t *testing.T) {
+	m := meta.New(id.Zid(20240112123456))
+	mRole := m.Clone()
+	mRole.Set(api.KeyRole, "literature")
+	mBadRole := m.Clone()
+	mBadRole.Set(api.KeyRole, "../etc")
+	testcases := []struct {
+		layout dirLayout
+		m      *meta.Meta
+		exp    string
+	}{
+		{layoutFlat, mRole, ""},
+		{layoutYear, m, "2024"},
+		{layoutMonth, m, filepath.Join("2024", "01")},
+		{layoutRole, m, ""},
+		{layoutRole, mRole, "literature"},
+		{layoutRole, mBadRole, ""},
+	}
+	for i, tc := range testcases {
+		if got := tc.layout.subDir(tc.m); got != tc.exp {
+			t.Errorf("%d: subDir(%v) should be %q, but got %q", i, tc.m, tc.exp, got)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dirPath := t.TempDir()
+	files := map[string]string{
+		"20240112123456.zettel":                        "title: One\nrole: zettel\n\nContent",
+		"20231231000000":                               "title: Two\nrole: literature\n",
+		"20231231000000.png":                           "\x89PNG",
+		filepath.Join("2022", "x"):                     "unrelated",
+		filepath.Join(".git", "20220101000000.zettel"): "hidden",
+	}
+	for name, content := range files {
+		path := filepath.Join(dirPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), fileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := layoutRole.migrate(nil, dirPath); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		filepath.Join(".git", "20220101000000.zettel"),
+		filepath.Join("2022", "x"),
+		filepath.Join("literature", "20231231000000"),
+		filepath.Join("literature", "20231231000000.png"),
+		filepath.Join("zettel", "20240112123456.zettel"),
+	}
+	for _, name := range exp {
+		if _, err := os.Stat(filepath.Join(dirPath, name)); err != nil {
+			t.Errorf("file %q expected, but got error %v", name, err)
+		}
+	}
+}
+
+func TestMigrateOnce(t *testing.T) {
+	dirPath := t.TempDir()
+	writeFile := func(name string) {
+		if err := os.WriteFile(filepath.Join(dirPath, name), []byte("title: T\n\nContent"), fileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkFile := func(name string) {
+		t.Helper()
+		if _, err := os.Stat(filepath.Join(dirPath, name)); err != nil {
+			t.Errorf("file %q expected, but got error %v", name, err)
+		}
+	}
+
+	writeFile("20240112123456.zettel")
+	if err := layoutYear.migrateOnce(nil, dirPath); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(filepath.Join("2024", "20240112123456.zettel"))
+	checkFile(layoutMarker)
+
+	// Files are not moved again, if the layout was not changed.
+	writeFile("20231231000000.zettel")
+	if err := layoutYear.migrateOnce(nil, dirPath); err != nil {
+		t.Fatal(err)
+	}
+	checkFile("20231231000000.zettel")
+
+	// Another layout results in a new migration.
+	if err := layoutMonth.migrateOnce(nil, dirPath); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(filepath.Join("2023", "12", "20231231000000.zettel"))
+	checkFile(filepath.Join("2024", "01", "20240112123456.zettel"))
+
+	// The flat layout removes the marker.
+	if err := layoutFlat.migrateOnce(nil, dirPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dirPath, layoutMarker)); err == nil {
+		t.Error("marker must be removed for flat layout")
+	}
+}
@@ -15,13 +15,16 @@ package dirbox
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"time"
 
 	"t73f.de/r/zsc/input"
+	"zettelstore.de/z/box"
 	"zettelstore.de/z/box/filebox"
 	"zettelstore.de/z/box/notify"
 	"zettelstore.de/z/kernel"
@@ -162,6 +165,7 @@ func (cmd *fileGetMetaContent) run(dirPath string) {
 	}
 	if err == nil {
 		cmdCleanupMeta(m, entry)
+		content, err = filebox.DecryptContent(zid, content)
 	}
 	cmd.rc <- resGetMetaContent{m, content, err}
 }
@@ -197,6 +201,13 @@ func (cmd *fileSetZettel) run(dirPath string) {
 	contentName := entry.ContentName
 	m := cmd.zettel.Meta
 	content := cmd.zettel.Content.AsBytes()
+	if filebox.MustEncrypt(m) {
+		content, err = filebox.EncryptContent(zid, content)
+		if err != nil {
+			cmd.rc <- err
+			return
+		}
+	}
 	metaName := entry.MetaName
 	if metaName == "" {
 		if contentName == "" {
@@ -221,6 +232,44 @@ func (cmd *fileSetZettel) run(dirPath string) {
 	cmd.rc <- err
 }
 
+// COMMAND: srvSetZettelStream ----------------------------------------
+//
+// Writes the metadata of a zettel, and moves the already written content
+// from a temporary file into place.
+
+func (dp *dirBox) srvSetZettelStream(ctx context.Context, entry *notify.DirEntry, m *meta.Meta, tempPath string) error {
+	rc := make(chan resSetZettelStream, 1)
+	dp.getFileChan(m.Zid) <- &fileSetZettelStream{entry, m, tempPath, rc}
+	ctx, cancel := context.WithTimeout(ctx, serviceTimeout)
+	defer cancel()
+	select {
+	case err := <-rc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type fileSetZettelStream struct {
+	entry    *notify.DirEntry
+	meta     *meta.Meta
+	tempPath string
+	rc       chan<- resSetZettelStream
+}
+type resSetZettelStream = error
+
+func (cmd *fileSetZettelStream) run(dirPath string) {
+	entry := cmd.entry
+	err := writeMetaFile(filepath.Join(dirPath, entry.MetaName), cmd.meta)
+	if err == nil {
+		err = os.Rename(cmd.tempPath, filepath.Join(dirPath, entry.ContentName))
+	}
+	if err != nil {
+		os.Remove(cmd.tempPath)
+	}
+	cmd.rc <- err
+}
+
 func writeMetaFile(metaPath string, m *meta.Meta) error {
 	metaFile, err := openFileWrite(metaPath)
 	if err != nil {
@@ -369,8 +418,18 @@ func cmdCleanupMeta(m *meta.Meta, entry *notify.DirEntry) {
 // umask(1) accordingly.
 const fileMode os.FileMode = 0666 //
 
+// dirMode to create a new sub-directory, see fileMode.
+const dirMode os.FileMode = 0777
+
 func openFileWrite(path string) (*os.File, error) {
-	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Sub-directory of a directory layout might be missing.
+		if err = os.MkdirAll(filepath.Dir(path), dirMode); err == nil {
+			f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
+		}
+	}
+	return f, err
 }
 
 func writeFileZid(w io.Writer, zid id.Zid) error {
@@ -394,3 +453,60 @@ func writeFileContent(path string, content []byte) error {
 	}
 	return err
 }
+
+// writeTempContent writes the content into a temporary file, placed in the
+// directory of the given content file. The name of the temporary file does
+// not start with a zettel identifier, therefore it is ignored by the
+// directory service.
+func writeTempContent(contentPath string, r io.Reader) (string, error) {
+	dir, name := filepath.Split(contentPath)
+	tempPath := filepath.Join(dir, fmt.Sprintf(".%s.%d.tmp", name, time.Now().UnixNano()))
+	f, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileMode)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Sub-directory of a directory layout might be missing.
+		if err = os.MkdirAll(dir, dirMode); err == nil {
+			f, err = os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileMode)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, r)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", err
+	}
+	return tempPath, nil
+}
+
+// openContentStream opens a content file to read it as a stream. Encrypted
+// content cannot be streamed, because it must be decrypted as a whole.
+func openContentStream(path string) (*box.ContentStream, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var buf [64]byte
+	n, err := io.ReadFull(f, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		f.Close()
+		return nil, err
+	}
+	if filebox.IsEncrypted(buf[:n]) {
+		f.Close()
+		return nil, box.ErrNotStreamable
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &box.ContentStream{ReadSeekCloser: f, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
@@ -0,0 +1,94 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package dirbox
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/notify"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func TestSetZettelStream(t *testing.T) {
+	dirPath := t.TempDir()
+	m := meta.New(id.Zid(20241018120000))
+	m.Set(api.KeyTitle, "Paper")
+	m.Set(api.KeySyntax, "pdf")
+	entry := &notify.DirEntry{Zid: m.Zid}
+	if !entry.SetupFromMetaStream(m, func() []string { return nil }) {
+		t.Fatal("content of syntax pdf should be streamable")
+	}
+	entry.MetaName = filepath.Join("literature", entry.MetaName)
+	entry.ContentName = filepath.Join("literature", entry.ContentName)
+
+	const data = "%PDF-1.4 some binary data"
+	tempPath, err := writeTempContent(filepath.Join(dirPath, entry.ContentName), strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := filepath.Base(tempPath); !strings.HasPrefix(name, ".") {
+		t.Errorf("temporary file %q must be ignored by directory service", name)
+	}
+	rc := make(chan resSetZettelStream, 1)
+	cmd := fileSetZettelStream{entry, m, tempPath, rc}
+	cmd.run(dirPath)
+	if err = <-rc; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(tempPath); !os.IsNotExist(err) {
+		t.Errorf("temporary file %q should be moved, but got %v", tempPath, err)
+	}
+	if _, err = os.Stat(filepath.Join(dirPath, "literature", "20241018120000")); err != nil {
+		t.Error(err)
+	}
+
+	cs, err := openContentStream(filepath.Join(dirPath, entry.ContentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	if cs.Size != int64(len(data)) {
+		t.Errorf("expected size %d, but got %d", len(data), cs.Size)
+	}
+	if _, err = cs.Seek(9, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(cs); string(got) != data[9:] {
+		t.Errorf("expected %q, but got %q", data[9:], got)
+	}
+}
+
+func TestNotStreamable(t *testing.T) {
+	m := meta.New(id.Zid(20241018120000))
+	m.Set(api.KeySyntax, meta.SyntaxZmk)
+	entry := &notify.DirEntry{Zid: m.Zid}
+	if entry.SetupFromMetaStream(m, func() []string { return nil }) {
+		t.Errorf("zettelmarkup is stored together with metadata, but got %v", entry)
+	}
+
+	path := filepath.Join(t.TempDir(), "20241018120000.bin")
+	if err := os.WriteFile(path, []byte("%zs-encrypted-v1 AAAA"), fileMode); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openContentStream(path); err != box.ErrNotStreamable {
+		t.Errorf("encrypted content must not be streamed, but got %v", err)
+	}
+}
@@ -0,0 +1,442 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+// Package feedbox provides a read-only box that presents the entries of RSS
+// and Atom feeds as zettel.
+package feedbox
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/manager"
+	"zettelstore.de/z/kernel"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func init() {
+	manager.Register("feed", func(u *url.URL, cdata *manager.ConnectData) (box.ManagedBox, error) {
+		sources := u.Query()["url"]
+		if len(sources) == 0 {
+			return nil, errors.New("feed box needs at least one feed: " + u.String())
+		}
+		return &feedBox{
+			log: kernel.Main.GetLogger(kernel.BoxService).Clone().
+				Str("box", "feed").Int("boxnum", int64(cdata.Number)).Child(),
+			number:   cdata.Number,
+			location: u.String(),
+			sources:  sources,
+			refresh:  time.Duration(box.GetQueryInt(u, "refresh", 60, 3600, 86400)) * time.Second,
+			maxSize:  int64(box.GetQueryInt(u, "maxsize", 16, 4096, 65536)) * 1024,
+			cdata:    *cdata,
+			client:   &http.Client{Timeout: time.Minute},
+		}, nil
+	})
+}
+
+// Metadata of a feed item zettel.
+const (
+	roleFeed   = "feed"
+	keyFeedURL = "feed-url" // URL of the feed that contains the item
+)
+
+// entry is a zettel that stores a feed item.
+type entry struct {
+	meta    *meta.Meta
+	content []byte
+	key     string // Source and identifier of the item
+}
+
+// feedBox fetches all feeds periodically and stores their items in memory.
+// Items that are no longer contained in a feed are removed.
+type feedBox struct {
+	log      *logger.Logger
+	number   int
+	location string
+	sources  []string      // URLs or file names of the feeds
+	refresh  time.Duration // Time between two fetches of all feeds
+	maxSize  int64         // Maximum size of a feed in bytes
+	cdata    manager.ConnectData
+	client   *http.Client
+
+	mx      sync.RWMutex // Protects the following fields
+	entries map[id.Zid]entry
+	items   map[string][]item // Last successfully fetched items of each source
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func (fb *feedBox) notifyChanged(zid id.Zid, reason box.UpdateReason) {
+	if chci := fb.cdata.Notify; chci != nil {
+		fb.log.Trace().Zid(zid).Uint("reason", uint64(reason)).Msg("notifyChanged")
+		chci <- box.UpdateInfo{Box: fb, Reason: reason, Zid: zid}
+	}
+}
+
+func (fb *feedBox) Location() string { return fb.location }
+
+func (fb *feedBox) State() box.StartState {
+	fb.mx.RLock()
+	defer fb.mx.RUnlock()
+	if fb.done == nil {
+		return box.StartStateStopped
+	}
+	return box.StartStateStarted
+}
+
+func (fb *feedBox) Start(context.Context) error {
+	fb.mx.Lock()
+	if fb.done != nil {
+		fb.mx.Unlock()
+		return box.ErrStarted
+	}
+	fb.entries = map[id.Zid]entry{}
+	fb.items = map[string][]item{}
+	fb.done = make(chan struct{})
+	fb.stopped = make(chan struct{})
+	done, stopped := fb.done, fb.stopped
+	fb.mx.Unlock()
+
+	go fb.poll(done, stopped)
+	fb.log.Trace().Int("sources", int64(len(fb.sources))).Int("refresh", int64(fb.refresh/time.Second)).Msg("Start Box")
+	return nil
+}
+
+// poll fetches all feeds, first immediately, then periodically. Fetching is
+// done in the background, so that a slow feed does not delay the start of the
+// Zettelstore. Since the feed zettel may be indexed before they are fetched,
+// observers are notified about the first fetch too.
+func (fb *feedBox) poll(done <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	fb.fetchAll(ctx, true)
+	ticker := time.NewTicker(fb.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			fb.fetchAll(ctx, true)
+		}
+	}
+}
+
+func (fb *feedBox) Refresh(ctx context.Context) {
+	fb.fetchAll(ctx, true)
+	fb.log.Trace().Msg("Refresh")
+}
+
+func (fb *feedBox) Stop(context.Context) {
+	fb.mx.Lock()
+	done, stopped := fb.done, fb.stopped
+	fb.done = nil
+	fb.mx.Unlock()
+	if done != nil {
+		close(done)
+		<-stopped
+	}
+	fb.mx.Lock()
+	fb.entries = nil
+	fb.items = nil
+	fb.mx.Unlock()
+}
+
+// fetchAll retrieves all feeds and replaces the stored items. If a feed
+// cannot be retrieved, its previous items are retained. If requested,
+// observers are notified about all zettel that were changed, added, or
+// removed since the last fetch.
+func (fb *feedBox) fetchAll(ctx context.Context, notify bool) {
+	fetched := make(map[string][]item, len(fb.sources))
+	for _, src := range fb.sources {
+		items, err := fb.fetch(ctx, src)
+		if err != nil {
+			fb.log.Error().Err(err).Str("feed", src).Msg("Unable to fetch feed")
+			continue
+		}
+		fetched[src] = items
+	}
+
+	fb.mx.Lock()
+	if fb.done == nil {
+		fb.mx.Unlock()
+		return
+	}
+	for src, items := range fetched {
+		fb.items[src] = items
+	}
+	entries := buildEntries(fb.sources, fb.items, fb.entries, time.Now())
+	var changed, deleted []id.Zid
+	for zid, e := range entries {
+		if prev, found := fb.entries[zid]; !found || !prev.meta.Equal(e.meta, false) || string(prev.content) != string(e.content) {
+			changed = append(changed, zid)
+		}
+	}
+	for zid := range fb.entries {
+		if _, found := entries[zid]; !found {
+			deleted = append(deleted, zid)
+		}
+	}
+	fb.entries = entries
+	fb.mx.Unlock()
+
+	fb.log.Trace().Int("entries", int64(len(entries))).Int("changed", int64(len(changed))).Int("deleted", int64(len(deleted))).Msg("fetchAll")
+	if notify {
+		for _, zid := range changed {
+			fb.notifyChanged(zid, box.OnZettel)
+		}
+		for _, zid := range deleted {
+			fb.notifyChanged(zid, box.OnDelete)
+		}
+	}
+}
+
+// fetch retrieves and parses the feed of the given source, which is either an
+// URL or the name of a local file.
+func (fb *feedBox) fetch(ctx context.Context, src string) ([]item, error) {
+	var data []byte
+	u, err := url.Parse(src)
+	switch {
+	case err == nil && (u.Scheme == "http" || u.Scheme == "https"):
+		data, err = fb.get(ctx, src)
+	case err == nil && u.Scheme == "file":
+		data, err = fb.readFile(u.Path)
+	default:
+		data, err = fb.readFile(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(data)
+}
+
+func (fb *feedBox) get(ctx context.Context, src string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fb.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed: GET %s: %s", src, resp.Status)
+	}
+	return fb.read(src, resp.Body)
+}
+
+func (fb *feedBox) readFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return fb.read(name, f)
+}
+
+// read returns the data of a feed. A feed that is larger than the maximum size
+// is rejected, because its data must be held in memory.
+func (fb *feedBox) read(src string, r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, fb.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > fb.maxSize {
+		return nil, fmt.Errorf("feed: %s is larger than %d bytes", src, fb.maxSize)
+	}
+	return data, nil
+}
+
+// buildEntries creates a zettel for every item. An item keeps the identifier
+// of its zettel as long as it is contained in its feed. The identifier of a
+// new item is derived from its publication date, or from the current time, if
+// the date is not known.
+func buildEntries(sources []string, items map[string][]item, prev map[id.Zid]entry, now time.Time) map[id.Zid]entry {
+	prevZid := make(map[string]id.Zid, len(prev))
+	for zid, e := range prev {
+		prevZid[e.key] = zid
+	}
+
+	type keyedItem struct {
+		key    string
+		source string
+		it     item
+	}
+	used := id.NewSetCap(len(prev))
+	var known, unknown []keyedItem
+	for _, src := range sources {
+		for _, it := range items[src] {
+			ki := keyedItem{key: src + "\n" + it.guid, source: src, it: it}
+			if zid, found := prevZid[ki.key]; found && !used.Contains(zid) {
+				used.Add(zid)
+				known = append(known, ki)
+			} else {
+				unknown = append(unknown, ki)
+			}
+		}
+	}
+	slices.SortFunc(unknown, func(a, b keyedItem) int {
+		return cmp.Or(a.it.published.Compare(b.it.published), cmp.Compare(a.key, b.key))
+	})
+
+	entries := make(map[id.Zid]entry, len(known)+len(unknown))
+	seen := make(map[string]bool, len(known)+len(unknown))
+	for _, ki := range known {
+		seen[ki.key] = true
+		zid := prevZid[ki.key]
+		entries[zid] = entry{meta: itemMeta(zid, ki.source, ki.it), content: ki.it.content, key: ki.key}
+	}
+	for _, ki := range unknown {
+		if seen[ki.key] {
+			// A feed contains an item more than once.
+			continue
+		}
+		seen[ki.key] = true
+		t := ki.it.published
+		if t.IsZero() {
+			t = now
+		}
+		zid := freeZid(t, used)
+		if !zid.IsValid() {
+			continue
+		}
+		used.Add(zid)
+		entries[zid] = entry{meta: itemMeta(zid, ki.source, ki.it), content: ki.it.content, key: ki.key}
+	}
+	return entries
+}
+
+// freeZid returns the first unused zettel identifier at or after the given time.
+func freeZid(t time.Time, used *id.Set) id.Zid {
+	t = t.Local().Truncate(time.Second)
+	for {
+		zid, err := id.Parse(t.Format(id.TimestampLayout))
+		if err != nil {
+			return id.Invalid
+		}
+		if !used.Contains(zid) {
+			return zid
+		}
+		t = t.Add(time.Second)
+	}
+}
+
+func itemMeta(zid id.Zid, source string, it item) *meta.Meta {
+	m := meta.New(zid)
+	m.SetNonEmpty(api.KeyTitle, it.title)
+	m.Set(api.KeyRole, roleFeed)
+	m.Set(api.KeySyntax, it.syntax)
+	m.SetNonEmpty(api.KeyURL, it.link)
+	m.SetNonEmpty(api.KeyAuthor, it.author)
+	if !it.published.IsZero() {
+		published := it.published.Local().Format(id.TimestampLayout)
+		m.Set(api.KeyPublished, published)
+		m.Set(api.KeyCreated, published)
+	}
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		m.Set(keyFeedURL, source)
+	}
+	return m
+}
+
+func (fb *feedBox) getEntry(zid id.Zid) (entry, bool) {
+	fb.mx.RLock()
+	e, found := fb.entries[zid]
+	fb.mx.RUnlock()
+	return e, found
+}
+
+func (fb *feedBox) GetZettel(_ context.Context, zid id.Zid) (zettel.Zettel, error) {
+	e, found := fb.getEntry(zid)
+	if !found {
+		return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+	}
+	fb.log.Trace().Zid(zid).Msg("GetZettel")
+	return zettel.Zettel{Meta: e.meta.Clone(), Content: zettel.NewContent(e.content)}, nil
+}
+
+func (fb *feedBox) HasZettel(_ context.Context, zid id.Zid) bool {
+	_, found := fb.getEntry(zid)
+	return found
+}
+
+func (fb *feedBox) ApplyZid(_ context.Context, handle box.ZidFunc, constraint query.RetrievePredicate) error {
+	fb.mx.RLock()
+	defer fb.mx.RUnlock()
+	fb.log.Trace().Int("entries", int64(len(fb.entries))).Msg("ApplyZid")
+	for zid := range fb.entries {
+		if constraint(zid) {
+			handle(zid)
+		}
+	}
+	return nil
+}
+
+func (fb *feedBox) ApplyMeta(ctx context.Context, handle box.MetaFunc, constraint query.RetrievePredicate) error {
+	fb.mx.RLock()
+	defer fb.mx.RUnlock()
+	fb.log.Trace().Int("entries", int64(len(fb.entries))).Msg("ApplyMeta")
+	for zid, e := range fb.entries {
+		if constraint(zid) {
+			m := e.meta.Clone()
+			fb.cdata.Enricher.Enrich(ctx, m, fb.number)
+			handle(m)
+		}
+	}
+	return nil
+}
+
+func (*feedBox) CanDeleteZettel(context.Context, id.Zid) bool { return false }
+
+func (fb *feedBox) DeleteZettel(_ context.Context, zid id.Zid) (err error) {
+	if fb.HasZettel(context.Background(), zid) {
+		err = box.ErrReadOnly
+	} else {
+		err = box.ErrZettelNotFound{Zid: zid}
+	}
+	fb.log.Trace().Zid(zid).Err(err).Msg("DeleteZettel")
+	return err
+}
+
+func (fb *feedBox) ReadStats(st *box.ManagedBoxStats) {
+	st.ReadOnly = true
+	fb.mx.RLock()
+	st.Zettel = len(fb.entries)
+	fb.mx.RUnlock()
+	fb.log.Trace().Int("zettel", int64(st.Zettel)).Msg("ReadStats")
+}
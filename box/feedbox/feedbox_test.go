@@ -0,0 +1,178 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package feedbox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+const testRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+  <title>Test</title>
+  <item>
+    <title>First item</title>
+    <link>https://example.com/1</link>
+    <guid>https://example.com/1</guid>
+    <pubDate>Fri, 18 Oct 2024 12:00:00 +0000</pubDate>
+    <dc:creator>Alice</dc:creator>
+    <description>&lt;p&gt;Hello&lt;/p&gt;</description>
+  </item>
+  <item>
+    <title>Second item</title>
+    <link>https://example.com/2</link>
+    <pubDate>Fri, 18 Oct 2024 12:00:00 +0000</pubDate>
+  </item>
+</channel>
+</rss>`
+
+const testAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Test</title>
+  <author><name>Bob</name></author>
+  <entry>
+    <id>urn:test:1</id>
+    <title>Atom entry</title>
+    <link rel="alternate" href="https://example.org/1"/>
+    <updated>2024-10-18T13:00:00Z</updated>
+    <content type="text">Plain text</content>
+  </entry>
+</feed>`
+
+func TestParseFeed(t *testing.T) {
+	items, err := parseFeed([]byte(testRSS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected two RSS items, but got %v", items)
+	}
+	if it := items[0]; it.title != "First item" || it.author != "Alice" || string(it.content) != "<p>Hello</p>" || it.syntax != meta.SyntaxHTML {
+		t.Errorf("unexpected RSS item %v", it)
+	}
+	if it := items[1]; it.guid != "https://example.com/2" || it.published.IsZero() {
+		t.Errorf("unexpected RSS item %v", it)
+	}
+
+	items, err = parseFeed([]byte(testAtom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected one Atom entry, but got %v", items)
+	}
+	if it := items[0]; it.link != "https://example.org/1" || it.author != "Bob" || string(it.content) != "Plain text" || it.syntax != meta.SyntaxPlain {
+		t.Errorf("unexpected Atom entry %v", it)
+	}
+
+	if _, err = parseFeed([]byte("<html></html>")); err != errUnknownFormat {
+		t.Errorf("expected unknown format, but got %v", err)
+	}
+}
+
+func TestFeedBox(t *testing.T) {
+	var mx sync.Mutex
+	feeds := map[string]string{"/rss": testRSS, "/atom": testAtom}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		data, found := feeds[r.URL.Path]
+		mx.Unlock()
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(data))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	fb := &feedBox{
+		sources: []string{srv.URL + "/rss", srv.URL + "/atom"},
+		refresh: time.Hour,
+		maxSize: 4096,
+		client:  srv.Client(),
+	}
+	if err := fb.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer fb.Stop(ctx)
+
+	// The feeds are fetched in the background.
+	for i := 0; ; i++ {
+		var st box.ManagedBoxStats
+		if fb.ReadStats(&st); st.Zettel > 0 {
+			break
+		}
+		if i > 100 {
+			t.Fatal("feeds were not fetched after start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	zids := map[string]id.Zid{}
+	fb.ApplyZid(ctx, func(zid id.Zid) {
+		z, err := fb.GetZettel(ctx, zid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zids[z.Meta.GetDefault(api.KeyTitle, "")] = zid
+		if got := z.Meta.GetDefault(api.KeyRole, ""); got != roleFeed {
+			t.Errorf("expected role %q, but got %q", roleFeed, got)
+		}
+	}, func(id.Zid) bool { return true })
+	if len(zids) != 3 {
+		t.Fatalf("expected three zettel, but got %v", zids)
+	}
+	first, err := fb.GetZettel(ctx, zids["First item"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := first.Meta.GetDefault(api.KeyURL, ""); got != "https://example.com/1" {
+		t.Errorf("unexpected url %q", got)
+	}
+	if got := first.Meta.GetDefault(api.KeyPublished, ""); got != first.Meta.Zid.String() {
+		t.Errorf("zid %v should be derived from publication date %q", first.Meta.Zid, got)
+	}
+
+	// The second item is removed, an unavailable feed retains its items.
+	mx.Lock()
+	feeds["/rss"] = `<rss><channel><item><guid>https://example.com/1</guid><title>Changed</title></item></channel></rss>`
+	delete(feeds, "/atom")
+	mx.Unlock()
+	fb.Refresh(ctx)
+	if z, err2 := fb.GetZettel(ctx, zids["First item"]); err2 != nil || z.Meta.GetDefault(api.KeyTitle, "") != "Changed" {
+		t.Errorf("changed item should keep its zid, but got %v / %v", z.Meta, err2)
+	}
+	if fb.HasZettel(ctx, zids["Second item"]) {
+		t.Error("removed item should be deleted")
+	}
+	if !fb.HasZettel(ctx, zids["Atom entry"]) {
+		t.Error("items of unavailable feed should be retained")
+	}
+
+	fb.maxSize = 64
+	if _, err = fb.fetch(ctx, srv.URL+"/rss"); err == nil {
+		t.Error("feed larger than maximum size must be rejected")
+	}
+}
@@ -0,0 +1,240 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package feedbox
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// item is an entry of a RSS or Atom feed.
+type item struct {
+	guid      string
+	title     string
+	link      string
+	author    string
+	published time.Time // Zero, if not known
+	content   []byte
+	syntax    string
+}
+
+// errUnknownFormat is returned, if the data is neither a RSS nor an Atom feed.
+var errUnknownFormat = errors.New("neither RSS nor Atom feed")
+
+// parseFeed returns all items of a RSS (0.9x, 1.0, 2.0) or an Atom feed.
+func parseFeed(data []byte) ([]item, error) {
+	dec := newDecoder(data)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errUnknownFormat
+			}
+			return nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			switch se.Name.Local {
+			case "rss", "RDF":
+				var feed rssFeed
+				if err = dec.DecodeElement(&feed, &se); err != nil {
+					return nil, err
+				}
+				return feed.items(), nil
+			case "feed":
+				var feed atomFeed
+				if err = dec.DecodeElement(&feed, &se); err != nil {
+					return nil, err
+				}
+				return feed.items(), nil
+			}
+			return nil, errUnknownFormat
+		}
+	}
+}
+
+func newDecoder(data []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.CharsetReader = func(charset string, r io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, err
+		}
+		return enc.NewDecoder().Reader(r), nil
+	}
+	return dec
+}
+
+type rssFeed struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items []rssItem `xml:"item"` // RSS 1.0 places the items outside the channel
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Author      string `xml:"author"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+func (feed *rssFeed) items() []item {
+	rssItems := append(feed.Channel.Items, feed.Items...)
+	result := make([]item, 0, len(rssItems))
+	for _, ri := range rssItems {
+		it := item{
+			guid:      firstNonEmpty(ri.GUID, ri.Link, ri.Title),
+			title:     cleanText(ri.Title),
+			link:      strings.TrimSpace(ri.Link),
+			author:    cleanText(firstNonEmpty(ri.Creator, ri.Author)),
+			published: parseDate(firstNonEmpty(ri.PubDate, ri.Date)),
+			syntax:    meta.SyntaxHTML,
+		}
+		// Both description and content are HTML, where the content is
+		// typically the complete text.
+		if text := firstNonEmpty(ri.Content, ri.Description); text != "" {
+			it.content = []byte(text)
+		}
+		if it.guid != "" {
+			result = append(result, it)
+		}
+	}
+	return result
+}
+
+type atomFeed struct {
+	Authors []atomPerson `xml:"author"`
+	Entries []atomEntry  `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     atomText     `xml:"title"`
+	Links     []atomLink   `xml:"link"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Authors   []atomPerson `xml:"author"`
+	Summary   atomText     `xml:"summary"`
+	Content   atomText     `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+// value returns the text and its syntax.
+func (at *atomText) value() (string, string) {
+	switch at.Type {
+	case "html":
+		return strings.TrimSpace(at.Text), meta.SyntaxHTML
+	case "xhtml":
+		return strings.TrimSpace(at.InnerXML), meta.SyntaxHTML
+	}
+	return strings.TrimSpace(at.Text), meta.SyntaxPlain
+}
+
+func (feed *atomFeed) items() []item {
+	result := make([]item, 0, len(feed.Entries))
+	for _, ae := range feed.Entries {
+		title, _ := ae.Title.value()
+		it := item{
+			guid:      strings.TrimSpace(ae.ID),
+			title:     cleanText(title),
+			published: parseDate(firstNonEmpty(ae.Published, ae.Updated)),
+		}
+		for _, link := range ae.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				it.link = strings.TrimSpace(link.Href)
+				break
+			}
+		}
+		authors := ae.Authors
+		if len(authors) == 0 {
+			authors = feed.Authors
+		}
+		names := make([]string, 0, len(authors))
+		for _, a := range authors {
+			if name := cleanText(a.Name); name != "" {
+				names = append(names, name)
+			}
+		}
+		it.author = strings.Join(names, ", ")
+		text, syntax := ae.Content.value()
+		if text == "" {
+			text, syntax = ae.Summary.value()
+		}
+		if text != "" {
+			it.content = []byte(text)
+		}
+		it.syntax = syntax
+		if it.guid == "" {
+			it.guid = firstNonEmpty(it.link, it.title)
+		}
+		if it.guid != "" {
+			result = append(result, it)
+		}
+	}
+	return result
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, val := range vals {
+		if val = strings.TrimSpace(val); val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// cleanText removes line breaks and repeated spaces, e.g. for titles.
+func cleanText(s string) string { return strings.Join(strings.Fields(s), " ") }
+
+// parseDate parses the date formats of RSS (RFC 822) and Atom (RFC 3339).
+func parseDate(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	if t, err := mail.ParseDate(s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,126 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package filebox
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"sync"
+
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// cryptPrefix starts the stored content of an encrypted zettel.
+var cryptPrefix = []byte("%zs-encrypted-v1 ")
+
+var (
+	cryptMx  sync.RWMutex
+	cryptKey []byte
+)
+
+// ErrNoCryptKey is returned, if a zettel must be encrypted or decrypted, but
+// no secret was configured.
+var ErrNoCryptKey = errors.New("no key to encrypt / decrypt zettel content")
+
+// ErrDecrypt is returned, if the encrypted content of a zettel could not be decrypted.
+var ErrDecrypt = errors.New("unable to decrypt zettel content")
+
+// SetupEncryption derives the key to encrypt zettel content from the given
+// secret. An empty secret disables encryption.
+func SetupEncryption(secret string) {
+	cryptMx.Lock()
+	defer cryptMx.Unlock()
+	if secret == "" {
+		cryptKey = nil
+		return
+	}
+	h := sha256.New()
+	io.WriteString(h, "zettelstore content encryption\x00")
+	io.WriteString(h, secret)
+	cryptKey = h.Sum(nil)
+}
+
+// MustEncrypt returns true, if the content of the zettel must be stored encrypted.
+func MustEncrypt(m *meta.Meta) bool { return m.GetBool(meta.KeyEncrypt) }
+
+// IsEncrypted returns true, if the stored content is encrypted.
+func IsEncrypted(content []byte) bool { return bytes.HasPrefix(content, cryptPrefix) }
+
+func getAEAD() (cipher.AEAD, error) {
+	cryptMx.RLock()
+	key := cryptKey
+	cryptMx.RUnlock()
+	if key == nil {
+		return nil, ErrNoCryptKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptContent encrypts the content of the zettel with the given identifier.
+// The result is a text that can be stored safely.
+func EncryptContent(zid id.Zid, content []byte) ([]byte, error) {
+	aead, err := getAEAD()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(content)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, content, zid.Bytes())
+
+	result := make([]byte, 0, len(cryptPrefix)+base64.StdEncoding.EncodedLen(len(sealed))+1)
+	result = append(result, cryptPrefix...)
+	result = base64.StdEncoding.AppendEncode(result, sealed)
+	return append(result, '\n'), nil
+}
+
+// DecryptContent decrypts the stored content of the zettel with the given
+// identifier. If the content is not encrypted, it is returned unchanged.
+//
+// The zettel identifier is part of the encryption, so that the content of
+// one zettel cannot be moved to another zettel unnoticed.
+func DecryptContent(zid id.Zid, content []byte) ([]byte, error) {
+	if !IsEncrypted(content) {
+		return content, nil
+	}
+	aead, err := getAEAD()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.AppendDecode(nil, bytes.TrimSpace(content[len(cryptPrefix):]))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	nonceSize := aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, ErrDecrypt
+	}
+	result, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], zid.Bytes())
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return result, nil
+}
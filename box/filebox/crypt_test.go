@@ -0,0 +1,61 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package filebox
+
+import (
+	"bytes"
+	"testing"
+
+	"zettelstore.de/z/zettel/id"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	SetupEncryption("0123456789abcdef")
+	defer SetupEncryption("")
+
+	const zid = id.Zid(20241018120000)
+	plain := []byte("This is a secret.\n")
+	enc, err := EncryptContent(zid, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(enc) {
+		t.Errorf("encrypted content has no prefix: %q", enc)
+	}
+	if bytes.Contains(enc, plain[:10]) {
+		t.Errorf("encrypted content contains plain text: %q", enc)
+	}
+
+	got, err := DecryptContent(zid, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("expected %q, but got %q", plain, got)
+	}
+
+	if _, err = DecryptContent(zid+1, enc); err != ErrDecrypt {
+		t.Errorf("content of other zettel must not be decrypted, but got err=%v", err)
+	}
+
+	got, err = DecryptContent(zid, plain)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("plain content must be returned unchanged, but got %q (err=%v)", got, err)
+	}
+
+	SetupEncryption("")
+	if _, err = EncryptContent(zid, plain); err != ErrNoCryptKey {
+		t.Errorf("expected ErrNoCryptKey, but got %v", err)
+	}
+}
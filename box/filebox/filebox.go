@@ -40,6 +40,9 @@ func init() {
 				Str("box", "zip").Int("boxnum", int64(cdata.Number)).Child(),
 			number:   cdata.Number,
 			name:     path,
+			readonly: !box.GetQueryBool(u, "writable") || box.GetQueryBool(u, "readonly"),
+			compact:  box.GetQueryInt(u, "compact", 1, 1, 1000),
+			config:   cdata.Config,
 			enricher: cdata.Enricher,
 			notify:   cdata.Notify,
 		}, nil
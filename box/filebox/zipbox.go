@@ -19,10 +19,12 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"t73f.de/r/zsc/input"
 	"zettelstore.de/z/box"
 	"zettelstore.de/z/box/notify"
+	"zettelstore.de/z/config"
 	"zettelstore.de/z/logger"
 	"zettelstore.de/z/query"
 	"zettelstore.de/z/zettel"
@@ -34,9 +36,14 @@ type zipBox struct {
 	log      *logger.Logger
 	number   int
 	name     string
+	readonly bool
+	compact  int // Number of changes that are collected before the archive is rewritten
+	config   config.Config
 	enricher box.Enricher
 	notify   chan<- box.UpdateInfo
 	dirSrv   *notify.DirService
+	mx       sync.Mutex                // Protects the following fields
+	pending  map[id.Zid]*zettel.Zettel // Changes not yet written, nil value for a deleted zettel
 }
 
 func (zb *zipBox) Location() string {
@@ -77,11 +84,17 @@ func (zb *zipBox) Start(context.Context) error {
 }
 
 func (zb *zipBox) Refresh(_ context.Context) {
+	if err := zb.flush(); err != nil {
+		zb.log.Error().Err(err).Msg("Unable to write pending changes")
+	}
 	zb.dirSrv.Refresh()
 	zb.log.Trace().Msg("Refresh")
 }
 
 func (zb *zipBox) Stop(context.Context) {
+	if err := zb.flush(); err != nil {
+		zb.log.Error().Err(err).Msg("Unable to write pending changes")
+	}
 	zb.dirSrv.Stop()
 	zb.dirSrv = nil
 }
@@ -91,6 +104,10 @@ func (zb *zipBox) GetZettel(_ context.Context, zid id.Zid) (zettel.Zettel, error
 	if !entry.IsValid() {
 		return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
 	}
+	if z, isPending := zb.getPending(zid); isPending {
+		zb.log.Trace().Zid(zid).Msg("GetZettel/pending")
+		return z, nil
+	}
 	reader, err := zip.OpenReader(zb.name)
 	if err != nil {
 		return zettel.Zettel{}, err
@@ -133,6 +150,10 @@ func (zb *zipBox) GetZettel(_ context.Context, zid id.Zid) (zettel.Zettel, error
 	}
 
 	CleanupMeta(m, zid, entry.ContentExt, inMeta, entry.UselessFiles)
+	src, err = DecryptContent(zid, src)
+	if err != nil {
+		return zettel.Zettel{}, err
+	}
 	zb.log.Trace().Zid(zid).Msg("GetZettel")
 	return zettel.Zettel{Meta: m, Content: zettel.NewContent(src)}, nil
 }
@@ -162,9 +183,15 @@ func (zb *zipBox) ApplyMeta(ctx context.Context, handle box.MetaFunc, constraint
 		if !constraint(entry.Zid) {
 			continue
 		}
-		m, err2 := zb.readZipMeta(reader, entry.Zid, entry)
-		if err2 != nil {
-			continue
+		var m *meta.Meta
+		if z, isPending := zb.getPending(entry.Zid); isPending {
+			m = z.Meta
+		} else {
+			var err2 error
+			m, err2 = zb.readZipMeta(reader, entry.Zid, entry)
+			if err2 != nil {
+				continue
+			}
 		}
 		zb.enricher.Enrich(ctx, m, zb.number)
 		handle(m)
@@ -172,20 +199,8 @@ func (zb *zipBox) ApplyMeta(ctx context.Context, handle box.MetaFunc, constraint
 	return nil
 }
 
-func (*zipBox) CanDeleteZettel(context.Context, id.Zid) bool { return false }
-
-func (zb *zipBox) DeleteZettel(_ context.Context, zid id.Zid) error {
-	err := box.ErrReadOnly
-	entry := zb.dirSrv.GetDirEntry(zid)
-	if !entry.IsValid() {
-		err = box.ErrZettelNotFound{Zid: zid}
-	}
-	zb.log.Trace().Err(err).Msg("DeleteZettel")
-	return err
-}
-
 func (zb *zipBox) ReadStats(st *box.ManagedBoxStats) {
-	st.ReadOnly = true
+	st.ReadOnly = zb.readonly
 	st.Zettel = zb.dirSrv.NumDirEntries()
 	zb.log.Trace().Int("zettel", int64(st.Zettel)).Msg("ReadStats")
 }
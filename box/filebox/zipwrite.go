@@ -0,0 +1,323 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package filebox
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/notify"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// A zip box is only changed, if it was configured to be writable. It is
+// changed by rewriting the whole archive. Changed zettel are collected until
+// their number reaches zb.compact. Then all files of unchanged zettel are
+// copied into a temporary file, without decompressing them, followed by the
+// files of the changed zettel. Finally, the temporary file replaces the
+// archive atomically.
+//
+// By default, zb.compact is 1, i.e. every change is written through. Otherwise,
+// collected changes are written when the box is refreshed or stopped. If the
+// Zettelstore terminates abnormally before, up to zb.compact-1 changes are lost.
+
+func (zb *zipBox) notifyChanged(zid id.Zid, reason box.UpdateReason) {
+	if chci := zb.notify; chci != nil {
+		zb.log.Trace().Zid(zid).Uint("reason", uint64(reason)).Msg("notifyChanged")
+		chci <- box.UpdateInfo{Box: zb, Reason: reason, Zid: zid}
+	}
+}
+
+func (zb *zipBox) getPending(zid id.Zid) (zettel.Zettel, bool) {
+	zb.mx.Lock()
+	defer zb.mx.Unlock()
+	if z, found := zb.pending[zid]; found && z != nil {
+		result := *z
+		result.Meta = z.Meta.Clone()
+		return result, true
+	}
+	return zettel.Zettel{}, false
+}
+
+// setPending records a changed zettel and writes the archive, if enough
+// changes were collected.
+func (zb *zipBox) setPending(zid id.Zid, z *zettel.Zettel) error {
+	zb.mx.Lock()
+	defer zb.mx.Unlock()
+	if zb.pending == nil {
+		zb.pending = map[id.Zid]*zettel.Zettel{}
+	}
+	zb.pending[zid] = z
+	if len(zb.pending) < zb.compact {
+		return nil
+	}
+	return zb.writeArchive()
+}
+
+// flush writes all pending changes to the archive.
+func (zb *zipBox) flush() error {
+	zb.mx.Lock()
+	defer zb.mx.Unlock()
+	if len(zb.pending) == 0 {
+		return nil
+	}
+	return zb.writeArchive()
+}
+
+func (zb *zipBox) CanCreateZettel(context.Context) bool { return !zb.readonly }
+
+func (zb *zipBox) CreateZettel(_ context.Context, zettel zettel.Zettel) (id.Zid, error) {
+	if zb.readonly {
+		return id.Invalid, box.ErrReadOnly
+	}
+	newZid, err := zb.dirSrv.SetNewDirEntry()
+	if err != nil {
+		return id.Invalid, err
+	}
+	m := zettel.Meta.Clone()
+	m.Zid = newZid
+	zettel.Meta = m
+	entry := notify.DirEntry{Zid: newZid}
+	entry.SetupFromMetaContent(m, zettel.Content, zb.config.GetZettelFileSyntax)
+	if err = zb.dirSrv.UpdateDirEntry(&entry); err == nil {
+		err = zb.setPending(newZid, &zettel)
+	}
+	if err == nil {
+		zb.notifyChanged(newZid, box.OnZettel)
+	}
+	zb.log.Trace().Err(err).Zid(newZid).Msg("CreateZettel")
+	return newZid, err
+}
+
+func (zb *zipBox) CanUpdateZettel(context.Context, zettel.Zettel) bool { return !zb.readonly }
+
+func (zb *zipBox) UpdateZettel(_ context.Context, zettel zettel.Zettel) error {
+	if zb.readonly {
+		return box.ErrReadOnly
+	}
+	m := zettel.Meta.Clone()
+	zid := m.Zid
+	if !zid.IsValid() {
+		return box.ErrInvalidZid{Zid: zid.String()}
+	}
+	zettel.Meta = m
+	entry := zb.dirSrv.GetDirEntry(zid)
+	if !entry.IsValid() {
+		// Existing zettel, but new in this box.
+		entry = &notify.DirEntry{Zid: zid}
+	}
+	// All files of the zettel are replaced, including the useless ones.
+	entry.UselessFiles = nil
+	entry.SetupFromMetaContent(m, zettel.Content, zb.config.GetZettelFileSyntax)
+	err := zb.dirSrv.UpdateDirEntry(entry)
+	if err == nil {
+		err = zb.setPending(zid, &zettel)
+	}
+	if err == nil {
+		zb.notifyChanged(zid, box.OnZettel)
+	}
+	zb.log.Trace().Zid(zid).Err(err).Msg("UpdateZettel")
+	return err
+}
+
+func (zb *zipBox) CanDeleteZettel(_ context.Context, zid id.Zid) bool {
+	return !zb.readonly && zb.dirSrv.GetDirEntry(zid).IsValid()
+}
+
+func (zb *zipBox) DeleteZettel(_ context.Context, zid id.Zid) error {
+	if zb.readonly {
+		return box.ErrReadOnly
+	}
+	entry := zb.dirSrv.GetDirEntry(zid)
+	if !entry.IsValid() {
+		return box.ErrZettelNotFound{Zid: zid}
+	}
+	err := zb.dirSrv.DeleteDirEntry(zid)
+	if err == nil {
+		err = zb.setPending(zid, nil)
+	}
+	if err == nil {
+		zb.notifyChanged(zid, box.OnDelete)
+	}
+	zb.log.Trace().Zid(zid).Err(err).Msg("DeleteZettel")
+	return err
+}
+
+// writeArchive writes all pending changes into a new archive, which then
+// replaces the current one. zb.mx must be locked.
+func (zb *zipBox) writeArchive() error {
+	reader, err := zip.OpenReader(zb.name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	fi, err := os.Stat(zb.name)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(zb.name), "."+filepath.Base(zb.name)+".*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmpFile.Name()
+	err = zb.writeArchiveTo(tmpFile, reader)
+	if err == nil {
+		err = tmpFile.Chmod(fi.Mode())
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if err1 := tmpFile.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(tmpName, zb.name)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	zb.log.Debug().Int("changes", int64(len(zb.pending))).Msg("Archive rewritten")
+	zb.pending = nil
+	return nil
+}
+
+func (zb *zipBox) writeArchiveTo(w io.Writer, reader *zip.ReadCloser) error {
+	zw := zip.NewWriter(w)
+	if err := zw.SetComment(reader.Comment); err != nil {
+		return err
+	}
+	for _, f := range reader.File {
+		if zid := zidFromFileName(f.Name); zid.IsValid() {
+			if _, changed := zb.pending[zid]; changed {
+				continue
+			}
+		}
+		if err := zw.Copy(f); err != nil {
+			return err
+		}
+	}
+	for _, zid := range pendingZids(zb.pending) {
+		z := zb.pending[zid]
+		if z == nil {
+			continue
+		}
+		entry := zb.dirSrv.GetDirEntry(zid)
+		if !entry.IsValid() {
+			continue
+		}
+		if err := writeZipZettel(zw, entry, z); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func pendingZids(pending map[id.Zid]*zettel.Zettel) id.Slice {
+	result := make(id.Slice, 0, len(pending))
+	for zid := range pending {
+		result = append(result, zid)
+	}
+	slices.Sort(result)
+	return result
+}
+
+// zidFromFileName returns the zettel identifier at the start of a file name.
+func zidFromFileName(name string) id.Zid {
+	name = path.Base(name)
+	if len(name) < 14 {
+		return id.Invalid
+	}
+	zid, err := id.Parse(name[:14])
+	if err != nil {
+		return id.Invalid
+	}
+	return zid
+}
+
+func writeZipZettel(zw *zip.Writer, entry *notify.DirEntry, z *zettel.Zettel) error {
+	zid := entry.Zid
+	m := z.Meta
+	content := z.Content.AsBytes()
+	if MustEncrypt(m) {
+		var err error
+		if content, err = EncryptContent(zid, content); err != nil {
+			return err
+		}
+	}
+
+	contentName := entry.ContentName
+	if metaName := entry.MetaName; metaName != "" {
+		w, err := createZipFile(zw, metaName)
+		if err == nil {
+			err = writeZipMeta(w, m)
+		}
+		if err != nil || contentName == "" {
+			return err
+		}
+	} else if contentName == "" {
+		return fmt.Errorf("no meta, no content in writeZipZettel, zid=%v", zid)
+	}
+
+	w, err := createZipFile(zw, contentName)
+	if err != nil {
+		return err
+	}
+	if entry.MetaName == "" && entry.HasMetaInContent() {
+		if m.YamlSep {
+			if _, err = io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if err = writeZipMeta(w, m); err != nil {
+			return err
+		}
+		sep := "\n"
+		if m.YamlSep {
+			sep = "---\n"
+		}
+		if _, err = io.WriteString(w, sep); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+func createZipFile(zw *zip.Writer, name string) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+}
+
+func writeZipMeta(w io.Writer, m *meta.Meta) error {
+	_, err := io.WriteString(w, "id: "+m.Zid.String()+"\n")
+	if err == nil {
+		_, err = m.WriteComputed(w)
+	}
+	return err
+}
@@ -0,0 +1,261 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package filebox
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/notify"
+	"zettelstore.de/z/config"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func TestWriteZipZettel(t *testing.T) {
+	m1 := meta.New(id.Zid(20241018120000))
+	m1.Set(api.KeyTitle, "Text")
+	m1.Set(api.KeySyntax, meta.SyntaxZmk)
+	m2 := meta.New(id.Zid(20241018120001))
+	m2.Set(api.KeyTitle, "Image")
+	m2.Set(api.KeySyntax, "png")
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	testcases := []struct {
+		entry  notify.DirEntry
+		zettel zettel.Zettel
+	}{
+		{
+			notify.DirEntry{Zid: m1.Zid, ContentName: "20241018120000.zettel", ContentExt: "zettel"},
+			zettel.Zettel{Meta: m1, Content: zettel.NewContent([]byte("Some text"))},
+		},
+		{
+			notify.DirEntry{Zid: m2.Zid, MetaName: "20241018120001", ContentName: "20241018120001.png", ContentExt: "png"},
+			zettel.Zettel{Meta: m2, Content: zettel.NewContent([]byte("\x89PNG"))},
+		},
+	}
+	for _, tc := range testcases {
+		if err := writeZipZettel(zw, &tc.entry, &tc.zettel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]string{
+		"20241018120000.zettel": "id: 20241018120000\ntitle: Text\nsyntax: zmk\n\nSome text",
+		"20241018120001":        "id: 20241018120001\ntitle: Image\nsyntax: png\n",
+		"20241018120001.png":    "\x89PNG",
+	}
+	if len(reader.File) != len(exp) {
+		t.Errorf("expected %d files, but got %d", len(exp), len(reader.File))
+	}
+	for _, f := range reader.File {
+		rc, err2 := f.Open()
+		if err2 != nil {
+			t.Error(err2)
+			continue
+		}
+		got, err2 := io.ReadAll(rc)
+		rc.Close()
+		if err2 != nil {
+			t.Error(err2)
+			continue
+		}
+		if expContent, found := exp[f.Name]; !found {
+			t.Errorf("unexpected file %q", f.Name)
+		} else if string(got) != expContent {
+			t.Errorf("file %q: expected %q, but got %q", f.Name, expContent, got)
+		}
+	}
+}
+
+func TestZidFromFileName(t *testing.T) {
+	testcases := []struct {
+		name string
+		exp  id.Zid
+	}{
+		{"", id.Invalid},
+		{"2024", id.Invalid},
+		{"20241018120000", id.Zid(20241018120000)},
+		{"20241018120000 Title.zettel", id.Zid(20241018120000)},
+		{"abcdefghijklmn.zettel", id.Invalid},
+	}
+	for _, tc := range testcases {
+		if got := zidFromFileName(tc.name); got != tc.exp {
+			t.Errorf("zidFromFileName(%q) should be %v, but got %v", tc.name, tc.exp, got)
+		}
+	}
+}
+
+type testConfig struct{ config.Config }
+
+func (testConfig) GetZettelFileSyntax() []string { return nil }
+
+const testComment = "Test archive"
+
+func writeTestArchive(t *testing.T, name string, files []string) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	zw.SetComment(testComment)
+	for i := 0; i < len(files); i += 2 {
+		w, err2 := zw.Create(files[i])
+		if err2 == nil {
+			_, err2 = io.WriteString(w, files[i+1])
+		}
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+	}
+	if err = zw.Close(); err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestArchive(t *testing.T, name string) map[string]string {
+	reader, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.Comment != testComment {
+		t.Errorf("expected comment %q, but got %q", testComment, reader.Comment)
+	}
+	result := make(map[string]string, len(reader.File))
+	for _, f := range reader.File {
+		src, err2 := readZipFileContent(reader, f.Name)
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		result[f.Name] = string(src)
+	}
+	return result
+}
+
+func checkTestArchive(t *testing.T, name string, exp map[string]string) {
+	t.Helper()
+	got := readTestArchive(t, name)
+	if len(got) != len(exp) {
+		t.Errorf("expected files %v, but got %v", exp, got)
+	}
+	for fname, content := range exp {
+		if gotContent, found := got[fname]; !found {
+			t.Errorf("file %q not found", fname)
+		} else if gotContent != content {
+			t.Errorf("file %q: expected %q, but got %q", fname, content, gotContent)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Dir(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files must be removed, but got %v", entries)
+	}
+}
+
+func TestZipBoxWriteArchive(t *testing.T) {
+	t.Parallel()
+	name := filepath.Join(t.TempDir(), "box.zip")
+	writeTestArchive(t, name, []string{
+		"20241018120000.zettel", "title: Changed\n\nOld",
+		"20241018120001.zettel", "title: Deleted\n\nDeleted",
+		"20241018120002.zettel", "title: Unchanged\n\nUnchanged",
+	})
+	if err := os.Chmod(name, 0640); err != nil {
+		t.Fatal(err)
+	}
+	initial := readTestArchive(t, name)
+
+	ctx := context.Background()
+	zb := &zipBox{name: name, compact: 2, config: testConfig{}}
+	if err := zb.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; zb.State() != box.StartStateStarted; i++ {
+		if i > 100 {
+			t.Fatal("box was not started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The first change is only collected.
+	changed := id.Zid(20241018120000)
+	z, err := zb.GetZettel(ctx, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.Content = zettel.NewContent([]byte("New"))
+	if err = zb.UpdateZettel(ctx, z); err != nil {
+		t.Fatal(err)
+	}
+	checkTestArchive(t, name, initial)
+	if z, err = zb.GetZettel(ctx, changed); err != nil || z.Content.AsString() != "New" {
+		t.Errorf("pending zettel %v expected, but got %v/%v", changed, z, err)
+	}
+
+	// The second change rewrites the archive, merging the pending changes.
+	if err = zb.DeleteZettel(ctx, id.Zid(20241018120001)); err != nil {
+		t.Fatal(err)
+	}
+	checkTestArchive(t, name, map[string]string{
+		"20241018120000.zettel": "id: 20241018120000\ntitle: Changed\n\nNew",
+		"20241018120002.zettel": "title: Unchanged\n\nUnchanged",
+	})
+	if len(zb.pending) != 0 {
+		t.Errorf("no pending changes expected, but got %v", zb.pending)
+	}
+	if fi, err2 := os.Stat(name); err2 != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("file mode must be retained, but got %v/%v", fi, err2)
+	}
+
+	// A new zettel is collected until the box is stopped.
+	m := meta.New(id.Invalid)
+	m.Set(api.KeyTitle, "Created")
+	m.Set(api.KeySyntax, meta.SyntaxZmk)
+	zid, err := zb.CreateZettel(ctx, zettel.Zettel{Meta: m, Content: zettel.NewContent([]byte("Created"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !zb.HasZettel(ctx, zid) {
+		t.Errorf("created zettel %v not found", zid)
+	}
+	zb.Stop(ctx)
+	checkTestArchive(t, name, map[string]string{
+		"20241018120000.zettel":  "id: 20241018120000\ntitle: Changed\n\nNew",
+		"20241018120002.zettel":  "title: Unchanged\n\nUnchanged",
+		zid.String() + ".zettel": "id: " + zid.String() + "\ntitle: Created\nsyntax: zmk\n\nCreated",
+	})
+}
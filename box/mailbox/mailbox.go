@@ -0,0 +1,393 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+// Package mailbox provides a read-only box that presents the messages of a
+// Maildir or of a mbox file as zettel.
+package mailbox
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/manager"
+	"zettelstore.de/z/kernel"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func init() {
+	manager.Register("mail", func(u *url.URL, cdata *manager.ConnectData) (box.ManagedBox, error) {
+		path := u.Opaque
+		if path == "" {
+			path = u.Path
+		}
+		return &mailBox{
+			log: kernel.Main.GetLogger(kernel.BoxService).Clone().
+				Str("box", "mail").Int("boxnum", int64(cdata.Number)).Child(),
+			number:   cdata.Number,
+			location: u.String(),
+			path:     filepath.Clean(path),
+			cdata:    *cdata,
+		}, nil
+	})
+}
+
+// Metadata keys of a message zettel.
+const (
+	keySender    = "sender"
+	keyMessageID = "message-id"
+	roleMail     = "mail"
+)
+
+// entry stores the metadata of a zettel, and where its content is found.
+type entry struct {
+	meta *meta.Meta
+	src  source
+	part int // -1: body of the message, otherwise: number of attachment
+}
+
+// mailBox caches the metadata of all messages and their attachments. The
+// content is read again from the Maildir or mbox file, when it is needed.
+type mailBox struct {
+	log      *logger.Logger
+	number   int
+	location string
+	path     string
+	cdata    manager.ConnectData
+
+	mx      sync.RWMutex // Protects the following fields
+	entries map[id.Zid]entry
+}
+
+func (mb *mailBox) notifyChanged(zid id.Zid, reason box.UpdateReason) {
+	if chci := mb.cdata.Notify; chci != nil {
+		mb.log.Trace().Zid(zid).Uint("reason", uint64(reason)).Msg("notifyChanged")
+		chci <- box.UpdateInfo{Box: mb, Reason: reason, Zid: zid}
+	}
+}
+
+func (mb *mailBox) Location() string { return mb.location }
+
+func (mb *mailBox) State() box.StartState {
+	mb.mx.RLock()
+	defer mb.mx.RUnlock()
+	if mb.entries == nil {
+		return box.StartStateStopped
+	}
+	return box.StartStateStarted
+}
+
+func (mb *mailBox) Start(context.Context) error {
+	entries, err := mb.scan()
+	if err != nil {
+		return err
+	}
+	mb.mx.Lock()
+	defer mb.mx.Unlock()
+	if mb.entries != nil {
+		return box.ErrStarted
+	}
+	mb.entries = entries
+	mb.log.Trace().Int("zettel", int64(len(entries))).Msg("Start Box")
+	return nil
+}
+
+func (mb *mailBox) Refresh(context.Context) {
+	entries, err := mb.scan()
+	if err != nil {
+		mb.log.Error().Err(err).Msg("Refresh")
+		return
+	}
+	mb.mx.Lock()
+	if mb.entries == nil {
+		mb.mx.Unlock()
+		return
+	}
+	var changed, deleted []id.Zid
+	for zid, e := range entries {
+		if prev, found := mb.entries[zid]; !found || prev.src != e.src || !prev.meta.Equal(e.meta, false) {
+			changed = append(changed, zid)
+		}
+	}
+	for zid := range mb.entries {
+		if _, found := entries[zid]; !found {
+			deleted = append(deleted, zid)
+		}
+	}
+	mb.entries = entries
+	mb.mx.Unlock()
+
+	mb.log.Trace().Int("entries", int64(len(entries))).Int("changed", int64(len(changed))).Int("deleted", int64(len(deleted))).Msg("Refresh")
+	for _, zid := range changed {
+		mb.notifyChanged(zid, box.OnZettel)
+	}
+	for _, zid := range deleted {
+		mb.notifyChanged(zid, box.OnDelete)
+	}
+}
+
+func (mb *mailBox) Stop(context.Context) {
+	mb.mx.Lock()
+	mb.entries = nil
+	mb.mx.Unlock()
+}
+
+// scan reads all messages and computes the metadata of the resulting zettel.
+func (mb *mailBox) scan() (map[id.Zid]entry, error) {
+	sources, err := listSources(mb.path)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]scannedMessage, 0, len(sources))
+	for _, src := range sources {
+		data, errRead := src.read()
+		if errRead != nil {
+			mb.log.Error().Err(errRead).Str("path", src.path).Msg("Unable to read message")
+			continue
+		}
+		msg, errParse := parseMessage(data)
+		if errParse != nil {
+			mb.log.Error().Err(errParse).Str("path", src.path).Int("offset", src.offset).Msg("Unable to parse message")
+			continue
+		}
+		msgs = append(msgs, scannedMessage{msg: msg, src: src})
+	}
+	return buildEntries(msgs), nil
+}
+
+// scannedMessage is a message together with its source.
+type scannedMessage struct {
+	msg *message
+	src source
+}
+
+func (sm *scannedMessage) date() time.Time {
+	if sm.msg.date.IsZero() {
+		return sm.src.date
+	}
+	return sm.msg.date
+}
+
+// key returns the string that identifies the message, independent of where it
+// is stored.
+func (sm *scannedMessage) key() string {
+	if msgID := sm.msg.messageID; msgID != "" {
+		return msgID
+	}
+	return sm.date().UTC().Format(time.RFC3339) + "\x00" + sm.msg.sender + "\x00" + sm.msg.subject
+}
+
+// Identifier of mail zettel use an hour between 24 and 99. Such an identifier
+// is never created from a timestamp, e.g. for a new zettel in another box.
+const (
+	mailFirstHour = 24
+	mailSlots     = (100 - mailFirstHour) * 10000
+)
+
+// mailZid derives a zettel identifier from the day of a message and from a
+// key. If the identifier is already used, the next probe is tried.
+func mailZid(day, key string, probe int) id.Zid {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	if probe > 0 {
+		fmt.Fprintf(h, "\x01%d", probe)
+	}
+	slot := h.Sum64() % mailSlots
+	zid, err := id.Parse(fmt.Sprintf("%s%02d%04d", day, mailFirstHour+slot/10000, slot%10000))
+	if err != nil {
+		return id.Invalid
+	}
+	return zid
+}
+
+// maxProbes limits the search for an unused identifier.
+const maxProbes = 100
+
+// buildEntries assigns zettel identifiers to all messages and their
+// attachments. An identifier is derived from the day of a message and from a
+// hash of its message identifier, so that it does not depend on other
+// messages. Only if two messages of the same day collide, one of them gets
+// another identifier, again derived from the hash. A message is the successor
+// of the message it replies to. An attachment is subordinate to its message.
+func buildEntries(msgs []scannedMessage) map[id.Zid]entry {
+	slices.SortFunc(msgs, func(a, b scannedMessage) int {
+		return cmp.Or(
+			cmp.Compare(a.key(), b.key()),
+			cmp.Compare(a.src.path, b.src.path),
+			cmp.Compare(a.src.offset, b.src.offset),
+		)
+	})
+
+	entries := make(map[id.Zid]entry, len(msgs))
+	byMessageID := make(map[string]id.Zid, len(msgs))
+	nextZid := func(day, key string) id.Zid {
+		for probe := range maxProbes {
+			zid := mailZid(day, key, probe)
+			if !zid.IsValid() {
+				return id.Invalid
+			}
+			if _, found := entries[zid]; !found {
+				return zid
+			}
+		}
+		return id.Invalid
+	}
+	for _, sm := range msgs {
+		msg := sm.msg
+		date := sm.date().Local()
+		created := date.Format(id.TimestampLayout)
+		day, key := date.Format("20060102"), sm.key()
+		zid := nextZid(day, key)
+		if !zid.IsValid() {
+			continue
+		}
+		m := meta.New(zid)
+		if msg.subject != "" {
+			m.Set(api.KeyTitle, msg.subject)
+		}
+		m.Set(api.KeyRole, roleMail)
+		m.Set(api.KeySyntax, msg.syntax)
+		m.Set(api.KeyCreated, created)
+		if msg.sender != "" {
+			m.Set(keySender, msg.sender)
+		}
+		if msg.messageID != "" {
+			m.Set(keyMessageID, msg.messageID)
+			if _, found := byMessageID[msg.messageID]; !found {
+				byMessageID[msg.messageID] = zid
+			}
+		}
+		entries[zid] = entry{meta: m, src: sm.src, part: -1}
+
+		for i, att := range msg.attachments {
+			attZid := nextZid(day, fmt.Sprintf("%s\x00%d", key, i))
+			if !attZid.IsValid() {
+				continue
+			}
+			am := meta.New(attZid)
+			am.Set(api.KeyTitle, att.filename)
+			am.Set(api.KeySyntax, att.syntax)
+			am.Set(api.KeyCreated, created)
+			am.Set(api.KeySuperior, zid.String())
+			entries[attZid] = entry{meta: am, src: sm.src, part: i}
+		}
+	}
+
+	for _, sm := range msgs {
+		if sm.msg.inReplyTo == "" {
+			continue
+		}
+		parent, found := byMessageID[sm.msg.inReplyTo]
+		if !found {
+			continue
+		}
+		if zid, own := byMessageID[sm.msg.messageID]; own && zid != parent {
+			entries[zid].meta.Set(api.KeyPrecursor, parent.String())
+		}
+	}
+	return entries
+}
+
+func (mb *mailBox) getEntry(zid id.Zid) (entry, bool) {
+	mb.mx.RLock()
+	e, found := mb.entries[zid]
+	mb.mx.RUnlock()
+	return e, found
+}
+
+func (mb *mailBox) GetZettel(_ context.Context, zid id.Zid) (zettel.Zettel, error) {
+	e, found := mb.getEntry(zid)
+	if !found {
+		return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+	}
+	data, err := e.src.read()
+	if err != nil {
+		return zettel.Zettel{}, err
+	}
+	msg, err := parseMessage(data)
+	if err != nil {
+		return zettel.Zettel{}, err
+	}
+	content := msg.body
+	if e.part >= 0 {
+		if e.part >= len(msg.attachments) {
+			// The message was changed since the last scan.
+			return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+		}
+		content = msg.attachments[e.part].data
+	}
+	mb.log.Trace().Zid(zid).Msg("GetZettel")
+	return zettel.Zettel{Meta: e.meta.Clone(), Content: zettel.NewContent(content)}, nil
+}
+
+func (mb *mailBox) HasZettel(_ context.Context, zid id.Zid) bool {
+	_, found := mb.getEntry(zid)
+	return found
+}
+
+func (mb *mailBox) ApplyZid(_ context.Context, handle box.ZidFunc, constraint query.RetrievePredicate) error {
+	mb.mx.RLock()
+	defer mb.mx.RUnlock()
+	mb.log.Trace().Int("entries", int64(len(mb.entries))).Msg("ApplyZid")
+	for zid := range mb.entries {
+		if constraint(zid) {
+			handle(zid)
+		}
+	}
+	return nil
+}
+
+func (mb *mailBox) ApplyMeta(ctx context.Context, handle box.MetaFunc, constraint query.RetrievePredicate) error {
+	mb.mx.RLock()
+	defer mb.mx.RUnlock()
+	mb.log.Trace().Int("entries", int64(len(mb.entries))).Msg("ApplyMeta")
+	for zid, e := range mb.entries {
+		if constraint(zid) {
+			m := e.meta.Clone()
+			mb.cdata.Enricher.Enrich(ctx, m, mb.number)
+			handle(m)
+		}
+	}
+	return nil
+}
+
+func (*mailBox) CanDeleteZettel(context.Context, id.Zid) bool { return false }
+
+func (mb *mailBox) DeleteZettel(_ context.Context, zid id.Zid) error {
+	err := box.ErrReadOnly
+	if !mb.HasZettel(context.Background(), zid) {
+		err = box.ErrZettelNotFound{Zid: zid}
+	}
+	mb.log.Trace().Zid(zid).Err(err).Msg("DeleteZettel")
+	return err
+}
+
+func (mb *mailBox) ReadStats(st *box.ManagedBoxStats) {
+	st.ReadOnly = true
+	mb.mx.RLock()
+	st.Zettel = len(mb.entries)
+	mb.mx.RUnlock()
+	mb.log.Trace().Int("zettel", int64(st.Zettel)).Msg("ReadStats")
+}
@@ -0,0 +1,179 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package mailbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+const testMbox = `From alice@example.com Fri Oct 18 12:00:00 2024
+From: Alice <alice@example.com>
+Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=
+Date: Fri, 18 Oct 2024 12:00:00 +0000
+Message-ID: <1@example.com>
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/html; charset=utf-8
+
+<p>Hello</p>
+--inner
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Hello =E4
+--inner--
+--outer
+Content-Type: application/pdf
+Content-Disposition: attachment; filename="paper.pdf"
+Content-Transfer-Encoding: base64
+
+JVBERi0xLjQ=
+--outer--
+
+From bob@example.com Fri Oct 18 12:00:00 2024
+From: Bob <bob@example.com>
+Subject: Re: Hello
+Date: Fri, 18 Oct 2024 12:00:00 +0000
+Message-ID: <2@example.com>
+In-Reply-To: <1@example.com>
+
+>From here on, it is a reply.
+`
+
+func TestParseMessage(t *testing.T) {
+	sources := splitMbox([]byte(testMbox))
+	if len(sources) != 2 {
+		t.Fatalf("expected two messages, but got %d", len(sources))
+	}
+	data := []byte(testMbox)[sources[0].offset : sources[0].offset+sources[0].length]
+	msg, err := parseMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.subject != "Grüße" || msg.sender != "Alice <alice@example.com>" || msg.messageID != "1@example.com" {
+		t.Errorf("unexpected header values %q / %q / %q", msg.subject, msg.sender, msg.messageID)
+	}
+	if got := string(msg.body); msg.syntax != meta.SyntaxPlain || strings.TrimSpace(got) != "Hello ä" {
+		t.Errorf("expected plain text body, but got %q (%s)", got, msg.syntax)
+	}
+	if len(msg.attachments) != 1 {
+		t.Fatalf("expected one attachment, but got %v", msg.attachments)
+	}
+	if att := msg.attachments[0]; att.filename != "paper.pdf" || !strings.HasPrefix(string(att.data), "%PDF") {
+		t.Errorf("unexpected attachment %q / %q", att.filename, att.data)
+	}
+}
+
+func TestBuildEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mbox")
+	if err := os.WriteFile(path, []byte(testMbox), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mb := &mailBox{path: path}
+	entries, err := mb.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected message, attachment, and reply, but got %v", entries)
+	}
+	var msgZid, attZid, replyZid id.Zid
+	for zid, e := range entries {
+		if hour := zid.String()[8:10]; hour < "24" {
+			t.Errorf("identifier %v may be used by another zettel", zid)
+		}
+		switch {
+		case e.part == 0:
+			attZid = zid
+		case e.meta.GetDefault(keyMessageID, "") == "1@example.com":
+			msgZid = zid
+		default:
+			replyZid = zid
+		}
+	}
+	if !msgZid.IsValid() || !attZid.IsValid() || !replyZid.IsValid() {
+		t.Fatalf("unexpected zettel %v", entries)
+	}
+	if got := entries[attZid].meta.GetDefault(api.KeySuperior, ""); got != msgZid.String() {
+		t.Errorf("attachment should be subordinate to message, but got %q", got)
+	}
+	if got := entries[replyZid].meta.GetDefault(api.KeyPrecursor, ""); got != msgZid.String() {
+		t.Errorf("reply should follow message, but got %q", got)
+	}
+
+	mb.entries = entries
+	z, err := mb.GetZettel(context.Background(), replyZid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := z.Content.AsString(); got != "From here on, it is a reply.\n" {
+		t.Errorf("unexpected reply content %q", got)
+	}
+}
+
+func newTestMessage(msgID string, date time.Time) scannedMessage {
+	return scannedMessage{msg: &message{messageID: msgID, date: date}, src: source{path: msgID}}
+}
+
+func TestBuildEntriesStable(t *testing.T) {
+	date := time.Date(2024, 10, 18, 12, 0, 0, 0, time.Local)
+	entries := buildEntries([]scannedMessage{newTestMessage("1@example.com", date)})
+	var zid id.Zid
+	for z := range entries {
+		zid = z
+	}
+	if got := zid.String()[:8]; got != "20241018" {
+		t.Errorf("identifier should start with the day of the message, but got %v", zid)
+	}
+
+	// Other messages, even at the same time, do not change the identifier.
+	msgs := []scannedMessage{newTestMessage("1@example.com", date)}
+	for i := range 50 {
+		msgs = append(msgs, newTestMessage(fmt.Sprintf("%d@example.org", i), date.Add(-time.Duration(i)*time.Second)))
+	}
+	entries = buildEntries(msgs)
+	if len(entries) != len(msgs) {
+		t.Errorf("expected %d zettel, but got %d", len(msgs), len(entries))
+	}
+	if e, found := entries[zid]; !found || e.meta.GetDefault(keyMessageID, "") != "1@example.com" {
+		t.Errorf("identifier %v of message changed", zid)
+	}
+
+	// A collision is resolved for the colliding message only.
+	entries = buildEntries([]scannedMessage{
+		newTestMessage("1@example.com", date),
+		newTestMessage("1@example.com", date),
+	})
+	if len(entries) != 2 {
+		t.Errorf("expected two zettel, but got %v", entries)
+	}
+	if e, found := entries[zid]; !found || e.src.path != "1@example.com" {
+		t.Errorf("first message must keep its identifier %v", zid)
+	}
+}
@@ -0,0 +1,208 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package mailbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"zettelstore.de/z/web/content"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// message contains all data of a mail message that is relevant for zettel.
+type message struct {
+	subject     string
+	sender      string
+	date        time.Time
+	messageID   string
+	inReplyTo   string
+	body        []byte
+	syntax      string
+	attachments []attachment
+}
+
+// attachment is a MIME part of a message that is not part of its body.
+type attachment struct {
+	filename string
+	syntax   string
+	data     []byte
+}
+
+var wordDecoder = mime.WordDecoder{CharsetReader: charsetReader}
+
+// parseMessage parses a message in RFC 5322 format.
+func parseMessage(data []byte) (*message, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	h := msg.Header
+	m := &message{
+		subject:   decodeHeader(h.Get("Subject")),
+		sender:    decodeHeader(h.Get("From")),
+		messageID: firstMessageID(h.Get("Message-Id")),
+		inReplyTo: firstMessageID(h.Get("In-Reply-To")),
+	}
+	if date, errDate := h.Date(); errDate == nil {
+		m.date = date
+	}
+	if err = m.addPart(textproto.MIMEHeader(h), msg.Body, false); err != nil {
+		return nil, err
+	}
+	if m.syntax == "" {
+		m.syntax = meta.SyntaxPlain
+	}
+	return m, nil
+}
+
+// addPart adds a MIME part either as the body of the message, or as an
+// attachment. Within a multipart/alternative part, only the preferred text is
+// used as body, all other alternatives are ignored.
+func (m *message) addPart(header textproto.MIMEHeader, r io.Reader, alternative bool) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, errPart := mr.NextRawPart()
+			if errPart == io.EOF {
+				return nil
+			}
+			if errPart != nil {
+				return errPart
+			}
+			if errPart = m.addPart(p.Header, p, mediaType == "multipart/alternative"); errPart != nil {
+				return errPart
+			}
+		}
+	}
+
+	data, err := io.ReadAll(transferDecoder(header.Get("Content-Transfer-Encoding"), r))
+	if err != nil {
+		return err
+	}
+	disposition, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if disposition != "attachment" && filename == "" {
+		if syntax := textSyntax(mediaType); syntax != "" {
+			text := toUTF8(data, params["charset"])
+			switch {
+			case m.body == nil:
+				m.body, m.syntax = text, syntax
+				return nil
+			case alternative:
+				if m.syntax == meta.SyntaxHTML && syntax == meta.SyntaxPlain {
+					m.body, m.syntax = text, syntax
+				}
+				return nil
+			case m.syntax == syntax:
+				// E.g. a footer that was added by a mailing list.
+				m.body = append(append(m.body, '\n'), text...)
+				return nil
+			}
+		}
+	}
+	if filename == "" {
+		filename = fmt.Sprintf("attachment-%d", len(m.attachments)+1)
+		if exts, errExt := mime.ExtensionsByType(mediaType); errExt == nil && len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	m.attachments = append(m.attachments, attachment{
+		filename: decodeHeader(filename),
+		syntax:   content.SyntaxFromMIME(mediaType, data),
+		data:     data,
+	})
+	return nil
+}
+
+func textSyntax(mediaType string) string {
+	switch mediaType {
+	case "text/plain":
+		return meta.SyntaxPlain
+	case "text/html":
+		return meta.SyntaxHTML
+	}
+	return ""
+}
+
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// toUTF8 converts text of the given character set into UTF-8. If the character
+// set is not known, the text is not changed.
+func toUTF8(data []byte, charset string) []byte {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "us-ascii":
+		return data
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return data
+	}
+	if result, err2 := enc.NewDecoder().Bytes(data); err2 == nil {
+		return result
+	}
+	return data
+}
+
+func charsetReader(charset string, r io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewDecoder().Reader(r), nil
+}
+
+// decodeHeader decodes MIME encoded-words (RFC 2047) of a header value.
+func decodeHeader(val string) string {
+	if result, err := wordDecoder.DecodeHeader(val); err == nil {
+		val = result
+	}
+	return strings.Join(strings.Fields(val), " ")
+}
+
+// firstMessageID returns the first message identifier of a header value,
+// without the angle brackets.
+func firstMessageID(val string) string {
+	if start := strings.IndexByte(val, '<'); start >= 0 {
+		if end := strings.IndexByte(val[start:], '>'); end > 0 {
+			return val[start+1 : start+end]
+		}
+	}
+	return strings.TrimSpace(val)
+}
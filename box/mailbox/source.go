@@ -0,0 +1,156 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package mailbox
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// source specifies where a message is stored: either a whole file of a
+// Maildir, or a part of a mbox file.
+type source struct {
+	path   string
+	offset int64
+	length int64     // -1: whole file
+	date   time.Time // Fallback, if the message has no date
+}
+
+// read returns the message data.
+func (src *source) read() ([]byte, error) {
+	if src.length < 0 {
+		return os.ReadFile(src.path)
+	}
+	f, err := os.Open(src.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, src.length)
+	if _, err = f.ReadAt(data, src.offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return unescapeMbox(data), nil
+}
+
+// listSources returns the sources of all messages, either of a Maildir, or of
+// a mbox file.
+func listSources(path string) ([]source, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return listMaildir(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sources := splitMbox(data)
+	for i := range sources {
+		sources[i].path = path
+		if sources[i].date.IsZero() {
+			sources[i].date = fi.ModTime()
+		}
+	}
+	return sources, nil
+}
+
+// listMaildir returns the sources of all messages of the sub-directories
+// "cur" and "new". Temporary files in "tmp" are ignored.
+func listMaildir(path string) ([]source, error) {
+	var result []source
+	for _, sub := range []string{"cur", "new"} {
+		entries, err := os.ReadDir(filepath.Join(path, sub))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			src := source{path: filepath.Join(path, sub, entry.Name()), length: -1}
+			if fi, errInfo := entry.Info(); errInfo == nil {
+				src.date = fi.ModTime()
+			}
+			result = append(result, src)
+		}
+	}
+	return result, nil
+}
+
+var mboxSeparator = []byte("From ")
+
+// splitMbox returns the position of all messages within a mbox file. Every
+// message starts with a line "From SENDER DATE", which is not part of the
+// message.
+func splitMbox(data []byte) []source {
+	var result []source
+	pos := 0
+	for pos < len(data) {
+		end := bytes.IndexByte(data[pos:], '\n')
+		if end < 0 {
+			end = len(data) - pos
+		}
+		line := data[pos : pos+end]
+		next := pos + end + 1
+		if bytes.HasPrefix(line, mboxSeparator) && (pos == 0 || isBlankBefore(data, pos)) {
+			if n := len(result); n > 0 {
+				result[n-1].length = int64(pos) - result[n-1].offset
+			}
+			result = append(result, source{offset: int64(min(next, len(data))), date: mboxDate(line)})
+		}
+		pos = next
+	}
+	if n := len(result); n > 0 {
+		result[n-1].length = int64(len(data)) - result[n-1].offset
+	}
+	return result
+}
+
+// isBlankBefore returns true, if the line before the given position is empty.
+func isBlankBefore(data []byte, pos int) bool {
+	return pos >= 2 && data[pos-1] == '\n' && (data[pos-2] == '\n' || (pos >= 3 && data[pos-2] == '\r' && data[pos-3] == '\n'))
+}
+
+// mboxDate returns the date of the separator line, or the zero time.
+func mboxDate(line []byte) time.Time {
+	fields := strings.Fields(strings.TrimSpace(string(line)))
+	if len(fields) >= 7 {
+		if t, err := time.Parse(time.ANSIC, strings.Join(fields[2:7], " ")); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// unescapeMbox removes the quoting of lines that start with "From ", as
+// written by most mbox writers (mboxrd).
+func unescapeMbox(data []byte) []byte {
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	for i, line := range lines {
+		if trimmed := bytes.TrimLeft(line, ">"); len(trimmed) < len(line) && bytes.HasPrefix(trimmed, mboxSeparator) {
+			lines[i] = line[1:]
+		}
+	}
+	return bytes.Join(lines, nil)
+}
@@ -16,7 +16,9 @@ package manager
 import (
 	"context"
 	"errors"
+	"io"
 	"strings"
+	"time"
 
 	"zettelstore.de/z/box"
 	"zettelstore.de/z/query"
@@ -117,6 +119,43 @@ func (mgr *Manager) getZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, e
 	return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
 }
 
+// GetZettelStream retrieves the metadata and a stream of the content of a
+// specific zettel.
+func (mgr *Manager) GetZettelStream(ctx context.Context, zid id.Zid) (*meta.Meta, *box.ContentStream, error) {
+	mgr.mgrLog.Debug().Zid(zid).Msg("GetZettelStream")
+	if err := mgr.checkContinue(ctx); err != nil {
+		return nil, nil, err
+	}
+	mgr.mgrMx.RLock()
+	defer mgr.mgrMx.RUnlock()
+	for i, p := range mgr.boxes {
+		var errZNF box.ErrZettelNotFound
+		if m, cs, err := getBoxZettelStream(ctx, p, zid); !errors.As(err, &errZNF) {
+			if err == nil {
+				mgr.Enrich(ctx, m, i+1)
+			}
+			return m, cs, err
+		}
+	}
+	return nil, nil, box.ErrZettelNotFound{Zid: zid}
+}
+
+// getBoxZettelStream retrieves a stream from the given box. If the box is not
+// able to stream the content, it is read into memory.
+func getBoxZettelStream(ctx context.Context, p box.ManagedBox, zid id.Zid) (*meta.Meta, *box.ContentStream, error) {
+	if st, isStreamer := p.(box.Streamer); isStreamer {
+		m, cs, err := st.GetZettelStream(ctx, zid)
+		if !errors.Is(err, box.ErrNotStreamable) {
+			return m, cs, err
+		}
+	}
+	z, err := p.GetZettel(ctx, zid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return z.Meta, box.NewContentStream(z.Content), nil
+}
+
 // GetAllZettel retrieves a specific zettel from all managed boxes.
 func (mgr *Manager) GetAllZettel(ctx context.Context, zid id.Zid) ([]zettel.Zettel, error) {
 	mgr.mgrLog.Debug().Zid(zid).Msg("GetAllZettel")
@@ -127,7 +166,16 @@ func (mgr *Manager) GetAllZettel(ctx context.Context, zid id.Zid) ([]zettel.Zett
 	defer mgr.mgrMx.RUnlock()
 	var result []zettel.Zettel
 	for i, p := range mgr.boxes {
-		if z, err := p.GetZettel(ctx, zid); err == nil {
+		if ol, isOverlayer := p.(box.Overlayer); isOverlayer {
+			zs, err := ol.GetAllZettel(ctx, zid)
+			if err != nil {
+				return nil, err
+			}
+			for _, z := range zs {
+				mgr.Enrich(ctx, z.Meta, i+1)
+			}
+			result = append(result, zs...)
+		} else if z, err := p.GetZettel(ctx, zid); err == nil {
 			mgr.Enrich(ctx, z.Meta, i+1)
 			result = append(result, z)
 		}
@@ -191,6 +239,16 @@ func (mgr *Manager) GetMeta(ctx context.Context, zid id.Zid) (*meta.Meta, error)
 	return m, nil
 }
 
+// GetWords returns the words of the zettel with the given identifier, as
+// collected by the indexer.
+func (mgr *Manager) GetWords(ctx context.Context, zid id.Zid) ([]string, error) {
+	mgr.mgrLog.Debug().Zid(zid).Msg("GetWords")
+	if err := mgr.checkContinue(ctx); err != nil {
+		return nil, err
+	}
+	return mgr.idxStore.GetWords(ctx, zid)
+}
+
 // SelectMeta returns all zettel meta data that match the selection
 // criteria. The result is ordered by descending zettel id.
 func (mgr *Manager) SelectMeta(ctx context.Context, metaSeq []*meta.Meta, q *query.Query) ([]*meta.Meta, error) {
@@ -200,19 +258,33 @@ func (mgr *Manager) SelectMeta(ctx context.Context, metaSeq []*meta.Meta, q *que
 	if err := mgr.checkContinue(ctx); err != nil {
 		return nil, err
 	}
+	// Joins are executed before locking, because they select zettel too.
+	if err := q.ExecuteJoins(ctx, mgr); err != nil {
+		return nil, err
+	}
 	mgr.mgrMx.RLock()
 	defer mgr.mgrMx.RUnlock()
 
 	compSearch := q.RetrieveAndCompile(ctx, mgr, metaSeq)
+	start := time.Now()
 	if result := compSearch.Result(); result != nil {
+		compSearch.AddPhase(query.PhaseResult, start, len(result))
 		mgr.mgrLog.Trace().Int("count", int64(len(result))).Msg("found without ApplyMeta")
 		return result, nil
 	}
 	selected := map[id.Zid]*meta.Meta{}
 	for _, term := range compSearch.Terms {
+		start = time.Now()
 		rejected := id.NewSet()
+		var candidates *id.Set
+		if compSearch.CountCandidates() {
+			candidates = id.NewSet()
+		}
 		handleMeta := func(m *meta.Meta) {
 			zid := m.Zid
+			if candidates != nil && !candidates.Contains(zid) && compSearch.PreMatch(m) {
+				candidates.Add(zid)
+			}
 			if rejected.Contains(zid) {
 				mgr.mgrLog.Trace().Zid(zid).Msg("SelectMeta/alreadyRejected")
 				return
@@ -234,12 +306,18 @@ func (mgr *Manager) SelectMeta(ctx context.Context, metaSeq []*meta.Meta, q *que
 				return nil, err2
 			}
 		}
+		if candidates != nil {
+			compSearch.SetCandidates(term, candidates.Length())
+		}
+		compSearch.AddPhase(query.PhaseScan, start, len(selected))
 	}
+	start = time.Now()
 	result := make([]*meta.Meta, 0, len(selected))
 	for _, m := range selected {
 		result = append(result, m)
 	}
 	result = compSearch.AfterSearch(result)
+	compSearch.AddPhase(query.PhaseSort, start, len(result))
 	mgr.mgrLog.Trace().Int("count", int64(len(result))).Msg("found with ApplyMeta")
 	return result, nil
 }
@@ -275,6 +353,36 @@ func (mgr *Manager) UpdateZettel(ctx context.Context, zettel zettel.Zettel) erro
 	return box.ErrReadOnly
 }
 
+// UpdateZettelStream updates an existing zettel, where the new content is
+// read from the given reader.
+func (mgr *Manager) UpdateZettelStream(ctx context.Context, m *meta.Meta, r io.Reader) error {
+	mgr.mgrLog.Debug().Zid(m.Zid).Msg("UpdateZettelStream")
+	if err := mgr.checkContinue(ctx); err != nil {
+		return err
+	}
+	if _, isWriteBox := mgr.boxes[0].(box.WriteBox); !isWriteBox {
+		return box.ErrReadOnly
+	}
+	m = mgr.cleanMetaProperties(m)
+	if st, isStreamer := mgr.boxes[0].(box.Streamer); isStreamer {
+		err := st.UpdateZettelStream(ctx, m, r)
+		if err == nil {
+			mgr.idxUpdateZettelByZid(box.NoEnrichContext(ctx), m.Zid)
+			return nil
+		}
+		if !errors.Is(err, box.ErrNotStreamable) {
+			return err
+		}
+	}
+
+	// The box must store the content as a whole.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return mgr.UpdateZettel(ctx, zettel.Zettel{Meta: m, Content: zettel.NewContent(data)})
+}
+
 // CanDeleteZettel returns true, if box could possibly delete the given zettel.
 func (mgr *Manager) CanDeleteZettel(ctx context.Context, zid id.Zid) bool {
 	if err := mgr.checkContinue(ctx); err != nil {
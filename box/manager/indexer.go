@@ -15,10 +15,14 @@ package manager
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"net/url"
 	"time"
+	"unicode/utf8"
 
+	"t73f.de/r/zsc/api"
 	"zettelstore.de/z/box"
 	"zettelstore.de/z/box/manager/store"
 	"zettelstore.de/z/kernel"
@@ -73,6 +77,17 @@ func (mgr *Manager) SearchContains(s string) *id.Set {
 	return found
 }
 
+// SearchReferences returns all zettel that reference one of the given zettel
+// via the given metadata key, or nil if the key is not indexed.
+func (mgr *Manager) SearchReferences(key string, zids *id.Set) *id.Set {
+	found := mgr.idxStore.SearchReferences(key, zids)
+	mgr.idxLog.Debug().Str("key", key).Int("found", int64(found.Length())).Msg("SearchReferences")
+	if msg := mgr.idxLog.Trace(); msg.Enabled() {
+		msg.Str("ids", fmt.Sprint(found)).Msg("IDs")
+	}
+	return found
+}
+
 // idxIndexer runs in the background and updates the index data structures.
 // This is the main service of the idxIndexer.
 func (mgr *Manager) idxIndexer() {
@@ -114,15 +129,9 @@ func (mgr *Manager) idxWorkService(ctx context.Context) {
 			}
 		case arZettel:
 			mgr.idxLog.Debug().Zid(zid).Msg("zettel")
-			zettel, err := mgr.GetZettel(ctx, zid)
-			if err != nil {
-				// Zettel was deleted or is not accessible b/c of other reasons
-				mgr.idxLog.Trace().Zid(zid).Msg("delete")
-				mgr.idxDeleteZettel(ctx, zid)
+			if !mgr.idxUpdateZettelByZid(ctx, zid) {
 				continue
 			}
-			mgr.idxLog.Trace().Zid(zid).Msg("update")
-			mgr.idxUpdateZettel(ctx, zettel)
 			mgr.idxMx.Lock()
 			if lastReload {
 				mgr.idxDurReload = time.Since(start)
@@ -154,23 +163,125 @@ func (mgr *Manager) idxSleepService(timer *time.Timer, timerDuration time.Durati
 	return true
 }
 
+// idxUpdateZettelByZid updates the index data of the zettel with the given
+// identifier. Its content is read as a stream, so that binary content is
+// never held completely in memory. It returns false, if the zettel was
+// removed from the index.
+func (mgr *Manager) idxUpdateZettelByZid(ctx context.Context, zid id.Zid) bool {
+	m, cs, err := mgr.GetZettelStream(ctx, zid)
+	if err != nil {
+		// Zettel was deleted or is not accessible b/c of other reasons
+		mgr.idxLog.Trace().Zid(zid).Msg("delete")
+		mgr.idxDeleteZettel(ctx, zid)
+		return false
+	}
+	defer cs.Close()
+	mgr.idxLog.Trace().Zid(zid).Msg("update")
+
+	var content []byte
+	if mustIndexZettel(m) {
+		if !parser.IsASTParser(m.GetDefault(api.KeySyntax, meta.DefaultSyntax)) {
+			isBinary, errBin := isBinaryStream(cs)
+			if errBin == nil && isBinary {
+				hash, errHash := streamHash(cs)
+				if errHash == nil {
+					mgr.idxUpdateBlob(ctx, m, hash)
+					return true
+				}
+				errBin = errHash
+			}
+			if errBin != nil {
+				mgr.idxLog.Error().Err(errBin).Zid(zid).Msg("Unable to read content")
+				return true
+			}
+		}
+		if content, err = io.ReadAll(cs); err != nil {
+			mgr.idxLog.Error().Err(err).Zid(zid).Msg("Unable to read content")
+			return true
+		}
+	}
+	mgr.idxUpdateZettel(ctx, zettel.Zettel{Meta: m, Content: zettel.NewContent(content)})
+	return true
+}
+
 func (mgr *Manager) idxUpdateZettel(ctx context.Context, zettel zettel.Zettel) {
 	var cData collectData
 	cData.initialize()
-	if mustIndexZettel(zettel.Meta) {
+	m := zettel.Meta
+	zi := store.NewZettelIndex(m)
+	if mustIndexZettel(m) {
 		collectZettelIndexData(parser.ParseZettel(ctx, zettel, "", mgr.rtConfig), &cData)
+		zi.SetContentHash(contentHash(&zettel.Content))
 	}
+	mgr.idxUpdateIndex(ctx, m, zi, &cData)
+}
 
-	m := zettel.Meta
+// idxUpdateBlob updates the index data of a zettel with binary content.
+// Such content is not parsed, only its hash value is stored.
+func (mgr *Manager) idxUpdateBlob(ctx context.Context, m *meta.Meta, hash string) {
+	var cData collectData
+	cData.initialize()
 	zi := store.NewZettelIndex(m)
-	mgr.idxCollectFromMeta(ctx, m, zi, &cData)
-	mgr.idxProcessData(ctx, zi, &cData)
+	zi.SetContentHash(hash)
+	mgr.idxUpdateIndex(ctx, m, zi, &cData)
+}
+
+func (mgr *Manager) idxUpdateIndex(ctx context.Context, m *meta.Meta, zi *store.ZettelIndex, cData *collectData) {
+	mgr.idxCollectFromMeta(ctx, m, zi, cData)
+	mgr.idxProcessData(ctx, zi, cData)
 	toCheck := mgr.idxStore.UpdateReferences(ctx, zi)
 	mgr.idxCheckZettel(toCheck)
 }
 
+// contentHash returns a hash value of the zettel content, to detect zettel
+// with identical content. Empty content is not considered.
+func contentHash(content *zettel.Content) string {
+	if content.Length() == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(content.AsBytes())
+	return string(sum[:])
+}
+
+// streamHash returns the same hash value as contentHash, but reads the
+// content from a stream.
+func streamHash(r io.Reader) (string, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil || n == 0 {
+		return "", err
+	}
+	return string(h.Sum(nil)), nil
+}
+
+// isBinaryStream inspects the beginning of the content to decide whether it
+// is binary. Afterwards, the stream is positioned at its start again.
+func isBinaryStream(cs *box.ContentStream) (bool, error) {
+	var buf [512]byte
+	n, err := io.ReadFull(cs, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	if _, err = cs.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	prefix := buf[:n]
+	if n == len(buf) {
+		// The last rune might be cut in the middle.
+		i := n - 1
+		for i > n-utf8.UTFMax && !utf8.RuneStart(prefix[i]) {
+			i--
+		}
+		if !utf8.FullRune(prefix[i:]) {
+			prefix = prefix[:i]
+		}
+	}
+	return zettel.IsBinary(prefix), nil
+}
+
 func mustIndexZettel(m *meta.Meta) bool {
-	return m.Zid >= id.DefaultHomeZid
+	// Content of an encrypted zettel must not be stored in the index.
+	return m.Zid >= id.DefaultHomeZid && !m.GetBool(meta.KeyEncrypt)
 }
 
 func (mgr *Manager) idxCollectFromMeta(ctx context.Context, m *meta.Meta, zi *store.ZettelIndex, cData *collectData) {
@@ -0,0 +1,65 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package manager
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/zettel"
+)
+
+func TestIsBinaryStream(t *testing.T) {
+	testcases := []struct {
+		data string
+		exp  bool
+	}{
+		{"", false},
+		{"Some text", false},
+		{"\x89PNG\r\n\x1a\n\x00\x00", true},
+		{"%PDF\x00", true},
+		{strings.Repeat("a", 511) + "ä and more", false}, // rune cut by prefix
+		{strings.Repeat("a", 1000) + "\x00", false},      // only the prefix is inspected
+	}
+	for i, tc := range testcases {
+		cs := box.NewContentStream(zettel.NewContent([]byte(tc.data)))
+		got, err := isBinaryStream(cs)
+		if err != nil {
+			t.Errorf("%d: unexpected error %v", i, err)
+			continue
+		}
+		if got != tc.exp {
+			t.Errorf("%d: isBinaryStream should be %v, but got %v", i, tc.exp, got)
+		}
+		if data, _ := io.ReadAll(cs); string(data) != tc.data {
+			t.Errorf("%d: stream was not reset to its start", i)
+		}
+	}
+}
+
+func TestStreamHash(t *testing.T) {
+	content := zettel.NewContent([]byte("\x89PNG\r\n\x1a\n"))
+	hash, err := streamHash(box.NewContentStream(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := contentHash(&content); hash != exp {
+		t.Errorf("hash of stream %x differs from content hash %x", hash, exp)
+	}
+	if hash, _ = streamHash(strings.NewReader("")); hash != "" {
+		t.Errorf("empty content must not have a hash, but got %x", hash)
+	}
+}
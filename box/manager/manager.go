@@ -157,7 +157,7 @@ func New(boxURIs []*url.URL, authManager auth.BaseManager, rtConfig config.Confi
 	mgr.zidMapper = NewZidMapper(mgr)
 
 	cdata := ConnectData{Number: 1, Config: rtConfig, Enricher: mgr, Notify: mgr.infos, Mapper: mgr.zidMapper}
-	boxes := make([]box.ManagedBox, 0, len(boxURIs)+2)
+	boxes := make([]box.ManagedBox, 0, len(boxURIs)+3)
 	for _, uri := range boxURIs {
 		p, err := Connect(uri, authManager, &cdata)
 		if err != nil {
@@ -179,6 +179,16 @@ func New(boxURIs []*url.URL, authManager auth.BaseManager, rtConfig config.Confi
 	}
 	cdata.Number++
 	boxes = append(boxes, constbox, compbox)
+	if create, ok := registry[" audit"]; ok {
+		auditbox, err := create(nil, &cdata)
+		if err != nil {
+			return nil, err
+		}
+		if auditbox != nil {
+			boxes = append(boxes, auditbox)
+			cdata.Number++
+		}
+	}
 	mgr.boxes = boxes
 	return mgr, nil
 }
@@ -38,6 +38,7 @@ type zettelData struct {
 	otherRefs map[string]bidiRefs
 	words     []string // list of words of this zettel
 	urls      []string // list of urls of this zettel
+	hash      string   // hash value of the content
 }
 
 type bidiRefs struct {
@@ -62,6 +63,7 @@ type mapStore struct {
 	dead   map[id.Zid]*id.Set // map dead refs where they occur
 	words  stringRefs
 	urls   stringRefs
+	hashes stringRefs // zettel with a given content hash
 
 	// Stats
 	mxStats sync.Mutex
@@ -77,6 +79,7 @@ func New() store.Store {
 		dead:   make(map[id.Zid]*id.Set),
 		words:  make(stringRefs),
 		urls:   make(stringRefs),
+		hashes: make(stringRefs),
 	}
 }
 
@@ -90,6 +93,15 @@ func (ms *mapStore) GetMeta(_ context.Context, zid id.Zid) (*meta.Meta, error) {
 	return nil, box.ErrZettelNotFound{Zid: zid}
 }
 
+func (ms *mapStore) GetWords(_ context.Context, zid id.Zid) ([]string, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	if zi, found := ms.idx[zid]; found && zi.meta != nil {
+		return slices.Clone(zi.words), nil
+	}
+	return nil, box.ErrZettelNotFound{Zid: zid}
+}
+
 func (ms *mapStore) Enrich(_ context.Context, m *meta.Meta) {
 	if ms.doEnrich(m) {
 		ms.mxStats.Lock()
@@ -131,6 +143,10 @@ func (ms *mapStore) doEnrich(m *meta.Meta) bool {
 		m.Set(api.KeyBack, back.MetaString())
 		updated = true
 	}
+	if dups := ms.hashes[zi.hash]; zi.hash != "" && dups.Length() > 1 {
+		m.Set(meta.KeyDuplicates, dups.Clone().Remove(m.Zid).MetaString())
+		updated = true
+	}
 	return updated
 }
 
@@ -235,6 +251,51 @@ func (ms *mapStore) SearchContains(s string) *id.Set {
 	return result
 }
 
+// SearchReferences returns all zettel that reference one of the given zettel
+// via the given metadata key. It returns nil, if the key is not indexed.
+func (ms *mapStore) SearchReferences(key string, zids *id.Set) *id.Set {
+	refsOf := referencesFunc(key)
+	if refsOf == nil {
+		return nil
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	result := id.NewSet()
+	zids.ForEach(func(zid id.Zid) {
+		if zi, found := ms.idx[zid]; found {
+			result = result.IUnion(refsOf(zi))
+		}
+	})
+	return result
+}
+
+// referencesFunc returns a function that retrieves the zettel referencing a
+// given zettel via the key. The function may return more zettel, e.g. for
+// api.KeyBack, because a zettel might be linked in both directions.
+func referencesFunc(key string) func(*zettelData) *id.Set {
+	switch key {
+	case api.KeyForward:
+		return func(zi *zettelData) *id.Set { return zi.backward }
+	case api.KeyBackward, api.KeyBack:
+		return func(zi *zettelData) *id.Set { return zi.forward }
+	}
+	if inverse := meta.Inverse(key); inverse != "" {
+		// The referencing zettel stored a reference that is inverse to key.
+		return func(zi *zettelData) *id.Set { return zi.otherRefs[inverse].backward }
+	}
+	if !meta.IsComputed(key) {
+		// References without an inverse key are stored as ordinary references.
+		return func(zi *zettelData) *id.Set { return zi.backward }
+	}
+	for _, kd := range meta.GetSortedKeyDescriptions() {
+		if kd.Inverse == key {
+			// Key is computed from the references of the referenced zettel.
+			return func(zi *zettelData) *id.Set { return zi.otherRefs[key].forward }
+		}
+	}
+	return nil
+}
+
 func (ms *mapStore) selectWithPred(s string, pred func(string, string) bool) *id.Set {
 	// Must only be called if ms.mx is read-locked!
 	result := id.NewSet()
@@ -307,6 +368,7 @@ func (ms *mapStore) UpdateReferences(_ context.Context, zidx *store.ZettelIndex)
 	toCheck = toCheck.IUnion(ids)
 	zi.words = updateStrings(zidx.Zid, ms.words, zi.words, zidx.GetWords())
 	zi.urls = updateStrings(zidx.Zid, ms.urls, zi.urls, zidx.GetUrls())
+	zi.hash = ms.updateHash(zidx.Zid, zi.hash, zidx.GetContentHash())
 
 	// Check if zi must be inserted into ms.idx
 	if !ziExist {
@@ -447,6 +509,20 @@ func updateStrings(zid id.Zid, srefs stringRefs, prev []string, next store.WordS
 	return next.Words()
 }
 
+func (ms *mapStore) updateHash(zid id.Zid, prev, next string) string {
+	// Must only be called if ms.mx is write-locked!
+	if prev == next {
+		return next
+	}
+	if prev != "" {
+		deleteStrings(ms.hashes, []string{prev}, zid)
+	}
+	if next != "" {
+		ms.hashes[next] = ms.hashes[next].Add(zid)
+	}
+	return next
+}
+
 func (ms *mapStore) getOrCreateEntry(zid id.Zid) *zettelData {
 	// Must only be called if ms.mx is write-locked!
 	if zi, ok := ms.idx[zid]; ok {
@@ -477,6 +553,9 @@ func (ms *mapStore) doDeleteZettel(zid id.Zid) *id.Set {
 	}
 	deleteStrings(ms.words, zi.words, zid)
 	deleteStrings(ms.urls, zi.urls, zid)
+	if zi.hash != "" {
+		deleteStrings(ms.hashes, []string{zi.hash}, zid)
+	}
 	delete(ms.idx, zid)
 	return toCheck
 }
@@ -620,6 +699,9 @@ func (ms *mapStore) dumpIndex(w io.Writer) {
 		}
 		dumpStrings(w, "* Words", "", "", zi.words)
 		dumpStrings(w, "* URLs", "[[", "]]", zi.urls)
+		if zi.hash != "" {
+			fmt.Fprintf(w, "* Hash %x\n", zi.hash)
+		}
 	}
 }
 
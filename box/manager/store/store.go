@@ -46,6 +46,13 @@ type Store interface {
 	// GetMeta returns the metadata of the zettel with the given identifier.
 	GetMeta(context.Context, id.Zid) (*meta.Meta, error)
 
+	// GetWords returns the words of the zettel with the given identifier.
+	GetWords(context.Context, id.Zid) ([]string, error)
+
+	// SearchReferences returns all zettel that reference one of the given
+	// zettel via the given metadata key, or nil if the key is not indexed.
+	SearchReferences(key string, zids *id.Set) *id.Set
+
 	// Entrich metadata with data from store.
 	Enrich(ctx context.Context, m *meta.Meta)
 
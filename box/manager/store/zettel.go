@@ -27,6 +27,7 @@ type ZettelIndex struct {
 	deadrefs    *id.Set            // set of dead references
 	words       WordSet
 	urls        WordSet
+	hash        string // hash value of the content, empty if content is not indexed
 }
 
 // NewZettelIndex creates a new zettel index.
@@ -65,6 +66,9 @@ func (zi *ZettelIndex) SetWords(words WordSet) { zi.words = words }
 // SetUrls sets the words to the given value.
 func (zi *ZettelIndex) SetUrls(urls WordSet) { zi.urls = urls }
 
+// SetContentHash sets the hash value of the zettel content.
+func (zi *ZettelIndex) SetContentHash(hash string) { zi.hash = hash }
+
 // GetDeadRefs returns all dead references as a sorted list.
 func (zi *ZettelIndex) GetDeadRefs() *id.Set { return zi.deadrefs }
 
@@ -91,3 +95,6 @@ func (zi *ZettelIndex) GetWords() WordSet { return zi.words }
 
 // GetUrls returns a reference to the set of URLs. It must not be modified.
 func (zi *ZettelIndex) GetUrls() WordSet { return zi.urls }
+
+// GetContentHash returns the hash value of the zettel content.
+func (zi *ZettelIndex) GetContentHash() string { return zi.hash }
@@ -314,7 +314,7 @@ func matchValidFileName(name string) []string {
 }
 
 func seekZid(name string) id.Zid {
-	match := matchValidFileName(name)
+	match := matchValidFileName(filepath.Base(name))
 	if len(match) == 0 {
 		return id.Invalid
 	}
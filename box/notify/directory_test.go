@@ -40,6 +40,8 @@ func TestSeekZid(t *testing.T) {
 		{"12345678901234 abc.ext", id.Zid(12345678901234)},
 		{"12345678901234.abc.ext", id.Zid(12345678901234)},
 		{"12345678901234 def", id.Zid(12345678901234)},
+		{"2024/01/12345678901234.ext", id.Zid(12345678901234)},
+		{"12345678901234/abc.ext", id.Invalid},
 	}
 	for _, tc := range testcases {
 		gotZid := seekZid(tc.name)
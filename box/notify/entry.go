@@ -83,6 +83,36 @@ func (e *DirEntry) SetupFromMetaContent(m *meta.Meta, content zettel.Content, ge
 	}
 }
 
+// SetupFromMetaStream fills entry data based on metadata, if the content is
+// given as a stream and must be stored in a file of its own. It returns
+// false, if metadata and content would be stored in the same file.
+func (e *DirEntry) SetupFromMetaStream(m *meta.Meta, getZettelFileSyntax func() []string) bool {
+	if e.Zid != m.Zid {
+		panic("Zid differ")
+	}
+	if contentName := e.ContentName; contentName != "" {
+		if extIsMetaAndContent(e.ContentExt) {
+			return false
+		}
+		if e.MetaName == "" {
+			e.MetaName = e.calcBaseName(contentName)
+		}
+		return true
+	}
+
+	syntax := m.GetDefault(api.KeySyntax, meta.DefaultSyntax)
+	ext := calcContentExt(syntax, m.YamlSep, getZettelFileSyntax)
+	if extIsMetaAndContent(ext) {
+		return false
+	}
+	e.ContentName = e.calcBaseName(e.MetaName) + "." + ext
+	e.ContentExt = ext
+	if e.MetaName == "" {
+		e.MetaName = e.calcBaseName(e.ContentName)
+	}
+	return true
+}
+
 func contentExtWithMeta(syntax string, content zettel.Content) string {
 	p := parser.Get(syntax)
 	if content.IsBinary() {
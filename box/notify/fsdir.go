@@ -14,6 +14,7 @@
 package notify
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -23,19 +24,22 @@ import (
 )
 
 type fsdirNotifier struct {
-	log     *logger.Logger
-	events  chan Event
-	done    chan struct{}
-	refresh chan struct{}
-	base    *fsnotify.Watcher
-	path    string
-	fetcher EntryFetcher
-	parent  string
+	log       *logger.Logger
+	events    chan Event
+	done      chan struct{}
+	refresh   chan struct{}
+	base      *fsnotify.Watcher
+	path      string
+	fetcher   EntryFetcher
+	parent    string
+	recursive bool
+	subDirs   map[string]struct{} // Watched sub-directories, if recursive
 }
 
 // NewFSDirNotifier creates a directory based notifier that receives notifications
-// from the file system.
-func NewFSDirNotifier(log *logger.Logger, path string) (Notifier, error) {
+// from the file system. If recursive is true, all files of all sub-directories
+// are included.
+func NewFSDirNotifier(log *logger.Logger, path string, recursive bool) (Notifier, error) {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		log.Debug().Err(err).Str("path", path).Msg("Unable to create absolute path")
@@ -68,14 +72,16 @@ func NewFSDirNotifier(log *logger.Logger, path string) (Notifier, error) {
 	}
 
 	fsdn := &fsdirNotifier{
-		log:     log,
-		events:  make(chan Event),
-		refresh: make(chan struct{}),
-		done:    make(chan struct{}),
-		base:    watcher,
-		path:    absPath,
-		fetcher: newDirPathFetcher(absPath),
-		parent:  absParentDir,
+		log:       log,
+		events:    make(chan Event),
+		refresh:   make(chan struct{}),
+		done:      make(chan struct{}),
+		base:      watcher,
+		path:      absPath,
+		fetcher:   newDirPathFetcher(absPath, recursive),
+		parent:    absParentDir,
+		recursive: recursive,
+		subDirs:   map[string]struct{}{},
 	}
 	go fsdn.eventLoop()
 	return fsdn, nil
@@ -93,6 +99,7 @@ func (fsdn *fsdirNotifier) eventLoop() {
 	defer fsdn.base.Close()
 	defer close(fsdn.events)
 	defer close(fsdn.refresh)
+	fsdn.watchSubDirs(fsdn.path)
 	if !listDirElements(fsdn.log, fsdn.fetcher, fsdn.events, fsdn.done) {
 		return
 	}
@@ -143,16 +150,82 @@ func (fsdn *fsdirNotifier) traceDone(pos int64) {
 }
 
 func (fsdn *fsdirNotifier) processEvent(ev *fsnotify.Event) bool {
-	if strings.HasPrefix(ev.Name, fsdn.path) {
-		if len(ev.Name) == len(fsdn.path) {
-			return fsdn.processDirEvent(ev)
-		}
-		return fsdn.processFileEvent(ev)
+	if ev.Name == fsdn.path {
+		return fsdn.processDirEvent(ev)
+	}
+	if name, found := fsdn.relativeName(ev.Name); found {
+		return fsdn.processFileEvent(ev, name)
 	}
 	fsdn.log.Trace().Str("path", fsdn.path).Str("name", ev.Name).Str("op", ev.Op.String()).Msg("event does not match")
 	return true
 }
 
+// relativeName returns the name of a file relative to the zettel directory,
+// if the file belongs to the directory.
+func (fsdn *fsdirNotifier) relativeName(path string) (string, bool) {
+	name, found := strings.CutPrefix(path, fsdn.path+string(filepath.Separator))
+	if !found || name == "" {
+		return "", false
+	}
+	if strings.ContainsRune(name, filepath.Separator) && !fsdn.recursive {
+		return "", false
+	}
+	return name, true
+}
+
+// watchSubDirs adds a watch for all sub-directories of the given directory,
+// if files of sub-directories are included.
+func (fsdn *fsdirNotifier) watchSubDirs(dirPath string) {
+	if !fsdn.recursive {
+		return
+	}
+	filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() || path == fsdn.path {
+			return nil
+		}
+		if isHiddenDir(entry.Name()) {
+			return filepath.SkipDir
+		}
+		if errAdd := fsdn.base.Add(path); errAdd != nil {
+			fsdn.log.Error().Err(errAdd).Str("name", path).Msg("Unable to watch sub-directory")
+			return nil
+		}
+		fsdn.subDirs[path] = struct{}{}
+		return nil
+	})
+}
+
+// processSubDirEvent handles a created or removed sub-directory. The first
+// result is false, if no sub-directory is involved. The second result is
+// false, if processing must stop.
+func (fsdn *fsdirNotifier) processSubDirEvent(ev *fsnotify.Event) (bool, bool) {
+	if !fsdn.recursive {
+		return false, true
+	}
+	if ev.Has(fsnotify.Create) {
+		if fi, err := os.Lstat(ev.Name); err != nil || !fi.IsDir() || isHiddenDir(fi.Name()) {
+			return false, true
+		}
+		fsdn.log.Debug().Str("name", ev.Name).Msg("Sub-directory added")
+	} else if _, found := fsdn.subDirs[ev.Name]; found && (ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename)) {
+		fsdn.log.Debug().Str("name", ev.Name).Msg("Sub-directory removed")
+		for path := range fsdn.subDirs {
+			if path == ev.Name || strings.HasPrefix(path, ev.Name+string(filepath.Separator)) {
+				fsdn.base.Remove(path)
+				delete(fsdn.subDirs, path)
+			}
+		}
+	} else {
+		return false, true
+	}
+
+	// Files may have been moved together with the sub-directory, or they were
+	// created before the sub-directory was watched. Therefore, all files are
+	// listed again.
+	fsdn.watchSubDirs(ev.Name)
+	return true, listDirElements(fsdn.log, fsdn.fetcher, fsdn.events, fsdn.done)
+}
+
 func (fsdn *fsdirNotifier) processDirEvent(ev *fsnotify.Event) bool {
 	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
 		fsdn.log.Debug().Str("name", fsdn.path).Msg("Directory removed")
@@ -178,6 +251,7 @@ func (fsdn *fsdirNotifier) processDirEvent(ev *fsnotify.Event) bool {
 			}
 		}
 		fsdn.log.Debug().Str("name", fsdn.path).Msg("Directory added")
+		fsdn.watchSubDirs(fsdn.path)
 		return listDirElements(fsdn.log, fsdn.fetcher, fsdn.events, fsdn.done)
 	}
 
@@ -185,7 +259,10 @@ func (fsdn *fsdirNotifier) processDirEvent(ev *fsnotify.Event) bool {
 	return true
 }
 
-func (fsdn *fsdirNotifier) processFileEvent(ev *fsnotify.Event) bool {
+func (fsdn *fsdirNotifier) processFileEvent(ev *fsnotify.Event, name string) bool {
+	if isSubDir, ok := fsdn.processSubDirEvent(ev); isSubDir {
+		return ok
+	}
 	if ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write) {
 		if fi, err := os.Lstat(ev.Name); err != nil || !fi.Mode().IsRegular() {
 			regular := err == nil && fi.Mode().IsRegular()
@@ -193,18 +270,18 @@ func (fsdn *fsdirNotifier) processFileEvent(ev *fsnotify.Event) bool {
 			return true
 		}
 		fsdn.log.Trace().Str("name", ev.Name).Str("op", ev.Op.String()).Msg("File updated")
-		return fsdn.sendEvent(Update, filepath.Base(ev.Name))
+		return fsdn.sendEvent(Update, name)
 	}
 
 	if ev.Has(fsnotify.Rename) {
 		fi, err := os.Lstat(ev.Name)
 		if err != nil {
 			fsdn.log.Trace().Str("name", ev.Name).Str("op", ev.Op.String()).Msg("File deleted")
-			return fsdn.sendEvent(Delete, filepath.Base(ev.Name))
+			return fsdn.sendEvent(Delete, name)
 		}
 		if fi.Mode().IsRegular() {
 			fsdn.log.Trace().Str("name", ev.Name).Str("op", ev.Op.String()).Msg("File updated")
-			return fsdn.sendEvent(Update, filepath.Base(ev.Name))
+			return fsdn.sendEvent(Update, name)
 		}
 		fsdn.log.Trace().Str("name", ev.Name).Msg("File not regular")
 		return true
@@ -212,7 +289,7 @@ func (fsdn *fsdirNotifier) processFileEvent(ev *fsnotify.Event) bool {
 
 	if ev.Has(fsnotify.Remove) {
 		fsdn.log.Trace().Str("name", ev.Name).Str("op", ev.Op.String()).Msg("File deleted")
-		return fsdn.sendEvent(Delete, filepath.Base(ev.Name))
+		return fsdn.sendEvent(Delete, name)
 	}
 
 	fsdn.log.Trace().Str("name", ev.Name).Str("op", ev.Op.String()).Msg("File processed")
@@ -15,7 +15,10 @@ package notify
 
 import (
 	"archive/zip"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"zettelstore.de/z/logger"
 )
@@ -26,12 +29,18 @@ type EntryFetcher interface {
 }
 
 type dirPathFetcher struct {
-	dirPath string
+	dirPath   string
+	recursive bool
 }
 
-func newDirPathFetcher(dirPath string) EntryFetcher { return &dirPathFetcher{dirPath} }
+func newDirPathFetcher(dirPath string, recursive bool) EntryFetcher {
+	return &dirPathFetcher{dirPath, recursive}
+}
 
 func (dpf *dirPathFetcher) Fetch() ([]string, error) {
+	if dpf.recursive {
+		return fetchDirRecursive(dpf.dirPath)
+	}
 	entries, err := os.ReadDir(dpf.dirPath)
 	if err != nil {
 		return nil, err
@@ -46,6 +55,41 @@ func (dpf *dirPathFetcher) Fetch() ([]string, error) {
 	return result, nil
 }
 
+// fetchDirRecursive returns the names of all files within the directory and
+// its sub-directories, relative to the directory. Hidden sub-directories, e.g.
+// ".git", are ignored.
+func fetchDirRecursive(dirPath string) ([]string, error) {
+	var result []string
+	err := filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dirPath {
+				return err
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if path != dirPath && isHiddenDir(entry.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		result = append(result, name)
+		return nil
+	})
+	return result, err
+}
+
+// isHiddenDir returns true, if the given directory name must not be scanned for
+// zettel files.
+func isHiddenDir(name string) bool { return strings.HasPrefix(name, ".") }
+
 type zipPathFetcher struct {
 	zipPath string
 }
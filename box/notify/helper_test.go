@@ -0,0 +1,59 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFetchDirRecursive(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"12345678901234.zettel",
+		filepath.Join("2024", "20240101000000.zettel"),
+		filepath.Join("2024", "01", "20240102000000.png"),
+		filepath.Join("2024", "01", "20240102000000"),
+		filepath.Join(".git", "HEAD"),
+	}
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flat, err := newDirPathFetcher(dir, false).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"12345678901234.zettel"}; !slices.Equal(flat, exp) {
+		t.Errorf("flat: expected %q, but got %q", exp, flat)
+	}
+
+	all, err := newDirPathFetcher(dir, true).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(all)
+	exp := []string{files[0], files[3], files[2], files[1]}
+	if !slices.Equal(all, exp) {
+		t.Errorf("recursive: expected %q, but got %q", exp, all)
+	}
+}
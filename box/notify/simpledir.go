@@ -28,8 +28,9 @@ type simpleDirNotifier struct {
 }
 
 // NewSimpleDirNotifier creates a directory based notifier that will not receive
-// any notifications from the operating system.
-func NewSimpleDirNotifier(log *logger.Logger, path string) (Notifier, error) {
+// any notifications from the operating system. If recursive is true, all files
+// of all sub-directories are included.
+func NewSimpleDirNotifier(log *logger.Logger, path string, recursive bool) (Notifier, error) {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return nil, err
@@ -39,7 +40,7 @@ func NewSimpleDirNotifier(log *logger.Logger, path string) (Notifier, error) {
 		events:  make(chan Event),
 		done:    make(chan struct{}),
 		refresh: make(chan struct{}),
-		fetcher: newDirPathFetcher(absPath),
+		fetcher: newDirPathFetcher(absPath, recursive),
 	}
 	go sdn.eventLoop()
 	return sdn, nil
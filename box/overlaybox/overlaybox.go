@@ -0,0 +1,280 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+// Package overlaybox provides a box that layers a writable box over read-only
+// boxes. Changed zettel of the read-only boxes are stored as shadow copies in
+// the writable box.
+package overlaybox
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/manager"
+	"zettelstore.de/z/kernel"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func init() {
+	manager.Register("overlay", func(u *url.URL, cdata *manager.ConnectData) (box.ManagedBox, error) {
+		q := u.Query()
+		uppers, lowers := q["upper"], q["lower"]
+		if len(uppers) != 1 {
+			return nil, errors.New("overlay box needs exactly one upper box: " + u.String())
+		}
+		if len(lowers) == 0 {
+			return nil, errors.New("overlay box needs at least one lower box: " + u.String())
+		}
+		upper, err := connect(uppers[0], box.GetQueryBool(u, "readonly"), cdata)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := upper.(box.WriteBox); !ok {
+			return nil, errors.New("upper box is not writable: " + uppers[0])
+		}
+		boxes := []box.ManagedBox{upper}
+		for _, lower := range lowers {
+			p, err2 := connect(lower, true, cdata)
+			if err2 != nil {
+				return nil, err2
+			}
+			boxes = append(boxes, p)
+		}
+		return &overlayBox{
+			log: kernel.Main.GetLogger(kernel.BoxService).Clone().
+				Str("box", "overlay").Int("boxnum", int64(cdata.Number)).Child(),
+			location: u.String(),
+			cdata:    *cdata,
+			boxes:    boxes,
+		}, nil
+	})
+}
+
+// connect returns the box specified by the given box URI. All layered boxes
+// share the number of the overlay box.
+func connect(val string, readonly bool, cdata *manager.ConnectData) (box.ManagedBox, error) {
+	u, err := url.Parse(val)
+	if err != nil {
+		return nil, err
+	}
+	return manager.Connect(u, readonlyManager(readonly), cdata)
+}
+
+// readonlyManager forces a layered box to be read-only, if needed.
+type readonlyManager bool
+
+func (rm readonlyManager) IsReadonly() bool { return bool(rm) }
+
+// overlayBox layers the upper box over the lower boxes. Like the box manager,
+// the first box that contains a zettel wins. All changes are stored in the
+// upper box. Therefore, a changed zettel of a lower box becomes a shadow copy
+// in the upper box. If the shadow copy is deleted, the zettel is reset to its
+// original version.
+type overlayBox struct {
+	log      *logger.Logger
+	location string
+	cdata    manager.ConnectData
+	boxes    []box.ManagedBox // The upper box, followed by the lower boxes
+}
+
+func (ob *overlayBox) notifyChanged(zid id.Zid, reason box.UpdateReason) {
+	if chci := ob.cdata.Notify; chci != nil {
+		ob.log.Trace().Zid(zid).Uint("reason", uint64(reason)).Msg("notifyChanged")
+		chci <- box.UpdateInfo{Box: ob, Reason: reason, Zid: zid}
+	}
+}
+
+func (ob *overlayBox) upper() box.WriteBox { return ob.boxes[0].(box.WriteBox) }
+
+func (ob *overlayBox) Location() string { return ob.location }
+
+func (ob *overlayBox) State() box.StartState {
+	for _, p := range ob.boxes {
+		if ss, ok := p.(box.StartStopper); ok {
+			if state := ss.State(); state != box.StartStateStarted {
+				return state
+			}
+		}
+	}
+	return box.StartStateStarted
+}
+
+func (ob *overlayBox) Start(ctx context.Context) error {
+	for i := len(ob.boxes) - 1; i >= 0; i-- {
+		ss, ok := ob.boxes[i].(box.StartStopper)
+		if !ok {
+			continue
+		}
+		if err := ss.Start(ctx); err != nil {
+			for _, p := range ob.boxes[i+1:] {
+				if ss2, ok2 := p.(box.StartStopper); ok2 {
+					ss2.Stop(ctx)
+				}
+			}
+			return err
+		}
+	}
+	ob.log.Trace().Int("boxes", int64(len(ob.boxes))).Msg("Start Box")
+	return nil
+}
+
+func (ob *overlayBox) Refresh(ctx context.Context) {
+	for _, p := range ob.boxes {
+		if rb, ok := p.(box.Refresher); ok {
+			rb.Refresh(ctx)
+		}
+	}
+	ob.log.Trace().Msg("Refresh")
+}
+
+func (ob *overlayBox) Stop(ctx context.Context) {
+	for _, p := range ob.boxes {
+		if ss, ok := p.(box.StartStopper); ok {
+			ss.Stop(ctx)
+		}
+	}
+}
+
+func (ob *overlayBox) CanCreateZettel(ctx context.Context) bool {
+	return ob.upper().CanCreateZettel(ctx)
+}
+
+func (ob *overlayBox) CreateZettel(ctx context.Context, zettel zettel.Zettel) (id.Zid, error) {
+	zid, err := ob.upper().CreateZettel(ctx, zettel)
+	ob.log.Trace().Err(err).Zid(zid).Msg("CreateZettel")
+	return zid, err
+}
+
+func (ob *overlayBox) GetZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, error) {
+	for _, p := range ob.boxes {
+		if z, err := p.GetZettel(ctx, zid); !errors.As(err, &box.ErrZettelNotFound{}) {
+			return z, err
+		}
+	}
+	return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+}
+
+func (ob *overlayBox) GetAllZettel(ctx context.Context, zid id.Zid) ([]zettel.Zettel, error) {
+	var result []zettel.Zettel
+	for _, p := range ob.boxes {
+		if ol, ok := p.(box.Overlayer); ok {
+			zs, err := ol.GetAllZettel(ctx, zid)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, zs...)
+		} else if z, err := p.GetZettel(ctx, zid); err == nil {
+			result = append(result, z)
+		}
+	}
+	return result, nil
+}
+
+func (ob *overlayBox) HasZettel(ctx context.Context, zid id.Zid) bool {
+	for _, p := range ob.boxes {
+		if p.HasZettel(ctx, zid) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOriginal returns true, if one of the lower boxes contains the zettel.
+func (ob *overlayBox) hasOriginal(ctx context.Context, zid id.Zid) bool {
+	for _, p := range ob.boxes[1:] {
+		if p.HasZettel(ctx, zid) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ob *overlayBox) ApplyZid(ctx context.Context, handle box.ZidFunc, constraint query.RetrievePredicate) error {
+	seen := id.NewSet()
+	for _, p := range ob.boxes {
+		err := p.ApplyZid(ctx, func(zid id.Zid) {
+			if !seen.Contains(zid) {
+				seen.Add(zid)
+				handle(zid)
+			}
+		}, constraint)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ob *overlayBox) ApplyMeta(ctx context.Context, handle box.MetaFunc, constraint query.RetrievePredicate) error {
+	seen := id.NewSet()
+	for _, p := range ob.boxes {
+		err := p.ApplyMeta(ctx, func(m *meta.Meta) {
+			if !seen.Contains(m.Zid) {
+				seen.Add(m.Zid)
+				handle(m)
+			}
+		}, constraint)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ob *overlayBox) CanUpdateZettel(ctx context.Context, zettel zettel.Zettel) bool {
+	return ob.upper().CanUpdateZettel(ctx, zettel)
+}
+
+func (ob *overlayBox) UpdateZettel(ctx context.Context, zettel zettel.Zettel) error {
+	// If the zettel is stored in a lower box, the upper box stores it as a
+	// new zettel, which shadows the original.
+	err := ob.upper().UpdateZettel(ctx, zettel)
+	ob.log.Trace().Zid(zettel.Meta.Zid).Err(err).Msg("UpdateZettel")
+	return err
+}
+
+func (ob *overlayBox) CanDeleteZettel(ctx context.Context, zid id.Zid) bool {
+	return ob.boxes[0].CanDeleteZettel(ctx, zid)
+}
+
+func (ob *overlayBox) DeleteZettel(ctx context.Context, zid id.Zid) error {
+	err := ob.boxes[0].DeleteZettel(ctx, zid)
+	if err == nil {
+		if ob.hasOriginal(ctx, zid) {
+			// The zettel was reset to its original version.
+			ob.notifyChanged(zid, box.OnZettel)
+		}
+	} else if errors.As(err, &box.ErrZettelNotFound{}) && ob.hasOriginal(ctx, zid) {
+		err = box.ErrReadOnly
+	}
+	ob.log.Trace().Zid(zid).Err(err).Msg("DeleteZettel")
+	return err
+}
+
+func (ob *overlayBox) ReadStats(st *box.ManagedBoxStats) {
+	var upperStats box.ManagedBoxStats
+	ob.boxes[0].ReadStats(&upperStats)
+	st.ReadOnly = upperStats.ReadOnly
+	zids := id.NewSetCap(upperStats.Zettel)
+	for _, p := range ob.boxes {
+		_ = p.ApplyZid(context.Background(), func(zid id.Zid) { zids.Add(zid) }, query.AlwaysIncluded)
+	}
+	st.Zettel = zids.Length()
+	ob.log.Trace().Int("zettel", int64(st.Zettel)).Msg("ReadStats")
+}
@@ -0,0 +1,177 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package overlaybox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// testBox stores zettel in a map. Only writable test boxes can be changed.
+type testBox struct {
+	zettel   map[id.Zid]string
+	writable bool
+}
+
+func newTestBox(writable bool, zids ...id.Zid) *testBox {
+	tb := &testBox{zettel: map[id.Zid]string{}, writable: writable}
+	for _, zid := range zids {
+		tb.zettel[zid] = "original"
+	}
+	return tb
+}
+
+func (*testBox) Location() string { return "test:" }
+
+func (tb *testBox) GetZettel(_ context.Context, zid id.Zid) (zettel.Zettel, error) {
+	if content, found := tb.zettel[zid]; found {
+		return zettel.Zettel{Meta: meta.New(zid), Content: zettel.NewContent([]byte(content))}, nil
+	}
+	return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+}
+
+func (tb *testBox) HasZettel(_ context.Context, zid id.Zid) bool {
+	_, found := tb.zettel[zid]
+	return found
+}
+
+func (tb *testBox) ApplyZid(_ context.Context, handle box.ZidFunc, constraint query.RetrievePredicate) error {
+	for zid := range tb.zettel {
+		if constraint(zid) {
+			handle(zid)
+		}
+	}
+	return nil
+}
+
+func (tb *testBox) ApplyMeta(_ context.Context, handle box.MetaFunc, constraint query.RetrievePredicate) error {
+	for zid, content := range tb.zettel {
+		if constraint(zid) {
+			m := meta.New(zid)
+			m.Set("content", content)
+			handle(m)
+		}
+	}
+	return nil
+}
+
+func (tb *testBox) ReadStats(st *box.ManagedBoxStats) {
+	st.ReadOnly = !tb.writable
+	st.Zettel = len(tb.zettel)
+}
+
+func (tb *testBox) CanCreateZettel(context.Context) bool { return tb.writable }
+
+func (*testBox) CreateZettel(context.Context, zettel.Zettel) (id.Zid, error) {
+	return id.Invalid, box.ErrReadOnly
+}
+
+func (tb *testBox) CanUpdateZettel(context.Context, zettel.Zettel) bool { return tb.writable }
+
+func (tb *testBox) UpdateZettel(_ context.Context, z zettel.Zettel) error {
+	if !tb.writable {
+		return box.ErrReadOnly
+	}
+	tb.zettel[z.Meta.Zid] = z.Content.AsString()
+	return nil
+}
+
+func (tb *testBox) CanDeleteZettel(_ context.Context, zid id.Zid) bool {
+	return tb.writable && tb.HasZettel(context.Background(), zid)
+}
+
+func (tb *testBox) DeleteZettel(_ context.Context, zid id.Zid) error {
+	if !tb.writable {
+		return box.ErrReadOnly
+	}
+	if _, found := tb.zettel[zid]; !found {
+		return box.ErrZettelNotFound{Zid: zid}
+	}
+	delete(tb.zettel, zid)
+	return nil
+}
+
+func getContent(t *testing.T, ob *overlayBox, zid id.Zid) string {
+	t.Helper()
+	z, err := ob.GetZettel(context.Background(), zid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z.Content.AsString()
+}
+
+func TestOverlay(t *testing.T) {
+	ctx := context.Background()
+	upper := newTestBox(true, 3)
+	ob := &overlayBox{boxes: []box.ManagedBox{upper, newTestBox(false, 1, 2), newTestBox(false, 2)}}
+
+	var zids id.Slice
+	if err := ob.ApplyZid(ctx, func(zid id.Zid) { zids = append(zids, zid) }, query.AlwaysIncluded); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(zids)
+	if !slices.Equal(zids, id.Slice{1, 2, 3}) {
+		t.Errorf("expected every zettel once, but got %v", zids)
+	}
+	var st box.ManagedBoxStats
+	if ob.ReadStats(&st); st.Zettel != 3 || st.ReadOnly {
+		t.Errorf("unexpected stats %v", st)
+	}
+
+	if err := ob.DeleteZettel(ctx, 1); !errors.Is(err, box.ErrReadOnly) {
+		t.Errorf("original zettel must not be deleted, but got %v", err)
+	}
+	if !ob.CanUpdateZettel(ctx, zettel.Zettel{Meta: meta.New(1)}) {
+		t.Error("original zettel should be updatable")
+	}
+	err := ob.UpdateZettel(ctx, zettel.Zettel{Meta: meta.New(1), Content: zettel.NewContent([]byte("changed"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := getContent(t, ob, 1); got != "changed" {
+		t.Errorf("expected shadow copy, but got %q", got)
+	}
+	err = ob.ApplyMeta(ctx, func(m *meta.Meta) {
+		if got := m.GetDefault("content", ""); m.Zid == 1 && got != "changed" {
+			t.Errorf("expected metadata of shadow copy, but got %q", got)
+		}
+	}, query.AlwaysIncluded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zs, err2 := ob.GetAllZettel(ctx, 1); err2 != nil || len(zs) != 2 {
+		t.Errorf("expected shadow copy and original, but got %v / %v", zs, err2)
+	}
+
+	if !ob.CanDeleteZettel(ctx, 1) {
+		t.Error("shadow copy should be deletable")
+	}
+	if err = ob.DeleteZettel(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := getContent(t, ob, 1); got != "original" {
+		t.Errorf("expected reset to original, but got %q", got)
+	}
+	if err = ob.DeleteZettel(ctx, 3); err != nil || ob.HasZettel(ctx, 3) {
+		t.Errorf("zettel of upper box should be deleted, but got %v", err)
+	}
+}
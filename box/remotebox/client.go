@@ -0,0 +1,411 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package remotebox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"t73f.de/r/sx"
+	"t73f.de/r/sx/sxreader"
+	"t73f.de/r/zsc/api"
+	"t73f.de/r/zsc/sexp"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// remoteMeta is the metadata of a remote zettel, together with the rights the
+// remote Zettelstore grants to the configured user.
+type remoteMeta struct {
+	meta   *meta.Meta
+	rights api.ZettelRights
+}
+
+// remoteClient performs requests against the API of a remote Zettelstore.
+type remoteClient struct {
+	base     url.URL // Base URL of the remote API, without query and user info
+	username string
+	password string
+	client   *http.Client
+
+	mxToken sync.Mutex // Protects the following fields
+	token   string
+	expires time.Time // Zero, if the lifetime of the token is not known
+}
+
+func newRemoteClient(base url.URL, username, password, token string) *remoteClient {
+	return &remoteClient{
+		base:     base,
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: time.Minute},
+		token:    token,
+	}
+}
+
+// errStatus is returned if the remote Zettelstore answers with an unexpected
+// HTTP status code.
+type errStatus struct {
+	method string
+	url    string
+	code   int
+	msg    string
+}
+
+func (err *errStatus) Error() string {
+	if err.msg == "" {
+		return fmt.Sprintf("remote: %s %s: %d %s", err.method, err.url, err.code, http.StatusText(err.code))
+	}
+	return fmt.Sprintf("remote: %s %s: %d %s", err.method, err.url, err.code, err.msg)
+}
+
+// boxError translates an error of the remote Zettelstore into an error of the
+// box package, if possible.
+func boxError(err error, op string, zid id.Zid) error {
+	if errS, ok := err.(*errStatus); ok {
+		switch errS.code {
+		case http.StatusNotFound:
+			return box.ErrZettelNotFound{Zid: zid}
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return box.NewErrNotAllowed(op, nil, zid)
+		case http.StatusConflict:
+			return box.ErrConflict
+		}
+	}
+	return err
+}
+
+func (rc *remoteClient) makeURL(zid id.Zid, values url.Values) *url.URL {
+	u := rc.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/z"
+	if zid.IsValid() {
+		u.Path += "/" + zid.String()
+	}
+	u.RawQuery = values.Encode()
+	return &u
+}
+
+// do sends a request to the remote Zettelstore. The body of the response must
+// be closed by the caller, if no error is returned.
+func (rc *remoteClient) do(ctx context.Context, method string, u *url.URL, body []byte, withToken bool) (*http.Response, error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), rd)
+	if err != nil {
+		return nil, err
+	}
+	if withToken {
+		rc.mxToken.Lock()
+		token := rc.token
+		rc.mxToken.Unlock()
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if code := resp.StatusCode; code < 200 || 300 <= code {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, &errStatus{
+			method: method,
+			url:    u.Redacted(),
+			code:   code,
+			msg:    strings.TrimSpace(string(msg)),
+		}
+	}
+	return resp, nil
+}
+
+func (rc *remoteClient) doObject(ctx context.Context, method string, u *url.URL, body []byte) (sx.Object, error) {
+	resp, err := rc.do(ctx, method, u, body, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return sxreader.MakeReader(resp.Body).Read()
+}
+
+// updateToken makes sure that a valid token is available for the next
+// requests. A token that expires within the given duration is renewed. If the
+// token cannot be renewed, the user is authenticated again, if credentials
+// were configured.
+func (rc *remoteClient) updateToken(ctx context.Context, within time.Duration) error {
+	rc.mxToken.Lock()
+	token, expires := rc.token, rc.expires
+	rc.mxToken.Unlock()
+
+	u := rc.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/a"
+	if token != "" {
+		if !expires.IsZero() && time.Now().Add(within).Before(expires) {
+			return nil
+		}
+		err := rc.requestToken(ctx, http.MethodPut, &u, true)
+		if err == nil || rc.username == "" {
+			return err
+		}
+	} else if rc.username == "" {
+		return nil
+	}
+	return rc.requestToken(ctx, http.MethodPost, &u, false)
+}
+
+func (rc *remoteClient) requestToken(ctx context.Context, method string, u *url.URL, withToken bool) error {
+	req := u
+	if !withToken {
+		lu := *u
+		lu.User = url.UserPassword(rc.username, rc.password)
+		req = &lu
+	}
+	resp, err := rc.do(ctx, method, req, nil, withToken)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	obj, err := sxreader.MakeReader(resp.Body).Read()
+	if err != nil {
+		return err
+	}
+	vals, err := sexp.ParseList(obj, "ssi")
+	if err != nil {
+		return err
+	}
+	token := vals[1].(sx.String).GetValue()
+	if token == "" {
+		return fmt.Errorf("remote: no token received from %s", u.Redacted())
+	}
+	rc.mxToken.Lock()
+	rc.token = token
+	rc.expires = time.Now().Add(time.Duration(vals[2].(sx.Int64)) * time.Second)
+	rc.mxToken.Unlock()
+	return nil
+}
+
+// queryMeta retrieves the metadata of all remote zettel that satisfy the
+// given query.
+func (rc *remoteClient) queryMeta(ctx context.Context, q string) (map[id.Zid]remoteMeta, error) {
+	values := url.Values{api.QueryKeyEncoding: {api.EncodingData}}
+	if q != "" {
+		values.Set(api.QueryKeyQuery, q)
+	}
+	obj, err := rc.doObject(ctx, http.MethodGet, rc.makeURL(id.Invalid, values), nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseMetaList(obj)
+}
+
+// getMeta retrieves the metadata of a remote zettel.
+func (rc *remoteClient) getMeta(ctx context.Context, zid id.Zid) (remoteMeta, error) {
+	values := url.Values{api.QueryKeyEncoding: {api.EncodingData}, api.QueryKeyPart: {api.PartMeta}}
+	obj, err := rc.doObject(ctx, http.MethodGet, rc.makeURL(zid, values), nil)
+	if err != nil {
+		return remoteMeta{}, boxError(err, "Read", zid)
+	}
+	pair, isPair := sx.GetPair(obj)
+	if !isPair {
+		return remoteMeta{}, fmt.Errorf("remote: metadata expected, but got %v", obj)
+	}
+	rm, err := parseMetaRights(zid, pair)
+	if err == nil && !isUsableMeta(rm.meta) {
+		return remoteMeta{}, box.ErrZettelNotFound{Zid: zid}
+	}
+	return rm, err
+}
+
+// getZettel retrieves a remote zettel.
+func (rc *remoteClient) getZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, error) {
+	values := url.Values{api.QueryKeyEncoding: {api.EncodingData}, api.QueryKeyPart: {api.PartZettel}}
+	obj, err := rc.doObject(ctx, http.MethodGet, rc.makeURL(zid, values), nil)
+	if err != nil {
+		return zettel.Zettel{}, boxError(err, "Read", zid)
+	}
+	zd, err := sexp.ParseZettel(obj)
+	if err != nil {
+		return zettel.Zettel{}, err
+	}
+	m := makeMeta(zid, zd.Meta)
+	if !isUsableMeta(m) {
+		return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+	}
+	var content zettel.Content
+	if err = content.SetDecoded(zd.Content, zd.Encoding); err != nil {
+		return zettel.Zettel{}, err
+	}
+	return zettel.Zettel{Meta: m, Content: content}, nil
+}
+
+// createZettel creates a new zettel at the remote Zettelstore.
+func (rc *remoteClient) createZettel(ctx context.Context, z zettel.Zettel) (id.Zid, error) {
+	values := url.Values{api.QueryKeyEncoding: {api.EncodingData}}
+	obj, err := rc.doObject(ctx, http.MethodPost, rc.makeURL(id.Invalid, values), encodeZettel(z))
+	if err != nil {
+		return id.Invalid, boxError(err, "Create", id.Invalid)
+	}
+	if zid, isInt := obj.(sx.Int64); isInt && id.Zid(zid).IsValid() {
+		return id.Zid(zid), nil
+	}
+	return id.Invalid, fmt.Errorf("remote: zettel identifier expected, but got %v", obj)
+}
+
+// updateZettel updates a zettel at the remote Zettelstore.
+func (rc *remoteClient) updateZettel(ctx context.Context, z zettel.Zettel) error {
+	zid := z.Meta.Zid
+	values := url.Values{api.QueryKeyEncoding: {api.EncodingData}}
+	resp, err := rc.do(ctx, http.MethodPut, rc.makeURL(zid, values), encodeZettel(z), true)
+	if err != nil {
+		return boxError(err, "Write", zid)
+	}
+	return resp.Body.Close()
+}
+
+// deleteZettel removes a zettel from the remote Zettelstore.
+func (rc *remoteClient) deleteZettel(ctx context.Context, zid id.Zid) error {
+	resp, err := rc.do(ctx, http.MethodDelete, rc.makeURL(zid, nil), nil, true)
+	if err != nil {
+		return boxError(err, "Delete", zid)
+	}
+	return resp.Body.Close()
+}
+
+func encodeZettel(z zettel.Zettel) []byte {
+	data, encoding := z.Content.Encode()
+	var buf bytes.Buffer
+	sx.Print(&buf, sexp.EncodeZettel(api.ZettelData{
+		Meta:     z.Meta.Map(),
+		Rights:   api.ZettelCanNone,
+		Encoding: encoding,
+		Content:  data,
+	}))
+	return buf.Bytes()
+}
+
+// parseMetaList parses the result of a query in data encoding:
+//
+//	(meta-list (query "...") (human "...") (list (zettel (id N) (meta ...) (rights N)) ...))
+func parseMetaList(obj sx.Object) (map[id.Zid]remoteMeta, error) {
+	pair, isPair := sx.GetPair(obj)
+	if !isPair || pair == nil {
+		return nil, fmt.Errorf("remote: list of zettel expected, but got %v", obj)
+	}
+	result := map[id.Zid]remoteMeta{}
+	for node := pair.Tail(); node != nil; node = node.Tail() {
+		elem, isElem := sx.GetPair(node.Car())
+		if !isElem || symbolValue(elem.Car()) != "list" {
+			continue
+		}
+		for zn := elem.Tail(); zn != nil; zn = zn.Tail() {
+			zp, isZettel := sx.GetPair(zn.Car())
+			if !isZettel || symbolValue(zp.Car()) != "zettel" {
+				continue
+			}
+			rm, err := parseMetaRights(id.Invalid, zp)
+			if err != nil {
+				return nil, err
+			}
+			if isUsableMeta(rm.meta) {
+				result[rm.meta.Zid] = rm
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseMetaRights parses a list of metadata and rights, possibly together with
+// the zettel identifier.
+func parseMetaRights(zid id.Zid, pair *sx.Pair) (remoteMeta, error) {
+	var zm map[string]string
+	rights := api.ZettelCanNone
+	for node := pair.Tail(); node != nil; node = node.Tail() {
+		elem, isElem := sx.GetPair(node.Car())
+		if !isElem || elem == nil {
+			continue
+		}
+		switch symbolValue(elem.Car()) {
+		case "id":
+			if val, isInt := elem.Tail().Car().(sx.Int64); isInt {
+				zid = id.Zid(val)
+			}
+		case "meta":
+			zm = map[string]string{}
+			for mn := elem.Tail(); mn != nil; mn = mn.Tail() {
+				if kv, isKV := sx.GetPair(mn.Car()); isKV && kv != nil {
+					if val, isString := sx.GetString(kv.Tail().Car()); isString {
+						zm[symbolValue(kv.Car())] = val.GetValue()
+					}
+				}
+			}
+		case "rights":
+			if val, isInt := elem.Tail().Car().(sx.Int64); isInt {
+				rights = api.ZettelRights(val)
+			}
+		}
+	}
+	if !zid.IsValid() || zm == nil {
+		return remoteMeta{}, fmt.Errorf("remote: no zettel identifier or metadata in %v", pair)
+	}
+	return remoteMeta{meta: makeMeta(zid, zm), rights: rights}, nil
+}
+
+func symbolValue(obj sx.Object) string {
+	if sym, isSymbol := obj.(*sx.Symbol); isSymbol {
+		return sym.GetValue()
+	}
+	return ""
+}
+
+// roleUser is the role of a zettel that describes a user.
+const roleUser = "user"
+
+// isUsableMeta returns true, if the remote zettel may be used locally. System
+// zettel and user zettel of the remote Zettelstore are never used, because
+// they would change the configuration and the users of the local one.
+func isUsableMeta(m *meta.Meta) bool {
+	return m.Zid >= id.DefaultHomeZid && !isUserMeta(m)
+}
+
+// isUserMeta returns true, if the metadata describes a user.
+func isUserMeta(m *meta.Meta) bool {
+	if _, found := m.Get(api.KeyUserID); found {
+		return true
+	}
+	return m.GetDefault(api.KeyRole, "") == roleUser
+}
+
+// makeMeta creates the metadata of a remote zettel. Computed metadata is
+// ignored, because it is computed by the local Zettelstore. Credentials are
+// never stored locally.
+func makeMeta(zid id.Zid, zm map[string]string) *meta.Meta {
+	m := meta.New(zid)
+	for k, v := range zm {
+		if k != "" && k != api.KeyCredential && !meta.IsComputed(k) {
+			m.Set(meta.RemoveNonGraphic(k), meta.RemoveNonGraphic(v))
+		}
+	}
+	return m
+}
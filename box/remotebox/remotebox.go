@@ -0,0 +1,410 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+// Package remotebox provides a box that retrieves its zettel from another
+// Zettelstore via its API.
+package remotebox
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/manager"
+	"zettelstore.de/z/kernel"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+)
+
+func init() {
+	manager.Register("remote", func(u *url.URL, cdata *manager.ConnectData) (box.ManagedBox, error) {
+		q := u.Query()
+		base := url.URL{Scheme: "http", Host: u.Host, Path: u.Path}
+		if box.GetQueryBool(u, "tls") {
+			base.Scheme = "https"
+		}
+		var username, password string
+		if user := u.User; user != nil {
+			username = user.Username()
+			password, _ = user.Password()
+		}
+		return &remoteBox{
+			log: kernel.Main.GetLogger(kernel.BoxService).Clone().
+				Str("box", "remote").Int("boxnum", int64(cdata.Number)).Child(),
+			number:   cdata.Number,
+			location: redactLocation(u),
+			readonly: box.GetQueryBool(u, "readonly"),
+			query:    q.Get("query"),
+			refresh:  time.Duration(box.GetQueryInt(u, "refresh", 5, 60, 86400)) * time.Second,
+			cdata:    *cdata,
+			client:   newRemoteClient(base, username, password, q.Get("token")),
+		}, nil
+	})
+}
+
+// redactLocation removes all secrets from the box URI.
+func redactLocation(u *url.URL) string {
+	loc := *u
+	if loc.User != nil {
+		loc.User = url.User(loc.User.Username())
+	}
+	if q := loc.Query(); q.Has("token") {
+		q.Set("token", "xxxxx")
+		loc.RawQuery = q.Encode()
+	}
+	return loc.String()
+}
+
+// remoteBox caches the metadata of the zettel of a remote Zettelstore. The
+// cache is refreshed periodically. Content is always retrieved from the remote
+// Zettelstore.
+type remoteBox struct {
+	log      *logger.Logger
+	number   int
+	location string
+	readonly bool
+	query    string        // Query to select the remote zettel
+	refresh  time.Duration // Time between two refreshes of the cache
+	cdata    manager.ConnectData
+	client   *remoteClient
+
+	mx      sync.RWMutex // Protects the following fields
+	entries map[id.Zid]remoteMeta
+	started bool // The first fill of the cache was attempted
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func (rb *remoteBox) notifyChanged(zid id.Zid, reason box.UpdateReason) {
+	if chci := rb.cdata.Notify; chci != nil {
+		rb.log.Trace().Zid(zid).Uint("reason", uint64(reason)).Msg("notifyChanged")
+		chci <- box.UpdateInfo{Box: rb, Reason: reason, Zid: zid}
+	}
+}
+
+func (rb *remoteBox) Location() string { return rb.location }
+
+func (rb *remoteBox) State() box.StartState {
+	rb.mx.RLock()
+	defer rb.mx.RUnlock()
+	if rb.done == nil {
+		return box.StartStateStopped
+	}
+	if !rb.started {
+		return box.StartStateStarting
+	}
+	return box.StartStateStarted
+}
+
+func (rb *remoteBox) Start(context.Context) error {
+	rb.mx.Lock()
+	if rb.done != nil {
+		rb.mx.Unlock()
+		return box.ErrStarted
+	}
+	rb.entries = map[id.Zid]remoteMeta{}
+	rb.started = false
+	rb.done = make(chan struct{})
+	rb.stopped = make(chan struct{})
+	done, stopped := rb.done, rb.stopped
+	rb.mx.Unlock()
+
+	go rb.poll(done, stopped)
+	rb.log.Trace().Str("query", rb.query).Int("refresh", int64(rb.refresh/time.Second)).Msg("Start Box")
+	return nil
+}
+
+// poll fills the cache, first immediately, then periodically. Filling is done
+// in the background, so that a slow remote Zettelstore does not delay the start
+// of the local one. Until the first fill was attempted, the box reports that it
+// is starting. The first fill does not need to notify observers, because all
+// boxes are indexed after they are started.
+func (rb *remoteBox) poll(done <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := rb.fillCache(ctx, false); err != nil {
+		rb.log.Error().Err(err).Msg("Unable to retrieve remote zettel, will retry")
+	}
+	rb.mx.Lock()
+	rb.started = true
+	rb.mx.Unlock()
+
+	ticker := time.NewTicker(rb.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := rb.fillCache(ctx, true); err != nil {
+				rb.log.Error().Err(err).Msg("Unable to refresh remote zettel")
+			}
+		}
+	}
+}
+
+func (rb *remoteBox) Refresh(ctx context.Context) {
+	if err := rb.fillCache(ctx, true); err != nil {
+		rb.log.Error().Err(err).Msg("Refresh")
+	}
+	rb.log.Trace().Msg("Refresh")
+}
+
+func (rb *remoteBox) Stop(context.Context) {
+	rb.mx.Lock()
+	done, stopped := rb.done, rb.stopped
+	rb.done = nil
+	rb.mx.Unlock()
+	if done != nil {
+		close(done)
+		<-stopped
+	}
+	rb.mx.Lock()
+	rb.entries = nil
+	rb.started = false
+	rb.mx.Unlock()
+}
+
+// fillCache retrieves the metadata of all remote zettel and replaces the
+// cached metadata. If requested, observers are notified about all zettel that
+// were changed, added, or removed since the last fill.
+func (rb *remoteBox) fillCache(ctx context.Context, notify bool) error {
+	if err := rb.client.updateToken(ctx, 2*rb.refresh); err != nil {
+		return err
+	}
+	entries, err := rb.client.queryMeta(ctx, rb.query)
+	if err != nil {
+		return err
+	}
+
+	rb.mx.Lock()
+	if rb.done == nil {
+		rb.mx.Unlock()
+		return box.ErrStopped
+	}
+	var changed, deleted []id.Zid
+	for zid, rm := range entries {
+		if prev, found := rb.entries[zid]; !found || !prev.meta.Equal(rm.meta, false) {
+			changed = append(changed, zid)
+		}
+	}
+	for zid := range rb.entries {
+		if _, found := entries[zid]; !found {
+			deleted = append(deleted, zid)
+		}
+	}
+	rb.entries = entries
+	rb.mx.Unlock()
+
+	rb.log.Trace().Int("entries", int64(len(entries))).Int("changed", int64(len(changed))).Int("deleted", int64(len(deleted))).Msg("fillCache")
+	if notify {
+		for _, zid := range changed {
+			rb.notifyChanged(zid, box.OnZettel)
+		}
+		for _, zid := range deleted {
+			rb.notifyChanged(zid, box.OnDelete)
+		}
+	}
+	return nil
+}
+
+func (rb *remoteBox) getEntry(zid id.Zid) (remoteMeta, bool) {
+	rb.mx.RLock()
+	rm, found := rb.entries[zid]
+	rb.mx.RUnlock()
+	return rm, found
+}
+
+// updateEntry retrieves the current metadata of a remote zettel, after it was
+// created or updated. If the zettel must not be used locally any more, it is
+// removed from the cache.
+func (rb *remoteBox) updateEntry(ctx context.Context, zid id.Zid) {
+	rm, err := rb.client.getMeta(ctx, zid)
+	if err != nil {
+		if _, isNotFound := err.(box.ErrZettelNotFound); !isNotFound {
+			rb.log.Error().Err(err).Zid(zid).Msg("Unable to retrieve changed metadata")
+			return
+		}
+	}
+	rb.mx.Lock()
+	if rb.entries != nil {
+		if err == nil {
+			rb.entries[zid] = rm
+		} else {
+			delete(rb.entries, zid)
+		}
+	}
+	rb.mx.Unlock()
+}
+
+func (rb *remoteBox) CanCreateZettel(context.Context) bool {
+	if rb.readonly {
+		return false
+	}
+	// The remote policy for a new zettel is not known in advance. If the
+	// user may create zettel similar to an existing one, creation is assumed
+	// to be allowed. The remote Zettelstore will reject it otherwise.
+	rb.mx.RLock()
+	defer rb.mx.RUnlock()
+	for _, rm := range rb.entries {
+		if rm.rights&api.ZettelCanCreate != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AssignsZid returns true, because the API does not allow to create a remote
+// zettel with a given identifier.
+func (*remoteBox) AssignsZid() bool { return true }
+
+func (rb *remoteBox) CreateZettel(ctx context.Context, zettel zettel.Zettel) (id.Zid, error) {
+	if rb.readonly {
+		return id.Invalid, box.ErrReadOnly
+	}
+	if isUserMeta(zettel.Meta) {
+		return id.Invalid, box.NewErrNotAllowed("Create", nil, id.Invalid)
+	}
+	zid, err := rb.client.createZettel(ctx, zettel)
+	if err == nil {
+		rb.updateEntry(ctx, zid)
+		rb.notifyChanged(zid, box.OnZettel)
+	}
+	rb.log.Trace().Err(err).Zid(zid).Msg("CreateZettel")
+	return zid, err
+}
+
+func (rb *remoteBox) GetZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, error) {
+	if _, found := rb.getEntry(zid); !found {
+		return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+	}
+	z, err := rb.client.getZettel(ctx, zid)
+	rb.log.Trace().Err(err).Zid(zid).Msg("GetZettel")
+	return z, err
+}
+
+func (rb *remoteBox) HasZettel(_ context.Context, zid id.Zid) bool {
+	_, found := rb.getEntry(zid)
+	return found
+}
+
+func (rb *remoteBox) ApplyZid(_ context.Context, handle box.ZidFunc, constraint query.RetrievePredicate) error {
+	rb.mx.RLock()
+	defer rb.mx.RUnlock()
+	rb.log.Trace().Int("entries", int64(len(rb.entries))).Msg("ApplyZid")
+	for zid := range rb.entries {
+		if constraint(zid) {
+			handle(zid)
+		}
+	}
+	return nil
+}
+
+func (rb *remoteBox) ApplyMeta(ctx context.Context, handle box.MetaFunc, constraint query.RetrievePredicate) error {
+	rb.mx.RLock()
+	defer rb.mx.RUnlock()
+	rb.log.Trace().Int("entries", int64(len(rb.entries))).Msg("ApplyMeta")
+	for zid, rm := range rb.entries {
+		if constraint(zid) {
+			m := rm.meta.Clone()
+			rb.cdata.Enricher.Enrich(ctx, m, rb.number)
+			handle(m)
+		}
+	}
+	return nil
+}
+
+func (rb *remoteBox) CanUpdateZettel(_ context.Context, zettel zettel.Zettel) bool {
+	if rb.readonly {
+		return false
+	}
+	rm, found := rb.getEntry(zettel.Meta.Zid)
+	return found && rm.rights&api.ZettelCanWrite != 0 && !isUserMeta(zettel.Meta)
+}
+
+func (rb *remoteBox) UpdateZettel(ctx context.Context, zettel zettel.Zettel) error {
+	if rb.readonly {
+		return box.ErrReadOnly
+	}
+	zid := zettel.Meta.Zid
+	if !zid.IsValid() {
+		return box.ErrInvalidZid{Zid: zid.String()}
+	}
+	rm, found := rb.getEntry(zid)
+	if !found {
+		// The API does not allow to create a remote zettel with a given identifier.
+		return box.ErrZettelNotFound{Zid: zid}
+	}
+	if rm.rights&api.ZettelCanWrite == 0 || isUserMeta(zettel.Meta) {
+		return box.NewErrNotAllowed("Write", nil, zid)
+	}
+	err := rb.client.updateZettel(ctx, zettel)
+	if err == nil {
+		rb.updateEntry(ctx, zid)
+		rb.notifyChanged(zid, box.OnZettel)
+	}
+	rb.log.Trace().Zid(zid).Err(err).Msg("UpdateZettel")
+	return err
+}
+
+func (rb *remoteBox) CanDeleteZettel(_ context.Context, zid id.Zid) bool {
+	if rb.readonly {
+		return false
+	}
+	rm, found := rb.getEntry(zid)
+	return found && rm.rights&api.ZettelCanDelete != 0
+}
+
+func (rb *remoteBox) DeleteZettel(ctx context.Context, zid id.Zid) error {
+	if rb.readonly {
+		return box.ErrReadOnly
+	}
+	rm, found := rb.getEntry(zid)
+	if !found {
+		return box.ErrZettelNotFound{Zid: zid}
+	}
+	if rm.rights&api.ZettelCanDelete == 0 {
+		return box.NewErrNotAllowed("Delete", nil, zid)
+	}
+	err := rb.client.deleteZettel(ctx, zid)
+	if err == nil {
+		rb.mx.Lock()
+		delete(rb.entries, zid)
+		rb.mx.Unlock()
+		rb.notifyChanged(zid, box.OnDelete)
+	}
+	rb.log.Trace().Zid(zid).Err(err).Msg("DeleteZettel")
+	return err
+}
+
+func (rb *remoteBox) ReadStats(st *box.ManagedBoxStats) {
+	st.ReadOnly = rb.readonly
+	rb.mx.RLock()
+	st.Zettel = len(rb.entries)
+	rb.mx.RUnlock()
+	rb.log.Trace().Int("zettel", int64(st.Zettel)).Msg("ReadStats")
+}
@@ -0,0 +1,336 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package s3box
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// s3Client performs requests against an S3-compatible object storage. Only
+// path-style requests are supported, i.e. the bucket is the first component
+// of the URL path. Requests are signed with AWS signature version 4, if an
+// access key is given.
+type s3Client struct {
+	endpoint  url.URL // Scheme and host of the object storage
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func newS3Client(endpoint url.URL, bucket, region, accessKey, secretKey string) *s3Client {
+	return &s3Client{
+		endpoint:  endpoint,
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: time.Minute},
+	}
+}
+
+// errStatus is returned if the object storage answers with an unexpected
+// HTTP status code.
+type errStatus struct {
+	method string
+	key    string
+	code   int
+	msg    string
+}
+
+func (err *errStatus) Error() string {
+	return fmt.Sprintf("s3: %s %q: %d %s", err.method, err.key, err.code, err.msg)
+}
+
+// statusCode returns the HTTP status code of an errStatus, or zero.
+func statusCode(err error) int {
+	if errS, ok := err.(*errStatus); ok {
+		return errS.code
+	}
+	return 0
+}
+
+// do sends a request to the object storage. The body of the response must be
+// closed by the caller, if no error is returned.
+func (sc *s3Client) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := sc.endpoint
+	u.Path = "/" + sc.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = encodePath(u.Path)
+	u.RawQuery = encodeQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = int64(len(body))
+	}
+	if sc.accessKey != "" {
+		sc.sign(req, body, time.Now().UTC())
+	}
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if code := resp.StatusCode; code < 200 || code > 299 {
+		defer resp.Body.Close()
+		var errResp struct {
+			Code    string
+			Message string
+		}
+		msg := http.StatusText(code)
+		if data, err1 := io.ReadAll(resp.Body); err1 == nil && xml.Unmarshal(data, &errResp) == nil && errResp.Code != "" {
+			msg = errResp.Code + ": " + errResp.Message
+		}
+		return nil, &errStatus{method: method, key: key, code: code, msg: msg}
+	}
+	return resp, nil
+}
+
+// ---------- Signature version 4 --------------------------------------------
+
+const (
+	amzDateFormat    = "20060102T150405Z"
+	amzDayFormat     = "20060102"
+	amzAlgorithm     = "AWS4-HMAC-SHA256"
+	amzService       = "s3"
+	amzTerminator    = "aws4_request"
+	hdrContentHash   = "X-Amz-Content-Sha256"
+	hdrDate          = "X-Amz-Date"
+	hdrAuthorization = "Authorization"
+)
+
+// sign adds the headers of an AWS signature version 4 to the request.
+func (sc *s3Client) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set(hdrContentHash, hex.EncodeToString(payloadHash[:]))
+	req.Header.Set(hdrDate, now.Format(amzDateFormat))
+
+	signedHeaders, canonicalHeaders := canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		req.Header.Get(hdrContentHash),
+	}, "\n")
+
+	day := now.Format(amzDayFormat)
+	scope := strings.Join([]string{day, sc.region, amzService, amzTerminator}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		amzAlgorithm,
+		req.Header.Get(hdrDate),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+sc.secretKey), day)
+	key = hmacSHA256(key, sc.region)
+	key = hmacSHA256(key, amzService)
+	key = hmacSHA256(key, amzTerminator)
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set(hdrAuthorization, fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		amzAlgorithm, sc.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalHeaders returns the list of signed headers and their canonical
+// form. The host header and all headers starting with "X-Amz-" are signed.
+func canonicalHeaders(req *http.Request) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteByte(':')
+		sb.WriteString(headers[name])
+		sb.WriteByte('\n')
+	}
+	return strings.Join(names, ";"), sb.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// encodePath encodes a path as required by signature version 4: every byte
+// except the unreserved characters and the slash is percent-encoded.
+func encodePath(path string) string {
+	var sb strings.Builder
+	for i := range len(path) {
+		if ch := path[i]; ch == '/' || isUnreserved(ch) {
+			sb.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", ch)
+		}
+	}
+	return sb.String()
+}
+
+// encodeQuery encodes the query as required by signature version 4: sorted
+// by key, every byte except the unreserved characters is percent-encoded.
+func encodeQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, encodeComponent(k)+"="+encodeComponent(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func encodeComponent(s string) string {
+	return strings.ReplaceAll(encodePath(s), "/", "%2F")
+}
+
+func isUnreserved(ch byte) bool {
+	return ('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') ||
+		ch == '-' || ch == '_' || ch == '.' || ch == '~'
+}
+
+// ---------- Object operations ----------------------------------------------
+
+// listObjects returns the ETags of all objects whose key starts with the given
+// prefix, indexed by key.
+func (sc *s3Client) listObjects(ctx context.Context, prefix string) (map[string]string, error) {
+	result := map[string]string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := sc.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var lbr struct {
+			IsTruncated           bool
+			NextContinuationToken string
+			Contents              []struct {
+				Key  string
+				ETag string
+			}
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&lbr)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range lbr.Contents {
+			result[obj.Key] = obj.ETag
+		}
+		if !lbr.IsTruncated || lbr.NextContinuationToken == "" {
+			return result, nil
+		}
+		token = lbr.NextContinuationToken
+	}
+}
+
+// getObject returns the data of an object.
+func (sc *s3Client) getObject(ctx context.Context, key string) ([]byte, error) {
+	resp, err := sc.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// headObject returns the ETag of an object.
+func (sc *s3Client) headObject(ctx context.Context, key string) (string, error) {
+	resp, err := sc.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// putObject stores the data as an object and returns the new ETag, which is
+// empty if the object storage did not send it. If etag is not empty, the
+// object is only stored if its current ETag is the given one. Otherwise, the
+// object is only stored if it does not exist. In both cases,
+// http.StatusPreconditionFailed is returned, if the condition does not hold.
+// If etag is unknownETag, the object is stored unconditionally.
+func (sc *s3Client) putObject(ctx context.Context, key string, data []byte, etag string) (string, error) {
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	switch etag {
+	case "":
+		header.Set("If-None-Match", "*")
+	case unknownETag:
+	default:
+		header.Set("If-Match", etag)
+	}
+	resp, err := sc.do(ctx, http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// deleteObject removes an object. It is not an error if the object does not
+// exist.
+func (sc *s3Client) deleteObject(ctx context.Context, key string) error {
+	resp, err := sc.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		if statusCode(err) == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
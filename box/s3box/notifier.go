@@ -0,0 +1,241 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package s3box
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"zettelstore.de/z/box/notify"
+	"zettelstore.de/z/logger"
+)
+
+// s3Notifier lists the objects of a bucket periodically and sends events
+// about changed objects. Object names are relative to the prefix. It also
+// remembers the ETags of all objects to allow conditional writes.
+//
+// Since listing all objects takes some time, the box may write objects
+// concurrently. Every write increments a generation counter. After a listing,
+// the ETags of objects that were written after the listing started are kept,
+// because the listing may not reflect these writes.
+type s3Notifier struct {
+	log      *logger.Logger
+	client   *s3Client
+	prefix   string
+	interval time.Duration
+	events   chan notify.Event
+	done     chan struct{}
+	refresh  chan struct{}
+
+	mx      sync.RWMutex // Protects the following fields
+	etags   map[string]string
+	gen     uint64            // Incremented for every write of the box
+	written map[string]uint64 // Generation of the last write of an object
+}
+
+// unknownETag marks an object that was written by the box, but whose ETag is
+// not known. Since ETags are quoted strings, it never matches a real one.
+const unknownETag = "?"
+
+func newS3Notifier(log *logger.Logger, client *s3Client, prefix string, interval time.Duration) *s3Notifier {
+	sn := &s3Notifier{
+		log:      log,
+		client:   client,
+		prefix:   prefix,
+		interval: interval,
+		events:   make(chan notify.Event),
+		done:     make(chan struct{}),
+		refresh:  make(chan struct{}),
+		etags:    map[string]string{},
+		written:  map[string]uint64{},
+	}
+	go sn.eventLoop()
+	return sn
+}
+
+func (sn *s3Notifier) Events() <-chan notify.Event { return sn.events }
+
+func (sn *s3Notifier) Refresh() { sn.refresh <- struct{}{} }
+
+func (sn *s3Notifier) Close() { close(sn.done) }
+
+func (sn *s3Notifier) eventLoop() {
+	defer close(sn.events)
+	defer close(sn.refresh)
+	if !sn.listAll() {
+		return
+	}
+	ticker := time.NewTicker(sn.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sn.done:
+			return
+		case <-sn.refresh:
+			if !sn.listAll() {
+				return
+			}
+		case <-ticker.C:
+			if !sn.listChanges() {
+				return
+			}
+		}
+	}
+}
+
+// fetch returns the ETags of all objects, indexed by their name, together
+// with the generation when the listing started.
+func (sn *s3Notifier) fetch() (map[string]string, uint64, error) {
+	sn.mx.RLock()
+	gen := sn.gen
+	sn.mx.RUnlock()
+	objects, err := sn.client.listObjects(context.Background(), sn.prefix)
+	if err != nil {
+		return nil, gen, err
+	}
+	result := make(map[string]string, len(objects))
+	for key, etag := range objects {
+		if name := strings.TrimPrefix(key, sn.prefix); name != "" && !strings.HasSuffix(name, "/") {
+			result[name] = etag
+		}
+	}
+	return result, gen, nil
+}
+
+// merge replaces the known ETags by the fetched ones, except for objects that
+// were written after the listing started at the given generation. It returns
+// the names of new or changed objects, and the names of removed objects.
+func (sn *s3Notifier) merge(fetched map[string]string, gen uint64) (updated, deleted []string) {
+	sn.mx.Lock()
+	defer sn.mx.Unlock()
+	for name, wgen := range sn.written {
+		if wgen <= gen {
+			// The listing reflects the write.
+			delete(sn.written, name)
+			continue
+		}
+		if etag, found := sn.etags[name]; found {
+			fetched[name] = etag
+		} else {
+			delete(fetched, name)
+		}
+	}
+	updated, deleted = diffETags(sn.etags, fetched)
+	sn.etags = fetched
+	return updated, deleted
+}
+
+// listAll sends all objects as list events.
+func (sn *s3Notifier) listAll() bool {
+	if !sn.send(notify.Event{Op: notify.Make}) {
+		return false
+	}
+	etags, gen, err := sn.fetch()
+	if err != nil {
+		return sn.send(notify.Event{Op: notify.Error, Err: err})
+	}
+	sn.merge(etags, gen)
+	for _, name := range sn.names() {
+		sn.log.Trace().Str("name", name).Msg("Object listed")
+		if !sn.send(notify.Event{Op: notify.List, Name: name}) {
+			return false
+		}
+	}
+	return sn.send(notify.Event{Op: notify.List})
+}
+
+// listChanges sends events for all objects that were changed since the last
+// listing.
+func (sn *s3Notifier) listChanges() bool {
+	etags, gen, err := sn.fetch()
+	if err != nil {
+		sn.log.Error().Err(err).Msg("Unable to list objects")
+		return true
+	}
+	updated, deleted := sn.merge(etags, gen)
+	for _, name := range updated {
+		sn.log.Trace().Str("name", name).Msg("Object updated")
+		if !sn.send(notify.Event{Op: notify.Update, Name: name}) {
+			return false
+		}
+	}
+	for _, name := range deleted {
+		sn.log.Trace().Str("name", name).Msg("Object deleted")
+		if !sn.send(notify.Event{Op: notify.Delete, Name: name}) {
+			return false
+		}
+	}
+	return true
+}
+
+func (sn *s3Notifier) send(ev notify.Event) bool {
+	select {
+	case sn.events <- ev:
+		return true
+	case <-sn.done:
+		return false
+	}
+}
+
+// diffETags returns the names of new or changed objects, and the names of
+// removed objects.
+func diffETags(prev, cur map[string]string) (updated, deleted []string) {
+	for name, etag := range cur {
+		if prevETag, found := prev[name]; !found || prevETag != etag {
+			updated = append(updated, name)
+		}
+	}
+	for name := range prev {
+		if _, found := cur[name]; !found {
+			deleted = append(deleted, name)
+		}
+	}
+	return updated, deleted
+}
+
+// names returns the names of all known objects.
+func (sn *s3Notifier) names() []string {
+	sn.mx.RLock()
+	defer sn.mx.RUnlock()
+	result := make([]string, 0, len(sn.etags))
+	for name := range sn.etags {
+		result = append(result, name)
+	}
+	return result
+}
+
+// getETag returns the last known ETag of the named object, or the empty
+// string if the object is not known.
+func (sn *s3Notifier) getETag(name string) string {
+	sn.mx.RLock()
+	defer sn.mx.RUnlock()
+	return sn.etags[name]
+}
+
+// setETag records the ETag of an object that was written by the box itself,
+// so that it is not reported as changed by the next listing. An empty ETag
+// removes the object.
+func (sn *s3Notifier) setETag(name, etag string) {
+	sn.mx.Lock()
+	defer sn.mx.Unlock()
+	sn.gen++
+	sn.written[name] = sn.gen
+	if etag == "" {
+		delete(sn.etags, name)
+	} else {
+		sn.etags[name] = etag
+	}
+}
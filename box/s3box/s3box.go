@@ -0,0 +1,529 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+// Package s3box provides a box that stores zettel as objects of an
+// S3-compatible object storage.
+package s3box
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"t73f.de/r/zsc/input"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/filebox"
+	"zettelstore.de/z/box/manager"
+	"zettelstore.de/z/box/notify"
+	"zettelstore.de/z/kernel"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func init() {
+	manager.Register("s3", func(u *url.URL, cdata *manager.ConnectData) (box.ManagedBox, error) {
+		q := u.Query()
+		region := q.Get("region")
+		if region == "" {
+			region = "us-east-1"
+		}
+		endpoint, err := getEndpoint(q.Get("endpoint"), region)
+		if err != nil {
+			return nil, err
+		}
+		bucket := u.Host
+		if bucket == "" {
+			return nil, errors.New("no bucket in box URI: " + u.String())
+		}
+		accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if user := u.User; user != nil {
+			accessKey = user.Username()
+			secretKey, _ = user.Password()
+		}
+		return &s3Box{
+			log: kernel.Main.GetLogger(kernel.BoxService).Clone().
+				Str("box", "s3").Int("boxnum", int64(cdata.Number)).Child(),
+			number:   cdata.Number,
+			location: redactLocation(u),
+			readonly: box.GetQueryBool(u, "readonly"),
+			prefix:   getPrefix(u.Path),
+			refresh:  time.Duration(box.GetQueryInt(u, "refresh", 5, 60, 86400)) * time.Second,
+			cdata:    *cdata,
+			client:   newS3Client(*endpoint, bucket, region, accessKey, secretKey),
+		}, nil
+	})
+}
+
+// getEndpoint returns the URL of the object storage. By default, AWS is used.
+func getEndpoint(val, region string) (*url.URL, error) {
+	if val == "" {
+		val = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(val)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("invalid endpoint: " + val)
+	}
+	return &url.URL{Scheme: u.Scheme, Host: u.Host}, nil
+}
+
+// getPrefix returns the prefix of all object keys. If not empty, it ends with
+// a slash.
+func getPrefix(path string) string {
+	prefix := strings.Trim(path, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// redactLocation removes the secret key from the box URI.
+func redactLocation(u *url.URL) string {
+	loc := *u
+	if loc.User != nil {
+		loc.User = url.User(loc.User.Username())
+	}
+	return loc.String()
+}
+
+// s3Box stores the files of a zettel as objects, named in the same way as a
+// directory box names its files.
+type s3Box struct {
+	log      *logger.Logger
+	number   int
+	location string
+	readonly bool
+	prefix   string        // Prefix of all object keys
+	refresh  time.Duration // Time between two listings of all objects
+	cdata    manager.ConnectData
+	client   *s3Client
+	notifier *s3Notifier
+	dirSrv   *notify.DirService
+
+	mxCache sync.Mutex // Protects the following field
+	cache   map[id.Zid]cachedMeta
+}
+
+// cachedMeta stores the metadata of a zettel, together with the ETag of the
+// object that contained it. Metadata is cached to avoid object requests for
+// every ApplyMeta.
+type cachedMeta struct {
+	etag string
+	meta *meta.Meta
+}
+
+func (sb *s3Box) notifyChanged(zid id.Zid, reason box.UpdateReason) {
+	if chci := sb.cdata.Notify; chci != nil {
+		sb.log.Trace().Zid(zid).Uint("reason", uint64(reason)).Msg("notifyChanged")
+		chci <- box.UpdateInfo{Box: sb, Reason: reason, Zid: zid}
+	}
+}
+
+func (sb *s3Box) Location() string { return sb.location }
+
+func (sb *s3Box) State() box.StartState {
+	if ds := sb.dirSrv; ds != nil {
+		switch ds.State() {
+		case notify.DsCreated:
+			return box.StartStateStopped
+		case notify.DsStarting:
+			return box.StartStateStarting
+		case notify.DsWorking:
+			return box.StartStateStarted
+		case notify.DsMissing:
+			return box.StartStateStarted
+		case notify.DsStopping:
+			return box.StartStateStopping
+		}
+	}
+	return box.StartStateStopped
+}
+
+func (sb *s3Box) Start(context.Context) error {
+	sb.mxCache.Lock()
+	sb.cache = map[id.Zid]cachedMeta{}
+	sb.mxCache.Unlock()
+	sb.notifier = newS3Notifier(sb.log.Clone().Str("notify", "s3").Child(), sb.client, sb.prefix, sb.refresh)
+	sb.dirSrv = notify.NewDirService(sb, sb.log.Clone().Str("sub", "dirsrv").Child(), sb.notifier, sb.cdata.Notify)
+	sb.dirSrv.Start()
+	sb.log.Trace().Str("prefix", sb.prefix).Int("refresh", int64(sb.refresh/time.Second)).Msg("Start Box")
+	return nil
+}
+
+func (sb *s3Box) Refresh(context.Context) {
+	sb.dirSrv.Refresh()
+	sb.log.Trace().Msg("Refresh")
+}
+
+func (sb *s3Box) Stop(context.Context) {
+	if dirSrv := sb.dirSrv; dirSrv != nil {
+		sb.dirSrv = nil
+		dirSrv.Stop()
+	}
+}
+
+func (sb *s3Box) CanCreateZettel(context.Context) bool { return !sb.readonly }
+
+func (sb *s3Box) CreateZettel(ctx context.Context, zettel zettel.Zettel) (id.Zid, error) {
+	if sb.readonly {
+		return id.Invalid, box.ErrReadOnly
+	}
+	newZid, err := sb.dirSrv.SetNewDirEntry()
+	if err != nil {
+		return id.Invalid, err
+	}
+	m := zettel.Meta.Clone()
+	m.Zid = newZid
+	zettel.Meta = m
+	entry := notify.DirEntry{Zid: newZid}
+	entry.SetupFromMetaContent(m, zettel.Content, sb.cdata.Config.GetZettelFileSyntax)
+	err = sb.putZettel(ctx, &entry, zettel)
+	if err == nil {
+		err = sb.dirSrv.UpdateDirEntry(&entry)
+	} else {
+		sb.dirSrv.DeleteDirEntry(newZid)
+	}
+	if err == nil {
+		sb.notifyChanged(newZid, box.OnZettel)
+	}
+	sb.log.Trace().Err(err).Zid(newZid).Msg("CreateZettel")
+	return newZid, err
+}
+
+func (sb *s3Box) GetZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, error) {
+	entry := sb.dirSrv.GetDirEntry(zid)
+	if !entry.IsValid() {
+		return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+	}
+	m, content, err := sb.getMetaContent(ctx, entry, true)
+	if err != nil {
+		return zettel.Zettel{}, err
+	}
+	sb.log.Trace().Zid(zid).Msg("GetZettel")
+	return zettel.Zettel{Meta: m, Content: zettel.NewContent(content)}, nil
+}
+
+func (sb *s3Box) HasZettel(_ context.Context, zid id.Zid) bool {
+	return sb.dirSrv.GetDirEntry(zid).IsValid()
+}
+
+func (sb *s3Box) ApplyZid(_ context.Context, handle box.ZidFunc, constraint query.RetrievePredicate) error {
+	entries := sb.dirSrv.GetDirEntries(constraint)
+	sb.log.Trace().Int("entries", int64(len(entries))).Msg("ApplyZid")
+	for _, entry := range entries {
+		handle(entry.Zid)
+	}
+	return nil
+}
+
+func (sb *s3Box) ApplyMeta(ctx context.Context, handle box.MetaFunc, constraint query.RetrievePredicate) error {
+	entries := sb.dirSrv.GetDirEntries(constraint)
+	sb.log.Trace().Int("entries", int64(len(entries))).Msg("ApplyMeta")
+	for _, entry := range entries {
+		m, err := sb.getMeta(ctx, entry)
+		if err != nil {
+			sb.log.Trace().Err(err).Msg("ApplyMeta/getMeta")
+			return err
+		}
+		sb.cdata.Enricher.Enrich(ctx, m, sb.number)
+		handle(m)
+	}
+	return nil
+}
+
+func (sb *s3Box) CanUpdateZettel(context.Context, zettel.Zettel) bool { return !sb.readonly }
+
+func (sb *s3Box) UpdateZettel(ctx context.Context, zettel zettel.Zettel) error {
+	if sb.readonly {
+		return box.ErrReadOnly
+	}
+	m := zettel.Meta.Clone()
+	zid := m.Zid
+	if !zid.IsValid() {
+		return box.ErrInvalidZid{Zid: zid.String()}
+	}
+	zettel.Meta = m
+	entry := sb.dirSrv.GetDirEntry(zid)
+	if !entry.IsValid() {
+		// Existing zettel, but new in this box.
+		entry = &notify.DirEntry{Zid: zid}
+	}
+	entry.SetupFromMetaContent(m, zettel.Content, sb.cdata.Config.GetZettelFileSyntax)
+	err := sb.putZettel(ctx, entry, zettel)
+	if err == nil {
+		err = sb.dirSrv.UpdateDirEntry(entry)
+	}
+	if err == nil {
+		sb.notifyChanged(zid, box.OnZettel)
+	}
+	sb.log.Trace().Zid(zid).Err(err).Msg("UpdateZettel")
+	return err
+}
+
+func (sb *s3Box) CanDeleteZettel(_ context.Context, zid id.Zid) bool {
+	return !sb.readonly && sb.dirSrv.GetDirEntry(zid).IsValid()
+}
+
+func (sb *s3Box) DeleteZettel(ctx context.Context, zid id.Zid) error {
+	if sb.readonly {
+		return box.ErrReadOnly
+	}
+	entry := sb.dirSrv.GetDirEntry(zid)
+	if !entry.IsValid() {
+		return box.ErrZettelNotFound{Zid: zid}
+	}
+	err := sb.dirSrv.DeleteDirEntry(zid)
+	if err == nil {
+		err = sb.deleteObjects(ctx, entry)
+	}
+	sb.mxCache.Lock()
+	delete(sb.cache, zid)
+	sb.mxCache.Unlock()
+	if err == nil {
+		sb.notifyChanged(zid, box.OnDelete)
+	}
+	sb.log.Trace().Zid(zid).Err(err).Msg("DeleteZettel")
+	return err
+}
+
+func (sb *s3Box) ReadStats(st *box.ManagedBoxStats) {
+	st.ReadOnly = sb.readonly
+	st.Zettel = sb.dirSrv.NumDirEntries()
+	sb.log.Trace().Int("zettel", int64(st.Zettel)).Msg("ReadStats")
+}
+
+// ---------- Object access --------------------------------------------------
+
+// getMeta returns the metadata of a zettel, possibly from the cache.
+func (sb *s3Box) getMeta(ctx context.Context, entry *notify.DirEntry) (*meta.Meta, error) {
+	name := entry.MetaName
+	if name == "" {
+		name = entry.ContentName
+	}
+	etag := sb.notifier.getETag(name)
+	if etag == unknownETag {
+		etag = ""
+	}
+	if etag != "" {
+		sb.mxCache.Lock()
+		cm, found := sb.cache[entry.Zid]
+		sb.mxCache.Unlock()
+		if found && cm.etag == etag {
+			return cm.meta.Clone(), nil
+		}
+	}
+	m, _, err := sb.getMetaContent(ctx, entry, false)
+	if err == nil && etag != "" {
+		sb.mxCache.Lock()
+		sb.cache[entry.Zid] = cachedMeta{etag: etag, meta: m.Clone()}
+		sb.mxCache.Unlock()
+	}
+	return m, err
+}
+
+// getMetaContent retrieves the metadata and, if requested, the content of a
+// zettel, in the same way as a directory box reads its files.
+func (sb *s3Box) getMetaContent(ctx context.Context, entry *notify.DirEntry, withContent bool) (*meta.Meta, []byte, error) {
+	zid := entry.Zid
+	var m *meta.Meta
+	var content []byte
+	var err error
+	if metaName := entry.MetaName; metaName == "" {
+		contentName := entry.ContentName
+		if contentName == "" || entry.ContentExt == "" {
+			return nil, nil, fmt.Errorf("no meta, no content in getMetaContent, zid=%v", zid)
+		}
+		if entry.HasMetaInContent() {
+			var data []byte
+			if data, err = sb.getObject(ctx, contentName, zid); err == nil {
+				inp := input.NewInput(data)
+				m = meta.NewFromInput(zid, inp)
+				content = data[inp.Pos:]
+			}
+		} else {
+			m = filebox.CalcDefaultMeta(zid, entry.ContentExt)
+			if withContent {
+				content, err = sb.getObject(ctx, contentName, zid)
+			}
+		}
+	} else {
+		var data []byte
+		if data, err = sb.getObject(ctx, metaName, zid); err == nil {
+			m = meta.NewFromInput(zid, input.NewInput(data))
+			if withContent && entry.ContentName != "" {
+				content, err = sb.getObject(ctx, entry.ContentName, zid)
+			}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	filebox.CleanupMeta(m, zid, entry.ContentExt, entry.MetaName != "", entry.UselessFiles)
+	if withContent {
+		content, err = filebox.DecryptContent(zid, content)
+	}
+	return m, content, err
+}
+
+func (sb *s3Box) getObject(ctx context.Context, name string, zid id.Zid) ([]byte, error) {
+	data, err := sb.client.getObject(ctx, sb.prefix+name)
+	if statusCode(err) == http.StatusNotFound {
+		return nil, box.ErrZettelNotFound{Zid: zid}
+	}
+	return data, err
+}
+
+// putZettel stores the objects of a zettel. An object is only replaced if it
+// was not changed since it was listed, otherwise box.ErrConflict is returned.
+func (sb *s3Box) putZettel(ctx context.Context, entry *notify.DirEntry, z zettel.Zettel) error {
+	zid := entry.Zid
+	m := z.Meta
+	content := z.Content.AsBytes()
+	if filebox.MustEncrypt(m) {
+		var err error
+		if content, err = filebox.EncryptContent(zid, content); err != nil {
+			return err
+		}
+	}
+
+	metaName, contentName := entry.MetaName, entry.ContentName
+	if metaName == "" {
+		if contentName == "" {
+			return fmt.Errorf("no meta, no content in putZettel, zid=%v", zid)
+		}
+		if entry.HasMetaInContent() {
+			var buf bytes.Buffer
+			if err := writeMetaHeader(&buf, m); err != nil {
+				return err
+			}
+			buf.Write(content)
+			content = buf.Bytes()
+		}
+		return sb.putObject(ctx, contentName, content)
+	}
+
+	var buf bytes.Buffer
+	if err := writeMeta(&buf, m); err != nil {
+		return err
+	}
+	if contentName == "" {
+		return sb.putObject(ctx, metaName, buf.Bytes())
+	}
+	err := sb.checkObjects(ctx, metaName, contentName)
+	if err == nil {
+		err = sb.putObject(ctx, metaName, buf.Bytes())
+	}
+	if err == nil {
+		err = sb.putObject(ctx, contentName, content)
+	}
+	return err
+}
+
+// checkObjects verifies that none of the named objects was changed since it
+// was listed, before any of them is written. Otherwise, a zettel might be
+// written partially, if only its content object was changed by someone else.
+// Since objects cannot be written together, a concurrent change between the
+// check and the write is still detected by the conditional write only.
+func (sb *s3Box) checkObjects(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		known := sb.notifier.getETag(name)
+		if known == unknownETag {
+			continue
+		}
+		etag, err := sb.client.headObject(ctx, sb.prefix+name)
+		if statusCode(err) == http.StatusNotFound {
+			etag, err = "", nil
+		}
+		if err != nil {
+			return err
+		}
+		if etag != known {
+			sb.log.Info().Str("name", name).Msg("Object was changed by someone else")
+			return box.ErrConflict
+		}
+	}
+	return nil
+}
+
+// putObject stores an object conditionally. If the object storage does not
+// return the new ETag, it is retrieved separately. If this fails too, the
+// ETag is marked as unknown, so that the next write is not rejected, and the
+// next listing will provide it.
+func (sb *s3Box) putObject(ctx context.Context, name string, data []byte) error {
+	etag, err := sb.client.putObject(ctx, sb.prefix+name, data, sb.notifier.getETag(name))
+	if statusCode(err) == http.StatusPreconditionFailed {
+		sb.log.Info().Str("name", name).Msg("Object was changed by someone else")
+		return box.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if etag == "" {
+		var errHead error
+		if etag, errHead = sb.client.headObject(ctx, sb.prefix+name); errHead != nil || etag == "" {
+			sb.log.Info().Err(errHead).Str("name", name).Msg("Unable to retrieve ETag of written object")
+			etag = unknownETag
+		}
+	}
+	sb.notifier.setETag(name, etag)
+	return nil
+}
+
+func (sb *s3Box) deleteObjects(ctx context.Context, entry *notify.DirEntry) error {
+	names := append([]string{entry.MetaName, entry.ContentName}, entry.UselessFiles...)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if err := sb.client.deleteObject(ctx, sb.prefix+name); err != nil {
+			return err
+		}
+		sb.notifier.setETag(name, "")
+	}
+	return nil
+}
+
+func writeMeta(buf *bytes.Buffer, m *meta.Meta) error {
+	buf.WriteString("id: ")
+	buf.Write(m.Zid.Bytes())
+	buf.WriteByte('\n')
+	_, err := m.WriteComputed(buf)
+	return err
+}
+
+func writeMetaHeader(buf *bytes.Buffer, m *meta.Meta) error {
+	if m.YamlSep {
+		buf.WriteString("---\n")
+	}
+	if err := writeMeta(buf, m); err != nil {
+		return err
+	}
+	if m.YamlSep {
+		buf.WriteString("---\n")
+	} else {
+		buf.WriteByte('\n')
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package s3box
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/notify"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// testServer is a minimal stand-in for an S3-compatible object storage with
+// one bucket. Listings return at most two objects per page.
+type testServer struct {
+	bucket  string
+	mx      sync.Mutex
+	objects map[string][]byte
+	noETag  bool // Do not return the ETag of a written object
+	noHead  bool // Reject HEAD requests
+}
+
+func etagOf(data []byte) string { return fmt.Sprintf("%q", fmt.Sprintf("%x", md5.Sum(data))) }
+
+func (ts *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ts.mx.Lock()
+	defer ts.mx.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), amzAlgorithm+" Credential=key/") {
+		http.Error(w, "", http.StatusForbidden)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != ts.bucket {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	data, found := ts.objects[key]
+	switch r.Method {
+	case http.MethodGet:
+		if key == "" {
+			ts.list(w, r.URL.Query())
+			return
+		}
+		if !found {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodHead:
+		if ts.noHead {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", etagOf(data))
+	case http.MethodPut:
+		if (r.Header.Get("If-None-Match") == "*" && found) ||
+			(r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != etagOf(data)) {
+			http.Error(w, "", http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		ts.objects[key] = body
+		if !ts.noETag {
+			w.Header().Set("ETag", etagOf(body))
+		}
+	case http.MethodDelete:
+		delete(ts.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (ts *testServer) list(w http.ResponseWriter, q url.Values) {
+	var keys []string
+	for key := range ts.objects {
+		if strings.HasPrefix(key, q.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	start, _ := strconv.Atoi(q.Get("continuation-token"))
+	type object struct {
+		Key  string
+		ETag string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []object
+	}{}
+	for i := start; i < len(keys) && i < start+2; i++ {
+		result.Contents = append(result.Contents, object{keys[i], etagOf(ts.objects[keys[i]])})
+	}
+	if start+2 < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(start + 2)
+	}
+	xml.NewEncoder(w).Encode(&result)
+}
+
+func TestClient(t *testing.T) {
+	ts := &testServer{bucket: "zettel", objects: map[string][]byte{
+		"other/x":                  []byte("x"),
+		"zs/20241018120000":        []byte("title: A"),
+		"zs/20241018120000.png":    []byte("\x89PNG"),
+		"zs/20241018120001.zettel": []byte("title: B\n\nText"),
+	}}
+	srv := httptest.NewServer(ts)
+	defer srv.Close()
+	endpoint, _ := url.Parse(srv.URL)
+	client := newS3Client(*endpoint, "zettel", "us-east-1", "key", "secret")
+	ctx := context.Background()
+
+	objects, err := client.listObjects(ctx, "zs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 3 {
+		t.Errorf("expected 3 objects, but got %v", objects)
+	}
+	etag := objects["zs/20241018120000"]
+
+	if data, err2 := client.getObject(ctx, "zs/20241018120001.zettel"); err2 != nil || string(data) != "title: B\n\nText" {
+		t.Errorf("unexpected object data %q / %v", data, err2)
+	}
+	if _, err = client.getObject(ctx, "zs/missing"); statusCode(err) != http.StatusNotFound {
+		t.Errorf("expected not found, but got %v", err)
+	}
+
+	newETag, err := client.putObject(ctx, "zs/20241018120000", []byte("title: AA"), etag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.putObject(ctx, "zs/20241018120000", []byte("title: AAA"), etag); statusCode(err) != http.StatusPreconditionFailed {
+		t.Errorf("expected precondition failed for outdated ETag, but got %v", err)
+	}
+	if _, err = client.putObject(ctx, "zs/20241018120000", []byte("title: AAA"), newETag); err != nil {
+		t.Error(err)
+	}
+	if _, err = client.putObject(ctx, "zs/20241018120001.zettel", []byte("new"), ""); statusCode(err) != http.StatusPreconditionFailed {
+		t.Errorf("expected precondition failed for existing object, but got %v", err)
+	}
+
+	if got, err2 := client.headObject(ctx, "zs/20241018120001.zettel"); err2 != nil || got != etagOf([]byte("title: B\n\nText")) {
+		t.Errorf("unexpected ETag %q / %v", got, err2)
+	}
+	if _, err = client.headObject(ctx, "zs/missing"); statusCode(err) != http.StatusNotFound {
+		t.Errorf("expected not found, but got %v", err)
+	}
+
+	if err = client.deleteObject(ctx, "zs/20241018120000.png"); err != nil {
+		t.Error(err)
+	}
+	if objects, err = client.listObjects(ctx, "zs/"); err != nil || len(objects) != 2 {
+		t.Errorf("expected 2 objects after delete, but got %v / %v", objects, err)
+	}
+
+	anonymous := newS3Client(*endpoint, "zettel", "us-east-1", "", "")
+	if _, err = anonymous.listObjects(ctx, ""); statusCode(err) != http.StatusForbidden {
+		t.Errorf("expected forbidden for anonymous access, but got %v", err)
+	}
+}
+
+func TestDiffETags(t *testing.T) {
+	prev := map[string]string{"a": "1", "b": "2", "c": "3"}
+	cur := map[string]string{"a": "1", "b": "22", "d": "4"}
+	updated, deleted := diffETags(prev, cur)
+	slices.Sort(updated)
+	if !slices.Equal(updated, []string{"b", "d"}) {
+		t.Errorf("expected updated [b d], but got %v", updated)
+	}
+	if !slices.Equal(deleted, []string{"c"}) {
+		t.Errorf("expected deleted [c], but got %v", deleted)
+	}
+}
+
+func TestNotifierMerge(t *testing.T) {
+	sn := &s3Notifier{
+		etags:   map[string]string{"a": "1", "b": "2", "c": "3"},
+		written: map[string]uint64{},
+	}
+	sn.setETag("c", "33")
+	gen := sn.gen
+
+	// While listing, the box writes "a" and deletes "b".
+	sn.setETag("a", "11")
+	sn.setETag("b", "")
+	updated, deleted := sn.merge(map[string]string{"a": "1", "b": "2", "c": "33", "d": "4"}, gen)
+	if exp := map[string]string{"a": "11", "c": "33", "d": "4"}; !maps.Equal(sn.etags, exp) {
+		t.Errorf("expected ETags %v, but got %v", exp, sn.etags)
+	}
+	if !slices.Equal(updated, []string{"d"}) || len(deleted) != 0 {
+		t.Errorf("expected only d to be updated, but got %v / %v", updated, deleted)
+	}
+	if _, found := sn.written["c"]; found {
+		t.Error("write of c is reflected by the listing and must be forgotten")
+	}
+
+	// The next listing reflects all writes.
+	gen = sn.gen
+	updated, deleted = sn.merge(map[string]string{"a": "11", "c": "33"}, gen)
+	if len(updated) != 0 || !slices.Equal(deleted, []string{"d"}) || len(sn.written) != 0 {
+		t.Errorf("expected only d to be deleted, but got %v / %v / %v", updated, deleted, sn.written)
+	}
+}
+
+func newTestBox(t *testing.T, ts *testServer) (*s3Box, func()) {
+	srv := httptest.NewServer(ts)
+	endpoint, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newS3Client(*endpoint, ts.bucket, "us-east-1", "key", "secret")
+	sb := &s3Box{
+		prefix:   "zs/",
+		client:   client,
+		notifier: &s3Notifier{client: client, prefix: "zs/", etags: map[string]string{}, written: map[string]uint64{}},
+	}
+	return sb, srv.Close
+}
+
+func TestPutObjectWithoutETag(t *testing.T) {
+	ts := &testServer{bucket: "zettel", objects: map[string][]byte{}, noETag: true}
+	sb, closeServer := newTestBox(t, ts)
+	defer closeServer()
+	ctx := context.Background()
+
+	if err := sb.putObject(ctx, "20241018120000.zettel", []byte("A")); err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := sb.notifier.getETag("20241018120000.zettel"), etagOf([]byte("A")); got != exp {
+		t.Errorf("ETag %q must be retrieved, but got %q", exp, got)
+	}
+	if err := sb.putObject(ctx, "20241018120000.zettel", []byte("AA")); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.mx.Lock()
+	ts.noHead = true
+	ts.mx.Unlock()
+	if err := sb.putObject(ctx, "20241018120000.zettel", []byte("AAA")); err != nil {
+		t.Fatal(err)
+	}
+	if got := sb.notifier.getETag("20241018120000.zettel"); got != unknownETag {
+		t.Errorf("ETag must be unknown, but got %q", got)
+	}
+	// An object with unknown ETag can be written again.
+	if err := sb.putObject(ctx, "20241018120000.zettel", []byte("AAAA")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(ts.objects["zs/20241018120000.zettel"]); got != "AAAA" {
+		t.Errorf("expected object %q, but got %q", "AAAA", got)
+	}
+}
+
+func TestPutZettelConflict(t *testing.T) {
+	ts := &testServer{bucket: "zettel", objects: map[string][]byte{
+		"zs/20241018120000":     []byte("title: A"),
+		"zs/20241018120000.png": []byte("\x89PNG"),
+	}}
+	sb, closeServer := newTestBox(t, ts)
+	defer closeServer()
+	ctx := context.Background()
+	sb.notifier.setETag("20241018120000", etagOf([]byte("title: A")))
+	sb.notifier.setETag("20241018120000.png", etagOf([]byte("\x89PNG")))
+
+	// Someone else changes the content object.
+	ts.mx.Lock()
+	ts.objects["zs/20241018120000.png"] = []byte("\x89PNG changed")
+	ts.mx.Unlock()
+
+	m := meta.New(id.Zid(20241018120000))
+	m.Set(api.KeyTitle, "B")
+	m.Set(api.KeySyntax, "png")
+	entry := notify.DirEntry{Zid: m.Zid, MetaName: "20241018120000", ContentName: "20241018120000.png", ContentExt: "png"}
+	err := sb.putZettel(ctx, &entry, zettel.Zettel{Meta: m, Content: zettel.NewContent([]byte("\x89PNG new"))})
+	if err != box.ErrConflict {
+		t.Errorf("expected conflict, but got %v", err)
+	}
+	if got := string(ts.objects["zs/20241018120000"]); got != "title: A" {
+		t.Errorf("metadata object must not be written, but got %q", got)
+	}
+
+	// After the next listing, the zettel can be written.
+	sb.notifier.setETag("20241018120000.png", etagOf([]byte("\x89PNG changed")))
+	if err = sb.putZettel(ctx, &entry, zettel.Zettel{Meta: m, Content: zettel.NewContent([]byte("\x89PNG new"))}); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(ts.objects["zs/20241018120000.png"]); got != "\x89PNG new" {
+		t.Errorf("content object must be written, but got %q", got)
+	}
+}
+
+func TestEncodeQuery(t *testing.T) {
+	q := url.Values{"prefix": {"a b/c"}, "list-type": {"2"}, "continuation-token": {"x+y="}}
+	exp := "continuation-token=x%2By%3D&list-type=2&prefix=a%20b%2Fc"
+	if got := encodeQuery(q); got != exp {
+		t.Errorf("expected %q, but got %q", exp, got)
+	}
+}
+
+func TestGetPrefix(t *testing.T) {
+	testcases := []struct{ path, exp string }{
+		{"", ""}, {"/", ""}, {"/zettel", "zettel/"}, {"/a/b/", "a/b/"},
+	}
+	for _, tc := range testcases {
+		if got := getPrefix(tc.path); got != tc.exp {
+			t.Errorf("getPrefix(%q) should be %q, but got %q", tc.path, tc.exp, got)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"zettelstore.de/z/box/dbbox"
+	"zettelstore.de/z/box/manager"
+)
+
+// ---------- Subcommand: convert --------------------------------------------
+
+func cmdConvert(fs *flag.FlagSet) (int, error) {
+	args := fs.Args()
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: zettelstore convert DIRECTORY DBFILE")
+		return 2, nil
+	}
+	u, err := getConvertDirURL(args[0])
+	if err != nil {
+		return 2, err
+	}
+	src, err := manager.Connect(u, readonlyManager{}, &manager.ConnectData{Number: 1})
+	if err != nil {
+		return 2, err
+	}
+
+	ctx := context.Background()
+	if err = startBox(ctx, src); err != nil {
+		return 1, err
+	}
+	defer stopBox(ctx, src)
+
+	count, err := dbbox.Convert(ctx, src, args[1])
+	fmt.Printf("%d zettel stored in %q\n", count, args[1])
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// getConvertDirURL returns the URL of a read-only directory box. The directory
+// is either given by its path, or as a box URI to specify more parameter, e.g.
+// the layout of the directory.
+func getConvertDirURL(val string) (*url.URL, error) {
+	if !strings.HasPrefix(val, "dir:") {
+		if strings.HasPrefix(val, "/") {
+			val = "dir://" + val
+		} else {
+			val = "dir:" + val
+		}
+	}
+	u, err := url.Parse(val)
+	if err != nil {
+		return nil, err
+	}
+	// No external changes are expected while converting.
+	q := u.Query()
+	q.Set("type", "simple")
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// readonlyManager forces the directory box to be read-only.
+type readonlyManager struct{}
+
+func (readonlyManager) IsReadonly() bool { return true }
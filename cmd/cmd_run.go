@@ -16,10 +16,17 @@ package cmd
 import (
 	"context"
 	"flag"
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
 
 	"zettelstore.de/z/auth"
 	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/auditbox"
 	"zettelstore.de/z/config"
 	"zettelstore.de/z/kernel"
 	"zettelstore.de/z/usecase"
@@ -62,21 +69,34 @@ func setupRouting(webSrv server.Server, boxManager box.Manager, authManager auth
 	ucGetUser := usecase.NewGetUser(authManager, boxManager)
 	ucAuthenticate := usecase.NewAuthenticate(logAuth, authManager, &ucGetUser)
 	ucIsAuth := usecase.NewIsAuthenticated(logUc, &getUser, authManager)
-	ucCreateZettel := usecase.NewCreateZettel(logUc, rtConfig, protectedBoxManager)
+	auditTrail := auditbox.GetTrail()
+	ucCreateZettel := usecase.NewCreateZettel(logUc, rtConfig, protectedBoxManager, auditTrail)
 	ucGetAllZettel := usecase.NewGetAllZettel(protectedBoxManager)
 	ucGetZettel := usecase.NewGetZettel(protectedBoxManager)
+	ucGetZettelStream := usecase.NewGetZettelStream(protectedBoxManager)
 	ucParseZettel := usecase.NewParseZettel(rtConfig, ucGetZettel)
-	ucQuery := usecase.NewQuery(protectedBoxManager)
+	ucQuery := usecase.NewQuery(protectedBoxManager, boxManager)
 	ucEvaluate := usecase.NewEvaluate(rtConfig, &ucGetZettel, &ucQuery)
 	ucQuery.SetEvaluate(&ucEvaluate)
 	ucTagZettel := usecase.NewTagZettel(protectedBoxManager, &ucQuery)
 	ucRoleZettel := usecase.NewRoleZettel(protectedBoxManager, &ucQuery)
 	ucListSyntax := usecase.NewListSyntax(protectedBoxManager)
 	ucListRoles := usecase.NewListRoles(protectedBoxManager)
-	ucDelete := usecase.NewDeleteZettel(logUc, protectedBoxManager)
-	ucUpdate := usecase.NewUpdateZettel(logUc, protectedBoxManager)
+	ucDelete := usecase.NewDeleteZettel(logUc, protectedBoxManager, auditTrail)
+	ucUpdate := usecase.NewUpdateZettel(logUc, protectedBoxManager, auditTrail)
+	firstBoxURI, _ := kern.GetConfig(kernel.BoxService, kernel.BoxURIs+"1").(*url.URL)
+	uploadDir, err := getUploadDir(firstBoxURI)
+	if err != nil {
+		webLog.Error().Err(err).Str("dir", uploadDir).Msg("Unable to create directory for incomplete uploads")
+		uploadDir = ""
+	}
+	ucUpload := usecase.NewUploadContent(logUc, protectedBoxManager, &getUser, auditTrail, uploadDir,
+		kern.GetConfig(kernel.WebService, kernel.WebMaxUploadSize).(int64))
 	ucRefresh := usecase.NewRefresh(logUc, protectedBoxManager)
 	ucReIndex := usecase.NewReIndex(logUc, protectedBoxManager)
+	ucCreateShare := usecase.NewCreateShare(logUc, protectedBoxManager, &getUser, authManager, authManager)
+	ucUseShare := usecase.NewUseShare(logUc, boxManager)
+	ucRevokeShare := usecase.NewRevokeShare(logUc, protectedBoxManager)
 	ucVersion := usecase.NewVersion(kernel.Main.GetConfig(kernel.CoreService, kernel.CoreVersion).(string))
 
 	a := api.New(
@@ -107,7 +127,7 @@ func setupRouting(webSrv server.Server, boxManager box.Manager, authManager auth
 	}
 	webSrv.AddListRoute('g', server.MethodGet, wui.MakeGetGoActionHandler(&ucRefresh))
 	webSrv.AddListRoute('h', server.MethodGet, wui.MakeListHTMLMetaHandler(&ucQuery, &ucTagZettel, &ucRoleZettel, &ucReIndex))
-	webSrv.AddZettelRoute('h', server.MethodGet, wui.MakeGetHTMLZettelHandler(&ucEvaluate, ucGetZettel))
+	webSrv.AddZettelRoute('h', server.MethodGet, wui.MakeGetHTMLZettelHandler(&ucEvaluate, ucGetZettel, &ucQuery))
 	webSrv.AddListRoute('i', server.MethodGet, wui.MakeGetLoginOutHandler())
 	webSrv.AddListRoute('i', server.MethodPost, wui.MakePostLoginHandler(&ucAuthenticate))
 	webSrv.AddZettelRoute('i', server.MethodGet, wui.MakeGetInfoHandler(
@@ -117,20 +137,70 @@ func setupRouting(webSrv server.Server, boxManager box.Manager, authManager auth
 	webSrv.AddListRoute('a', server.MethodPost, a.MakePostLoginHandler(&ucAuthenticate))
 	webSrv.AddListRoute('a', server.MethodPut, a.MakeRenewAuthHandler())
 	webSrv.AddListRoute('x', server.MethodGet, a.MakeGetDataHandler(ucVersion))
+	if !authManager.IsReadonly() && authManager.WithAuth() {
+		webSrv.AddListRoute('s', server.MethodPost, a.MakePostShareHandler(&ucCreateShare))
+		webSrv.AddZettelRoute('s', server.MethodPost, a.MakePostShareHandler(&ucCreateShare))
+		webSrv.AddZettelRoute('s', server.MethodDelete, a.MakeDeleteShareHandler(&ucRevokeShare))
+	}
 	webSrv.AddListRoute('x', server.MethodPost, a.MakePostCommandHandler(&ucIsAuth, &ucRefresh))
 	webSrv.AddListRoute('z', server.MethodGet, a.MakeQueryHandler(&ucQuery, &ucTagZettel, &ucRoleZettel, &ucReIndex))
-	webSrv.AddZettelRoute('z', server.MethodGet, a.MakeGetZettelHandler(ucGetZettel, ucParseZettel, ucEvaluate))
+	webSrv.AddZettelRoute('z', server.MethodGet, a.MakeGetZettelHandler(ucGetZettel, ucGetZettelStream, ucParseZettel, ucEvaluate))
 	if !authManager.IsReadonly() {
 		webSrv.AddListRoute('z', server.MethodPost, a.MakePostCreateZettelHandler(&ucCreateZettel))
-		webSrv.AddZettelRoute('z', server.MethodPut, a.MakeUpdateZettelHandler(&ucUpdate))
+		webSrv.AddZettelRoute('z', server.MethodPut, a.MakeUpdateZettelHandler(&ucUpdate, ucGetZettelStream, &ucUpload))
 		webSrv.AddZettelRoute('z', server.MethodDelete, a.MakeDeleteZettelHandler(&ucDelete))
 	}
 
 	if authManager.WithAuth() {
 		webSrv.SetUserRetriever(usecase.NewGetUserByZid(boxManager))
+		if header := kern.GetConfig(kernel.WebService, kernel.WebProxyUserHeader).(string); header != "" {
+			webSrv.SetProxyAuth(header, ucGetUser.Run)
+		}
+		if !authManager.IsReadonly() {
+			webSrv.SetShareRetriever(&ucUseShare)
+		}
 	}
 }
 
 type getUserImpl struct{}
 
 func (*getUserImpl) GetUser(ctx context.Context) *meta.Meta { return server.GetUser(ctx) }
+func (*getUserImpl) GetClient(ctx context.Context) string   { return server.GetClient(ctx) }
+
+// getUploadDir returns the directory to store incomplete uploads, which must
+// not be accessible by others. It does not change, when the Zettelstore is
+// restarted, so that an upload can be continued. If the first box is a
+// writable directory box, a hidden directory within it is used. Otherwise,
+// the directory is placed below the cache directory of the user, named after
+// the location of the first box.
+func getUploadDir(u *url.URL) (string, error) {
+	var dir string
+	if u != nil && u.Scheme == "dir" && !box.GetQueryBool(u, "readonly") {
+		path := u.Opaque
+		if path == "" {
+			path = u.Path
+		}
+		dir = filepath.Join(filepath.Clean(path), ".zettelstore-upload")
+	} else {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		h := fnv.New64a()
+		if u != nil {
+			h.Write([]byte(u.String()))
+		}
+		dir = filepath.Join(cacheDir, "zettelstore", fmt.Sprintf("upload-%016x", h.Sum64()))
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return dir, err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return dir, err
+	}
+	if !fi.IsDir() || (runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0) {
+		return dir, fmt.Errorf("%s must be a directory, accessible only by its owner", dir)
+	}
+	return dir, nil
+}
@@ -0,0 +1,667 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/manager"
+	"zettelstore.de/z/config"
+	"zettelstore.de/z/usecase"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// ---------- Subcommand: sync -----------------------------------------------
+
+func flgSync(fs *flag.FlagSet) {
+	fs.Bool("n", false, "only show what would be done")
+	fs.String("s", ".zssync", "file that stores the state of the last synchronisation")
+}
+
+func cmdSync(fs *flag.FlagSet) (int, error) {
+	args := fs.Args()
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: zettelstore sync [-n] [-s STATEFILE] STORE1 STORE2")
+		return 2, nil
+	}
+	dryRun := fs.Lookup("n").Value.String() == "true"
+	stateFile := fs.Lookup("s").Value.String()
+
+	ctx := context.Background()
+	var stores [2]box.ManagedBox
+	for i, arg := range args {
+		u, err := getSyncURL(arg)
+		if err != nil {
+			return 2, err
+		}
+		cdata := manager.ConnectData{Number: i + 1, Config: syncConfig{}, Enricher: syncEnricher{}}
+		mb, err := manager.Connect(u, syncAuthManager{readonly: dryRun}, &cdata)
+		if err != nil {
+			return 2, err
+		}
+		if err = startBox(ctx, mb); err != nil {
+			return 1, err
+		}
+		defer stopBox(ctx, mb)
+		stores[i] = mb
+	}
+
+	locations := [2]string{stores[0].Location(), stores[1].Location()}
+	state, zids, err := readSyncState(stateFile, locations)
+	if err != nil {
+		return 1, err
+	}
+	s := syncer{stores: stores, state: state, zids: zids, dryRun: dryRun, out: os.Stdout}
+	err = s.run(ctx)
+	fmt.Printf("%d zettel copied, %d deleted, %d conflicts, %d errors\n", s.copied, s.deleted, s.conflicts, len(s.failed))
+	if err != nil {
+		return 1, err
+	}
+	if !dryRun {
+		if err = writeSyncState(stateFile, locations, s.state, s.zids); err != nil {
+			return 1, err
+		}
+	}
+	if len(s.failed) > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// getSyncURL returns the box URI of a store. A store is given by a box URI, by
+// the URL of another Zettelstore, or by the path of a directory.
+func getSyncURL(val string) (*url.URL, error) {
+	if strings.HasPrefix(val, "http://") || strings.HasPrefix(val, "https://") {
+		u, err := url.Parse(val)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		if u.Scheme == "https" {
+			q.Set("tls", "")
+		}
+		u.Scheme = "remote"
+		u.RawQuery = q.Encode()
+		return u, nil
+	}
+	if !strings.Contains(val, ":") || filepath.IsAbs(val) {
+		return getConvertDirURL(val)
+	}
+	return url.Parse(val)
+}
+
+// startBox starts the box, if needed, and waits until it is started.
+func startBox(ctx context.Context, mb box.ManagedBox) error {
+	if ss, ok := mb.(box.StartStopper); ok {
+		if err := ss.Start(ctx); err != nil {
+			return err
+		}
+		for ss.State() != box.StartStateStarted {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// stopBox stops the box, if needed.
+func stopBox(ctx context.Context, mb box.ManagedBox) {
+	if ss, ok := mb.(box.StartStopper); ok {
+		ss.Stop(ctx)
+	}
+}
+
+// syncAuthManager forces the boxes to be read-only, if nothing should be changed.
+type syncAuthManager struct{ readonly bool }
+
+func (am syncAuthManager) IsReadonly() bool { return am.readonly }
+
+// syncConfig provides the runtime configuration needed by boxes to store
+// zettel. Other methods must not be called.
+type syncConfig struct{ config.Config }
+
+func (syncConfig) GetZettelFileSyntax() []string { return nil }
+
+// syncEnricher does not enrich metadata, because only stored metadata is
+// synchronised.
+type syncEnricher struct{}
+
+func (syncEnricher) Enrich(context.Context, *meta.Meta, int) {}
+
+// ---------- Synchronisation ------------------------------------------------
+
+// syncState stores, for every zettel that is contained in both stores, its
+// version in each store after the last synchronisation.
+type syncState map[id.Zid][2]string
+
+// syncZidMap maps the identifier of a zettel in the first store to its
+// identifier in the second store, if both differ. This happens, if a store
+// assigns the identifier of a new zettel, like a remote Zettelstore.
+type syncZidMap map[id.Zid]id.Zid
+
+// syncer synchronises two stores. A zettel that was only changed in one store
+// since the last synchronisation is copied into the other store. If it was
+// changed in both stores, the newer version wins and the older version is
+// saved as a new zettel in both stores.
+//
+// Zettel are identified by their identifier in the first store. The state and
+// all messages use this identifier.
+type syncer struct {
+	stores [2]box.ManagedBox
+	state  syncState
+	zids   syncZidMap
+	dryRun bool
+	out    io.Writer
+
+	copied    int
+	deleted   int
+	conflicts int
+	failed    map[id.Zid]error
+}
+
+func (s *syncer) run(ctx context.Context) error {
+	s.failed = map[id.Zid]error{}
+	if s.zids == nil {
+		s.zids = syncZidMap{}
+	}
+	var versions [2]map[id.Zid]string
+	for i := range s.stores {
+		vers, err := s.getVersions(ctx, i)
+		if err != nil {
+			return err
+		}
+		if len(vers) == 0 && len(s.state) > 0 {
+			// Maybe a temporary failure, e.g. of a remote Zettelstore.
+			// All zettel of the other store would be deleted otherwise.
+			return fmt.Errorf("store %d contains no zettel, but was synchronised before", i+1)
+		}
+		versions[i] = vers
+	}
+
+	zids := make(id.Slice, 0, len(versions[0])+len(versions[1]))
+	for _, vers := range versions {
+		for zid := range vers {
+			zids = append(zids, zid)
+		}
+	}
+	slices.Sort(zids)
+	for _, zid := range slices.Compact(zids) {
+		if err := s.syncZettel(ctx, zid, versions); err != nil {
+			s.failed[zid] = err
+			fmt.Fprintf(os.Stderr, "%v: %v\n", zid, err)
+		}
+	}
+	if s.dryRun {
+		return nil
+	}
+
+	for i := range s.stores {
+		vers, err := s.getVersions(ctx, i)
+		if err != nil {
+			return err
+		}
+		versions[i] = vers
+	}
+	state := syncState{}
+	for zid, v0 := range versions[0] {
+		if v1, found := versions[1][zid]; found {
+			state[zid] = [2]string{v0, v1}
+		}
+	}
+	for zid := range s.failed {
+		// Try again with the next synchronisation.
+		if prev, found := s.state[zid]; found {
+			state[zid] = prev
+		} else {
+			delete(state, zid)
+		}
+	}
+	s.state = state
+	for zid := range s.zids {
+		if _, found := state[zid]; !found {
+			delete(s.zids, zid)
+		}
+	}
+	return nil
+}
+
+// getVersions returns the version of all zettel of a store, indexed by their
+// identifier in the first store. The version is the timestamp of the last
+// modification. Predefined zettel, like the configuration, belong to their
+// store and are never synchronised.
+func (s *syncer) getVersions(ctx context.Context, i int) (map[id.Zid]string, error) {
+	firstZids := map[id.Zid]id.Zid{}
+	if i == 1 {
+		for zid1, zid2 := range s.zids {
+			firstZids[zid2] = zid1
+		}
+	}
+	result := map[id.Zid]string{}
+	err := s.stores[i].ApplyMeta(
+		box.NoEnrichContext(ctx),
+		func(m *meta.Meta) {
+			zid, found := firstZids[m.Zid]
+			if !found {
+				zid = m.Zid
+				if s.storeZid(i, zid) != zid {
+					fmt.Fprintf(os.Stderr, "%v: ignored in store %d, identifier is used for another zettel of store 1\n", zid, i+1)
+					return
+				}
+			}
+			result[zid] = getVersion(m)
+		},
+		func(zid id.Zid) bool { return zid >= id.DefaultHomeZid })
+	return result, err
+}
+
+// storeZid returns the identifier of a zettel in the given store.
+func (s *syncer) storeZid(i int, zid id.Zid) id.Zid {
+	if i == 1 {
+		if zid2, found := s.zids[zid]; found {
+			return zid2
+		}
+	}
+	return zid
+}
+
+func getVersion(m *meta.Meta) string {
+	if modified, found := m.Get(api.KeyModified); found {
+		return meta.ExpandTimestamp(modified)
+	}
+	return meta.ExpandTimestamp(m.GetDefault(api.KeyCreated, ""))
+}
+
+func (s *syncer) syncZettel(ctx context.Context, zid id.Zid, versions [2]map[id.Zid]string) error {
+	var vers [2]string
+	var found, changed [2]bool
+	prev, synced := s.state[zid]
+	for i := range vers {
+		vers[i], found[i] = versions[i][zid]
+		changed[i] = !synced || vers[i] != prev[i]
+	}
+	switch {
+	case found[0] && found[1]:
+		switch {
+		case !changed[0] && !changed[1]:
+			return nil
+		case !changed[0]:
+			return s.copyZettel(ctx, zid, 1, 0)
+		case !changed[1]:
+			return s.copyZettel(ctx, zid, 0, 1)
+		}
+		return s.resolveConflict(ctx, zid, vers)
+	case found[0], found[1]:
+		from := 0
+		if found[1] {
+			from = 1
+		}
+		if synced && !changed[from] {
+			// Deleted in the other store, and not changed since.
+			return s.deleteZettel(ctx, zid, from)
+		}
+		if s.assignsZid(1 - from) {
+			return s.createZettel(ctx, zid, from, 1-from)
+		}
+		return s.copyZettel(ctx, zid, from, 1-from)
+	}
+	return nil
+}
+
+func (s *syncer) copyZettel(ctx context.Context, zid id.Zid, from, to int) error {
+	fmt.Fprintf(s.out, "%v: copy to store %d\n", zid, to+1)
+	s.copied++
+	if s.dryRun {
+		return nil
+	}
+	z, err := s.getZettel(ctx, from, zid)
+	if err != nil {
+		return err
+	}
+	return s.putZettel(ctx, to, z)
+}
+
+// createZettel copies a zettel into a store that assigns a new identifier.
+// Both identifier are mapped to each other, and this mapping is stored
+// together with the state.
+func (s *syncer) createZettel(ctx context.Context, zid id.Zid, from, to int) error {
+	s.copied++
+	if s.dryRun {
+		fmt.Fprintf(s.out, "%v: copy to store %d as new zettel\n", zid, to+1)
+		return nil
+	}
+	z, err := s.getZettel(ctx, from, zid)
+	if err != nil {
+		return err
+	}
+	newZid, err := createZettelIn(ctx, s.stores[to], z)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "%v: copy to store %d as %v\n", zid, to+1, newZid)
+	if to == 1 {
+		s.mapZid(zid, newZid)
+	} else {
+		zid2 := s.storeZid(1, zid)
+		delete(s.zids, zid)
+		s.mapZid(newZid, zid2)
+	}
+	return nil
+}
+
+// mapZid records the identifier of a zettel in the second store.
+func (s *syncer) mapZid(zid1, zid2 id.Zid) {
+	if zid1 == zid2 {
+		delete(s.zids, zid1)
+	} else {
+		s.zids[zid1] = zid2
+	}
+}
+
+func (s *syncer) deleteZettel(ctx context.Context, zid id.Zid, i int) error {
+	fmt.Fprintf(s.out, "%v: delete in store %d\n", zid, i+1)
+	s.deleted++
+	if s.dryRun {
+		return nil
+	}
+	return s.stores[i].DeleteZettel(ctx, s.storeZid(i, zid))
+}
+
+// getZettel retrieves a zettel of a store. The returned zettel has its
+// identifier of the first store.
+func (s *syncer) getZettel(ctx context.Context, i int, zid id.Zid) (zettel.Zettel, error) {
+	z, err := s.stores[i].GetZettel(ctx, s.storeZid(i, zid))
+	if err == nil && z.Meta.Zid != zid {
+		z.Meta = z.Meta.Clone()
+		z.Meta.Zid = zid
+	}
+	return z, err
+}
+
+// resolveConflict handles a zettel that was changed in both stores. The newer
+// version is stored in both stores, the older version is saved as a new
+// zettel, with a predecessor link to the original one.
+//
+// The saved version is created in one store and then stored with the same
+// identifier in the other store. If a previous synchronisation failed after
+// creating it, the saved version is reused, so that it is not created twice.
+func (s *syncer) resolveConflict(ctx context.Context, zid id.Zid, vers [2]string) error {
+	var zs [2]zettel.Zettel
+	for i := range s.stores {
+		z, err := s.getZettel(ctx, i, zid)
+		if err != nil {
+			return err
+		}
+		zs[i] = z
+	}
+	if isSameZettel(zs[0], zs[1]) {
+		return nil
+	}
+
+	winner := 0
+	if vers[1] > vers[0] {
+		winner = 1
+	}
+	loser := 1 - winner
+
+	// A store that assigns identifiers must create the saved version.
+	creator := loser
+	if s.assignsZid(winner) {
+		if s.assignsZid(loser) {
+			return errCreateWithZid
+		}
+		creator = winner
+	}
+	s.conflicts++
+	if s.dryRun {
+		fmt.Fprintf(s.out, "%v: conflict, store %d wins, version of store %d will be saved as new zettel\n", zid, winner+1, loser+1)
+		return nil
+	}
+
+	var createZettel usecase.CreateZettel
+	saved := createZettel.PrepareVersion(zs[loser])
+	saved.Meta.Set(api.KeyCreated, time.Now().Local().Format(id.TimestampLayout))
+	saved.Meta.Delete(api.KeyModified)
+	prev, found, err := s.findSavedVersion(ctx, saved)
+	if err != nil {
+		return err
+	}
+	if found[0] || found[1] {
+		saved = prev
+	} else {
+		newZid, err2 := createZettelIn(ctx, s.stores[creator], saved)
+		if err2 != nil {
+			return err2
+		}
+		saved.Meta.Zid = newZid
+		found[creator] = true
+	}
+	fmt.Fprintf(s.out, "%v: conflict, store %d wins, version of store %d saved as %v\n", zid, winner+1, loser+1, saved.Meta.Zid)
+	for i := range found {
+		if !found[i] {
+			if err = s.putZettel(ctx, i, saved); err != nil {
+				return err
+			}
+		}
+	}
+	return s.putZettel(ctx, loser, zs[winner])
+}
+
+// findSavedVersion searches both stores for the given saved version of a
+// conflicting zettel, e.g. because a previous synchronisation failed. It
+// returns the stored zettel and in which stores it was found.
+func (s *syncer) findSavedVersion(ctx context.Context, saved zettel.Zettel) (zettel.Zettel, [2]bool, error) {
+	var result zettel.Zettel
+	var found [2]bool
+	predecessor := saved.Meta.GetDefault(api.KeyPredecessor, "")
+	candidate := zettel.Zettel{Meta: saved.Meta.Clone(), Content: saved.Content}
+	for i, mb := range s.stores {
+		var zids id.Slice
+		err := mb.ApplyMeta(
+			box.NoEnrichContext(ctx),
+			func(m *meta.Meta) {
+				if m.GetDefault(api.KeyPredecessor, "") == predecessor {
+					zids = append(zids, m.Zid)
+				}
+			},
+			func(id.Zid) bool { return true })
+		if err != nil {
+			return result, found, err
+		}
+		slices.Sort(zids)
+		for _, zid := range zids {
+			if found[0] && zid != result.Meta.Zid {
+				continue
+			}
+			z, err2 := mb.GetZettel(ctx, zid)
+			if err2 != nil {
+				return result, found, err2
+			}
+			candidate.Meta.Zid = zid
+			if isSameZettel(z, candidate, api.KeyCreated) {
+				result, found[i] = z, true
+				break
+			}
+		}
+	}
+	return result, found, nil
+}
+
+// isSameZettel returns true, if both zettel differ at most in their
+// modification timestamp, and in the values of the given keys.
+func isSameZettel(z1, z2 zettel.Zettel, keys ...string) bool {
+	m1, m2 := z1.Meta.Clone(), z2.Meta.Clone()
+	for _, key := range append(keys, api.KeyModified) {
+		m1.Delete(key)
+		m2.Delete(key)
+	}
+	return m1.Equal(m2, false) && z1.Content.Equal(&z2.Content)
+}
+
+// assignsZid returns true, if the given store cannot create a zettel with a
+// given identifier.
+func (s *syncer) assignsZid(i int) bool {
+	za, ok := s.stores[i].(box.ZidAssigner)
+	return ok && za.AssignsZid()
+}
+
+func createZettelIn(ctx context.Context, mb box.ManagedBox, z zettel.Zettel) (id.Zid, error) {
+	if wb, ok := mb.(box.WriteBox); ok {
+		return wb.CreateZettel(ctx, z)
+	}
+	return id.Invalid, box.ErrReadOnly
+}
+
+var errCreateWithZid = errors.New("store does not allow to create a zettel with a given identifier")
+
+// putZettel stores the zettel in the given store. The zettel has its
+// identifier of the first store.
+func (s *syncer) putZettel(ctx context.Context, i int, z zettel.Zettel) error {
+	wb, ok := s.stores[i].(box.WriteBox)
+	if !ok {
+		return box.ErrReadOnly
+	}
+	if zid := s.storeZid(i, z.Meta.Zid); zid != z.Meta.Zid {
+		z.Meta = z.Meta.Clone()
+		z.Meta.Zid = zid
+	}
+	err := wb.UpdateZettel(ctx, z)
+	if errors.As(err, &box.ErrZettelNotFound{}) {
+		// E.g. a remote Zettelstore, that creates new identifier.
+		return errCreateWithZid
+	}
+	return err
+}
+
+// ---------- Persistent state -----------------------------------------------
+
+const syncStateHeader = "zettelstore-sync 1"
+
+// readSyncState reads the state of the last synchronisation of the given
+// stores, together with the mapping of zettel identifier. If the file does not
+// exist, or stores the state of other stores, an empty state is returned.
+func readSyncState(filename string, locations [2]string) (syncState, syncZidMap, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return syncState{}, syncZidMap{}, nil
+		}
+		return nil, nil, err
+	}
+	state, zids, locs, err := parseSyncState(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	switch locs {
+	case locations:
+		return state, zids, nil
+	case [2]string{locations[1], locations[0]}:
+		swapped, swappedZids := make(syncState, len(state)), make(syncZidMap, len(zids))
+		for zid, vers := range state {
+			zid2 := zid
+			if mapped, found := zids[zid]; found {
+				zid2 = mapped
+				swappedZids[zid2] = zid
+			}
+			swapped[zid2] = [2]string{vers[1], vers[0]}
+		}
+		return swapped, swappedZids, nil
+	}
+	fmt.Fprintf(os.Stderr, "%s stores the state of other stores, comparing all zettel\n", filename)
+	return syncState{}, syncZidMap{}, nil
+}
+
+// parseSyncState parses the state file. Every line of the state stores the
+// identifier of a zettel, its version in both stores, and optionally its
+// identifier in the second store, if it differs.
+func parseSyncState(data []byte) (syncState, syncZidMap, [2]string, error) {
+	var locs [2]string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	if !sc.Scan() || sc.Text() != syncStateHeader {
+		return nil, nil, locs, errors.New("no synchronisation state")
+	}
+	for i := range locs {
+		if !sc.Scan() {
+			return nil, nil, locs, errors.New("missing store location")
+		}
+		locs[i] = sc.Text()
+	}
+	state, zids := syncState{}, syncZidMap{}
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 && len(fields) != 4 {
+			return nil, nil, locs, fmt.Errorf("invalid line %q", sc.Text())
+		}
+		zid, err := id.Parse(fields[0])
+		if err != nil {
+			return nil, nil, locs, err
+		}
+		state[zid] = [2]string{strings.Trim(fields[1], "-"), strings.Trim(fields[2], "-")}
+		if len(fields) == 4 {
+			zid2, err2 := id.Parse(fields[3])
+			if err2 != nil {
+				return nil, nil, locs, err2
+			}
+			zids[zid] = zid2
+		}
+	}
+	return state, zids, locs, sc.Err()
+}
+
+// writeSyncState writes the state into a temporary file first, which then
+// replaces the previous state.
+func writeSyncState(filename string, locations [2]string, state syncState, zids syncZidMap) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n%s\n%s\n", syncStateHeader, locations[0], locations[1])
+	stateZids := make(id.Slice, 0, len(state))
+	for zid := range state {
+		stateZids = append(stateZids, zid)
+	}
+	slices.Sort(stateZids)
+	for _, zid := range stateZids {
+		vers := state[zid]
+		fmt.Fprintf(&buf, "%v %s %s", zid, versionField(vers[0]), versionField(vers[1]))
+		if zid2, found := zids[zid]; found {
+			fmt.Fprintf(&buf, " %v", zid2)
+		}
+		buf.WriteByte('\n')
+	}
+	tmpname := filename + ".tmp"
+	if err := os.WriteFile(tmpname, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpname, filename)
+}
+
+// versionField encodes an empty version, which would be lost otherwise.
+func versionField(ver string) string {
+	if ver == "" {
+		return "-"
+	}
+	return ver
+}
@@ -0,0 +1,348 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/usecase"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// syncTestBox is a minimal writable box for testing the synchronisation.
+type syncTestBox struct {
+	zettel map[id.Zid]zettel.Zettel
+	next   id.Zid
+}
+
+func newSyncTestBox(next id.Zid) *syncTestBox {
+	return &syncTestBox{zettel: map[id.Zid]zettel.Zettel{}, next: next}
+}
+
+func (*syncTestBox) Location() string { return "test:" }
+func (tb *syncTestBox) GetZettel(_ context.Context, zid id.Zid) (zettel.Zettel, error) {
+	if z, found := tb.zettel[zid]; found {
+		return zettel.Zettel{Meta: z.Meta.Clone(), Content: z.Content}, nil
+	}
+	return zettel.Zettel{}, box.ErrZettelNotFound{Zid: zid}
+}
+func (tb *syncTestBox) HasZettel(_ context.Context, zid id.Zid) bool {
+	_, found := tb.zettel[zid]
+	return found
+}
+func (tb *syncTestBox) ApplyZid(_ context.Context, handle box.ZidFunc, constraint query.RetrievePredicate) error {
+	for zid := range tb.zettel {
+		if constraint(zid) {
+			handle(zid)
+		}
+	}
+	return nil
+}
+func (tb *syncTestBox) ApplyMeta(_ context.Context, handle box.MetaFunc, constraint query.RetrievePredicate) error {
+	for zid, z := range tb.zettel {
+		if constraint(zid) {
+			handle(z.Meta.Clone())
+		}
+	}
+	return nil
+}
+func (tb *syncTestBox) ReadStats(st *box.ManagedBoxStats) { st.Zettel = len(tb.zettel) }
+func (*syncTestBox) CanCreateZettel(context.Context) bool { return true }
+func (tb *syncTestBox) CreateZettel(_ context.Context, z zettel.Zettel) (id.Zid, error) {
+	zid := tb.next
+	tb.next++
+	z.Meta = z.Meta.Clone()
+	z.Meta.Zid = zid
+	tb.zettel[zid] = z
+	return zid, nil
+}
+func (*syncTestBox) CanUpdateZettel(context.Context, zettel.Zettel) bool { return true }
+func (tb *syncTestBox) UpdateZettel(_ context.Context, z zettel.Zettel) error {
+	tb.zettel[z.Meta.Zid] = zettel.Zettel{Meta: z.Meta.Clone(), Content: z.Content}
+	return nil
+}
+func (*syncTestBox) CanDeleteZettel(context.Context, id.Zid) bool { return true }
+func (tb *syncTestBox) DeleteZettel(_ context.Context, zid id.Zid) error {
+	delete(tb.zettel, zid)
+	return nil
+}
+
+func (tb *syncTestBox) set(zid id.Zid, modified, content string) {
+	m := meta.New(zid)
+	m.Set(api.KeyTitle, zid.String())
+	m.Set(api.KeyModified, modified)
+	tb.zettel[zid] = zettel.Zettel{Meta: m, Content: zettel.NewContent([]byte(content))}
+}
+
+func (tb *syncTestBox) content(zid id.Zid) string {
+	if z, found := tb.zettel[zid]; found {
+		return z.Content.AsString()
+	}
+	return ""
+}
+
+func TestSync(t *testing.T) {
+	b1, b2 := newSyncTestBox(20241018130000), newSyncTestBox(20241018140000)
+	b1.set(20241018120001, "20241018120001", "one")
+	b1.set(20241018120002, "20241018120002", "two")
+	b2.set(20241018120003, "20241018120003", "three")
+	s := syncer{stores: [2]box.ManagedBox{b1, b2}, state: syncState{}, out: io.Discard}
+	runSync := func(expCopied, expDeleted, expConflicts int) {
+		t.Helper()
+		s.copied, s.deleted, s.conflicts = 0, 0, 0
+		if err := s.run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if s.copied != expCopied || s.deleted != expDeleted || s.conflicts != expConflicts || len(s.failed) != 0 {
+			t.Errorf("expected %d/%d/%d copied/deleted/conflicts, but got %d/%d/%d (%v)",
+				expCopied, expDeleted, expConflicts, s.copied, s.deleted, s.conflicts, s.failed)
+		}
+		if len(b1.zettel) != len(b2.zettel) || len(s.state) != len(b1.zettel) {
+			t.Errorf("stores not in sync: %d/%d zettel, %d state entries", len(b1.zettel), len(b2.zettel), len(s.state))
+		}
+	}
+
+	runSync(3, 0, 0)
+	runSync(0, 0, 0)
+
+	b1.set(20241018120001, "20241018150000", "one changed")
+	delete(b2.zettel, 20241018120002)
+	runSync(1, 1, 0)
+	if got := b2.content(20241018120001); got != "one changed" {
+		t.Errorf("change not copied, got %q", got)
+	}
+	if b1.HasZettel(context.Background(), 20241018120002) {
+		t.Error("deletion not synchronised")
+	}
+
+	b1.set(20241018120003, "20241018160000", "three in 1")
+	b2.set(20241018120003, "20241018170000", "three in 2")
+	runSync(0, 0, 1)
+	if got1, got2 := b1.content(20241018120003), b2.content(20241018120003); got1 != "three in 2" || got2 != got1 {
+		t.Errorf("newer version should win, but got %q and %q", got1, got2)
+	}
+	saved, err := b2.GetZettel(context.Background(), 20241018130000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Content.AsString(); got != "three in 1" {
+		t.Errorf("older version should be saved, but got %q", got)
+	}
+	if got := saved.Meta.GetDefault(api.KeyPredecessor, ""); got != "20241018120003" {
+		t.Errorf("saved version should have predecessor, but got %q", got)
+	}
+
+	b1.set(20241018120001, "20241018180000", "one")
+	b2.set(20241018120001, "20241018190000", "one")
+	runSync(0, 0, 0)
+}
+
+func TestSyncState(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state")
+	locs := [2]string{"dir:a", "remote://localhost:23123/"}
+	state := syncState{20241018120000: {"20241018120000", ""}, 20241018120001: {"20241018120001", "20241018130000"}}
+	zids := syncZidMap{20241018120001: 20241018140000}
+	if err := writeSyncState(filename, locs, state, zids); err != nil {
+		t.Fatal(err)
+	}
+	got, gotZids, err := readSyncState(filename, locs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[20241018120000] != state[20241018120000] || got[20241018120001] != state[20241018120001] {
+		t.Errorf("expected %v, but got %v", state, got)
+	}
+	if len(gotZids) != 1 || gotZids[20241018120001] != 20241018140000 {
+		t.Errorf("expected mapping %v, but got %v", zids, gotZids)
+	}
+	got, gotZids, err = readSyncState(filename, [2]string{locs[1], locs[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := [2]string{"20241018130000", "20241018120001"}; got[20241018140000] != exp {
+		t.Errorf("expected swapped versions %v, but got %v", exp, got[20241018140000])
+	}
+	if len(gotZids) != 1 || gotZids[20241018140000] != 20241018120001 {
+		t.Errorf("expected swapped mapping, but got %v", gotZids)
+	}
+	if got, _, err = readSyncState(filename, [2]string{"dir:b", locs[1]}); err != nil || len(got) != 0 {
+		t.Errorf("expected empty state for other stores, but got %v / %v", got, err)
+	}
+}
+
+func TestSyncIgnoresPredefined(t *testing.T) {
+	b1, b2 := newSyncTestBox(20241018130000), newSyncTestBox(20241018140000)
+	b1.set(id.ConfigurationZid, "20241018120000", "configuration of store 1")
+	b1.set(20241018120001, "20241018120001", "one")
+	b2.set(id.ConfigurationZid, "20241018120000", "configuration of store 2")
+	s := syncer{stores: [2]box.ManagedBox{b1, b2}, state: syncState{}, out: io.Discard}
+	if err := s.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s.copied != 1 || s.conflicts != 0 || len(s.state) != 1 {
+		t.Errorf("only one zettel should be copied, but got %d copied, %d conflicts, state %v", s.copied, s.conflicts, s.state)
+	}
+	if got := b2.content(id.ConfigurationZid); got != "configuration of store 2" {
+		t.Errorf("configuration must not be changed, but got %q", got)
+	}
+}
+
+// syncAssignBox is a box that assigns the identifier of new zettel, like a
+// remote Zettelstore.
+type syncAssignBox struct{ *syncTestBox }
+
+func (syncAssignBox) AssignsZid() bool { return true }
+func (ab syncAssignBox) UpdateZettel(ctx context.Context, z zettel.Zettel) error {
+	if !ab.HasZettel(ctx, z.Meta.Zid) {
+		return box.ErrZettelNotFound{Zid: z.Meta.Zid}
+	}
+	return ab.syncTestBox.UpdateZettel(ctx, z)
+}
+
+func TestSyncAssignsZid(t *testing.T) {
+	ctx := context.Background()
+	b1, b2 := newSyncTestBox(20241018130000), newSyncTestBox(20241018140000)
+	b1.set(20241018120001, "20241018120001", "one")
+	b1.set(20241018120002, "20241018120002", "two")
+	b2.set(20241018120002, "20241018120002", "two")
+	s := syncer{stores: [2]box.ManagedBox{b1, syncAssignBox{b2}}, state: syncState{}, out: io.Discard}
+	runSync := func() {
+		t.Helper()
+		if err := s.run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.failed) != 0 {
+			t.Errorf("no errors expected, but got %v", s.failed)
+		}
+	}
+
+	// A new zettel gets a new identifier in store 2.
+	runSync()
+	if got := b2.content(20241018140000); got != "one" {
+		t.Errorf("new zettel must be created in store 2, but got %q", got)
+	}
+	if got := s.zids[20241018120001]; got != 20241018140000 {
+		t.Errorf("identifier must be mapped, but got %v", s.zids)
+	}
+	if len(s.state) != 2 || len(b2.zettel) != 2 {
+		t.Errorf("stores not in sync: state %v, %d zettel in store 2", s.state, len(b2.zettel))
+	}
+
+	// The mapping is stored together with the state.
+	filename := filepath.Join(t.TempDir(), "state")
+	locs := [2]string{"dir:a", "remote://localhost:23123/"}
+	if err := writeSyncState(filename, locs, s.state, s.zids); err != nil {
+		t.Fatal(err)
+	}
+	state, zids, err := readSyncState(filename, locs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = syncer{stores: s.stores, state: state, zids: zids, out: io.Discard}
+
+	// Changes are copied in both directions.
+	b2.set(20241018140000, "20241018150000", "one in 2")
+	runSync()
+	if got := b1.content(20241018120001); got != "one in 2" || len(b1.zettel) != 2 {
+		t.Errorf("change must be copied into store 1, but got %q and %d zettel", got, len(b1.zettel))
+	}
+	b1.set(20241018120001, "20241018160000", "one in 1")
+	runSync()
+	if got := b2.content(20241018140000); got != "one in 1" || len(b2.zettel) != 2 {
+		t.Errorf("change must be copied into store 2, but got %q and %d zettel", got, len(b2.zettel))
+	}
+
+	// A new zettel of store 2 keeps its identifier in store 1.
+	b2.set(20241018140005, "20241018140005", "five")
+	runSync()
+	if got := b1.content(20241018140005); got != "five" {
+		t.Errorf("new zettel must be copied into store 1, but got %q", got)
+	}
+
+	// A deletion uses the mapped identifier, which is then removed.
+	delete(b2.zettel, 20241018140000)
+	runSync()
+	if b1.HasZettel(ctx, 20241018120001) {
+		t.Error("deletion not synchronised")
+	}
+	if len(s.zids) != 0 {
+		t.Errorf("mapping must be removed, but got %v", s.zids)
+	}
+
+	// A saved version of a previous, failed synchronisation is reused.
+	b1.set(20241018120002, "20241018160000", "two in 1")
+	b2.set(20241018120002, "20241018170000", "two in 2")
+	var createZettel usecase.CreateZettel
+	leftover := createZettel.PrepareVersion(b1.zettel[20241018120002])
+	leftover.Meta.Delete(api.KeyModified)
+	leftover.Meta.Set(api.KeyCreated, "20241018180000")
+	leftoverZid, _ := b2.CreateZettel(ctx, leftover)
+
+	runSync()
+	if s.conflicts != 1 {
+		t.Errorf("expected one conflict, but got %d", s.conflicts)
+	}
+	if len(b1.zettel) != 3 || len(b2.zettel) != 3 {
+		t.Errorf("saved version must not be created again, got %d/%d zettel", len(b1.zettel), len(b2.zettel))
+	}
+	if got := b1.content(leftoverZid); got != "two in 1" {
+		t.Errorf("saved version must be copied into store 1, but got %q", got)
+	}
+	if got := b1.content(20241018120002); got != "two in 2" {
+		t.Errorf("newer version should win, but got %q", got)
+	}
+
+	// Store 2 wins, so it must create the saved version.
+	b1.set(20241018120002, "20241018200000", "two again in 1")
+	b2.set(20241018120002, "20241018210000", "two again in 2")
+	savedZid := b2.next
+	runSync()
+	if got1, got2 := b1.content(savedZid), b2.content(savedZid); got1 != "two again in 1" || got2 != got1 {
+		t.Errorf("saved version should be in both stores, but got %q and %q", got1, got2)
+	}
+}
+
+func TestSyncAssignsZidFirst(t *testing.T) {
+	b1, b2 := newSyncTestBox(20241018130000), newSyncTestBox(20241018140000)
+	b2.set(20241018120001, "20241018120001", "one")
+	s := syncer{stores: [2]box.ManagedBox{syncAssignBox{b1}, b2}, state: syncState{}, out: io.Discard}
+	if err := s.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := b1.content(20241018130000); got != "one" {
+		t.Errorf("new zettel must be created in store 1, but got %q", got)
+	}
+	if len(s.zids) != 1 || s.zids[20241018130000] != 20241018120001 {
+		t.Errorf("identifier must be mapped, but got %v", s.zids)
+	}
+	if _, found := s.state[20241018130000]; !found || len(s.state) != 1 {
+		t.Errorf("state must use identifier of store 1, but got %v", s.state)
+	}
+
+	b1.set(20241018130000, "20241018150000", "one in 1")
+	if err := s.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := b2.content(20241018120001); got != "one in 1" || len(b2.zettel) != 1 {
+		t.Errorf("change must be copied into store 2, but got %q and %d zettel", got, len(b2.zettel))
+	}
+}
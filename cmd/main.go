@@ -30,7 +30,9 @@ import (
 	"zettelstore.de/z/auth"
 	"zettelstore.de/z/auth/impl"
 	"zettelstore.de/z/box"
+	"zettelstore.de/z/box/auditbox"
 	"zettelstore.de/z/box/compbox"
+	"zettelstore.de/z/box/filebox"
 	"zettelstore.de/z/box/manager"
 	"zettelstore.de/z/config"
 	"zettelstore.de/z/kernel"
@@ -85,6 +87,15 @@ func init() {
 			fs.String("t", api.EncoderHTML.String(), "target output encoding")
 		},
 	})
+	RegisterCommand(Command{
+		Name: "convert",
+		Func: cmdConvert,
+	})
+	RegisterCommand(Command{
+		Name:     "sync",
+		Func:     cmdSync,
+		SetFlags: flgSync,
+	})
 	RegisterCommand(Command{
 		Name: "password",
 		Func: cmdPassword,
@@ -161,6 +172,7 @@ func deleteConfiguredBoxes(cfg *meta.Meta) {
 const (
 	keyAdminPort         = "admin-port"
 	keyAssetDir          = "asset-dir"
+	keyAuditLog          = "audit-log"
 	keyBaseURL           = "base-url"
 	keyDebug             = "debug-mode"
 	keyDefaultDirBoxType = "default-dir-box-type"
@@ -169,12 +181,15 @@ const (
 	keyListenAddr        = "listen-addr"
 	keyLogLevel          = "log-level"
 	keyMaxRequestSize    = "max-request-size"
+	keyMaxUploadSize     = "max-upload-size"
 	keyOwner             = "owner"
 	keyPersistentCookie  = "persistent-cookie"
+	keyProxyUserHeader   = "proxy-user-header"
 	keyBoxOneURI         = kernel.BoxURIs + "1"
 	keyReadOnly          = "read-only-mode"
 	keyTokenLifetimeHTML = "token-lifetime-html"
 	keyTokenLifetimeAPI  = "token-lifetime-api"
+	keyTrustedProxies    = "trusted-proxies"
 	keyURLPrefix         = "url-prefix"
 	keyVerbose           = "verbose-mode"
 )
@@ -223,6 +238,9 @@ func setServiceConfig(cfg *meta.Meta) bool {
 	if val, found := cfg.Get(keyMaxRequestSize); found {
 		err = setConfigValue(err, kernel.WebService, kernel.WebMaxRequestSize, val)
 	}
+	if val, found := cfg.Get(keyMaxUploadSize); found {
+		err = setConfigValue(err, kernel.WebService, kernel.WebMaxUploadSize, val)
+	}
 	err = setConfigValue(
 		err, kernel.WebService, kernel.WebTokenLifetimeAPI, cfg.GetDefault(keyTokenLifetimeAPI, ""))
 	err = setConfigValue(
@@ -230,6 +248,12 @@ func setServiceConfig(cfg *meta.Meta) bool {
 	if val, found := cfg.Get(keyAssetDir); found {
 		err = setConfigValue(err, kernel.WebService, kernel.WebAssetDir, val)
 	}
+	if val, found := cfg.Get(keyProxyUserHeader); found {
+		err = setConfigValue(err, kernel.WebService, kernel.WebProxyUserHeader, val)
+	}
+	if val, found := cfg.Get(keyTrustedProxies); found {
+		err = setConfigValue(err, kernel.WebService, kernel.WebTrustedProxies, val)
+	}
 	return err == nil
 }
 
@@ -265,6 +289,9 @@ func executeCommand(name string, args ...string) int {
 	if command.Boxes {
 		createManager = func(boxURIs []*url.URL, authManager auth.Manager, rtConfig config.Config) (box.Manager, error) {
 			compbox.Setup(cfg)
+			if err := auditbox.Setup(cfg.GetDefault(keyAuditLog, ""), &getUserImpl{}); err != nil {
+				return nil, err
+			}
 			return manager.New(boxURIs, authManager, rtConfig)
 		}
 	} else {
@@ -277,11 +304,14 @@ func executeCommand(name string, args ...string) int {
 		return 2
 	}
 	cfg.Delete("secret")
+	if secret != "" {
+		filebox.SetupEncryption(secret)
+	}
 	secret = fmt.Sprintf("%x", sha256.Sum256([]byte(secret)))
 
 	kern.SetCreators(
-		func(readonly bool, owner id.Zid) (auth.Manager, error) {
-			return impl.New(readonly, owner, secret), nil
+		func(readonly bool, owners []id.Zid) (auth.Manager, error) {
+			return impl.New(readonly, owners, secret), nil
 		},
 		createManager,
 		func(srv server.Server, plMgr box.Manager, authMgr auth.Manager, rtConfig config.Config) error {
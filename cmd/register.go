@@ -16,11 +16,18 @@ package cmd
 
 // Mention all needed encoders, parsers and stores to have them registered.
 import (
+	_ "zettelstore.de/z/box/auditbox"      // Allow to use audit box.
 	_ "zettelstore.de/z/box/compbox"       // Allow to use computed box.
 	_ "zettelstore.de/z/box/constbox"      // Allow to use global internal box.
+	_ "zettelstore.de/z/box/dbbox"         // Allow to use database box.
 	_ "zettelstore.de/z/box/dirbox"        // Allow to use directory box.
+	_ "zettelstore.de/z/box/feedbox"       // Allow to use feed box.
 	_ "zettelstore.de/z/box/filebox"       // Allow to use file box.
+	_ "zettelstore.de/z/box/mailbox"       // Allow to use mail box.
 	_ "zettelstore.de/z/box/membox"        // Allow to use in-memory box.
+	_ "zettelstore.de/z/box/overlaybox"    // Allow to use overlay box.
+	_ "zettelstore.de/z/box/remotebox"     // Allow to use remote box.
+	_ "zettelstore.de/z/box/s3box"         // Allow to use S3 box.
 	_ "zettelstore.de/z/encoder/htmlenc"   // Allow to use HTML encoder.
 	_ "zettelstore.de/z/encoder/mdenc"     // Allow to use markdown encoder.
 	_ "zettelstore.de/z/encoder/shtmlenc"  // Allow to use SHTML encoder.
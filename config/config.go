@@ -26,6 +26,7 @@ const (
 	KeyHomeZettel           = "home-zettel"
 	KeyShowBackLinks        = "show-back-links"
 	KeyShowFolgeLinks       = "show-folge-links"
+	KeyShowRelatedLinks     = "show-related-links"
 	KeyShowSubordinateLinks = "show-subordinate-links"
 	KeyShowSuccessorLinks   = "show-successor-links"
 	// api.KeyLang
@@ -44,6 +44,7 @@ import (
 type Port interface {
 	GetZettel(context.Context, id.Zid) (zettel.Zettel, error)
 	QueryMeta(ctx context.Context, q *query.Query) ([]*meta.Meta, error)
+	QueryDuplicates(ctx context.Context, q *query.Query, ml []*meta.Meta) []query.DuplicateGroup
 }
 
 // EvaluateZettel evaluates the given zettel in the given context, with the
@@ -296,7 +297,7 @@ func (e *evaluator) evalQueryTransclusion(expr string) ast.BlockNode {
 		}
 		return makeBlockNode(createInlineErrorText(nil, "Unable", "to", "search", "zettel"))
 	}
-	result, _ := QueryAction(e.ctx, q, ml, e.rtConfig)
+	result, _ := QueryAction(e.ctx, q, ml, e.port.QueryDuplicates(e.ctx, q, ml), e.rtConfig)
 	if result != nil {
 		ast.Walk(e, result)
 	}
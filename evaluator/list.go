@@ -33,7 +33,8 @@ import (
 )
 
 // QueryAction transforms a list of metadata according to query actions into a AST nested list.
-func QueryAction(ctx context.Context, q *query.Query, ml []*meta.Meta, rtConfig config.Config) (ast.BlockNode, int) {
+// If the query contains a DUPLICATES action, the groups of duplicates must be given.
+func QueryAction(ctx context.Context, q *query.Query, ml []*meta.Meta, dups []query.DuplicateGroup, rtConfig config.Config) (ast.BlockNode, int) {
 	ap := actionPara{
 		ctx:   ctx,
 		q:     q,
@@ -43,10 +44,27 @@ func QueryAction(ctx context.Context, q *query.Query, ml []*meta.Meta, rtConfig
 		max:   -1,
 		title: rtConfig.GetSiteName(),
 	}
+	if plan := q.Explain(); plan != nil {
+		var buf bytes.Buffer
+		plan.Print(&buf)
+		return &ast.VerbatimNode{Kind: ast.VerbatimProg, Attrs: nil, Content: buf.Bytes()}, len(ml)
+	}
 	actions := q.Actions()
+	if paths, isPath := q.Paths(ml); isPath && len(actions) == 0 {
+		return ap.createBlockNodePaths(paths)
+	}
 	if len(actions) == 0 {
 		return ap.createBlockNodeMeta("")
 	}
+	if _, isDuplicates := query.DuplicatesSpecFromActions(actions); isDuplicates {
+		return ap.createBlockNodeDuplicates(dups)
+	}
+	if spec, isGroup := query.GroupSpecFromActions(actions); isGroup {
+		return ap.createBlockNodeGroup(spec)
+	}
+	if keys, isTable := query.TableKeys(actions); isTable {
+		return ap.createBlockNodeTable(keys)
+	}
 
 	acts := make([]string, 0, len(actions))
 	for i, act := range actions {
@@ -267,6 +285,217 @@ func (ap *actionPara) createBlockNodeMeta(key string) (ast.BlockNode, int) {
 	}, len(items)
 }
 
+// createBlockNodePaths shows each path as a breadcrumb trail.
+func (ap *actionPara) createBlockNodePaths(paths [][]*meta.Meta) (ast.BlockNode, int) {
+	if len(paths) == 0 {
+		return nil, 0
+	}
+	items := make([]ast.ItemSlice, 0, len(paths))
+	for _, path := range paths {
+		is := make(ast.InlineSlice, 0, 2*len(path))
+		for i, m := range path {
+			if i > 0 {
+				is = append(is, &ast.TextNode{Text: " \u2192 "})
+			}
+			is = append(is, &ast.LinkNode{
+				Attrs:   nil,
+				Ref:     ast.ParseReference(m.Zid.String()),
+				Inlines: parser.ParseSpacedText(m.GetTitle()),
+			})
+		}
+		items = append(items, ast.ItemSlice{ast.CreateParaNode(is...)})
+	}
+	return &ast.NestedListNode{
+		Kind:  ap.kind,
+		Items: items,
+		Attrs: nil,
+	}, len(items)
+}
+
+// createBlockNodeDuplicates shows each group of duplicates, together with
+// links to compare the zettel, and to list the zettel that reference the
+// duplicates of the first zettel. These must be updated, if the duplicates
+// are merged into the first zettel.
+func (ap *actionPara) createBlockNodeDuplicates(groups []query.DuplicateGroup) (ast.BlockNode, int) {
+	if len(groups) == 0 {
+		return nil, 0
+	}
+	items := make([]ast.ItemSlice, 0, len(groups))
+	for _, g := range groups {
+		is := make(ast.InlineSlice, 0, 2*len(g.Zettel)+4)
+		is = append(is, &ast.TextNode{Text: strconv.Itoa(g.Similarity) + "%: "})
+		var compare, refs bytes.Buffer
+		compare.WriteString(ast.QueryPrefix)
+		refs.WriteString(ast.QueryPrefix)
+		for i, m := range g.Zettel {
+			zid := m.Zid.String()
+			if i > 0 {
+				is = append(is, &ast.TextNode{Text: ", "})
+				if i > 1 {
+					refs.WriteString(" OR ")
+				}
+				refs.WriteString(api.KeyForward + api.SearchOperatorHas + zid)
+			}
+			is = append(is, &ast.LinkNode{
+				Attrs:   nil,
+				Ref:     ast.ParseReference(zid),
+				Inlines: parser.ParseSpacedText(m.GetTitle()),
+			})
+			compare.WriteString(zid)
+			compare.WriteByte(' ')
+		}
+		compare.WriteString(api.IdentDirective + api.ActionSeparator + query.TableAction + " id title created modified back")
+		is = append(is,
+			&ast.TextNode{Text: " ("},
+			&ast.LinkNode{Attrs: nil, Ref: ast.ParseReference(compare.String()), Inlines: ast.InlineSlice{&ast.TextNode{Text: "compare"}}},
+			&ast.TextNode{Text: ", "},
+			&ast.LinkNode{Attrs: nil, Ref: ast.ParseReference(refs.String()), Inlines: ast.InlineSlice{&ast.TextNode{Text: "references"}}},
+			&ast.TextNode{Text: ")"},
+		)
+		items = append(items, ast.ItemSlice{ast.CreateParaNode(is...)})
+	}
+	return &ast.NestedListNode{
+		Kind:  ap.kind,
+		Items: items,
+		Attrs: nil,
+	}, len(items)
+}
+
+func (ap *actionPara) createBlockNodeTable(keys []string) (ast.BlockNode, int) {
+	if len(ap.ml) == 0 {
+		return nil, 0
+	}
+	header := make(ast.TableRow, len(keys))
+	for i, key := range keys {
+		header[i] = &ast.TableCell{Align: ast.AlignDefault, Inlines: ap.tableHeaderInlines(keys, key)}
+	}
+	rows := make([]ast.TableRow, 0, len(ap.ml))
+	for _, m := range ap.ml {
+		row := make(ast.TableRow, len(keys))
+		for i, key := range keys {
+			row[i] = &ast.TableCell{Align: ast.AlignDefault, Inlines: tableCellInlines(m, key)}
+		}
+		rows = append(rows, row)
+	}
+	align := make([]ast.Alignment, len(keys))
+	for i := range align {
+		align[i] = ast.AlignDefault
+	}
+	return &ast.TableNode{Header: header, Align: align, Rows: rows}, len(rows)
+}
+
+// tableHeaderInlines returns a link to the same table, but sorted by the
+// given key. If the table is already sorted by the key, the order is reversed.
+func (ap *actionPara) tableHeaderInlines(keys []string, key string) ast.InlineSlice {
+	ordered, descending := ap.q.OrderedBy(key)
+	sea := ap.q.Clone()
+	sea.RemoveActions()
+	sea = sea.SetOrder(key, ordered && !descending)
+
+	var buf bytes.Buffer
+	buf.WriteString(ast.QueryPrefix)
+	sea.Print(&buf)
+	buf.WriteByte(' ')
+	buf.WriteString(api.ActionSeparator)
+	buf.WriteByte(' ')
+	buf.WriteString(query.TableAction)
+	for _, k := range keys {
+		buf.WriteByte(' ')
+		buf.WriteString(k)
+	}
+
+	text := key
+	if ordered {
+		if descending {
+			text += " \u25bc"
+		} else {
+			text += " \u25b2"
+		}
+	}
+	return ast.InlineSlice{&ast.LinkNode{
+		Attrs:   nil,
+		Ref:     ast.ParseReference(buf.String()),
+		Inlines: ast.InlineSlice{&ast.TextNode{Text: text}},
+	}}
+}
+
+func tableCellInlines(m *meta.Meta, key string) ast.InlineSlice {
+	value, found := m.Get(key)
+	if !found {
+		return nil
+	}
+	switch key {
+	case api.KeyID:
+		return ast.InlineSlice{&ast.LinkNode{
+			Attrs:   nil,
+			Ref:     ast.ParseReference(value),
+			Inlines: ast.InlineSlice{&ast.TextNode{Text: value}},
+		}}
+	case api.KeyTitle:
+		return ast.InlineSlice{&ast.LinkNode{
+			Attrs:   nil,
+			Ref:     ast.ParseReference(m.Zid.String()),
+			Inlines: parser.ParseSpacedText(value),
+		}}
+	}
+	switch meta.Type(key) {
+	case meta.TypeID, meta.TypeIDSet:
+		var is ast.InlineSlice
+		for i, val := range meta.ListFromValue(value) {
+			if i > 0 {
+				is = append(is, &ast.TextNode{Text: " "})
+			}
+			is = append(is, &ast.LinkNode{
+				Attrs:   nil,
+				Ref:     ast.ParseReference(val),
+				Inlines: ast.InlineSlice{&ast.TextNode{Text: val}},
+			})
+		}
+		return is
+	case meta.TypeZettelmarkup:
+		return parser.ParseSpacedText(value)
+	}
+	return ast.InlineSlice{&ast.TextNode{Text: value}}
+}
+
+func (ap *actionPara) createBlockNodeGroup(spec *query.GroupSpec) (ast.BlockNode, int) {
+	rows := spec.Apply(ap.ml)
+	if len(rows) == 0 {
+		return nil, 0
+	}
+	columns := spec.Columns()
+	header := make(ast.TableRow, len(columns))
+	align := make([]ast.Alignment, len(columns))
+	for i, col := range columns {
+		header[i] = &ast.TableCell{Align: ast.AlignDefault, Inlines: ast.InlineSlice{&ast.TextNode{Text: col}}}
+		align[i] = ast.AlignRight
+	}
+	align[0] = ast.AlignLeft
+
+	var buf bytes.Buffer
+	ap.prepareSimpleQuery(&buf)
+	buf.WriteString(spec.Key)
+	buf.WriteString(api.SearchOperatorHas)
+	bufLen := buf.Len()
+
+	tableRows := make([]ast.TableRow, 0, len(rows))
+	for _, row := range rows {
+		buf.WriteString(row[0])
+		tableRow := make(ast.TableRow, len(row))
+		tableRow[0] = &ast.TableCell{Align: ast.AlignDefault, Inlines: ast.InlineSlice{&ast.LinkNode{
+			Attrs:   nil,
+			Ref:     ast.ParseReference(buf.String()),
+			Inlines: ast.InlineSlice{&ast.TextNode{Text: row[0]}},
+		}}}
+		buf.Truncate(bufLen)
+		for i, val := range row[1:] {
+			tableRow[i+1] = &ast.TableCell{Align: ast.AlignDefault, Inlines: ast.InlineSlice{&ast.TextNode{Text: val}}}
+		}
+		tableRows = append(tableRows, tableRow)
+	}
+	return &ast.TableNode{Header: header, Align: align, Rows: tableRows}, len(tableRows)
+}
+
 func (ap *actionPara) prepareCatAction(key string, buf *bytes.Buffer) (meta.CountedCategories, int) {
 	if len(ap.ml) == 0 {
 		return nil, 0
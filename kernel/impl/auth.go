@@ -21,6 +21,7 @@ import (
 	"zettelstore.de/z/kernel"
 	"zettelstore.de/z/logger"
 	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
 )
 
 type authService struct {
@@ -37,15 +38,12 @@ func (as *authService) Initialize(logger *logger.Logger) {
 	as.logger = logger
 	as.descr = descriptionMap{
 		kernel.AuthOwner: {
-			"Owner's zettel id",
+			"Owners' zettel ids",
 			func(val string) (any, error) {
-				if owner := as.cur[kernel.AuthOwner]; owner != nil && owner != id.Invalid {
+				if owners, ok := as.cur[kernel.AuthOwner].([]id.Zid); ok && len(owners) > 0 {
 					return nil, errAlreadySetOwner
 				}
-				if val == "" {
-					return id.Invalid, nil
-				}
-				return parseZid(val)
+				return parseZidList(val)
 			},
 			false,
 		},
@@ -61,7 +59,7 @@ func (as *authService) Initialize(logger *logger.Logger) {
 		},
 	}
 	as.next = interfaceMap{
-		kernel.AuthOwner:    id.Invalid,
+		kernel.AuthOwner:    []id.Zid(nil),
 		kernel.AuthReadonly: false,
 	}
 }
@@ -72,8 +70,8 @@ func (as *authService) Start(*myKernel) error {
 	as.mxService.Lock()
 	defer as.mxService.Unlock()
 	readonlyMode := as.GetNextConfig(kernel.AuthReadonly).(bool)
-	owner := as.GetNextConfig(kernel.AuthOwner).(id.Zid)
-	authMgr, err := as.createManager(readonlyMode, owner)
+	owners := as.GetNextConfig(kernel.AuthOwner).([]id.Zid)
+	authMgr, err := as.createManager(readonlyMode, owners)
 	if err != nil {
 		as.logger.Error().Err(err).Msg("Unable to create manager")
 		return err
@@ -97,3 +95,36 @@ func (as *authService) Stop(*myKernel) {
 }
 
 func (*authService) GetStatistics() []kernel.KeyValue { return nil }
+
+// needsLogin returns true, if an administration console session must be
+// authenticated.
+func (as *authService) needsLogin() bool {
+	as.mxService.RLock()
+	defer as.mxService.RUnlock()
+	return as.manager != nil && as.manager.WithAuth()
+}
+
+var (
+	errNoAuthManager = errors.New("authentication service not started")
+	errNoAdmin       = errors.New("user is not allowed to administer")
+)
+
+// checkAdminToken validates the given API token and returns the user it was
+// issued for, but only if this user is allowed to administer the Zettelstore.
+func (as *authService) checkAdminToken(token string, getUser func(id.Zid, string) *meta.Meta) (*meta.Meta, error) {
+	as.mxService.RLock()
+	mgr := as.manager
+	as.mxService.RUnlock()
+	if mgr == nil {
+		return nil, errNoAuthManager
+	}
+	tokenData, err := mgr.CheckToken([]byte(token), auth.KindAPI)
+	if err != nil {
+		return nil, err
+	}
+	user := getUser(tokenData.Zid, tokenData.Ident)
+	if user == nil || !mgr.IsAdmin(user) {
+		return nil, errNoAdmin
+	}
+	return user, nil
+}
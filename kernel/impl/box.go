@@ -22,9 +22,12 @@ import (
 	"strconv"
 	"sync"
 
+	"t73f.de/r/zsc/api"
 	"zettelstore.de/z/box"
 	"zettelstore.de/z/kernel"
 	"zettelstore.de/z/logger"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
 )
 
 type boxService struct {
@@ -138,6 +141,25 @@ func (ps *boxService) DumpIndex(w io.Writer) {
 	ps.manager.Dump(w)
 }
 
+// GetUser returns the metadata of the user zettel with the given zettel
+// identifier, if its user identification matches the given ident.
+func (ps *boxService) GetUser(zid id.Zid, ident string) *meta.Meta {
+	ps.mxService.RLock()
+	mgr := ps.manager
+	ps.mxService.RUnlock()
+	if mgr == nil {
+		return nil
+	}
+	z, err := mgr.GetZettel(box.NoEnrichContext(context.Background()), zid)
+	if err != nil {
+		return nil
+	}
+	if userID, found := z.Meta.Get(api.KeyUserID); !found || userID != ident {
+		return nil
+	}
+	return z.Meta
+}
+
 func (ps *boxService) Refresh() error {
 	ps.mxService.RLock()
 	defer ps.mxService.RUnlock()
@@ -99,6 +99,7 @@ func (cs *configService) Initialize(logger *logger.Logger) {
 		kernel.ConfigSimpleMode:        {"Simple mode", cs.noFrozen(parseBool), true},
 		config.KeyShowBackLinks:        {"Show back links", parseString, true},
 		config.KeyShowFolgeLinks:       {"Show folge links", parseString, true},
+		config.KeyShowRelatedLinks:     {"Show related links", parseString, true},
 		config.KeyShowSubordinateLinks: {"Show subordinate links", parseString, true},
 		config.KeyShowSuccessorLinks:   {"Show successor links", parseString, true},
 	}
@@ -118,6 +119,7 @@ func (cs *configService) Initialize(logger *logger.Logger) {
 		kernel.ConfigSimpleMode:        false,
 		config.KeyShowBackLinks:        "",
 		config.KeyShowFolgeLinks:       "",
+		config.KeyShowRelatedLinks:     "false",
 		config.KeyShowSubordinateLinks: "",
 		config.KeyShowSuccessorLinks:   "",
 	}
@@ -22,10 +22,12 @@ import (
 	"strconv"
 	"strings"
 
+	"t73f.de/r/zsc/api"
 	"t73f.de/r/zsc/maps"
 	"zettelstore.de/z/kernel"
 	"zettelstore.de/z/logger"
 	"zettelstore.de/z/strfun"
+	"zettelstore.de/z/zettel/meta"
 )
 
 type cmdSession struct {
@@ -35,6 +37,7 @@ type cmdSession struct {
 	header   bool
 	colwidth int
 	eol      []byte
+	user     *meta.Meta
 }
 
 func (sess *cmdSession) initialize(w io.Writer, kern *myKernel) {
@@ -51,6 +54,10 @@ func (sess *cmdSession) executeLine(line string) bool {
 	}
 	cmd, args := splitLine(line)
 	if c, ok := commands[cmd]; ok {
+		if !publicCommands.Has(cmd) && sess.user == nil && sess.kern.auth.needsLogin() {
+			sess.println("Authentication required, use 'login TOKEN' first.")
+			return true
+		}
 		return c.Func(sess, cmd, args)
 	}
 	if cmd == "help" {
@@ -185,6 +192,7 @@ var commands = map[string]command{
 		},
 	},
 	"log-level":   {"get/set log level", cmdLogLevel},
+	"login":       {"authenticate as owner or administrator", cmdLogin},
 	"metrics":     {"show Go runtime metrics", cmdMetrics},
 	"next-config": {"show next configuration data", cmdNextConfig},
 	"profile":     {"start profiling", cmdProfile},
@@ -201,6 +209,9 @@ var commands = map[string]command{
 	"stop":  {"stop service", cmdStop},
 }
 
+// publicCommands can be executed without authentication.
+var publicCommands = strfun.NewSet("", "bye", "crlf", "echo", "header", "help", "login")
+
 func cmdHelp(sess *cmdSession, _ string, _ []string) bool {
 	cmds := maps.Keys(commands)
 	table := [][]string{{"Command", "Description"}}
@@ -512,6 +523,25 @@ func cmdDumpIndex(sess *cmdSession, _ string, _ []string) bool {
 	return true
 }
 
+func cmdLogin(sess *cmdSession, cmd string, args []string) bool {
+	if len(args) != 1 {
+		sess.usage(cmd, "TOKEN")
+		sess.println("-- An API token can be obtained via the web service.")
+		return true
+	}
+	kern := sess.kern
+	user, err := kern.auth.checkAdminToken(args[0], kern.box.GetUser)
+	if err != nil {
+		kern.logger.Mandatory().Err(err).Msg("Failed login on administration console")
+		sess.println("Login failed:", err.Error())
+		return true
+	}
+	sess.user = user
+	kern.logger.Mandatory().Zid(user.Zid).Msg("Login on administration console")
+	sess.println("Logged in as", user.GetDefault(api.KeyUserID, user.Zid.String()))
+	return true
+}
+
 func cmdRefresh(sess *cmdSession, _ string, _ []string) bool {
 	kern := sess.kern
 	kern.logger.Mandatory().Msg("Refresh")
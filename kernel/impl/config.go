@@ -248,6 +248,21 @@ func parseZid(val string) (any, error) {
 	}
 }
 
+func parseZidList(val string) (any, error) {
+	fields := strings.Fields(val)
+	result := make([]id.Zid, 0, len(fields))
+	for _, field := range fields {
+		zid, err := id.Parse(field)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(result, zid) {
+			result = append(result, zid)
+		}
+	}
+	return result, nil
+}
+
 func parseInvalidZid(val string) (any, error) {
 	zid, _ := id.Parse(val)
 	return zid, nil
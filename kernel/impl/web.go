@@ -81,7 +81,9 @@ func (ws *webService) Initialize(logger *logger.Logger) {
 			},
 			true},
 		kernel.WebMaxRequestSize:   {"Max Request Size", parseInt64, true},
+		kernel.WebMaxUploadSize:    {"Max Upload Size", parseInt64, true},
 		kernel.WebPersistentCookie: {"Persistent cookie", parseBool, true},
+		kernel.WebProxyUserHeader:  {"Header with user identification from proxy", parseString, true},
 		kernel.WebSecureCookie:     {"Secure cookie", parseBool, true},
 		kernel.WebTokenLifetimeAPI: {
 			"Token lifetime API",
@@ -93,6 +95,7 @@ func (ws *webService) Initialize(logger *logger.Logger) {
 			makeDurationParser(1*time.Hour, 1*time.Minute, 30*24*time.Hour),
 			true,
 		},
+		kernel.WebTrustedProxies: {"Networks of trusted proxies", parsePrefixList, true},
 		kernel.WebURLPrefix: {
 			"URL prefix under which the web server runs",
 			func(val string) (any, error) {
@@ -109,14 +112,40 @@ func (ws *webService) Initialize(logger *logger.Logger) {
 		kernel.WebBaseURL:           "http://127.0.0.1:23123/",
 		kernel.WebListenAddress:     "127.0.0.1:23123",
 		kernel.WebMaxRequestSize:    int64(16 * 1024 * 1024),
+		kernel.WebMaxUploadSize:     int64(1024 * 1024 * 1024),
 		kernel.WebPersistentCookie:  false,
+		kernel.WebProxyUserHeader:   "",
 		kernel.WebSecureCookie:      true,
 		kernel.WebTokenLifetimeAPI:  1 * time.Hour,
 		kernel.WebTokenLifetimeHTML: 10 * time.Minute,
+		kernel.WebTrustedProxies:    []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("::1/128")},
 		kernel.WebURLPrefix:         "/",
 	}
 }
 
+// parsePrefixList parses a list of network addresses, separated by space or
+// comma. An address without a prefix length denotes just this address.
+func parsePrefixList(val string) (any, error) {
+	fields := strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == ' ' })
+	result := make([]netip.Prefix, 0, len(fields))
+	for _, field := range fields {
+		if strings.IndexByte(field, '/') < 0 {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, prefix.Masked())
+	}
+	return result, nil
+}
+
 func makeDurationParser(defDur, minDur, maxDur time.Duration) parseFunc {
 	return func(val string) (any, error) {
 		if d, err := strconv.ParseUint(val, 10, 64); err == nil {
@@ -147,6 +176,7 @@ func (ws *webService) Start(kern *myKernel) error {
 	if maxRequestSize < 1024 {
 		maxRequestSize = 1024
 	}
+	trusted := ws.GetNextConfig(kernel.WebTrustedProxies).([]netip.Prefix)
 
 	if !strings.HasSuffix(baseURL, urlPrefix) {
 		ws.logger.Error().Str("base-url", baseURL).Str("url-prefix", urlPrefix).Msg(
@@ -158,7 +188,7 @@ func (ws *webService) Start(kern *myKernel) error {
 		ws.logger.Info().Str("listen", listenAddr).Msg("service may be reached from outside, but authentication is not enabled")
 	}
 
-	srvw := impl.New(ws.logger, listenAddr, baseURL, urlPrefix, persistentCookie, secureCookie, maxRequestSize, kern.auth.manager)
+	srvw := impl.New(ws.logger, listenAddr, baseURL, urlPrefix, persistentCookie, secureCookie, maxRequestSize, trusted, kern.auth.manager)
 	err := kern.web.setupServer(srvw, kern.box.manager, kern.auth.manager, &kern.cfg)
 	if err != nil {
 		ws.logger.Error().Err(err).Msg("Unable to create")
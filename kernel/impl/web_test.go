@@ -0,0 +1,60 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package impl
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestParsePrefixList(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		val string
+		exp []string
+		err bool
+	}{
+		{"", nil, false},
+		{"127.0.0.1", []string{"127.0.0.1/32"}, false},
+		{"127.0.0.1 ::1", []string{"127.0.0.1/32", "::1/128"}, false},
+		{"10.0.0.0/8,fd00::/8", []string{"10.0.0.0/8", "fd00::/8"}, false},
+		{" 10.1.2.3/8 , , 192.168.1.1 ", []string{"10.0.0.0/8", "192.168.1.1/32"}, false},
+		{"localhost", nil, true},
+		{"10.0.0.0/33", nil, true},
+		{"10.0.0.0/", nil, true},
+		{"127.0.0.1 10.0.0.0.0/8", nil, true},
+		{"fd00::/129", nil, true},
+	}
+	for _, tc := range testcases {
+		val, err := parsePrefixList(tc.val)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, but got %v", tc.val, val)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.val, err)
+			continue
+		}
+		var got []string
+		for _, prefix := range val.([]netip.Prefix) {
+			got = append(got, prefix.String())
+		}
+		if !slices.Equal(got, tc.exp) {
+			t.Errorf("%q: expected %v, but got %v", tc.val, tc.exp, got)
+		}
+	}
+}
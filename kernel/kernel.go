@@ -193,10 +193,13 @@ const (
 	WebBaseURL           = "base-url"
 	WebListenAddress     = "listen"
 	WebPersistentCookie  = "persistent"
+	WebProxyUserHeader   = "proxy-user-header"
 	WebMaxRequestSize    = "max-request-size"
+	WebMaxUploadSize     = "max-upload-size"
 	WebSecureCookie      = "secure"
 	WebTokenLifetimeAPI  = "api-lifetime"
 	WebTokenLifetimeHTML = "html-lifetime"
+	WebTrustedProxies    = "trusted-proxies"
 	WebURLPrefix         = "prefix"
 )
 
@@ -215,7 +218,7 @@ type LogEntry struct {
 }
 
 // CreateAuthManagerFunc is called to create a new auth manager.
-type CreateAuthManagerFunc func(readonly bool, owner id.Zid) (auth.Manager, error)
+type CreateAuthManagerFunc func(readonly bool, owners []id.Zid) (auth.Manager, error)
 
 // CreateBoxManagerFunc is called to create a new box manager.
 type CreateBoxManagerFunc func(
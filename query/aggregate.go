@@ -0,0 +1,191 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"zettelstore.de/z/zettel/meta"
+)
+
+// GroupAction is the action that groups the selected zettel by the values of
+// a metadata key. It is followed by the key and by aggregate functions.
+const GroupAction = "GROUP"
+
+// Aggregate functions, to be used after GroupAction.
+const (
+	AggregateCount = "COUNT"
+	AggregateSum   = "SUM"
+	AggregateMin   = "MIN"
+	AggregateMax   = "MAX"
+	AggregateAvg   = "AVG"
+)
+
+// GroupSpec specifies how zettel are grouped and aggregated.
+type GroupSpec struct {
+	Key        string      // Metadata key that determines the groups
+	Aggregates []Aggregate // Functions that are applied to each group
+}
+
+// Aggregate is an aggregate function, applied to the values of a key.
+type Aggregate struct {
+	Func string
+	Key  string // empty for AggregateCount
+}
+
+// GroupSpecFromActions returns the grouping specification, if the given
+// actions contain a GROUP action with a valid key. If no aggregate function
+// is given, the zettel of each group are counted.
+func GroupSpecFromActions(actions []string) (*GroupSpec, bool) {
+	for i, act := range actions {
+		if act != GroupAction {
+			continue
+		}
+		if i+1 >= len(actions) {
+			return nil, false
+		}
+		key := strings.ToLower(actions[i+1])
+		if !meta.KeyIsValid(key) {
+			return nil, false
+		}
+		spec := &GroupSpec{Key: key}
+		args := actions[i+2:]
+		for j := 0; j < len(args); j++ {
+			switch fn := args[j]; fn {
+			case AggregateCount:
+				spec.Aggregates = append(spec.Aggregates, Aggregate{Func: fn})
+			case AggregateSum, AggregateMin, AggregateMax, AggregateAvg:
+				if j+1 < len(args) {
+					if aggKey := strings.ToLower(args[j+1]); meta.KeyIsValid(aggKey) {
+						spec.Aggregates = append(spec.Aggregates, Aggregate{Func: fn, Key: aggKey})
+						j++
+					}
+				}
+			}
+		}
+		if len(spec.Aggregates) == 0 {
+			spec.Aggregates = []Aggregate{{Func: AggregateCount}}
+		}
+		return spec, true
+	}
+	return nil, false
+}
+
+// Columns returns the names of the columns of the grouped result.
+func (spec *GroupSpec) Columns() []string {
+	result := make([]string, 0, len(spec.Aggregates)+1)
+	result = append(result, spec.Key)
+	for _, agg := range spec.Aggregates {
+		if agg.Key == "" {
+			result = append(result, agg.Func)
+		} else {
+			result = append(result, agg.Func+" "+agg.Key)
+		}
+	}
+	return result
+}
+
+// Apply groups the given metadata and calculates the aggregate functions
+// for each group. Zettel without a value for the group key are ignored. Each
+// row starts with the group value, followed by the aggregated values. The rows
+// are sorted by the group value.
+func (spec *GroupSpec) Apply(ml []*meta.Meta) [][]string {
+	arr := meta.CreateArrangement(ml, spec.Key)
+	if len(arr) == 0 {
+		return nil
+	}
+	groups := make([]string, 0, len(arr))
+	for group := range arr {
+		groups = append(groups, group)
+	}
+	slices.Sort(groups)
+
+	rows := make([][]string, 0, len(groups))
+	for _, group := range groups {
+		row := make([]string, 0, len(spec.Aggregates)+1)
+		row = append(row, group)
+		for _, agg := range spec.Aggregates {
+			row = append(row, agg.apply(arr[group]))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (agg *Aggregate) apply(ml []*meta.Meta) string {
+	if agg.Func == AggregateCount {
+		return strconv.Itoa(len(ml))
+	}
+	isTimestamp := meta.Type(agg.Key) == meta.TypeTimestamp
+	count := 0
+	var sum float64
+	var minVal, maxVal string
+	var minNum, maxNum float64
+	for _, m := range ml {
+		val, found := m.Get(agg.Key)
+		if !found {
+			continue
+		}
+		if isTimestamp {
+			val = meta.ExpandTimestamp(val)
+			if count == 0 || val < minVal {
+				minVal = val
+			}
+			if count == 0 || val > maxVal {
+				maxVal = val
+			}
+			count++
+			continue
+		}
+		num, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			continue
+		}
+		if count == 0 || num < minNum {
+			minNum = num
+		}
+		if count == 0 || num > maxNum {
+			maxNum = num
+		}
+		sum += num
+		count++
+	}
+	if count == 0 {
+		return ""
+	}
+	if isTimestamp {
+		switch agg.Func {
+		case AggregateMin:
+			return minVal
+		case AggregateMax:
+			return maxVal
+		}
+		return ""
+	}
+	switch agg.Func {
+	case AggregateSum:
+		return formatNumber(sum)
+	case AggregateMin:
+		return formatNumber(minNum)
+	case AggregateMax:
+		return formatNumber(maxNum)
+	case AggregateAvg:
+		return formatNumber(sum / float64(count))
+	}
+	return ""
+}
+
+func formatNumber(num float64) string { return strconv.FormatFloat(num, 'f', -1, 64) }
@@ -0,0 +1,89 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query_test
+
+import (
+	"strings"
+	"testing"
+
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func TestGroupSpec(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		spec string
+		exp  string
+	}{
+		{"", ""},
+		{"| GROUP", ""},
+		{"| GROUP status", "status|COUNT"},
+		{"| GROUP Status SUM effort AVG effort", "status|SUM effort|AVG effort"},
+		{"| GROUP status MIN created MAX", "status|MIN created"},
+		{"| N GROUP tags COUNT MAX effort", "tags|COUNT|MAX effort"},
+	}
+	for i, tc := range testcases {
+		spec, ok := query.GroupSpecFromActions(query.Parse(tc.spec).Actions())
+		if !ok {
+			if tc.exp != "" {
+				t.Errorf("%d: GroupSpecFromActions(%q) should be %q, but got nothing", i, tc.spec, tc.exp)
+			}
+			continue
+		}
+		if got := strings.Join(spec.Columns(), "|"); got != tc.exp {
+			t.Errorf("%d: GroupSpecFromActions(%q) should be %q, but got %q", i, tc.spec, tc.exp, got)
+		}
+	}
+}
+
+func TestGroupApply(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		status, effort, created string
+	}{
+		{"open", "3", "20240301"},
+		{"open", "5", "20240115"},
+		{"done", "2", "20231224"},
+		{"done", "", "20240501"},
+		{"", "7", ""},
+	}
+	ml := make([]*meta.Meta, 0, len(data))
+	for i, d := range data {
+		m := meta.New(id.Zid(i + 1))
+		if d.status != "" {
+			m.Set("status", d.status)
+		}
+		if d.effort != "" {
+			m.Set("effort", d.effort)
+		}
+		if d.created != "" {
+			m.Set("created", d.created)
+		}
+		ml = append(ml, m)
+	}
+
+	spec, _ := query.GroupSpecFromActions(query.Parse(
+		"| GROUP status COUNT SUM effort AVG effort MIN effort MAX created").Actions())
+	exp := "done 2 2 2 2 20240501000000|open 2 8 4 3 20240301000000"
+	rows := spec.Apply(ml)
+	got := make([]string, len(rows))
+	for i, row := range rows {
+		got[i] = strings.Join(row, " ")
+	}
+	if gotS := strings.Join(got, "|"); gotS != exp {
+		t.Errorf("expected %q, but got %q", exp, gotS)
+	}
+}
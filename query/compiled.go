@@ -27,14 +27,16 @@ type Compiled struct {
 	seed     int
 	pick     int
 	order    []sortOrder
-	offset   int // <= 0: no offset
-	limit    int // <= 0: no limit
+	after    *meta.Meta // Sort position of a cursor, nil: no cursor
+	offset   int        // <= 0: no offset
+	limit    int        // <= 0: no limit
 
 	startMeta []*meta.Meta
 	PreMatch  MetaMatchFunc // Precondition for Match and Retrieve
 	Terms     []CompiledTerm
 
 	sortFunc sortFunc
+	plan     *Plan // Non-nil, if the query should be explained
 }
 
 // MetaMatchFunc is a function determine whethe some metadata should be selected or not.
@@ -47,6 +49,94 @@ func matchNever(*meta.Meta) bool  { return false }
 type CompiledTerm struct {
 	Match    MetaMatchFunc     // Match on metadata
 	Retrieve RetrievePredicate // Retrieve from full-text search
+
+	planTerm int // Position of the term plan, starting with 1; 0: no plan
+}
+
+// compiledGroup is a compiled sub-expression of a term.
+type compiledGroup struct {
+	negate     bool
+	restricted bool // Retrieval is restricted by the terms
+	terms      []CompiledTerm
+}
+
+func (tg *termGroup) compile(searcher Searcher) compiledGroup {
+	cg := compiledGroup{
+		negate:     tg.negate,
+		restricted: !tg.negate,
+		terms:      make([]CompiledTerm, 0, len(tg.terms)),
+	}
+	for _, term := range tg.terms {
+		cTerm := term.retrieveAndCompileTerm(searcher, nil)
+		if cTerm.Retrieve == nil {
+			cg.restricted = false
+			cTerm.Retrieve = AlwaysIncluded
+		}
+		if cTerm.Match == nil {
+			cTerm.Match = matchAlways
+		}
+		cg.terms = append(cg.terms, cTerm)
+	}
+	return cg
+}
+
+// match returns true, if the metadata matches one of the terms of a
+// non-negated group, or none of the terms of a negated group.
+func (cg *compiledGroup) match(m *meta.Meta) bool {
+	for _, term := range cg.terms {
+		if term.Match(m) && term.Retrieve(m.Zid) {
+			return !cg.negate
+		}
+	}
+	return cg.negate
+}
+
+// retrieve returns a predicate for the index-based retrieval of the group, or
+// nil if the group does not restrict it. A negated group never restricts the
+// retrieval, since the index cannot be asked for zettel without a word.
+func (cg *compiledGroup) retrieve() RetrievePredicate {
+	if !cg.restricted {
+		return nil
+	}
+	terms := cg.terms
+	return func(zid id.Zid) bool {
+		for _, term := range terms {
+			if term.Retrieve(zid) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// compileGroups combines the match function and the retrieve predicate of a
+// term with those of its sub-expressions.
+func (ct *conjTerms) compileGroups(searcher Searcher, match MetaMatchFunc, pred RetrievePredicate) (MetaMatchFunc, RetrievePredicate) {
+	groups := make([]compiledGroup, 0, len(ct.groups))
+	for _, g := range ct.groups {
+		cg := g.compile(searcher)
+		groups = append(groups, cg)
+		if groupPred := cg.retrieve(); groupPred != nil {
+			if pred == nil {
+				pred = groupPred
+			} else {
+				termPred := pred
+				pred = func(zid id.Zid) bool { return termPred(zid) && groupPred(zid) }
+			}
+		}
+	}
+	termMatch := match
+	return func(m *meta.Meta) bool {
+		if termMatch != nil && !termMatch(m) {
+			return false
+		}
+		for i := range groups {
+			if !groups[i].match(m) {
+				return false
+			}
+		}
+		return true
+	}, pred
 }
 
 // RetrievePredicate returns true, if the given Zid is contained in the (full-text) search.
@@ -77,6 +167,7 @@ func (c *Compiled) Result() []*meta.Meta {
 	result = c.pickElements(result)
 	c.ensureSortFunc()
 	result = c.sortElements(result)
+	result = c.afterElements(result)
 	result = c.offsetElements(result)
 	return limitElements(result, c.limit)
 }
@@ -117,6 +208,7 @@ func (c *Compiled) AfterSearch(metaList []*meta.Meta) []*meta.Meta {
 	} else {
 		metaList = c.sortElements(metaList)
 	}
+	metaList = c.afterElements(metaList)
 	metaList = c.offsetElements(metaList)
 	return limitElements(metaList, c.limit)
 }
@@ -129,6 +221,10 @@ func (c *Compiled) sortElements(metaList []*meta.Meta) []*meta.Meta {
 			c.ensureSortFunc()
 			slices.SortFunc(metaList, c.sortFunc)
 		}
+	} else if c.limit > 0 || c.after != nil {
+		// A limited list must be sorted to allow stable cursors.
+		c.ensureSortFunc()
+		slices.SortFunc(metaList, c.sortFunc)
 	}
 	return metaList
 }
@@ -0,0 +1,97 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query
+
+import (
+	"encoding/base64"
+	"net/url"
+	"slices"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// AfterDirective restricts the result to the zettel that are sorted after the
+// position encoded in the following cursor.
+const AfterDirective = "AFTER"
+
+// Cursor returns a token that encodes the sort position of the last element
+// of the given result list. It is only returned, if the list was limited, and
+// therefore there might be more elements, and if the sort order is not random.
+//
+// The query, extended by AFTER and the cursor, will return the next elements.
+// In contrast to OFFSET, no element is skipped or returned twice, if zettel
+// are created or deleted between both queries.
+func (q *Query) Cursor(ml []*meta.Meta) string {
+	if q == nil || q.limit <= 0 || len(ml) < q.limit || q.pick > 0 {
+		return ""
+	}
+	if len(q.order) > 0 && q.order[0].isRandom() {
+		return ""
+	}
+	m := ml[len(ml)-1]
+	vals := url.Values{}
+	vals.Set(api.KeyID, m.Zid.String())
+	for _, so := range q.order {
+		if so.key == api.KeyID {
+			break
+		}
+		if val, found := m.Get(so.key); found {
+			vals.Set(so.key, val)
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(vals.Encode()))
+}
+
+// decodeCursor returns the sort position encoded in the cursor, represented as
+// metadata.
+func decodeCursor(cursor string) (*meta.Meta, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+	vals, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil, false
+	}
+	zid, err := id.Parse(vals.Get(api.KeyID))
+	if err != nil {
+		return nil, false
+	}
+	m := meta.New(zid)
+	for key, val := range vals {
+		if key != api.KeyID && meta.KeyIsValid(key) && len(val) > 0 {
+			m.Set(key, val[0])
+		}
+	}
+	return m, true
+}
+
+// afterElements removes all elements that are sorted before or at the cursor
+// position. It is ignored for a random sort order.
+func (c *Compiled) afterElements(metaList []*meta.Meta) []*meta.Meta {
+	if c.after == nil || (len(c.order) > 0 && c.order[0].isRandom()) {
+		return metaList
+	}
+	c.ensureSortFunc()
+	if !slices.IsSortedFunc(metaList, c.sortFunc) {
+		slices.SortFunc(metaList, c.sortFunc)
+	}
+	pos, found := slices.BinarySearchFunc(metaList, c.after, c.sortFunc)
+	if found {
+		pos++
+	}
+	return metaList[pos:]
+}
@@ -0,0 +1,247 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/strfun"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// DuplicatesAction groups the selected zettel that have an identical or a
+// similar content. It may be followed by a similarity threshold in percent.
+const DuplicatesAction = "DUPLICATES"
+
+const defaultDuplicatesThreshold = 80
+
+// DuplicatesSpec specifies how duplicate zettel are detected.
+type DuplicatesSpec struct {
+	Threshold int // Minimal similarity in percent of two zettel
+}
+
+// DuplicatesPort is the collection of box methods needed to detect
+// near-duplicate zettel. Since the words are only retrieved for the given
+// zettel, the port may use the index directly, without checking access rights.
+type DuplicatesPort interface {
+	GetWords(ctx context.Context, zid id.Zid) ([]string, error)
+}
+
+// DuplicateGroup is a group of zettel that are duplicates of each other.
+type DuplicateGroup struct {
+	Similarity int // Lowest similarity in percent, 100 for identical content
+	Zettel     []*meta.Meta
+}
+
+// DuplicatesSpecFromActions returns the specification, if the given actions
+// contain a DUPLICATES action.
+func DuplicatesSpecFromActions(actions []string) (*DuplicatesSpec, bool) {
+	for i, act := range actions {
+		if act != DuplicatesAction {
+			continue
+		}
+		spec := &DuplicatesSpec{Threshold: defaultDuplicatesThreshold}
+		if i+1 < len(actions) {
+			if num, err := strconv.Atoi(actions[i+1]); err == nil && 0 < num && num <= 100 {
+				spec.Threshold = num
+			}
+		}
+		return spec, true
+	}
+	return nil, false
+}
+
+// Execute returns the groups of duplicate zettel, in the order of their first
+// zettel within the list. Groups contain only zettel of the list.
+//
+// Zettel with identical content are found via the index, which maintains the
+// metadata key meta.KeyDuplicates. Similar zettel are detected by comparing
+// the words of the content and the character trigrams of the title, using the
+// Jaccard index. Similarity is transitive: if A is similar to B, and B is
+// similar to C, then A, B, and C form one group.
+func (spec *DuplicatesSpec) Execute(ctx context.Context, ml []*meta.Meta, port DuplicatesPort) []DuplicateGroup {
+	pos := make(map[id.Zid]int, len(ml))
+	for i, m := range ml {
+		pos[m.Zid] = i
+	}
+	uf := newUnionFind(len(ml))
+	for i, m := range ml {
+		if dups, found := m.GetList(meta.KeyDuplicates); found {
+			for _, val := range dups {
+				if zid, err := id.Parse(val); err == nil {
+					if j, inList := pos[zid]; inList {
+						uf.union(i, j, 100)
+					}
+				}
+			}
+		}
+	}
+
+	features := make([][]string, len(ml))
+	for i, m := range ml {
+		features[i] = duplicateFeatures(ctx, m, port)
+	}
+	threshold := float64(spec.Threshold) / 100
+	similarityJoin(features, threshold, func(i, j int, sim float64) {
+		uf.union(i, j, int(math.Floor(sim*100)))
+	})
+	return uf.groups(ml)
+}
+
+// duplicateFeatures returns the sorted features of a zettel: the words of
+// its content, and the character trigrams of its title.
+func duplicateFeatures(ctx context.Context, m *meta.Meta, port DuplicatesPort) []string {
+	words, err := port.GetWords(ctx, m.Zid)
+	if err != nil {
+		words = nil
+	}
+	result := make([]string, 0, len(words))
+	for _, w := range words {
+		result = append(result, "w"+w)
+	}
+	if title, found := m.Get(api.KeyTitle); found {
+		runes := []rune(strings.Join(strfun.NormalizeWords(title), " "))
+		for i := 0; i+3 <= len(runes); i++ {
+			result = append(result, "t"+string(runes[i:i+3]))
+		}
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+// similarityJoin calls found for all pairs of feature sets, whose Jaccard
+// index is at least the threshold. To avoid comparing all pairs, only sets
+// are compared that share a feature within a prefix of the set, where the
+// features are ordered by increasing frequency ("prefix filtering").
+func similarityJoin(features [][]string, threshold float64, found func(i, j int, sim float64)) {
+	freq := map[string]int{}
+	for _, fs := range features {
+		for _, f := range fs {
+			freq[f]++
+		}
+	}
+	ordered := make([][]string, len(features))
+	order := make([]int, 0, len(features))
+	for i, fs := range features {
+		if len(fs) == 0 {
+			continue
+		}
+		ordered[i] = slices.Clone(fs)
+		slices.SortFunc(ordered[i], func(a, b string) int {
+			if result := cmp.Compare(freq[a], freq[b]); result != 0 {
+				return result
+			}
+			return strings.Compare(a, b)
+		})
+		order = append(order, i)
+	}
+	slices.SortStableFunc(order, func(i, j int) int { return cmp.Compare(len(features[i]), len(features[j])) })
+
+	index := map[string][]int{}
+	for _, i := range order {
+		size := len(features[i])
+		minSize := int(math.Ceil(threshold*float64(size) - 1e-9)) // avoid rounding errors, e.g. 0.7*10
+		seen := map[int]bool{}
+		prefix := ordered[i][:size-minSize+1]
+		for _, f := range prefix {
+			for _, j := range index[f] {
+				if seen[j] || len(features[j]) < minSize {
+					continue
+				}
+				seen[j] = true
+				if sim := jaccard(features[i], features[j]); sim >= threshold {
+					found(j, i, sim)
+				}
+			}
+		}
+		for _, f := range prefix {
+			index[f] = append(index[f], i)
+		}
+	}
+}
+
+// jaccard returns the Jaccard index of two sorted sets of strings.
+func jaccard(a, b []string) float64 {
+	common := 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch strings.Compare(a[i], b[j]) {
+		case -1:
+			i++
+		case 1:
+			j++
+		default:
+			common++
+			i++
+			j++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// unionFind maintains disjoint sets of list positions, together with the
+// lowest similarity of the pairs that joined each set.
+type unionFind struct {
+	parent []int
+	sim    []int
+}
+
+func newUnionFind(n int) *unionFind {
+	uf := &unionFind{parent: make([]int, n), sim: make([]int, n)}
+	for i := range n {
+		uf.parent[i] = i
+		uf.sim[i] = 100
+	}
+	return uf
+}
+
+func (uf *unionFind) find(i int) int {
+	for uf.parent[i] != i {
+		uf.parent[i] = uf.parent[uf.parent[i]]
+		i = uf.parent[i]
+	}
+	return i
+}
+
+func (uf *unionFind) union(i, j, sim int) {
+	ri, rj := uf.find(i), uf.find(j)
+	if ri != rj {
+		if rj < ri {
+			ri, rj = rj, ri
+		}
+		uf.parent[rj] = ri
+		uf.sim[ri] = min(uf.sim[ri], uf.sim[rj], sim)
+	}
+}
+
+func (uf *unionFind) groups(ml []*meta.Meta) []DuplicateGroup {
+	members := map[int][]*meta.Meta{}
+	for i, m := range ml {
+		root := uf.find(i)
+		members[root] = append(members[root], m)
+	}
+	var result []DuplicateGroup
+	for i := range ml {
+		if group := members[i]; len(group) > 1 {
+			result = append(result, DuplicateGroup{Similarity: uf.sim[i], Zettel: group})
+		}
+	}
+	return result
+}
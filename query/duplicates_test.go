@@ -0,0 +1,103 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func TestDuplicatesSpecFromActions(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		actions string
+		exp     int
+	}{
+		{"", -1},
+		{"KEYS", -1},
+		{"DUPLICATES", 80},
+		{"DUPLICATES 50", 50},
+		{"DUPLICATES 0", 80},
+		{"DUPLICATES 101", 80},
+		{"DUPLICATES x", 80},
+		{"N DUPLICATES 100", 100},
+	}
+	for _, tc := range testcases {
+		spec, found := query.DuplicatesSpecFromActions(strings.Fields(tc.actions))
+		got := -1
+		if found {
+			got = spec.Threshold
+		}
+		if got != tc.exp {
+			t.Errorf("%q should result in %d, but got %d", tc.actions, tc.exp, got)
+		}
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		title string
+		words string
+		dups  string
+	}{
+		{"Shopping list", "milk bread butter eggs cheese", "00000000000004"},
+		{"Shopping list", "milk bread butter eggs cheese apples", ""},
+		{"Garden", "tree flower grass", ""},
+		{"Copy", "milk bread butter eggs cheese", "00000000000001"},
+		{"Gardening", "tree flower grass", ""},
+		{"Other", "something completely different", ""},
+	}
+	port := &similarPort{metas: map[id.Zid]*meta.Meta{}, words: map[id.Zid][]string{}}
+	ml := make([]*meta.Meta, 0, len(data))
+	for i, d := range data {
+		zid := id.Zid(i + 1)
+		m := meta.New(zid)
+		m.Set(api.KeyTitle, d.title)
+		if d.dups != "" {
+			m.Set(meta.KeyDuplicates, d.dups)
+		}
+		port.metas[zid] = m
+		port.words[zid] = strings.Fields(d.words)
+		ml = append(ml, m)
+	}
+
+	testcases := []struct {
+		threshold int
+		exp       string
+	}{
+		{100, "100:1 4"},
+		{95, "100:1 4"},
+		{90, "94:1 2 4"},
+		{70, "94:1 2 4|70:3 5"},
+	}
+	for _, tc := range testcases {
+		spec := query.DuplicatesSpec{Threshold: tc.threshold}
+		groups := spec.Execute(context.Background(), ml, port)
+		got := make([]string, len(groups))
+		for i, g := range groups {
+			got[i] = fmt.Sprintf("%d:%s", g.Similarity, zidsOf(g.Zettel))
+		}
+		if gotS := strings.Join(got, "|"); gotS != tc.exp {
+			t.Errorf("threshold %d should result in %q, but got %q", tc.threshold, tc.exp, gotS)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"t73f.de/r/zsc/maps"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// ExplainDirective signals that the execution plan of a query should be
+// returned, instead of its result.
+const ExplainDirective = "EXPLAIN"
+
+// Plan describes how a query was executed. It is only collected, if the
+// query contains the EXPLAIN directive.
+type Plan struct {
+	Query    string     // The query to be explained, without EXPLAIN
+	PreMatch bool       // Whether a pre-match, e.g. an access policy, is applied
+	Terms    []TermPlan // Plans of the disjunctive terms
+	Order    string     // Sort order, empty if default order
+	Pick     int        // <= 0: no pick
+	Offset   int        // <= 0: no offset
+	Limit    int        // <= 0: no limit
+	Phases   []PhasePlan
+}
+
+// TermPlan describes how a conjunction of search terms is executed.
+//
+// The number of candidates is counted after the pre-match, e.g. the access
+// policy, is applied. Otherwise a user could find out about words in zettel
+// that the user is not allowed to read.
+type TermPlan struct {
+	Index      []string // Searches in the word index
+	Candidates string   // How candidates are retrieved, one of the Candidates... values
+	Count      int      // Number of candidates after the pre-match, -1 if not counted
+	Match      []string // Comparisons on metadata, applied to each candidate
+	Groups     int      // Number of nested sub-expressions
+}
+
+// Values to specify how the candidates of a term are retrieved.
+const (
+	CandidatesScan  = "scan"  // All zettel are candidates, metadata is scanned
+	CandidatesIndex = "index" // Candidates are retrieved via the word index
+	CandidatesNone  = "none"  // Search terms contradict, there are no candidates
+)
+
+// PhasePlan records the duration of a phase of query execution.
+type PhasePlan struct {
+	Name     string
+	Duration time.Duration
+	Count    int // Number of zettel after the phase, -1 if not applicable
+}
+
+// Explain returns the plan of the last execution of the query, or nil if the
+// query does not contain the EXPLAIN directive.
+func (q *Query) Explain() *Plan {
+	if q == nil {
+		return nil
+	}
+	return q.plan
+}
+
+// AddPhase records the duration of a phase of query execution, if the query
+// should be explained.
+func (q *Query) AddPhase(name string, start time.Time, count int) {
+	if q != nil {
+		q.plan.addPhase(name, start, count)
+	}
+}
+
+// CountCandidates returns true, if the candidates of each term should be
+// counted, because the query should be explained.
+func (c *Compiled) CountCandidates() bool { return c.plan != nil }
+
+// SetCandidates records the number of candidates of the given term, after
+// the pre-match was applied.
+func (c *Compiled) SetCandidates(term CompiledTerm, count int) {
+	if plan := c.plan; plan != nil && term.planTerm > 0 && term.planTerm <= len(plan.Terms) {
+		plan.Terms[term.planTerm-1].Count = count
+	}
+}
+
+// AddPhase records the duration of a phase of query execution, if the query
+// should be explained.
+func (c *Compiled) AddPhase(name string, start time.Time, count int) {
+	c.plan.addPhase(name, start, count)
+}
+
+func (plan *Plan) addPhase(name string, start time.Time, count int) {
+	if plan != nil {
+		plan.Phases = append(plan.Phases, PhasePlan{Name: name, Duration: time.Since(start), Count: count})
+	}
+}
+
+// clone returns a copy of the plan.
+func (plan *Plan) clone() *Plan {
+	if plan == nil {
+		return nil
+	}
+	c := *plan
+	c.Terms = slices.Clone(plan.Terms)
+	c.Phases = slices.Clone(plan.Phases)
+	return &c
+}
+
+// reset prepares the plan for a new execution of the query.
+func (plan *Plan) reset(q *Query) {
+	c := q.Clone()
+	c.plan = nil
+	plan.Query = c.String()
+	plan.PreMatch = q.preMatch != nil
+	plan.Terms = nil
+	var sb strings.Builder
+	env := PrintEnv{w: &sb}
+	env.printOrder(q.order)
+	plan.Order = sb.String()
+	plan.Pick = q.pick
+	plan.Offset = q.offset
+	plan.Limit = q.limit
+	// Joins and directives are executed before the query is compiled.
+	i := len(plan.Phases)
+	for i > 0 && (plan.Phases[i-1].Name == PhaseJoins || plan.Phases[i-1].Name == PhaseDirectives) {
+		i--
+	}
+	plan.Phases = plan.Phases[i:]
+}
+
+// Names of query execution phases.
+const (
+	PhaseJoins      = "joins"
+	PhaseDirectives = "directives"
+	PhaseCompile    = "compile"
+	PhaseResult     = "result"
+	PhaseScan       = "scan"
+	PhaseSort       = "sort"
+)
+
+func (ct *conjTerms) explain(searcher Searcher) TermPlan {
+	tp := TermPlan{Candidates: CandidatesScan, Count: -1, Groups: len(ct.groups)}
+	for _, key := range maps.Keys(ct.keys) {
+		tp.Match = append(tp.Match, explainKey(key)+" "+op2string[ct.keys[key]])
+	}
+	for _, key := range maps.Keys(ct.mvals) {
+		for _, val := range ct.mvals[key] {
+			tp.Match = append(tp.Match, fmt.Sprintf("%s %s %q", explainKey(key), op2string[val.op], val.value))
+		}
+	}
+	for _, refKey := range maps.Keys(ct.joins) {
+		tp.Match = append(tp.Match, fmt.Sprintf("%s references one of %d zettel", explainKey(refKey), ct.joins[refKey].targets.Length()))
+	}
+	if searcher == nil || len(ct.search) == 0 {
+		return tp
+	}
+	normCalls, plainCalls, negCalls := prepareRetrieveCalls(searcher, ct.search)
+	tp.Index = explainCalls(tp.Index, normCalls, "")
+	tp.Index = explainCalls(tp.Index, plainCalls, "")
+	tp.Index = explainCalls(tp.Index, negCalls, "not ")
+	slices.Sort(tp.Index)
+	tp.Index = slices.Compact(tp.Index)
+	if hasConflictingCalls(normCalls, plainCalls, negCalls) {
+		tp.Candidates = CandidatesNone
+	} else if len(normCalls) > 0 || len(plainCalls) > 0 {
+		tp.Candidates = CandidatesIndex
+	}
+	return tp
+}
+
+func explainKey(key string) string { return key + " (" + meta.Type(key).Name + ")" }
+
+var op2index = map[compareOp]string{
+	cmpEqual:   "equal",
+	cmpPrefix:  "prefix",
+	cmpSuffix:  "suffix",
+	cmpMatch:   "contains",
+	cmpHas:     "contains",
+	cmpLess:    "contains",
+	cmpGreater: "contains",
+}
+
+func explainCalls(result []string, calls searchCallMap, prefix string) []string {
+	for c := range calls {
+		result = append(result, fmt.Sprintf("%s%s %q", prefix, op2index[c.op], c.s))
+	}
+	return result
+}
+
+// Print the plan in a human readable form.
+func (plan *Plan) Print(w io.Writer) {
+	fmt.Fprintln(w, ExplainDirective, plan.Query)
+	if plan.PreMatch {
+		fmt.Fprintln(w, "pre-match: access policy")
+	}
+	for i, tp := range plan.Terms {
+		fmt.Fprintf(w, "term %d:\n", i+1)
+		for _, s := range tp.Index {
+			fmt.Fprintln(w, "  index:", s)
+		}
+		if tp.Count < 0 {
+			fmt.Fprintln(w, "  candidates:", tp.CandidatesString())
+		} else {
+			fmt.Fprintf(w, "  candidates: %s, %d readable zettel\n", tp.CandidatesString(), tp.Count)
+		}
+		for _, s := range tp.Match {
+			fmt.Fprintln(w, "  match:", s)
+		}
+		if tp.Groups > 0 {
+			fmt.Fprintln(w, "  groups:", tp.Groups)
+		}
+	}
+	if plan.Order != "" {
+		fmt.Fprintln(w, "order:", plan.Order)
+	}
+	for _, p := range []struct {
+		name string
+		val  int
+	}{{"pick", plan.Pick}, {"offset", plan.Offset}, {"limit", plan.Limit}} {
+		if p.val > 0 {
+			fmt.Fprintln(w, p.name+":", p.val)
+		}
+	}
+	for _, phase := range plan.Phases {
+		if phase.Count < 0 {
+			fmt.Fprintf(w, "phase %s: %v\n", phase.Name, phase.Duration)
+		} else {
+			fmt.Fprintf(w, "phase %s: %v, %d zettel\n", phase.Name, phase.Duration, phase.Count)
+		}
+	}
+}
+
+// CandidatesString returns a description of the candidate retrieval.
+func (tp *TermPlan) CandidatesString() string {
+	switch tp.Candidates {
+	case CandidatesIndex:
+		return "found via index"
+	case CandidatesNone:
+		return "none (contradicting search terms)"
+	}
+	return "all (full metadata scan)"
+}
@@ -0,0 +1,222 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"t73f.de/r/zsc/maps"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// joinSeparator separates the key of a zettel reference from the key of the
+// referenced zettel, e.g. "precursor.tags".
+const joinSeparator = "."
+
+// joinTerm is a search term that follows the zettel references of a metadata
+// key into the metadata of the referenced zettel. A zettel matches, if at least
+// one of the referenced zettel matches the term.
+type joinTerm struct {
+	term     conjTerms // Comparisons on the metadata of the referenced zettel
+	targets  *id.Set   // Referenced zettel that match the term, set by executeJoins
+	executed bool      // Targets were determined
+}
+
+type joinMap map[string]*joinTerm
+
+// JoinPort is the collection of box methods needed to execute joins.
+type JoinPort interface {
+	SelectMeta(ctx context.Context, metaSeq []*meta.Meta, q *Query) ([]*meta.Meta, error)
+}
+
+// ReferenceSearcher is a Searcher that also knows which zettel reference other
+// zettel. It is used to retrieve candidates for a join efficiently.
+type ReferenceSearcher interface {
+	// SearchReferences returns all zettel that reference one of the given
+	// zettel via the given metadata key. The result may contain more zettel.
+	// If the references of the key are not known, nil is returned.
+	SearchReferences(key string, zids *id.Set) *id.Set
+}
+
+// splitJoinKey splits a key like "precursor.tags" into the key of the zettel
+// reference and the key of the referenced zettel. The first key must have a
+// zettel identifier (or a set of them) as its value.
+func splitJoinKey(s string) (string, string, bool) {
+	refKey, key, found := strings.Cut(s, joinSeparator)
+	if !found || !meta.KeyIsValid(refKey) || !meta.KeyIsValid(key) {
+		return "", "", false
+	}
+	if t := meta.Type(refKey); t != meta.TypeID && t != meta.TypeIDSet {
+		return "", "", false
+	}
+	return refKey, key, true
+}
+
+func (ct *conjTerms) getJoin(refKey string) *joinTerm {
+	if ct.joins == nil {
+		ct.joins = joinMap{}
+	}
+	jt, found := ct.joins[refKey]
+	if !found {
+		jt = &joinTerm{}
+		ct.joins[refKey] = jt
+	}
+	return jt
+}
+
+func (ct *conjTerms) addJoinKey(refKey, key string, op compareOp) {
+	ct.getJoin(refKey).term.addKey(key, op)
+}
+
+func (ct *conjTerms) addJoinValue(refKey, key string, val expValue) {
+	jt := ct.getJoin(refKey)
+	if jt.term.mvals == nil {
+		jt.term.mvals = expMetaValues{}
+	}
+	jt.term.mvals[key] = append(jt.term.mvals[key], val)
+}
+
+// clone returns a deep copy of the join map. Already determined targets are
+// copied too, because a query is cloned before it is compiled, e.g. in
+// RetrieveAndCompile. Executing the joins of the copy will not change the
+// original query, and vice versa.
+func (jm joinMap) clone() joinMap {
+	if len(jm) == 0 {
+		return nil
+	}
+	result := make(joinMap, len(jm))
+	for refKey, jt := range jm {
+		result[refKey] = &joinTerm{term: jt.term.clone(), targets: jt.targets.Clone(), executed: jt.executed}
+	}
+	return result
+}
+
+// ExecuteJoins determines the referenced zettel of all joins of the query,
+// that were not executed before. It must be called before the query is used
+// to select zettel, otherwise a join will never match. Typically, it is called
+// by the box that selects the zettel, so that only readable zettel are
+// referenced.
+func (q *Query) ExecuteJoins(ctx context.Context, port JoinPort) error {
+	if q == nil || !termsHaveOpenJoins(q.terms) {
+		return nil
+	}
+	start := time.Now()
+	err := executeJoins(ctx, q.terms, port)
+	q.AddPhase(PhaseJoins, start, -1)
+	return err
+}
+
+func termsHaveOpenJoins(terms []conjTerms) bool {
+	for _, term := range terms {
+		for _, jt := range term.joins {
+			if !jt.executed {
+				return true
+			}
+		}
+		for _, g := range term.groups {
+			if termsHaveOpenJoins(g.terms) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func executeJoins(ctx context.Context, terms []conjTerms, port JoinPort) error {
+	for _, term := range terms {
+		for _, jt := range term.joins {
+			if jt.executed {
+				continue
+			}
+			ml, err := port.SelectMeta(ctx, nil, &Query{terms: []conjTerms{jt.term.clone()}})
+			if err != nil {
+				return err
+			}
+			jt.targets = metaList2idSet(ml)
+			jt.executed = true
+		}
+		for _, g := range term.groups {
+			if err := executeJoins(ctx, g.terms, port); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileJoins combines the match function and the retrieve predicate of a
+// term with those of its joins.
+func (ct *conjTerms) compileJoins(searcher Searcher, match MetaMatchFunc, pred RetrievePredicate) (MetaMatchFunc, RetrievePredicate) {
+	refSearcher, hasReferences := searcher.(ReferenceSearcher)
+	for refKey, jt := range ct.joins {
+		if hasReferences {
+			if candidates := refSearcher.SearchReferences(refKey, jt.targets); candidates != nil {
+				if termPred := pred; termPred == nil {
+					pred = candidates.Contains
+				} else {
+					pred = func(zid id.Zid) bool { return termPred(zid) && candidates.Contains(zid) }
+				}
+			}
+		}
+		termMatch, joinMatch := match, jt.matchFunc(refKey)
+		if termMatch == nil {
+			match = joinMatch
+		} else {
+			match = func(m *meta.Meta) bool { return termMatch(m) && joinMatch(m) }
+		}
+	}
+	return match, pred
+}
+
+func (jt *joinTerm) matchFunc(refKey string) MetaMatchFunc {
+	targets := jt.targets
+	if targets.IsEmpty() {
+		return matchNever
+	}
+	return func(m *meta.Meta) bool {
+		val, found := m.Get(refKey)
+		if !found {
+			return false
+		}
+		for _, s := range meta.ListFromValue(val) {
+			if zid, err := id.Parse(s); err == nil && targets.Contains(zid) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (pe *PrintEnv) printJoins(joins joinMap) {
+	for _, refKey := range maps.Keys(joins) {
+		jt := joins[refKey]
+		prefix := refKey + joinSeparator
+		pe.printKeys(prefix, jt.term.keys)
+		for _, name := range maps.Keys(jt.term.mvals) {
+			pe.printExprValues(prefix+name, jt.term.mvals[name])
+		}
+	}
+}
+
+func (pe *PrintEnv) printHumanJoins(joins joinMap) {
+	for _, refKey := range maps.Keys(joins) {
+		jt := joins[refKey]
+		prefix := refKey + joinSeparator
+		pe.printHumanKeys(prefix, jt.term.keys)
+		pe.printHumanMetaValues(prefix, jt.term.mvals)
+	}
+}
@@ -14,6 +14,7 @@
 package query
 
 import (
+	"slices"
 	"strconv"
 
 	"t73f.de/r/zsc/api"
@@ -40,10 +41,14 @@ func (q *Query) Parse(spec string) *Query {
 }
 
 type parserState struct {
-	inp *input.Input
+	inp   *input.Input
+	depth int // Nesting depth of groups
 }
 
-func (ps *parserState) mustStop() bool { return ps.inp.Ch == input.EOS }
+func (ps *parserState) mustStop() bool {
+	ch := ps.inp.Ch
+	return ch == input.EOS || (ps.depth > 0 && ch == groupEndChar)
+}
 func (ps *parserState) acceptSingleKw(s string) bool {
 	inp := ps.inp
 	if inp.Accept(s) && (inp.IsSpace() || ps.isActionSep() || ps.mustStop()) {
@@ -62,6 +67,8 @@ func (ps *parserState) acceptKwArgs(s string) bool {
 
 const (
 	actionSeparatorChar       = '|'
+	groupStartChar            = '('
+	groupEndChar              = ')'
 	existOperatorChar         = '?'
 	searchOperatorNotChar     = '!'
 	searchOperatorEqualChar   = '='
@@ -117,6 +124,11 @@ func (ps *parserState) parse(q *Query) *Query {
 			continue
 		}
 		inp.SetPos(pos)
+		if ps.acceptSingleKw(PathDirective) {
+			q = ps.parsePath(q)
+			continue
+		}
+		inp.SetPos(pos)
 		if q == nil || len(q.zids) == 0 {
 			break
 		}
@@ -130,6 +142,11 @@ func (ps *parserState) parse(q *Query) *Query {
 			continue
 		}
 		inp.SetPos(pos)
+		if ps.acceptSingleKw(SimilarDirective) {
+			q = ps.parseSimilar(q)
+			continue
+		}
+		inp.SetPos(pos)
 		if ps.acceptSingleKw(api.UnlinkedDirective) {
 			q = ps.parseUnlinked(q)
 			continue
@@ -156,6 +173,14 @@ func (ps *parserState) parse(q *Query) *Query {
 			continue
 		}
 		inp.SetPos(pos)
+		if ps.acceptSingleKw(ExplainDirective) {
+			q = createIfNeeded(q)
+			if q.plan == nil {
+				q.plan = &Plan{}
+			}
+			continue
+		}
+		inp.SetPos(pos)
 		if ps.acceptSingleKw(api.RandomDirective) {
 			q = createIfNeeded(q)
 			if len(q.order) == 0 {
@@ -178,6 +203,13 @@ func (ps *parserState) parse(q *Query) *Query {
 			}
 		}
 		inp.SetPos(pos)
+		if ps.acceptKwArgs(AfterDirective) {
+			if s, ok := ps.parseAfter(q); ok {
+				q = s
+				continue
+			}
+		}
+		inp.SetPos(pos)
 		if ps.acceptKwArgs(api.OffsetDirective) {
 			if s, ok := ps.parseOffset(q); ok {
 				q = s
@@ -196,11 +228,105 @@ func (ps *parserState) parse(q *Query) *Query {
 			q = ps.parseActions(q)
 			break
 		}
+		if s, ok := ps.parseGroup(q); ok {
+			q = s
+			continue
+		}
+		inp.SetPos(pos)
 		q = ps.parseText(q)
 	}
 	return q
 }
 
+// notDirective negates a group of terms, or the following term.
+const notDirective = "NOT"
+
+// parseGroup parses a parenthesised sub-expression, optionally negated by a
+// preceding "NOT". A "NOT" without parenthesis negates the following search
+// term only. It returns false, if there is no such sub-expression.
+func (ps *parserState) parseGroup(q *Query) (*Query, bool) {
+	inp := ps.inp
+	negate := false
+	if inp.Accept(notDirective) {
+		if inp.Ch != groupStartChar {
+			if !inp.IsSpace() {
+				return q, false
+			}
+			inp.SkipSpace()
+			if ps.mustStop() || ps.isActionSep() {
+				return q, false
+			}
+			if inp.Ch != groupStartChar {
+				return addGroup(q, true, ps.parseNegatedTerm()), true
+			}
+		}
+		negate = true
+	}
+	if inp.Ch != groupStartChar {
+		return q, false
+	}
+	inp.Next()
+	ps.depth++
+	var sub *Query
+	for {
+		inp.SkipSpace()
+		if ps.mustStop() || ps.isActionSep() {
+			break
+		}
+		pos := inp.Pos
+		if ps.acceptSingleKw(api.OrDirective) {
+			sub = createIfNeeded(sub)
+			if !sub.terms[len(sub.terms)-1].isEmpty() {
+				sub.terms = append(sub.terms, conjTerms{})
+			}
+			continue
+		}
+		inp.SetPos(pos)
+		if s, ok := ps.parseGroup(sub); ok {
+			sub = s
+			continue
+		}
+		inp.SetPos(pos)
+		sub = ps.parseText(sub)
+	}
+	ps.depth--
+	if inp.Ch == groupEndChar {
+		inp.Next()
+	}
+
+	return addGroup(q, negate, sub), true
+}
+
+// parseNegatedTerm parses the search term that follows a "NOT" without
+// parenthesis. This term may be a group, or another negated term.
+func (ps *parserState) parseNegatedTerm() *Query {
+	inp := ps.inp
+	pos := inp.Pos
+	if sub, ok := ps.parseGroup(nil); ok {
+		return sub
+	}
+	inp.SetPos(pos)
+	return ps.parseText(nil)
+}
+
+// addGroup adds the terms of the sub-expression as a group to the query.
+func addGroup(q *Query, negate bool, sub *Query) *Query {
+	if sub == nil {
+		return q
+	}
+	terms := sub.terms
+	for len(terms) > 0 && terms[len(terms)-1].isEmpty() {
+		terms = terms[:len(terms)-1]
+	}
+	if len(terms) == 0 {
+		return q
+	}
+	q = createIfNeeded(q)
+	last := &q.terms[len(q.terms)-1]
+	last.groups = append(last.groups, &termGroup{negate: negate, terms: terms})
+	return q
+}
+
 func (ps *parserState) parseContext(q *Query) *Query {
 	inp := ps.inp
 	spec := &ContextSpec{}
@@ -265,6 +391,74 @@ func (ps *parserState) parseCount(spec *ContextSpec) bool {
 	return true
 }
 
+func (ps *parserState) parsePath(q *Query) *Query {
+	inp := ps.inp
+	q = createIfNeeded(q)
+	spec := &PathSpec{}
+	for {
+		inp.SkipSpace()
+		if ps.mustStop() {
+			break
+		}
+		pos := inp.Pos
+		if zid, found := ps.scanZid(); found {
+			if !slices.Contains(q.zids, zid) {
+				q.zids = append(q.zids, zid)
+			}
+			continue
+		}
+		inp.SetPos(pos)
+		if ps.acceptSingleKw(api.BackwardDirective) {
+			spec.Direction = ContextDirBackward
+			continue
+		}
+		inp.SetPos(pos)
+		if ps.acceptSingleKw(api.ForwardDirective) {
+			spec.Direction = ContextDirForward
+			continue
+		}
+		inp.SetPos(pos)
+		if ps.acceptKwArgs(api.MaxDirective) {
+			if num, ok := ps.scanPosInt(); ok {
+				if spec.MaxLength == 0 || spec.MaxLength >= num {
+					spec.MaxLength = num
+				}
+				continue
+			}
+		}
+
+		inp.SetPos(pos)
+		break
+	}
+	q.directives = append(q.directives, spec)
+	return q
+}
+
+func (ps *parserState) parseSimilar(q *Query) *Query {
+	inp := ps.inp
+	spec := &SimilarSpec{}
+	for {
+		inp.SkipSpace()
+		if ps.mustStop() {
+			break
+		}
+		pos := inp.Pos
+		if ps.acceptKwArgs(api.MaxDirective) {
+			if num, ok := ps.scanPosInt(); ok {
+				if spec.MaxCount == 0 || spec.MaxCount >= num {
+					spec.MaxCount = num
+				}
+				continue
+			}
+		}
+
+		inp.SetPos(pos)
+		break
+	}
+	q.directives = append(q.directives, spec)
+	return q
+}
+
 func (ps *parserState) parseUnlinked(q *Query) *Query {
 	inp := ps.inp
 
@@ -321,6 +515,16 @@ func (ps *parserState) parseOrder(q *Query) (*Query, bool) {
 	return q, false
 }
 
+func (ps *parserState) parseAfter(q *Query) (*Query, bool) {
+	cursor := string(ps.scanWord())
+	if _, ok := decodeCursor(cursor); !ok {
+		return q, false
+	}
+	q = createIfNeeded(q)
+	q.after = cursor
+	return q, true
+}
+
 func (ps *parserState) parseOffset(q *Query) (*Query, bool) {
 	num, ok := ps.scanPosInt()
 	if !ok {
@@ -379,6 +583,11 @@ func (ps *parserState) parseText(q *Query) *Query {
 		// Assert hasOp == true
 		if op == cmpExist || op == cmpNotExist {
 			if inp.IsSpace() || ps.isActionSep() || ps.mustStop() {
+				if refKey, joinKey, isJoin := splitJoinKey(string(key)); isJoin {
+					q = createIfNeeded(q)
+					q.terms[len(q.terms)-1].addJoinKey(refKey, joinKey, op)
+					return q
+				}
 				return q.addKey(string(key), op)
 			}
 			ps.inp.SetPos(pos)
@@ -396,6 +605,8 @@ func (ps *parserState) parseText(q *Query) *Query {
 	if hasOp {
 		if key == nil {
 			q.addSearch(expValue{string(text), op})
+		} else if refKey, joinKey, isJoin := splitJoinKey(string(key)); isJoin {
+			q.terms[len(q.terms)-1].addJoinValue(refKey, joinKey, expValue{string(text), op})
 		} else {
 			last := len(q.terms) - 1
 			if q.terms[last].mvals == nil {
@@ -427,6 +638,8 @@ func (ps *parserState) scanSearchTextOrKey(hasOp bool) ([]byte, []byte) {
 				allowKey = false
 				if key := inp.Src[pos:inp.Pos]; meta.KeyIsValid(string(key)) {
 					return nil, key
+				} else if _, _, isJoin := splitJoinKey(string(key)); isJoin {
+					return nil, key
 				}
 			}
 		}
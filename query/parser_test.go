@@ -14,6 +14,7 @@
 package query_test
 
 import (
+	"strings"
 	"testing"
 
 	"zettelstore.de/z/query"
@@ -53,6 +54,20 @@ func TestParser(t *testing.T) {
 
 		{"CONTEXT 0", "CONTEXT 0"},
 
+		{"1 SIMILAR", "00000000000001 SIMILAR"},
+		{"SIMILAR", "SIMILAR"},
+		{"1 SIMILAR MAX 5", "00000000000001 SIMILAR MAX 5"},
+		{"1 SIMILAR MAX 5 MAX 7", "00000000000001 SIMILAR MAX 5"},
+		{"1 SIMILAR MAX x", "00000000000001 SIMILAR MAX x"},
+
+		{"PATH", "PATH"},
+		{"PATH 1 2", "00000000000001 00000000000002 PATH"},
+		{"1 2 PATH", "00000000000001 00000000000002 PATH"},
+		{"1 PATH 2 BACKWARD a", "00000000000001 00000000000002 PATH BACKWARD a"},
+		{"PATH 1 2 FORWARD MAX 3", "00000000000001 00000000000002 PATH FORWARD MAX 3"},
+		{"PATH 1 2 MAX x", "00000000000001 00000000000002 PATH MAX x"},
+		{"PATH 1 1", "00000000000001 PATH"},
+
 		{"1 UNLINKED", "00000000000001 UNLINKED"},
 		{"UNLINKED", "UNLINKED"},
 		{"1 UNLINKED PHRASE", "00000000000001 UNLINKED PHRASE"},
@@ -83,6 +98,8 @@ func TestParser(t *testing.T) {
 		{`key~a`, `key~a`}, {`key!~a`, `key!~a`},
 		{`key<a`, `key<a`}, {`key!<a`, `key!<a`},
 		{`key>a`, `key>a`}, {`key!>a`, `key!>a`},
+		{`modified>-7d`, `modified>-7d`}, {`created<TODAY`, `created<TODAY`},
+		{`published>START-OF-MONTH`, `published>START-OF-MONTH`}, {`modified>2024-03`, `modified>2024-03`},
 		{`key1:a key2:b`, `key1:a key2:b`},
 		{`key1: key2:b`, `key1: key2:b`},
 		{"word key:a", "key:a word"},
@@ -103,6 +120,21 @@ func TestParser(t *testing.T) {
 		{"LIMIT 4 LIMIT 8", "LIMIT 4"}, {"LIMIT 8 LIMIT 4", "LIMIT 4"},
 		{"OR", ""}, {"OR OR", ""}, {"a OR", "a"}, {"OR b", "b"}, {"OR a OR", "a"},
 		{"a OR b", "a OR b"},
+		{"a (b OR c)", "(b OR c) a"}, {"(a b)", "(a b)"}, {"(a", "(a)"}, {"()", ""}, {"( )", ""},
+		{"a NOT (b c)", "NOT (b c) a"}, {"NOT(a)", "NOT (a)"}, {"NOT a", "NOT (a)"}, {"NOTE", "NOTE"},
+		{"(a (b OR NOT (c)))", "((b OR NOT (c)) a)"}, {"a OR (b OR c) d", "a OR (b OR c) d"},
+		{"(tags:#a OR tags:#b) NOT role:c", "(tags:#a OR tags:#b) NOT (role:c)"},
+		{"a NOT", "a NOT"}, {"NOT NOT a", "NOT (NOT (a))"}, {"NOT | a", "NOT | a"}, {"(NOT b)", "(NOT (b))"},
+		{"precursor.tags:#draft", "precursor.tags:#draft"},
+		{"back.role=project role:zettel", "role:zettel back.role=project"},
+		{"precursor.role=x precursor.tags?", "precursor.tags? precursor.role=x"},
+		{"folge.tags!? superior.role!=x", "folge.tags!? superior.role!=x"},
+		{"NOT (precursor.tags:#draft)", "NOT (precursor.tags:#draft)"},
+		{"title.role=x", "title.role=x"}, {"precursor.x.y=z", "precursor.x.y=z"}, {"precursor.=x", "precursor.=x"},
+		{"key:a (b) | N", "key:a (b) | N"},
+		{"a | TABLE title back", "a | TABLE title back"},
+		{"EXPLAIN", "EXPLAIN"}, {"a EXPLAIN b", "EXPLAIN a b"}, {"EXPLAIN EXPLAIN a", "EXPLAIN a"},
+		{"1 CONTEXT EXPLAIN", "00000000000001 CONTEXT EXPLAIN"}, {"EXPLAINED", "EXPLAINED"},
 		{"|", ""}, {" | RANDOM", "| RANDOM"}, {"| RANDOM", "| RANDOM"}, {"a|a b ", "a | a b"},
 	}
 	for i, tc := range testcases {
@@ -123,3 +155,24 @@ func TestParser(t *testing.T) {
 		}
 	}
 }
+
+func TestTableKeys(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		spec string
+		exp  string
+	}{
+		{"", ""},
+		{"| N", ""},
+		{"| TABLE", "id title"},
+		{"| TABLE Title back", "title back"},
+		{"| N TABLE role forward", "role forward"},
+		{"| TABLE role !invalid", "role"},
+	}
+	for i, tc := range testcases {
+		keys, ok := query.TableKeys(query.Parse(tc.spec).Actions())
+		if got := strings.Join(keys, " "); got != tc.exp || ok != (tc.exp != "") {
+			t.Errorf("%d: TableKeys(%q) should be %q, but got %q (%v)", i, tc.spec, tc.exp, got, ok)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query
+
+import (
+	"context"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// PathDirective searches for the shortest paths between two zettel.
+const PathDirective = "PATH"
+
+// PathSpec contains all specification values for calculating the shortest
+// paths between two zettel. The zettel are the first and the last zettel of
+// the list of zettel identifier of the query.
+type PathSpec struct {
+	Direction ContextDirection
+	MaxLength int // Maximum number of links of a path, <= 0: default length
+
+	paths [][]*meta.Meta // Paths found by Execute
+}
+
+const (
+	defaultPathLength = 7
+	maxPaths          = 20
+)
+
+func (spec *PathSpec) Print(pe *PrintEnv) {
+	pe.printSpace()
+	pe.writeString(PathDirective)
+	switch spec.Direction {
+	case ContextDirBackward:
+		pe.printSpace()
+		pe.writeString(api.BackwardDirective)
+	case ContextDirForward:
+		pe.printSpace()
+		pe.writeString(api.ForwardDirective)
+	}
+	pe.printPosInt(api.MaxDirective, spec.MaxLength)
+}
+
+// Execute searches the shortest paths from the first zettel of the start list
+// to the last zettel. A path follows links and metadata with zettel
+// identifier values. All zettel of all paths are returned, in path order.
+func (spec *PathSpec) Execute(ctx context.Context, startSeq []*meta.Meta, port ContextPort) []*meta.Meta {
+	spec.paths = nil
+	if len(startSeq) == 0 {
+		return nil
+	}
+	from, to := startSeq[0], startSeq[len(startSeq)-1]
+	if from.Zid == to.Zid {
+		spec.paths = [][]*meta.Meta{{from}}
+		return []*meta.Meta{from}
+	}
+	maxLength := spec.MaxLength
+	if maxLength <= 0 {
+		maxLength = defaultPathLength
+	}
+	isBackward := spec.Direction == ContextDirBoth || spec.Direction == ContextDirBackward
+	isForward := spec.Direction == ContextDirBoth || spec.Direction == ContextDirForward
+
+	// Breadth-first search, remembering all predecessors on a shortest path.
+	metas := map[id.Zid]*meta.Meta{from.Zid: from}
+	parents := map[id.Zid][]id.Zid{from.Zid: nil}
+	level := []*meta.Meta{from}
+	for length := 1; length <= maxLength && len(level) > 0; length++ {
+		var nextLevel []*meta.Meta
+		nextParents := map[id.Zid][]id.Zid{}
+		for _, m := range level {
+			for _, zid := range pathNeighbors(m, isBackward, isForward) {
+				if _, seen := parents[zid]; seen {
+					continue
+				}
+				if _, found := nextParents[zid]; !found {
+					if zid == to.Zid {
+						metas[zid] = to
+					} else {
+						next, err := port.GetMeta(ctx, zid)
+						if err != nil {
+							continue
+						}
+						metas[zid] = next
+						nextLevel = append(nextLevel, next)
+					}
+				}
+				nextParents[zid] = append(nextParents[zid], m.Zid)
+			}
+		}
+		for zid, p := range nextParents {
+			parents[zid] = p
+		}
+		if _, found := nextParents[to.Zid]; found {
+			spec.paths = collectPaths(to.Zid, parents, metas)
+			break
+		}
+		level = nextLevel
+	}
+
+	var result []*meta.Meta
+	seen := id.NewSet()
+	for _, path := range spec.paths {
+		for _, m := range path {
+			if !seen.Contains(m.Zid) {
+				seen.Add(m.Zid)
+				result = append(result, m)
+			}
+		}
+	}
+	return result
+}
+
+// pathNeighbors returns the zettel identifier that are directly connected
+// with the given zettel.
+func pathNeighbors(m *meta.Meta, isBackward, isForward bool) []id.Zid {
+	var result []id.Zid
+	for _, p := range m.ComputedPairsRest() {
+		key := p.Key
+		if key == api.KeyBack {
+			continue
+		}
+		switch key {
+		case api.KeyBackward:
+			if !isBackward {
+				continue
+			}
+		case api.KeyForward:
+			if !isForward {
+				continue
+			}
+		default:
+			hasInverse := meta.Inverse(key) != ""
+			if (!hasInverse || !isBackward) && (hasInverse || !isForward) {
+				continue
+			}
+		}
+		switch meta.Type(key) {
+		case meta.TypeID, meta.TypeIDSet:
+			for _, val := range meta.ListFromValue(p.Value) {
+				if zid, err := id.Parse(val); err == nil {
+					result = append(result, zid)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// collectPaths returns all paths that end in the given zettel, by following
+// the predecessors.
+func collectPaths(zid id.Zid, parents map[id.Zid][]id.Zid, metas map[id.Zid]*meta.Meta) [][]*meta.Meta {
+	preds := parents[zid]
+	if len(preds) == 0 {
+		return [][]*meta.Meta{{metas[zid]}}
+	}
+	var result [][]*meta.Meta
+	for _, pred := range preds {
+		for _, path := range collectPaths(pred, parents, metas) {
+			if len(result) >= maxPaths {
+				return result
+			}
+			result = append(result, append(path, metas[zid]))
+		}
+	}
+	return result
+}
+
+// Paths returns the paths that were found by a PATH directive. Only paths
+// are returned, whose zettel are all contained in the given list, e.g.
+// because some zettel were removed by a search term. If there is no PATH
+// directive, false is returned.
+func (q *Query) Paths(ml []*meta.Meta) ([][]*meta.Meta, bool) {
+	if q == nil {
+		return nil, false
+	}
+	for _, d := range q.directives {
+		spec, isPath := d.(*PathSpec)
+		if !isPath {
+			continue
+		}
+		zids := id.NewSetCap(len(ml))
+		for _, m := range ml {
+			zids.Add(m.Zid)
+		}
+		var result [][]*meta.Meta
+	nextPath:
+		for _, path := range spec.paths {
+			for _, m := range path {
+				if !zids.Contains(m.Zid) {
+					continue nextPath
+				}
+			}
+			result = append(result, path)
+		}
+		return result, true
+	}
+	return nil, false
+}
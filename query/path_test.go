@@ -0,0 +1,87 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+type pathPort map[id.Zid]*meta.Meta
+
+func (pp pathPort) GetMeta(_ context.Context, zid id.Zid) (*meta.Meta, error) {
+	if m, found := pp[zid]; found {
+		return m, nil
+	}
+	return nil, errors.New("zettel not found: " + zid.String())
+}
+func (pp pathPort) SelectMeta(context.Context, []*meta.Meta, *query.Query) ([]*meta.Meta, error) {
+	return nil, nil
+}
+
+func TestPath(t *testing.T) {
+	t.Parallel()
+	links := map[id.Zid]string{
+		1: "00000000000002 00000000000003",
+		2: "00000000000004",
+		3: "00000000000004 00000000000005",
+		5: "00000000000006",
+		4: "00000000000006",
+	}
+	port := pathPort{}
+	for zid := id.Zid(1); zid <= 7; zid++ {
+		m := meta.New(zid)
+		if forward, found := links[zid]; found {
+			m.Set(api.KeyForward, forward)
+		}
+		port[zid] = m
+	}
+
+	testcases := []struct {
+		spec string
+		exp  string
+	}{
+		{"PATH 1 6 FORWARD", "1 2 4 6|1 3 4 6|1 3 5 6"},
+		{"PATH 1 4", "1 2 4|1 3 4"},
+		{"PATH 1 6 FORWARD MAX 2", ""},
+		{"PATH 6 1 FORWARD", ""},
+		{"PATH 1 7", ""},
+		{"PATH 3 3", "3"},
+	}
+	for _, tc := range testcases {
+		q := query.Parse(tc.spec)
+		zids := q.GetZids()
+		startSeq := make([]*meta.Meta, len(zids))
+		for i, zid := range zids {
+			startSeq[i] = port[zid]
+		}
+		spec := q.GetDirectives()[0].(*query.PathSpec)
+		ml := spec.Execute(context.Background(), startSeq, port)
+		paths, _ := q.Paths(ml)
+		got := make([]string, len(paths))
+		for i, path := range paths {
+			got[i] = zidsOf(path)
+		}
+		if gotS := strings.Join(got, "|"); gotS != tc.exp {
+			t.Errorf("%q should result in %q, but got %q", tc.spec, tc.exp, gotS)
+		}
+	}
+}
@@ -58,31 +58,60 @@ func (q *Query) Print(w io.Writer) {
 	for _, d := range q.directives {
 		d.Print(&env)
 	}
-	for i, term := range q.terms {
+	env.printExplain(q.plan)
+	env.printTerms(q.terms)
+	env.printPosInt(api.PickDirective, q.pick)
+	env.printOrder(q.order)
+	env.printAfter(q.after)
+	env.printPosInt(api.OffsetDirective, q.offset)
+	env.printPosInt(api.LimitDirective, q.limit)
+	env.printActions(q.actions)
+}
+
+func (pe *PrintEnv) printExplain(plan *Plan) {
+	if plan != nil {
+		pe.printSpace()
+		pe.writeString(ExplainDirective)
+	}
+}
+
+func (pe *PrintEnv) printTerms(terms []conjTerms) {
+	for i, term := range terms {
 		if i > 0 {
-			env.writeString(" OR")
-		}
-		for _, name := range maps.Keys(term.keys) {
-			env.printSpace()
-			env.writeString(name)
-			if op := term.keys[name]; op == cmpExist || op == cmpNotExist {
-				env.writeString(op2string[op])
-			} else {
-				env.writeStrings(api.ExistOperator, " ", name, api.ExistNotOperator)
-			}
+			pe.writeString(" OR")
 		}
+		pe.printKeys("", term.keys)
 		for _, name := range maps.Keys(term.mvals) {
-			env.printExprValues(name, term.mvals[name])
+			pe.printExprValues(name, term.mvals[name])
+		}
+		pe.printJoins(term.joins)
+		for _, g := range term.groups {
+			pe.printSpace()
+			if g.negate {
+				pe.writeStrings(notDirective, " ")
+			}
+			pe.write(groupStartChar)
+			pe.space = false
+			pe.printTerms(g.terms)
+			pe.write(groupEndChar)
+			pe.space = true
 		}
 		if len(term.search) > 0 {
-			env.printExprValues("", term.search)
+			pe.printExprValues("", term.search)
+		}
+	}
+}
+
+func (pe *PrintEnv) printKeys(prefix string, keys keyExistMap) {
+	for _, name := range maps.Keys(keys) {
+		pe.printSpace()
+		pe.writeStrings(prefix, name)
+		if op := keys[name]; op == cmpExist || op == cmpNotExist {
+			pe.writeString(op2string[op])
+		} else {
+			pe.writeStrings(api.ExistOperator, " ", prefix, name, api.ExistNotOperator)
 		}
 	}
-	env.printPosInt(api.PickDirective, q.pick)
-	env.printOrder(q.order)
-	env.printPosInt(api.OffsetDirective, q.offset)
-	env.printPosInt(api.LimitDirective, q.limit)
-	env.printActions(q.actions)
 }
 
 // PrintEnv is an environment where queries are printed.
@@ -165,49 +194,77 @@ func (q *Query) PrintHuman(w io.Writer) {
 	for _, d := range q.directives {
 		d.Print(&env)
 	}
-	for i, term := range q.terms {
+	env.printExplain(q.plan)
+	env.printHumanTerms(q.terms)
+
+	env.printPosInt(api.PickDirective, q.pick)
+	env.printOrder(q.order)
+	env.printAfter(q.after)
+	env.printPosInt(api.OffsetDirective, q.offset)
+	env.printPosInt(api.LimitDirective, q.limit)
+	env.printActions(q.actions)
+}
+
+func (pe *PrintEnv) printHumanTerms(terms []conjTerms) {
+	for i, term := range terms {
 		if i > 0 {
-			env.writeString(" OR ")
-			env.space = false
+			pe.writeString(" OR ")
+			pe.space = false
 		}
-		for _, name := range maps.Keys(term.keys) {
-			if env.space {
-				env.writeString(" AND ")
+		pe.printHumanKeys("", term.keys)
+		pe.printHumanMetaValues("", term.mvals)
+		pe.printHumanJoins(term.joins)
+		for _, g := range term.groups {
+			if pe.space {
+				pe.writeString(" AND ")
 			}
-			env.writeString(name)
-			switch term.keys[name] {
-			case cmpExist:
-				env.writeString(" EXIST")
-			case cmpNotExist:
-				env.writeString(" NOT EXIST")
-			default:
-				env.writeString(" IS SCHRÖDINGER'S CAT")
+			if g.negate {
+				pe.writeString("NOT ")
 			}
-			env.space = true
-		}
-		for _, name := range maps.Keys(term.mvals) {
-			if env.space {
-				env.writeString(" AND ")
-			}
-			env.writeString(name)
-			env.printHumanSelectExprValues(term.mvals[name])
-			env.space = true
+			pe.write(groupStartChar)
+			pe.space = false
+			pe.printHumanTerms(g.terms)
+			pe.write(groupEndChar)
+			pe.space = true
 		}
 		if len(term.search) > 0 {
-			if env.space {
-				env.writeString(" ")
+			if pe.space {
+				pe.writeString(" ")
 			}
-			env.writeString("ANY")
-			env.printHumanSelectExprValues(term.search)
-			env.space = true
+			pe.writeString("ANY")
+			pe.printHumanSelectExprValues(term.search)
+			pe.space = true
 		}
 	}
+}
 
-	env.printPosInt(api.PickDirective, q.pick)
-	env.printOrder(q.order)
-	env.printPosInt(api.OffsetDirective, q.offset)
-	env.printPosInt(api.LimitDirective, q.limit)
-	env.printActions(q.actions)
+func (pe *PrintEnv) printHumanKeys(prefix string, keys keyExistMap) {
+	for _, name := range maps.Keys(keys) {
+		if pe.space {
+			pe.writeString(" AND ")
+		}
+		pe.writeStrings(prefix, name)
+		switch keys[name] {
+		case cmpExist:
+			pe.writeString(" EXIST")
+		case cmpNotExist:
+			pe.writeString(" NOT EXIST")
+		default:
+			pe.writeString(" IS SCHRÖDINGER'S CAT")
+		}
+		pe.space = true
+	}
+}
+
+func (pe *PrintEnv) printHumanMetaValues(prefix string, mvals expMetaValues) {
+	for _, name := range maps.Keys(mvals) {
+		if pe.space {
+			pe.writeString(" AND ")
+		}
+		pe.writeStrings(prefix, name)
+		pe.printHumanSelectExprValues(mvals[name])
+		pe.space = true
+	}
 }
 
 func (pe *PrintEnv) printHumanSelectExprValues(values []expValue) {
@@ -278,6 +335,13 @@ func (pe *PrintEnv) printOrder(order []sortOrder) {
 	}
 }
 
+func (pe *PrintEnv) printAfter(cursor string) {
+	if cursor != "" {
+		pe.printSpace()
+		pe.writeStrings(AfterDirective, " ", cursor)
+	}
+}
+
 func (pe *PrintEnv) printPosInt(key string, val int) {
 	if val > 0 {
 		pe.printSpace()
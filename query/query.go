@@ -18,7 +18,10 @@ import (
 	"context"
 	"math/rand/v2"
 	"slices"
+	"strings"
+	"time"
 
+	"t73f.de/r/zsc/api"
 	"zettelstore.de/z/zettel/id"
 	"zettelstore.de/z/zettel/meta"
 )
@@ -61,11 +64,15 @@ type Query struct {
 
 	// Fields to be used for sorting
 	order  []sortOrder
-	offset int // <= 0: no offset
-	limit  int // <= 0: no limit
+	after  string // Cursor of the last element of a previous result, empty: no cursor
+	offset int    // <= 0: no offset
+	limit  int    // <= 0: no limit
 
 	// Execute specification
 	actions []string
+
+	// Execution plan, if the query should be explained
+	plan *Plan
 }
 
 // GetZids returns a slide of all specified zettel identifier.
@@ -100,11 +107,54 @@ type conjTerms struct {
 	keys   keyExistMap
 	mvals  expMetaValues // Expected values for a meta datum
 	search []expValue    // Search string
+	groups []*termGroup  // Nested sub-expressions
+	joins  joinMap       // Terms on referenced zettel, by reference key
+}
+
+// termGroup is a parenthesised sub-expression, i.e. a disjunction of terms,
+// that may be negated.
+type termGroup struct {
+	negate bool
+	terms  []conjTerms
 }
 
 func (ct *conjTerms) isEmpty() bool {
-	return len(ct.keys) == 0 && len(ct.mvals) == 0 && len(ct.search) == 0
+	return len(ct.keys) == 0 && len(ct.mvals) == 0 && len(ct.search) == 0 && len(ct.groups) == 0 && len(ct.joins) == 0
 }
+
+func (ct *conjTerms) clone() conjTerms {
+	var c conjTerms
+	if len(ct.keys) > 0 {
+		c.keys = make(keyExistMap, len(ct.keys))
+		for k, v := range ct.keys {
+			c.keys[k] = v
+		}
+	}
+	c.mvals = make(expMetaValues, len(ct.mvals))
+	for k, v := range ct.mvals {
+		c.mvals[k] = v
+	}
+	if len(ct.search) > 0 {
+		c.search = append([]expValue{}, ct.search...)
+	}
+	if len(ct.groups) > 0 {
+		c.groups = make([]*termGroup, len(ct.groups))
+		for i, g := range ct.groups {
+			c.groups[i] = &termGroup{negate: g.negate, terms: cloneTerms(g.terms)}
+		}
+	}
+	c.joins = ct.joins.clone()
+	return c
+}
+
+func cloneTerms(terms []conjTerms) []conjTerms {
+	result := make([]conjTerms, len(terms))
+	for i := range terms {
+		result[i] = terms[i].clone()
+	}
+	return result
+}
+
 func (ct *conjTerms) addKey(key string, op compareOp) {
 	if ct.keys == nil {
 		ct.keys = map[string]compareOp{key: op}
@@ -152,32 +202,17 @@ func (q *Query) Clone() *Query {
 	}
 
 	c.preMatch = q.preMatch
-	c.terms = make([]conjTerms, len(q.terms))
-	for i, term := range q.terms {
-		if len(term.keys) > 0 {
-			c.terms[i].keys = make(keyExistMap, len(term.keys))
-			for k, v := range term.keys {
-				c.terms[i].keys[k] = v
-			}
-		}
-		// if len(c.mvals) > 0 {
-		c.terms[i].mvals = make(expMetaValues, len(term.mvals))
-		for k, v := range term.mvals {
-			c.terms[i].mvals[k] = v
-		}
-		// }
-		if len(term.search) > 0 {
-			c.terms[i].search = append([]expValue{}, term.search...)
-		}
-	}
+	c.terms = cloneTerms(q.terms)
 	c.seed = q.seed
 	c.pick = q.pick
 	if len(q.order) > 0 {
 		c.order = append([]sortOrder{}, q.order...)
 	}
+	c.after = q.after
 	c.offset = q.offset
 	c.limit = q.limit
 	c.actions = q.actions
+	c.plan = q.plan.clone()
 	return c
 }
 
@@ -264,7 +299,13 @@ func (q *Query) GetMetaValues(key string, withMissing bool) (vals []string) {
 	if q == nil {
 		return nil
 	}
-	for _, term := range q.terms {
+	vals = collectMetaValues(vals, q.terms, key, withMissing)
+	slices.Sort(vals)
+	return slices.Compact(vals)
+}
+
+func collectMetaValues(vals []string, terms []conjTerms, key string, withMissing bool) []string {
+	for _, term := range terms {
 		if mvs, hasMv := term.mvals[key]; hasMv {
 			for _, ev := range mvs {
 				if withMissing || !missingMap[ev.op] {
@@ -272,9 +313,14 @@ func (q *Query) GetMetaValues(key string, withMissing bool) (vals []string) {
 				}
 			}
 		}
+		for _, g := range term.groups {
+			// Values of a negated group are effectively missing.
+			if withMissing || !g.negate {
+				vals = collectMetaValues(vals, g.terms, key, withMissing)
+			}
+		}
 	}
-	slices.Sort(vals)
-	return slices.Compact(vals)
+	return vals
 }
 
 // SetPreMatch sets the pre-selection predicate.
@@ -319,6 +365,47 @@ func (q *Query) Actions() []string {
 	return q.actions
 }
 
+// TableAction is the action that produces a table of metadata values. It is
+// followed by the metadata keys of the columns.
+const TableAction = "TABLE"
+
+// TableKeys returns the metadata keys of a TABLE action, if the given actions
+// contain one. If no key is given, the keys "id" and "title" are used.
+func TableKeys(actions []string) ([]string, bool) {
+	for i, act := range actions {
+		if act != TableAction {
+			continue
+		}
+		keys := make([]string, 0, len(actions)-i-1)
+		for _, key := range actions[i+1:] {
+			if key = strings.ToLower(key); meta.KeyIsValid(key) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			keys = append(keys, api.KeyID, api.KeyTitle)
+		}
+		return keys, true
+	}
+	return nil, false
+}
+
+// OrderedBy returns true, if the query is primarily sorted by the given key.
+// The second result signals a descending order.
+func (q *Query) OrderedBy(key string) (bool, bool) {
+	if q == nil || len(q.order) == 0 || q.order[0].key != key {
+		return false, false
+	}
+	return true, q.order[0].descending
+}
+
+// SetOrder replaces the sort order of the query with the given key.
+func (q *Query) SetOrder(key string, descending bool) *Query {
+	q = createIfNeeded(q)
+	q.order = []sortOrder{{key, descending}}
+	return q
+}
+
 // RemoveActions will remove the action part of a query.
 func (q *Query) RemoveActions() {
 	if q != nil {
@@ -339,7 +426,19 @@ func (q *Query) EnrichNeeded() bool {
 		// Unknown, what an action will use. Example: RSS needs api.KeyPublished.
 		return true
 	}
-	for _, term := range q.terms {
+	if termsEnrichNeeded(q.terms) {
+		return true
+	}
+	for _, o := range q.order {
+		if meta.IsProperty(o.key) {
+			return true
+		}
+	}
+	return false
+}
+
+func termsEnrichNeeded(terms []conjTerms) bool {
+	for _, term := range terms {
 		for key := range term.keys {
 			if meta.IsProperty(key) {
 				return true
@@ -350,10 +449,15 @@ func (q *Query) EnrichNeeded() bool {
 				return true
 			}
 		}
-	}
-	for _, o := range q.order {
-		if meta.IsProperty(o.key) {
-			return true
+		for refKey := range term.joins {
+			if meta.IsProperty(refKey) {
+				return true
+			}
+		}
+		for _, g := range term.groups {
+			if termsEnrichNeeded(g.terms) {
+				return true
+			}
 		}
 	}
 	return false
@@ -370,6 +474,11 @@ func (q *Query) RetrieveAndCompile(_ context.Context, searcher Searcher, metaSeq
 				Retrieve: AlwaysIncluded,
 			}}}
 	}
+	start := time.Now()
+	plan := q.plan
+	if plan != nil {
+		plan.reset(q)
+	}
 	q = q.Clone()
 
 	preMatch := q.preMatch
@@ -388,16 +497,25 @@ func (q *Query) RetrieveAndCompile(_ context.Context, searcher Searcher, metaSeq
 		startMeta: metaSeq,
 		PreMatch:  preMatch,
 		Terms:     []CompiledTerm{},
+		plan:      plan,
+	}
+	if q.after != "" {
+		result.after, _ = decodeCursor(q.after)
 	}
 
 	for _, term := range q.terms {
 		cTerm := term.retrieveAndCompileTerm(searcher, startSet)
+		if plan != nil {
+			plan.Terms = append(plan.Terms, term.explain(searcher))
+			cTerm.planTerm = len(plan.Terms)
+		}
 		if cTerm.Retrieve == nil {
 			if cTerm.Match == nil {
 				// no restriction on match/retrieve -> all will match
 				result.Terms = []CompiledTerm{{
 					Match:    matchAlways,
 					Retrieve: AlwaysIncluded,
+					planTerm: cTerm.planTerm,
 				}}
 				break
 			}
@@ -408,6 +526,7 @@ func (q *Query) RetrieveAndCompile(_ context.Context, searcher Searcher, metaSeq
 		}
 		result.Terms = append(result.Terms, cTerm)
 	}
+	result.AddPhase(PhaseCompile, start, -1)
 	return result
 }
 
@@ -427,6 +546,14 @@ func (ct *conjTerms) retrieveAndCompileTerm(searcher Searcher, startSet *id.Set)
 	var pred RetrievePredicate
 	if searcher != nil {
 		pred = ct.retrieveIndex(searcher)
+	}
+	if len(ct.groups) > 0 {
+		match, pred = ct.compileGroups(searcher, match, pred)
+	}
+	if len(ct.joins) > 0 {
+		match, pred = ct.compileJoins(searcher, match, pred)
+	}
+	if searcher != nil {
 		if startSet != nil {
 			if pred == nil {
 				pred = startSet.ContainsOrNil
@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"zettelstore.de/z/encoder/textenc"
@@ -387,8 +388,10 @@ func createIDCompareFunc(cmpVal string, cmpOp compareOp) stringPredicate {
 }
 
 func valuesToTimestampPredicates(values []expValue, addSearch addSearchFunc) []stringPredicate {
+	now := time.Now().Local()
 	result := make([]stringPredicate, len(values))
 	for i, v := range values {
+		v.value = resolveTimestamp(v.value, now)
 		value := meta.ExpandTimestamp(v.value)
 		switch op := disambiguatedTimestampOp(v.op); op {
 		case cmpLess, cmpNoLess, cmpGreater, cmpNoGreater:
@@ -15,6 +15,7 @@ package query_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"t73f.de/r/zsc/api"
@@ -46,3 +47,253 @@ func TestMatchZidNegate(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchGroup(t *testing.T) {
+	q := query.Parse("role:a (tags:#x OR tags:#y) NOT (lang:de)")
+	compiled := q.RetrieveAndCompile(context.Background(), nil, nil)
+
+	testCases := []struct {
+		role string
+		tags string
+		lang string
+		exp  bool
+	}{
+		{"a", "#x", "", true},
+		{"a", "#y #z", "en", true},
+		{"a", "#z", "", false},
+		{"a", "#x", "de", false},
+		{"b", "#x", "", false},
+	}
+	for i, tc := range testCases {
+		m := meta.New(id.MustParse(api.ZidVersion))
+		m.Set(api.KeyRole, tc.role)
+		m.Set(api.KeyTags, tc.tags)
+		if tc.lang != "" {
+			m.Set(api.KeyLang, tc.lang)
+		}
+		if got := compiled.Terms[0].Match(m); got != tc.exp {
+			t.Errorf("%d: %v, match of %q should be %v, but got %v", i, m, q, tc.exp, got)
+		}
+	}
+}
+
+func TestMatchNotTerm(t *testing.T) {
+	q := query.Parse("(tags:#x OR tags:#y) NOT role:c")
+	compiled := q.RetrieveAndCompile(context.Background(), nil, nil)
+
+	testCases := []struct {
+		role string
+		tags string
+		exp  bool
+	}{
+		{"a", "#x", true},
+		{"c", "#x", false},
+		{"c", "#z", false},
+		{"a", "#z", false},
+	}
+	for i, tc := range testCases {
+		m := meta.New(id.MustParse(api.ZidVersion))
+		m.Set(api.KeyRole, tc.role)
+		m.Set(api.KeyTags, tc.tags)
+		if got := compiled.Terms[0].Match(m); got != tc.exp {
+			t.Errorf("%d: %v, match of %q should be %v, but got %v", i, m, q, tc.exp, got)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	q := query.Parse("EXPLAIN role:a tags? ORDER title LIMIT 3")
+	if q.Explain() == nil {
+		t.Fatalf("query %q must be explained", q)
+	}
+	compiled := q.RetrieveAndCompile(context.Background(), nil, nil)
+	plan := q.Explain()
+	if got, exp := plan.Query, "tags? role:a ORDER title LIMIT 3"; got != exp {
+		t.Errorf("plan query should be %q, but got %q", exp, got)
+	}
+	if len(plan.Terms) != 1 {
+		t.Fatalf("plan must contain one term, but got %v", plan.Terms)
+	}
+	if tp := plan.Terms[0]; tp.Candidates != query.CandidatesScan || tp.Count != -1 || len(tp.Match) != 3 {
+		t.Errorf("unexpected term plan %v", tp)
+	}
+	if !compiled.CountCandidates() {
+		t.Error("candidates of an explained query must be counted")
+	}
+	compiled.SetCandidates(compiled.Terms[0], 7)
+	if got := plan.Terms[0].Count; got != 7 {
+		t.Errorf("expected 7 candidates, but got %d", got)
+	}
+	var sb strings.Builder
+	plan.Print(&sb)
+	if got, exp := sb.String(), "  candidates: all (full metadata scan), 7 readable zettel\n"; !strings.Contains(got, exp) {
+		t.Errorf("plan %q must contain %q", got, exp)
+	}
+	if plan.Order != "ORDER title" || plan.Limit != 3 {
+		t.Errorf("unexpected order/limit: %q/%d", plan.Order, plan.Limit)
+	}
+	if len(plan.Phases) != 1 || plan.Phases[0].Name != query.PhaseCompile {
+		t.Errorf("plan must contain compile phase, but got %v", plan.Phases)
+	}
+
+	if query.Parse("role:a").Explain() != nil {
+		t.Error("query without EXPLAIN must not be explained")
+	}
+	if compiled = query.Parse("role:a").RetrieveAndCompile(context.Background(), nil, nil); compiled.CountCandidates() {
+		t.Error("candidates of a query without EXPLAIN must not be counted")
+	}
+
+	c := q.Clone()
+	c.RetrieveAndCompile(context.Background(), nil, nil)
+	if len(plan.Phases) != 1 {
+		t.Errorf("plan of clone must not change original plan, but got %v", plan.Phases)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	titles := []string{"c", "a", "e", "b", "d", "a"}
+	createList := func(skip id.Zid) []*meta.Meta {
+		ml := make([]*meta.Meta, 0, len(titles))
+		for i, title := range titles {
+			if zid := id.Zid(i + 1); zid != skip {
+				m := meta.New(zid)
+				m.Set(api.KeyTitle, title)
+				ml = append(ml, m)
+			}
+		}
+		return ml
+	}
+	getPage := func(q *query.Query, ml []*meta.Meta) []*meta.Meta {
+		compiled := q.RetrieveAndCompile(context.Background(), nil, nil)
+		return compiled.AfterSearch(ml)
+	}
+
+	q := query.Parse("ORDER title LIMIT 2")
+	page := getPage(q, createList(0))
+	if got := zidsOf(page); got != "6 2" {
+		t.Errorf("first page should be %q, but got %q", "6 2", got)
+	}
+	cursor := q.Cursor(page)
+	if cursor == "" {
+		t.Fatal("cursor expected for first page")
+	}
+
+	// A zettel of the first page is deleted: no zettel must be skipped.
+	q = query.Parse(q.String() + " " + query.AfterDirective + " " + cursor)
+	if got := q.String(); got != "ORDER title AFTER "+cursor+" LIMIT 2" {
+		t.Errorf("unexpected query string %q", got)
+	}
+	page = getPage(q, createList(6))
+	if got := zidsOf(page); got != "4 1" {
+		t.Errorf("second page should be %q, but got %q", "4 1", got)
+	}
+
+	q = query.Parse("ORDER title AFTER " + q.Cursor(page) + " LIMIT 2")
+	page = getPage(q, createList(0))
+	if got := zidsOf(page); got != "5 3" {
+		t.Errorf("third page should be %q, but got %q", "5 3", got)
+	}
+
+	if got := query.Parse("RANDOM LIMIT 2").Cursor(page); got != "" {
+		t.Errorf("no cursor expected for random order, but got %q", got)
+	}
+	if got := query.Parse("AFTER xyz").String(); got != "AFTER xyz" {
+		t.Errorf("invalid cursor must be a search term, but got %q", got)
+	}
+}
+
+func zidsOf(ml []*meta.Meta) string {
+	result := make([]byte, 0, 2*len(ml))
+	for i, m := range ml {
+		if i > 0 {
+			result = append(result, ' ')
+		}
+		result = append(result, m.Zid.String()[13:]...)
+	}
+	return string(result)
+}
+
+type joinPort []*meta.Meta
+
+func (jp joinPort) SelectMeta(ctx context.Context, _ []*meta.Meta, q *query.Query) ([]*meta.Meta, error) {
+	compiled := q.RetrieveAndCompile(ctx, nil, nil)
+	var result []*meta.Meta
+	for _, m := range jp {
+		if compiled.Terms[0].Match(m) {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+func TestMatchJoin(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		precursor string
+		role      string
+		tags      string
+	}{
+		{"", "project", "#draft"},
+		{"00000000000001", "zettel", ""},
+		{"00000000000002", "zettel", "#draft"},
+		{"00000000000001 00000000000003", "project", ""},
+		{"00000000000009", "zettel", ""},
+	}
+	port := make(joinPort, len(data))
+	for i, d := range data {
+		m := meta.New(id.Zid(i + 1))
+		m.Set(api.KeyPrecursor, d.precursor)
+		m.Set(api.KeyRole, d.role)
+		m.Set(api.KeyTags, d.tags)
+		port[i] = m
+	}
+
+	testcases := []struct {
+		spec string
+		exp  string
+	}{
+		{"precursor.tags:#draft", "2 4"},
+		{"precursor.role=project", "2 4"},
+		{"precursor.role=project precursor.tags:#draft", "2 4"},
+		{"precursor.role=zettel", "3 4"},
+		{"precursor.role=zettel precursor.tags:#draft", "4"},
+		{"precursor.tags? role:project", "4"},
+		{"NOT (precursor.tags:#draft)", "1 3 5"},
+		{"precursor.role=unknown", ""},
+	}
+	for _, tc := range testcases {
+		q := query.Parse(tc.spec)
+		if err := q.ExecuteJoins(context.Background(), port); err != nil {
+			t.Errorf("%q: unexpected error %v", tc.spec, err)
+			continue
+		}
+		ml, _ := port.SelectMeta(context.Background(), nil, q)
+		if got := zidsOf(ml); got != tc.exp {
+			t.Errorf("%q should result in %q, but got %q", tc.spec, tc.exp, got)
+		}
+	}
+
+	q := query.Parse("precursor.tags:#draft")
+	c := q.Clone()
+	if err := c.ExecuteJoins(context.Background(), port); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.ExecuteJoins(context.Background(), joinPort{}); err != nil {
+		t.Fatal(err)
+	}
+	if ml, _ := port.SelectMeta(context.Background(), nil, q); len(ml) != 0 {
+		t.Errorf("original should not match, but got %q", zidsOf(ml))
+	}
+	if ml, _ := port.SelectMeta(context.Background(), nil, c); zidsOf(ml) != "2 4" {
+		t.Errorf("executing joins of original must not change clone, but got %q", zidsOf(ml))
+	}
+
+	// Executed joins are not executed again.
+	c = q.Clone()
+	if err := c.ExecuteJoins(context.Background(), port); err != nil {
+		t.Fatal(err)
+	}
+	if ml, _ := port.SelectMeta(context.Background(), nil, c); len(ml) != 0 {
+		t.Errorf("joins must not be executed twice, but got %q", zidsOf(ml))
+	}
+}
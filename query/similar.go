@@ -0,0 +1,207 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/strfun"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// SimilarDirective ranks zettel by their similarity to the given zettel.
+const SimilarDirective = "SIMILAR"
+
+// SimilarSpec contains all specification values for calculating similar zettel.
+type SimilarSpec struct {
+	MaxCount int // Maximum number of similar zettel, <= 0: default count
+}
+
+const defaultSimilarCount = 20
+
+// SimilarPort is the collection of box methods needed by this directive.
+type SimilarPort interface {
+	GetWords(ctx context.Context, zid id.Zid) ([]string, error)
+	SearchEqual(word string) *id.Set
+	SelectMeta(ctx context.Context, metaSeq []*meta.Meta, q *Query) ([]*meta.Meta, error)
+}
+
+func (spec *SimilarSpec) Print(pe *PrintEnv) {
+	pe.printSpace()
+	pe.writeString(SimilarDirective)
+	pe.printPosInt(api.MaxDirective, spec.MaxCount)
+}
+
+// Execute returns the zettel that are most similar to the given zettel,
+// ordered by decreasing similarity. The given zettel are not part of the
+// result.
+//
+// Each zettel is described by a vector of its features: the words found by the
+// indexer, and the zettel it references. Features that are shared by many
+// zettel get a lower weight, similar to the TF-IDF measure. Common tags get an
+// additional weight.
+//
+// Only zettel that can be read are candidates, and only they are used to
+// weight the features. Otherwise the result would reveal something about
+// zettel that must not be read.
+func (spec *SimilarSpec) Execute(ctx context.Context, startSeq []*meta.Meta, port SimilarPort) []*meta.Meta {
+	startZids := id.NewSetCap(len(startSeq))
+	features := map[string]struct{}{}
+	var tags []string
+	for _, m := range startSeq {
+		startZids.Add(m.Zid)
+		for _, f := range similarFeatures(ctx, m, port) {
+			features[f] = struct{}{}
+		}
+		tags = append(tags, similarTags(m)...)
+	}
+	if len(features) == 0 {
+		return nil
+	}
+
+	// Retrieve all candidates: readable zettel that share at least one feature.
+	featureList := make([]string, 0, len(features))
+	for f := range features {
+		featureList = append(featureList, f)
+	}
+	slices.Sort(featureList)
+	candidates, err := port.SelectMeta(ctx, nil, similarQuery(featureList))
+	if err != nil {
+		return nil
+	}
+	metas := make(map[id.Zid]*meta.Meta, len(candidates))
+	for _, m := range candidates {
+		if !startZids.Contains(m.Zid) {
+			metas[m.Zid] = m
+		}
+	}
+	numCandidates := float64(len(metas))
+	if numCandidates == 0 {
+		return nil
+	}
+	featureZids := make(map[string][]id.Zid, len(features))
+	for _, f := range featureList {
+		port.SearchEqual(f).ForEach(func(zid id.Zid) {
+			if _, found := metas[zid]; found {
+				featureZids[f] = append(featureZids[f], zid)
+			}
+		})
+	}
+	idf := func(f string) float64 {
+		return math.Log(1 + numCandidates/float64(max(len(featureZids[f]), 1)))
+	}
+
+	scores := make(map[id.Zid]float64, len(metas))
+	for f, zids := range featureZids {
+		weight := idf(f)
+		for _, zid := range zids {
+			scores[zid] += weight
+		}
+	}
+	for zid, m := range metas {
+		for _, tag := range similarTags(m) {
+			if _, found := featureZids[tag]; found && slices.Contains(tags, tag) {
+				scores[zid] += idf(tag)
+			}
+		}
+	}
+
+	// Rank candidates by their score first. Retrieving the words of a zettel
+	// is more expensive, so it is only done for the best candidates. Without
+	// a length, sortRanked orders by score.
+	maxCount := spec.MaxCount
+	if maxCount <= 0 {
+		maxCount = defaultSimilarCount
+	}
+	startLen := float64(len(features))
+	ranked := make([]rankedZid, 0, len(scores))
+	for zid, score := range scores {
+		ranked = append(ranked, rankedZid{zid: zid, score: score})
+	}
+	sortRanked(ranked, startLen)
+	ranked = ranked[:min(len(ranked), similarPreselection*maxCount)]
+
+	for i, rz := range ranked {
+		ranked[i].length = float64(len(similarFeatures(ctx, metas[rz.zid], port)))
+	}
+	sortRanked(ranked, startLen)
+
+	result := make([]*meta.Meta, 0, min(maxCount, len(ranked)))
+	for _, rz := range ranked[:min(maxCount, len(ranked))] {
+		result = append(result, metas[rz.zid])
+	}
+	return result
+}
+
+// similarQuery returns a query that selects all zettel that contain at least
+// one of the given features.
+func similarQuery(features []string) *Query {
+	terms := make([]conjTerms, 0, len(features))
+	for _, f := range features {
+		terms = append(terms, conjTerms{search: []expValue{{value: f, op: cmpEqual}}})
+	}
+	return &Query{terms: []conjTerms{{groups: []*termGroup{{terms: terms}}}}}
+}
+
+const similarPreselection = 4 // Factor of candidates that are ranked with all features
+
+type rankedZid struct {
+	zid    id.Zid
+	score  float64 // Sum of weights of common features
+	length float64 // Number of features
+}
+
+// similarity is the score, normalized by the number of features of both zettel.
+func (rz *rankedZid) similarity(startLen float64) float64 {
+	return rz.score / math.Sqrt(startLen*max(rz.length, 1))
+}
+
+// sortRanked sorts the candidates by decreasing similarity.
+func sortRanked(ranked []rankedZid, startLen float64) {
+	slices.SortFunc(ranked, func(i, j rankedZid) int {
+		if result := cmp.Compare(j.similarity(startLen), i.similarity(startLen)); result != 0 {
+			return result
+		}
+		return cmp.Compare(j.zid, i.zid)
+	})
+}
+
+// similarFeatures returns the features of a zettel: its words and the
+// identifier of all referenced zettel.
+func similarFeatures(ctx context.Context, m *meta.Meta, port SimilarPort) []string {
+	words, err := port.GetWords(ctx, m.Zid)
+	if err != nil {
+		words = nil
+	}
+	if forward, found := m.GetList(api.KeyForward); found {
+		words = append(words, forward...)
+	}
+	return words
+}
+
+// similarTags returns the tags of a zettel, normalized as a word.
+func similarTags(m *meta.Meta) []string {
+	var result []string
+	if tags, found := m.GetList(api.KeyTags); found {
+		for _, tag := range tags {
+			result = append(result, strfun.NormalizeWords(tag)...)
+		}
+	}
+	return result
+}
@@ -0,0 +1,124 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/query"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// similarPort allows to read only the zettel in metas, but the word index
+// contains also other zettel.
+type similarPort struct {
+	metas map[id.Zid]*meta.Meta
+	words map[id.Zid][]string
+	calls map[id.Zid]int // Number of GetWords calls, if not nil
+}
+
+func (sp *similarPort) GetWords(_ context.Context, zid id.Zid) ([]string, error) {
+	if sp.calls != nil {
+		sp.calls[zid]++
+	}
+	if _, found := sp.metas[zid]; found {
+		return sp.words[zid], nil
+	}
+	return nil, errors.New("zettel not found: " + zid.String())
+}
+func (sp *similarPort) SearchEqual(word string) *id.Set {
+	result := id.NewSet()
+	for zid, words := range sp.words {
+		for _, w := range words {
+			if w == word {
+				result.Add(zid)
+			}
+		}
+	}
+	return result
+}
+func (*similarPort) SearchPrefix(string) *id.Set   { return nil }
+func (*similarPort) SearchSuffix(string) *id.Set   { return nil }
+func (*similarPort) SearchContains(string) *id.Set { return nil }
+func (sp *similarPort) SelectMeta(ctx context.Context, _ []*meta.Meta, q *query.Query) ([]*meta.Meta, error) {
+	compiled := q.RetrieveAndCompile(ctx, sp, nil)
+	var result []*meta.Meta
+	for _, m := range sp.metas {
+		for _, term := range compiled.Terms {
+			if term.Retrieve(m.Zid) && term.Match(m) {
+				result = append(result, m)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func TestSimilar(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		words string
+		tags  string
+	}{
+		{"zettel note link index", "#zettel"},
+		{"zettel note link", ""},
+		{"zettel index cooking", "#zettel"},
+		{"cooking recipe pasta", "#food"},
+		{"zettel", ""},
+		{"garden tree", ""},
+	}
+	port := &similarPort{metas: map[id.Zid]*meta.Meta{}, words: map[id.Zid][]string{}, calls: map[id.Zid]int{}}
+	for i, d := range data {
+		zid := id.Zid(i + 1)
+		m := meta.New(zid)
+		if d.tags != "" {
+			m.Set(api.KeyTags, d.tags)
+		}
+		port.metas[zid] = m
+		port.words[zid] = strings.Fields(d.words)
+	}
+	// Unreadable zettel must neither be found, nor change the weight of a word.
+	for i := range 5 {
+		port.words[id.Zid(100+i)] = []string{"index", "link"}
+	}
+	port.words[id.Zid(200)] = []string{"garden", "tree"}
+
+	testcases := []struct {
+		spec string
+		exp  string
+	}{
+		{"1 SIMILAR", "2 3 5"},
+		{"1 SIMILAR MAX 2", "2 3"},
+		{"4 SIMILAR", "3"},
+		{"6 SIMILAR", ""},
+	}
+	for _, tc := range testcases {
+		q := query.Parse(tc.spec)
+		startSeq := []*meta.Meta{port.metas[q.GetZids()[0]]}
+		spec := q.GetDirectives()[0].(*query.SimilarSpec)
+		if got := zidsOf(spec.Execute(context.Background(), startSeq, port)); got != tc.exp {
+			t.Errorf("%q should result in %q, but got %q", tc.spec, tc.exp, got)
+		}
+	}
+	for zid, calls := range port.calls {
+		if _, found := port.metas[zid]; !found {
+			t.Errorf("words of unreadable zettel %v retrieved %d times", zid, calls)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"zettelstore.de/z/zettel/id"
+)
+
+// Symbolic timestamp values, resolved when the query is evaluated.
+const (
+	timestampNow          = "NOW"
+	timestampToday        = "TODAY"
+	timestampYesterday    = "YESTERDAY"
+	timestampTomorrow     = "TOMORROW"
+	timestampStartOfWeek  = "START-OF-WEEK"
+	timestampStartOfMonth = "START-OF-MONTH"
+	timestampStartOfYear  = "START-OF-YEAR"
+)
+
+// resolveTimestamp transforms a relative or symbolic timestamp value into a
+// timestamp with digits only, based on the given time. Values that are not
+// relative or symbolic are returned unchanged.
+//
+// A relative value is a signed number, followed by a unit: "h" (hours), "d"
+// (days), "w" (weeks), "m" (months), or "y" (years), e.g. "-7d". A date like
+// "2024-03" or "2024-03-15", optionally followed by a time like "T10:30", is
+// transformed into its digits.
+func resolveTimestamp(value string, now time.Time) string {
+	if value == "" {
+		return value
+	}
+	switch value {
+	case timestampNow:
+		return now.Format(id.TimestampLayout)
+	case timestampToday:
+		return formatDay(now)
+	case timestampYesterday:
+		return formatDay(now.AddDate(0, 0, -1))
+	case timestampTomorrow:
+		return formatDay(now.AddDate(0, 0, 1))
+	case timestampStartOfWeek:
+		// A week starts on monday.
+		return formatDay(now.AddDate(0, 0, -(int(now.Weekday())+6)%7))
+	case timestampStartOfMonth:
+		return now.Format("200601") + "01000000"
+	case timestampStartOfYear:
+		return now.Format("2006") + "0101000000"
+	}
+	if ch := value[0]; ch == '-' || ch == '+' {
+		if t, ok := addRelative(now, value); ok {
+			return t.Format(id.TimestampLayout)
+		}
+		return value
+	}
+	if s, ok := compactDate(value); ok {
+		return s
+	}
+	return value
+}
+
+func formatDay(t time.Time) string { return t.Format("20060102") + "000000" }
+
+func addRelative(now time.Time, value string) (time.Time, bool) {
+	last := len(value) - 1
+	if last < 2 || !isDigits(value[1:last]) {
+		return now, false
+	}
+	n, err := strconv.Atoi(value[1:last])
+	if err != nil {
+		return now, false
+	}
+	if value[0] == '-' {
+		n = -n
+	}
+	switch value[last] {
+	case 'h':
+		return now.Add(time.Duration(n) * time.Hour), true
+	case 'd':
+		return now.AddDate(0, 0, n), true
+	case 'w':
+		return now.AddDate(0, 0, 7*n), true
+	case 'm':
+		return now.AddDate(0, n, 0), true
+	case 'y':
+		return now.AddDate(n, 0, 0), true
+	}
+	return now, false
+}
+
+// compactDate removes the separators from a date like "2024-03-15T10:30:00".
+func compactDate(value string) (string, bool) {
+	if l := len(value); l < 7 || l > 19 {
+		return "", false
+	}
+	var sb strings.Builder
+	for i := range len(value) {
+		ch := value[i]
+		switch i {
+		case 4, 7:
+			if ch != '-' {
+				return "", false
+			}
+		case 10:
+			if ch != 'T' {
+				return "", false
+			}
+		case 13, 16:
+			if ch != ':' {
+				return "", false
+			}
+		default:
+			if ch < '0' || '9' < ch {
+				return "", false
+			}
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String(), true
+}
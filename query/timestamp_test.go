@@ -0,0 +1,58 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveTimestamp(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, time.March, 14, 15, 9, 26, 0, time.Local) // A thursday
+	testcases := []struct {
+		value string
+		exp   string
+	}{
+		{"", ""},
+		{"2024", "2024"},
+		{"20240314", "20240314"},
+		{"abc", "abc"},
+		{"NOW", "20240314150926"},
+		{"TODAY", "20240314000000"},
+		{"YESTERDAY", "20240313000000"},
+		{"TOMORROW", "20240315000000"},
+		{"START-OF-WEEK", "20240311000000"},
+		{"START-OF-MONTH", "20240301000000"},
+		{"START-OF-YEAR", "20240101000000"},
+		{"-7d", "20240307150926"},
+		{"+1d", "20240315150926"},
+		{"-2h", "20240314130926"},
+		{"-1w", "20240307150926"},
+		{"-1m", "20240214150926"},
+		{"-1y", "20230314150926"},
+		{"-d", "-d"}, {"-7x", "-7x"}, {"-+7d", "-+7d"}, {"-", "-"},
+		{"2024-03", "202403"},
+		{"2024-03-15", "20240315"},
+		{"2024-03-15T10:30", "202403151030"},
+		{"2024-03-15T10:30:45", "20240315103045"},
+		{"2024-3-15", "2024-3-15"},
+		{"2024-03-15 10:30", "2024-03-15 10:30"},
+	}
+	for _, tc := range testcases {
+		if got := resolveTimestamp(tc.value, now); got != tc.exp {
+			t.Errorf("resolveTimestamp(%q) should be %q, but got %q", tc.value, tc.exp, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package usecase
+
+import (
+	"context"
+	"slices"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// Operations that are recorded in an audit trail.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditRecorder records all operations that changed a zettel.
+type AuditRecorder interface {
+	// RecordChange stores that the current user changed the given zettel.
+	// Keys lists the metadata keys that were changed, withContent states
+	// whether the content was changed too.
+	RecordChange(ctx context.Context, op string, zid id.Zid, keys []string, withContent bool)
+}
+
+// changedKeys returns the sorted list of metadata keys whose values differ.
+// Modified is ignored, because it changes on every update.
+func changedKeys(oldMeta, newMeta *meta.Meta) []string {
+	var result []string
+	newPairs := newMeta.Map()
+	for key, oldVal := range oldMeta.Map() {
+		if newVal, found := newPairs[key]; !found || newVal != oldVal {
+			result = append(result, key)
+		}
+	}
+	for key := range newPairs {
+		if _, found := oldMeta.Get(key); !found {
+			result = append(result, key)
+		}
+	}
+	result = slices.DeleteFunc(result, func(key string) bool { return key == api.KeyModified })
+	slices.Sort(result)
+	return result
+}
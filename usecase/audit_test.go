@@ -0,0 +1,56 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package usecase
+
+import (
+	"slices"
+	"testing"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func TestChangedKeys(t *testing.T) {
+	t.Parallel()
+	newMeta := func(pairs ...string) *meta.Meta {
+		m := meta.New(id.Zid(1))
+		for i := 0; i < len(pairs); i += 2 {
+			m.Set(pairs[i], pairs[i+1])
+		}
+		return m
+	}
+	testcases := []struct {
+		name     string
+		oldMeta  *meta.Meta
+		newMeta  *meta.Meta
+		expected []string
+	}{
+		{"empty", newMeta(), newMeta(), nil},
+		{"same", newMeta(api.KeyTitle, "a"), newMeta(api.KeyTitle, "a"), nil},
+		{"changed", newMeta(api.KeyTitle, "a"), newMeta(api.KeyTitle, "b"), []string{api.KeyTitle}},
+		{"added", newMeta(), newMeta(api.KeyTitle, "a"), []string{api.KeyTitle}},
+		{"removed", newMeta(api.KeyTitle, "a"), newMeta(), []string{api.KeyTitle}},
+		{"modified", newMeta(api.KeyModified, "20241019100000"), newMeta(api.KeyModified, "20241019110000"), nil},
+		{"sorted",
+			newMeta(api.KeyTitle, "a", api.KeyRole, "r", api.KeyTags, "#t"),
+			newMeta(api.KeyTags, "#u", api.KeySyntax, "zmk", api.KeyRole, "r"),
+			[]string{api.KeySyntax, api.KeyTags, api.KeyTitle}},
+	}
+	for _, tc := range testcases {
+		if got := changedKeys(tc.oldMeta, tc.newMeta); !slices.Equal(got, tc.expected) {
+			t.Errorf("%s: expected %v, but got %v", tc.name, tc.expected, got)
+		}
+	}
+}
@@ -36,14 +36,16 @@ type CreateZettel struct {
 	log      *logger.Logger
 	rtConfig config.Config
 	port     CreateZettelPort
+	audit    AuditRecorder
 }
 
 // NewCreateZettel creates a new use case.
-func NewCreateZettel(log *logger.Logger, rtConfig config.Config, port CreateZettelPort) CreateZettel {
+func NewCreateZettel(log *logger.Logger, rtConfig config.Config, port CreateZettelPort, audit AuditRecorder) CreateZettel {
 	return CreateZettel{
 		log:      log,
 		rtConfig: rtConfig,
 		port:     port,
+		audit:    audit,
 	}
 }
 
@@ -71,6 +73,21 @@ func (*CreateZettel) PrepareVersion(origZettel zettel.Zettel) zettel.Zettel {
 	return zettel.Zettel{Meta: m, Content: content}
 }
 
+// PrepareKeep the zettel of a read-only box, e.g. a feed item, for further
+// modification. The new zettel keeps the URL of its source.
+func (*CreateZettel) PrepareKeep(origZettel zettel.Zettel) zettel.Zettel {
+	origMeta := origZettel.Meta
+	m := meta.New(id.Invalid)
+	m.SetNonEmpty(api.KeyTitle, origMeta.GetDefault(api.KeyTitle, ""))
+	m.SetNonEmpty(api.KeyTags, origMeta.GetDefault(api.KeyTags, ""))
+	m.SetNonEmpty(api.KeySyntax, origMeta.GetDefault(api.KeySyntax, meta.DefaultSyntax))
+	m.SetNonEmpty(api.KeyAuthor, origMeta.GetDefault(api.KeyAuthor, ""))
+	m.SetNonEmpty(api.KeyURL, origMeta.GetDefault(api.KeyURL, ""))
+	content := origZettel.Content
+	content.TrimSpace()
+	return zettel.Zettel{Meta: m, Content: content}
+}
+
 // PrepareFolge the zettel for further modification.
 func (*CreateZettel) PrepareFolge(origZettel zettel.Zettel) zettel.Zettel {
 	origMeta := origZettel.Meta
@@ -154,5 +171,8 @@ func (uc *CreateZettel) Run(ctx context.Context, zettel zettel.Zettel) (id.Zid,
 	zettel.Content.TrimSpace()
 	zid, err := uc.port.CreateZettel(ctx, zettel)
 	uc.log.Info().User(ctx).Zid(zid).Err(err).Msg("Create zettel")
+	if err == nil && uc.audit != nil {
+		uc.audit.RecordChange(ctx, AuditCreate, zid, changedKeys(meta.New(zid), m), true)
+	}
 	return zid, err
 }
@@ -28,18 +28,22 @@ type DeleteZettelPort interface {
 
 // DeleteZettel is the data for this use case.
 type DeleteZettel struct {
-	log  *logger.Logger
-	port DeleteZettelPort
+	log   *logger.Logger
+	port  DeleteZettelPort
+	audit AuditRecorder
 }
 
 // NewDeleteZettel creates a new use case.
-func NewDeleteZettel(log *logger.Logger, port DeleteZettelPort) DeleteZettel {
-	return DeleteZettel{log: log, port: port}
+func NewDeleteZettel(log *logger.Logger, port DeleteZettelPort, audit AuditRecorder) DeleteZettel {
+	return DeleteZettel{log: log, port: port, audit: audit}
 }
 
 // Run executes the use case.
 func (uc *DeleteZettel) Run(ctx context.Context, zid id.Zid) error {
 	err := uc.port.DeleteZettel(ctx, zid)
 	uc.log.Info().User(ctx).Zid(zid).Err(err).Msg("Delete zettel")
+	if err == nil && uc.audit != nil {
+		uc.audit.RecordChange(ctx, AuditDelete, zid, nil, false)
+	}
 	return err
 }
@@ -84,3 +84,9 @@ func (uc *Evaluate) GetZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, e
 func (uc *Evaluate) QueryMeta(ctx context.Context, q *query.Query) ([]*meta.Meta, error) {
 	return uc.ucQuery.Run(ctx, q)
 }
+
+// QueryDuplicates returns the groups of duplicates within a result of QueryMeta.
+func (uc *Evaluate) QueryDuplicates(ctx context.Context, q *query.Query, ml []*meta.Meta) []query.DuplicateGroup {
+	groups, _ := uc.ucQuery.Duplicates(ctx, q, ml)
+	return groups
+}
@@ -49,14 +49,16 @@ func NewGetUser(authz auth.AuthzManager, port GetUserPort) GetUser {
 func (uc GetUser) Run(ctx context.Context, ident string) (*meta.Meta, error) {
 	ctx = box.NoEnrichContext(ctx)
 
-	// It is important to try first with the owner. First, because another user
-	// could give herself the same ''ident''. Second, in most cases the owner
+	// It is important to try first with the owners. First, because another user
+	// could give herself the same ''ident''. Second, in most cases an owner
 	// will authenticate.
-	identZettel, err := uc.port.GetZettel(ctx, uc.authz.Owner())
-	if err == nil && identZettel.Meta.GetDefault(api.KeyUserID, "") == ident {
-		return identZettel.Meta, nil
+	for _, owner := range uc.authz.Owners() {
+		identZettel, err := uc.port.GetZettel(ctx, owner)
+		if err == nil && identZettel.Meta.GetDefault(api.KeyUserID, "") == ident {
+			return identZettel.Meta, nil
+		}
 	}
-	// Owner was not found or has another ident. Try via list search.
+	// No owner was found or they have another ident. Try via list search.
 	q := query.Parse(api.KeyUserID + api.SearchOperatorHas + ident + " " + api.SearchOperatorHas + ident)
 	metaList, err := uc.port.SelectMeta(ctx, nil, q)
 	if err != nil {
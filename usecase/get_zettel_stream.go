@@ -0,0 +1,44 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package usecase
+
+import (
+	"context"
+
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// GetZettelStreamPort is the interface used by this use case.
+type GetZettelStreamPort interface {
+	// GetZettelStream retrieves the metadata and a stream of the content of
+	// a specific zettel.
+	GetZettelStream(ctx context.Context, zid id.Zid) (*meta.Meta, *box.ContentStream, error)
+}
+
+// GetZettelStream is the data for this use case.
+type GetZettelStream struct {
+	port GetZettelStreamPort
+}
+
+// NewGetZettelStream creates a new use case.
+func NewGetZettelStream(port GetZettelStreamPort) GetZettelStream {
+	return GetZettelStream{port: port}
+}
+
+// Run executes the use case. The caller must close the returned stream.
+func (uc GetZettelStream) Run(ctx context.Context, zid id.Zid) (*meta.Meta, *box.ContentStream, error) {
+	return uc.port.GetZettelStream(ctx, zid)
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"t73f.de/r/zsc/api"
 	"zettelstore.de/z/ast"
@@ -35,18 +36,22 @@ import (
 type QueryPort interface {
 	GetZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, error)
 	GetMeta(ctx context.Context, zid id.Zid) (*meta.Meta, error)
+	GetWords(ctx context.Context, zid id.Zid) ([]string, error)
+	SearchEqual(word string) *id.Set
 	SelectMeta(ctx context.Context, metaSeq []*meta.Meta, q *query.Query) ([]*meta.Meta, error)
 }
 
 // Query is the data for this use case.
 type Query struct {
 	port       QueryPort
+	index      query.DuplicatesPort
 	ucEvaluate Evaluate
 }
 
-// NewQuery creates a new use case.
-func NewQuery(port QueryPort) Query {
-	return Query{port: port}
+// NewQuery creates a new use case. The index is used to detect duplicates
+// of already selected zettel, it does not need to check access rights.
+func NewQuery(port QueryPort, index query.DuplicatesPort) Query {
+	return Query{port: port, index: index}
 }
 
 // SetEvaluate sets the usecase Evaluate, because of circular dependencies.
@@ -61,16 +66,30 @@ func (uc *Query) Run(ctx context.Context, q *query.Query) ([]*meta.Meta, error)
 	if len(zids) == 0 {
 		return nil, nil
 	}
+	start := time.Now()
 	metaSeq, err := uc.getMetaZid(ctx, zids)
 	if err != nil {
 		return metaSeq, err
 	}
-	if metaSeq = uc.processDirectives(ctx, metaSeq, q.GetDirectives()); len(metaSeq) > 0 {
+	metaSeq = uc.processDirectives(ctx, metaSeq, q.GetDirectives())
+	q.AddPhase(query.PhaseDirectives, start, len(metaSeq))
+	if len(metaSeq) > 0 {
 		return uc.port.SelectMeta(ctx, metaSeq, q)
 	}
 	return nil, nil
 }
 
+// Duplicates returns the groups of duplicate zettel within the given list,
+// if the query contains a DUPLICATES action. The list must be a result of
+// Run, because access rights are not checked again.
+func (uc *Query) Duplicates(ctx context.Context, q *query.Query, ml []*meta.Meta) ([]query.DuplicateGroup, bool) {
+	spec, isDuplicates := query.DuplicatesSpecFromActions(q.Actions())
+	if !isDuplicates {
+		return nil, false
+	}
+	return spec.Execute(ctx, ml, uc.index), true
+}
+
 func (uc *Query) getMetaZid(ctx context.Context, zids []id.Zid) ([]*meta.Meta, error) {
 	metaSeq := make([]*meta.Meta, 0, len(zids))
 	for _, zid := range zids {
@@ -100,6 +119,10 @@ func (uc *Query) processDirectives(ctx context.Context, metaSeq []*meta.Meta, di
 			metaSeq = uc.processContextDirective(ctx, ds, metaSeq)
 		case *query.IdentSpec:
 			// Nothing to do.
+		case *query.SimilarSpec:
+			metaSeq = ds.Execute(ctx, metaSeq, uc.port)
+		case *query.PathSpec:
+			metaSeq = ds.Execute(ctx, metaSeq, uc.port)
 		case *query.ItemsSpec:
 			metaSeq = uc.processItemsDirective(ctx, ds, metaSeq)
 		case *query.UnlinkedSpec:
@@ -0,0 +1,240 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/auth"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// ValueRoleShare is the role of all share zettel.
+const ValueRoleShare = "share"
+
+// ErrShareInvalid is returned if a share is not usable any more.
+var ErrShareInvalid = errors.New("share is invalid, expired, or revoked")
+
+// Use case: create a share for a zettel or a query.
+// ---------------------------------------------------
+
+// CurrentUserPort allows to retrieve the currently active user.
+type CurrentUserPort interface {
+	GetUser(context.Context) *meta.Meta
+}
+
+// CreateSharePort is the interface used by this use case.
+type CreateSharePort interface {
+	// GetMeta retrieves just the meta data of a specific zettel.
+	GetMeta(ctx context.Context, zid id.Zid) (*meta.Meta, error)
+
+	// CreateZettel creates a new zettel.
+	CreateZettel(ctx context.Context, zettel zettel.Zettel) (id.Zid, error)
+}
+
+// CreateShare is the data for this use case.
+type CreateShare struct {
+	log   *logger.Logger
+	port  CreateSharePort
+	up    CurrentUserPort
+	token auth.TokenManager
+	authz auth.AuthzManager
+}
+
+// NewCreateShare creates a new use case.
+func NewCreateShare(log *logger.Logger, port CreateSharePort, up CurrentUserPort, token auth.TokenManager, authz auth.AuthzManager) CreateShare {
+	return CreateShare{log: log, port: port, up: up, token: token, authz: authz}
+}
+
+// Run executes the use case. Either the zettel identifier must be valid, or
+// a query must be given. If maxViews is greater than zero, the share can only
+// be used that often.
+//
+// It returns the zettel identifier of the new share zettel, and the token
+// that grants access to the shared zettel / query result.
+func (uc *CreateShare) Run(ctx context.Context, zid id.Zid, q string, d time.Duration, maxViews int) (id.Zid, []byte, error) {
+	user := uc.up.GetUser(ctx)
+	if !uc.authz.WithAuth() || user == nil || uc.authz.GetUserRole(user) < meta.UserRoleWriter {
+		return id.Invalid, nil, box.NewErrNotAllowed("CreateShare", user, zid)
+	}
+
+	m := meta.New(id.Invalid)
+	var title string
+	if zid.IsValid() {
+		sharedMeta, err := uc.port.GetMeta(ctx, zid)
+		if err != nil {
+			return id.Invalid, nil, err
+		}
+		m.Set(meta.KeyShareZettel, zid.String())
+		title = "Share of " + sharedMeta.GetTitle()
+	} else {
+		m.Set(meta.KeyShareQuery, q)
+		title = "Share of query " + q
+	}
+	expires := time.Now().Add(d)
+	m.Set(api.KeyTitle, title)
+	m.Set(api.KeyRole, ValueRoleShare)
+	m.Set(api.KeySyntax, meta.SyntaxNone)
+	m.Set(api.KeyVisibility, api.ValueVisibilityLogin)
+	m.Set(api.KeyExpire, expires.Local().Format(id.TimestampLayout))
+	m.Set(meta.KeyShareCreator, user.Zid.String())
+	m.Set(meta.KeyShareViews, "0")
+	if maxViews > 0 {
+		m.Set(meta.KeyShareMaxViews, strconv.Itoa(maxViews))
+	}
+	m.SetNow(api.KeyCreated)
+
+	shareZid, err := uc.port.CreateZettel(ctx, zettel.Zettel{Meta: m})
+	uc.log.Info().User(ctx).Zid(shareZid).Err(err).Msg("Create share")
+	if err != nil {
+		return id.Invalid, nil, err
+	}
+	token, err := uc.token.GetShareToken(shareZid, expires)
+	if err != nil {
+		return id.Invalid, nil, err
+	}
+	return shareZid, token, nil
+}
+
+// Use case: use a share to retrieve a zettel or a query result.
+// --------------------------------------------------------------
+
+// UseSharePort is the interface used by this use case.
+type UseSharePort interface {
+	// GetZettel retrieves a specific zettel.
+	GetZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, error)
+
+	// UpdateZettel updates an existing zettel.
+	UpdateZettel(ctx context.Context, zettel zettel.Zettel) error
+}
+
+// UseShare is the data for this use case.
+type UseShare struct {
+	log   *logger.Logger
+	port  UseSharePort
+	views *shareViews
+}
+
+// shareViews counts the views of shares that are not limited. These views are
+// not stored, to avoid writing the share zettel on every use.
+type shareViews struct {
+	mx     sync.Mutex // Serializes the counting of views
+	counts map[id.Zid]int64
+}
+
+// NewUseShare creates a new use case. The port must not check any access
+// rights, because the share is used without authentication.
+func NewUseShare(log *logger.Logger, port UseSharePort) UseShare {
+	return UseShare{log: log, port: port, views: &shareViews{counts: map[id.Zid]int64{}}}
+}
+
+// UseShare checks that the share zettel allows to retrieve data. If so, the
+// number of views is incremented. It returns the share zettel and the user
+// that created the share.
+//
+// Only if the number of views is limited, the share zettel is updated.
+// Otherwise, views are counted in memory only.
+func (uc *UseShare) UseShare(ctx context.Context, zid id.Zid) (*meta.Meta, *meta.Meta, error) {
+	ctx = box.NoEnrichContext(ctx)
+	uc.views.mx.Lock()
+	defer uc.views.mx.Unlock()
+
+	z, err := uc.port.GetZettel(ctx, zid)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := z.Meta
+	if m.GetDefault(api.KeyRole, "") != ValueRoleShare || m.GetBool(meta.KeyShareRevoked) {
+		return nil, nil, ErrShareInvalid
+	}
+	if val, found := m.Get(api.KeyExpire); found {
+		if expires, ok := meta.TimeValue(val); !ok || !time.Now().Before(expires) {
+			return nil, nil, ErrShareInvalid
+		}
+	}
+	views := m.GetNumber(meta.KeyShareViews, 0)
+	maxViews := m.GetNumber(meta.KeyShareMaxViews, 0)
+	if maxViews > 0 && views >= maxViews {
+		return nil, nil, ErrShareInvalid
+	}
+	creatorZid, err := id.Parse(m.GetDefault(meta.KeyShareCreator, ""))
+	if err != nil {
+		return nil, nil, ErrShareInvalid
+	}
+	creator, err := uc.port.GetZettel(ctx, creatorZid)
+	if err != nil {
+		return nil, nil, ErrShareInvalid
+	}
+
+	if maxViews > 0 {
+		views++
+		m.Set(meta.KeyShareViews, strconv.FormatInt(views, 10))
+		if err = uc.port.UpdateZettel(ctx, z); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		uc.views.counts[zid]++
+		views += uc.views.counts[zid]
+		m.Set(meta.KeyShareViews, strconv.FormatInt(views, 10))
+	}
+	uc.log.Info().Zid(zid).Int("views", views).Msg("Use share")
+	return m, creator.Meta, nil
+}
+
+// Use case: revoke a share.
+// --------------------------
+
+// RevokeSharePort is the interface used by this use case.
+type RevokeSharePort interface {
+	// GetZettel retrieves a specific zettel.
+	GetZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, error)
+
+	// UpdateZettel updates an existing zettel.
+	UpdateZettel(ctx context.Context, zettel zettel.Zettel) error
+}
+
+// RevokeShare is the data for this use case.
+type RevokeShare struct {
+	log  *logger.Logger
+	port RevokeSharePort
+}
+
+// NewRevokeShare creates a new use case.
+func NewRevokeShare(log *logger.Logger, port RevokeSharePort) RevokeShare {
+	return RevokeShare{log: log, port: port}
+}
+
+// Run executes the use case.
+func (uc *RevokeShare) Run(ctx context.Context, zid id.Zid) error {
+	z, err := uc.port.GetZettel(box.NoEnrichContext(ctx), zid)
+	if err != nil {
+		return err
+	}
+	if z.Meta.GetDefault(api.KeyRole, "") != ValueRoleShare {
+		return box.ErrZettelNotFound{Zid: zid}
+	}
+	z.Meta.Set(meta.KeyShareRevoked, api.ValueTrue)
+	err = uc.port.UpdateZettel(ctx, z)
+	uc.log.Info().User(ctx).Zid(zid).Err(err).Msg("Revoke share")
+	return err
+}
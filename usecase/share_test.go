@@ -0,0 +1,206 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"t73f.de/r/zsc/input"
+	"zettelstore.de/z/auth"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// shareBox stores only the metadata that is written to a file. Therefore,
+// computed and property keys are lost, as with a real box.
+type shareBox struct {
+	data    map[id.Zid][]byte
+	lastZid id.Zid
+}
+
+func newShareBox(zettel ...*meta.Meta) *shareBox {
+	sb := &shareBox{data: map[id.Zid][]byte{}, lastZid: 20241019100000}
+	for _, m := range zettel {
+		sb.store(m)
+	}
+	return sb
+}
+
+func (sb *shareBox) store(m *meta.Meta) {
+	var buf bytes.Buffer
+	_, _ = m.WriteComputed(&buf)
+	sb.data[m.Zid] = buf.Bytes()
+}
+
+func (sb *shareBox) GetMeta(_ context.Context, zid id.Zid) (*meta.Meta, error) {
+	data, found := sb.data[zid]
+	if !found {
+		return nil, box.ErrZettelNotFound{Zid: zid}
+	}
+	return meta.NewFromInput(zid, input.NewInput(data)), nil
+}
+
+func (sb *shareBox) GetZettel(ctx context.Context, zid id.Zid) (zettel.Zettel, error) {
+	m, err := sb.GetMeta(ctx, zid)
+	return zettel.Zettel{Meta: m}, err
+}
+
+func (sb *shareBox) CreateZettel(_ context.Context, z zettel.Zettel) (id.Zid, error) {
+	sb.lastZid++
+	m := z.Meta.Clone()
+	m.Zid = sb.lastZid
+	sb.store(m)
+	return m.Zid, nil
+}
+
+func (sb *shareBox) UpdateZettel(_ context.Context, z zettel.Zettel) error {
+	if _, found := sb.data[z.Meta.Zid]; !found {
+		return box.ErrZettelNotFound{Zid: z.Meta.Zid}
+	}
+	sb.store(z.Meta)
+	return nil
+}
+
+type shareAuth struct{}
+
+func (shareAuth) GetToken(*meta.Meta, time.Duration, auth.TokenKind) ([]byte, error) { return nil, nil }
+func (shareAuth) CheckToken([]byte, auth.TokenKind) (auth.TokenData, error) {
+	return auth.TokenData{}, nil
+}
+func (shareAuth) GetShareToken(share id.Zid, _ time.Time) ([]byte, error) {
+	return share.Bytes(), nil
+}
+func (shareAuth) CheckShareToken(token []byte) (id.Zid, error) { return id.Parse(string(token)) }
+func (shareAuth) IsReadonly() bool                             { return false }
+func (shareAuth) Owners() []id.Zid                             { return nil }
+func (shareAuth) IsOwner(id.Zid) bool                          { return false }
+func (shareAuth) IsAdmin(*meta.Meta) bool                      { return false }
+func (shareAuth) WithAuth() bool                               { return true }
+func (shareAuth) GetUserRole(user *meta.Meta) meta.UserRole {
+	if user == nil {
+		return meta.UserRoleUnknown
+	}
+	return meta.GetUserRole(user.GetDefault(api.KeyUserRole, ""))
+}
+
+type shareUser struct{ user *meta.Meta }
+
+func (su shareUser) GetUser(context.Context) *meta.Meta { return su.user }
+
+func newShareUser(zid id.Zid, role string) *meta.Meta {
+	user := meta.New(zid)
+	user.Set(api.KeyUserID, "u"+zid.String())
+	user.Set(api.KeyUserRole, role)
+	return user
+}
+
+func TestCreateAndUseShare(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	writer := newShareUser(1, api.ValueUserRoleWriter)
+	shared := meta.New(20241019090000)
+	shared.Set(api.KeyTitle, "Shared")
+	sb := newShareBox(writer, shared)
+
+	ucCreate := NewCreateShare(nil, sb, shareUser{writer}, shareAuth{}, shareAuth{})
+	shareZid, token, err := ucCreate.Run(ctx, shared.Zid, "", time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zid, err2 := (shareAuth{}).CheckShareToken(token); err2 != nil || zid != shareZid {
+		t.Fatalf("token %q does not reference share %v", token, shareZid)
+	}
+
+	ucUse := NewUseShare(nil, sb)
+	for i := 1; i <= 2; i++ {
+		share, creator, err2 := ucUse.UseShare(ctx, shareZid)
+		if err2 != nil {
+			t.Fatalf("use %d: %v", i, err2)
+		}
+		if creator.Zid != writer.Zid {
+			t.Errorf("use %d: expected creator %v, but got %v", i, writer.Zid, creator.Zid)
+		}
+		if got := share.GetDefault(meta.KeyShareZettel, ""); got != shared.Zid.String() {
+			t.Errorf("use %d: expected shared zettel %v, but got %q", i, shared.Zid, got)
+		}
+		stored, _ := sb.GetMeta(ctx, shareZid)
+		if got := stored.GetNumber(meta.KeyShareViews, -1); got != int64(i) {
+			t.Errorf("use %d: expected %d stored views, but got %d", i, i, got)
+		}
+	}
+	if _, _, err = ucUse.UseShare(ctx, shareZid); err != ErrShareInvalid {
+		t.Errorf("share must be exhausted after two views, but got %v", err)
+	}
+}
+
+func TestUseShareInvalid(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	writer := newShareUser(1, api.ValueUserRoleWriter)
+	sb := newShareBox(writer)
+	ucCreate := NewCreateShare(nil, sb, shareUser{writer}, shareAuth{}, shareAuth{})
+	ucUse := NewUseShare(nil, sb)
+	ucRevoke := NewRevokeShare(nil, sb)
+
+	expiredZid, _, err := ucCreate.Run(ctx, id.Invalid, "role:zettel", -time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = ucUse.UseShare(ctx, expiredZid); err != ErrShareInvalid {
+		t.Errorf("expired share must be invalid, but got %v", err)
+	}
+
+	revokedZid, _, err := ucCreate.Run(ctx, id.Invalid, "role:zettel", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		share, _, err2 := ucUse.UseShare(ctx, revokedZid)
+		if err2 != nil {
+			t.Fatalf("share must be usable before revocation: %v", err2)
+		}
+		if got := share.GetNumber(meta.KeyShareViews, -1); got != int64(i) {
+			t.Errorf("use %d: expected %d views, but got %d", i, i, got)
+		}
+	}
+	if stored, _ := sb.GetMeta(ctx, revokedZid); stored.GetNumber(meta.KeyShareViews, -1) != 0 {
+		t.Errorf("views of an unlimited share must not be stored, but got %v", stored)
+	}
+	if err = ucRevoke.Run(ctx, revokedZid); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = ucUse.UseShare(ctx, revokedZid); err != ErrShareInvalid {
+		t.Errorf("revoked share must be invalid, but got %v", err)
+	}
+
+	if _, _, err = ucUse.UseShare(ctx, writer.Zid); err != ErrShareInvalid {
+		t.Errorf("zettel that is not a share must be invalid, but got %v", err)
+	}
+}
+
+func TestCreateShareNotAllowed(t *testing.T) {
+	t.Parallel()
+	reader := newShareUser(2, api.ValueUserRoleReader)
+	sb := newShareBox(reader)
+	ucCreate := NewCreateShare(nil, sb, shareUser{reader}, shareAuth{}, shareAuth{})
+	if _, _, err := ucCreate.Run(context.Background(), id.Invalid, "role:zettel", time.Hour, 0); err == nil {
+		t.Error("a reader must not be allowed to create a share")
+	}
+}
@@ -35,13 +35,14 @@ type UpdateZettelPort interface {
 
 // UpdateZettel is the data for this use case.
 type UpdateZettel struct {
-	log  *logger.Logger
-	port UpdateZettelPort
+	log   *logger.Logger
+	port  UpdateZettelPort
+	audit AuditRecorder
 }
 
 // NewUpdateZettel creates a new use case.
-func NewUpdateZettel(log *logger.Logger, port UpdateZettelPort) UpdateZettel {
-	return UpdateZettel{log: log, port: port}
+func NewUpdateZettel(log *logger.Logger, port UpdateZettelPort, audit AuditRecorder) UpdateZettel {
+	return UpdateZettel{log: log, port: port, audit: audit}
 }
 
 // Run executes the use case.
@@ -74,5 +75,8 @@ func (uc *UpdateZettel) Run(ctx context.Context, zettel zettel.Zettel, hasConten
 	zettel.Content.TrimSpace()
 	err = uc.port.UpdateZettel(ctx, zettel)
 	uc.log.Info().User(ctx).Zid(m.Zid).Err(err).Msg("Update zettel")
+	if err == nil && uc.audit != nil {
+		uc.audit.RecordChange(ctx, AuditUpdate, m.Zid, changedKeys(oldZettel.Meta, m), !zettel.Content.Equal(&oldZettel.Content))
+	}
 	return err
 }
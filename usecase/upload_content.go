@@ -0,0 +1,261 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/logger"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// UploadContentPort is the interface used by this use case.
+type UploadContentPort interface {
+	// GetZettelStream retrieves the metadata and a stream of the content of
+	// a specific zettel.
+	GetZettelStream(ctx context.Context, zid id.Zid) (*meta.Meta, *box.ContentStream, error)
+
+	// UpdateZettelStream updates an existing zettel, where the new content
+	// is read from the given reader.
+	UpdateZettelStream(ctx context.Context, m *meta.Meta, r io.Reader) error
+}
+
+// ContentRange specifies the part of the content that is transferred by one
+// chunk of an upload. First and Last are byte positions, Last is included.
+type ContentRange struct {
+	First int64
+	Last  int64
+	Total int64
+}
+
+// ErrUploadOffset is returned, if a chunk does not continue the content
+// received so far.
+type ErrUploadOffset struct{ Received int64 }
+
+func (err ErrUploadOffset) Error() string {
+	return "upload must continue at byte position " + strconv.FormatInt(err.Received, 10)
+}
+
+// ErrUploadTooLarge is returned, if the total size of a chunked upload is
+// larger than allowed.
+type ErrUploadTooLarge struct{ Max int64 }
+
+func (err ErrUploadTooLarge) Error() string {
+	return "upload must not be larger than " + strconv.FormatInt(err.Max, 10) + " bytes"
+}
+
+// errNoUploadDir is returned, if there is no directory to store incomplete
+// uploads.
+var errNoUploadDir = errors.New("no directory for incomplete uploads")
+
+// maxUploadAge is the duration after an incomplete upload is removed.
+const maxUploadAge = 24 * time.Hour
+
+// UploadContent is the data for this use case.
+type UploadContent struct {
+	log     *logger.Logger
+	port    UploadContentPort
+	up      CurrentUserPort
+	audit   AuditRecorder
+	dir     string
+	maxSize int64
+	mx      *sync.Mutex // Protects the following field
+	active  map[string]bool
+}
+
+// NewUploadContent creates a new use case. Incomplete uploads are stored
+// in the given directory, which must be accessible only by the Zettelstore.
+// It should be the same directory after a restart, so that uploads can be
+// continued. Stale uploads of previous runs are removed. A chunked upload
+// must not be larger than maxSize bytes.
+func NewUploadContent(log *logger.Logger, port UploadContentPort, up CurrentUserPort, audit AuditRecorder, dir string, maxSize int64) UploadContent {
+	uc := UploadContent{
+		log:     log,
+		port:    port,
+		up:      up,
+		audit:   audit,
+		dir:     dir,
+		maxSize: maxSize,
+		mx:      &sync.Mutex{},
+		active:  map[string]bool{},
+	}
+	if dir != "" {
+		uc.removeStale()
+	}
+	return uc
+}
+
+// Run replaces the content of a zettel with the data read from r.
+func (uc *UploadContent) Run(ctx context.Context, zid id.Zid, r io.Reader) error {
+	oldMeta, cs, err := uc.port.GetZettelStream(box.NoEnrichContext(ctx), zid)
+	if err != nil {
+		return err
+	}
+	cs.Close()
+
+	m := oldMeta.Clone()
+	m.SetNow(api.KeyModified)
+	err = uc.port.UpdateZettelStream(ctx, m, r)
+	uc.log.Info().User(ctx).Zid(zid).Err(err).Msg("Upload content")
+	if err == nil && uc.audit != nil {
+		uc.audit.RecordChange(ctx, AuditUpdate, zid, nil, true)
+	}
+	return err
+}
+
+// RunChunk stores one chunk of the content of a zettel. The content of the
+// zettel is replaced, when all chunks are received. It returns the number of
+// bytes received so far.
+func (uc *UploadContent) RunChunk(ctx context.Context, zid id.Zid, r io.Reader, cr ContentRange) (int64, error) {
+	if cr.Total > uc.maxSize {
+		return 0, ErrUploadTooLarge{Max: uc.maxSize}
+	}
+	if uc.dir == "" {
+		return 0, errNoUploadDir
+	}
+	path := uc.partPath(ctx, zid, cr.Total)
+	if !uc.acquire(path) {
+		return 0, box.ErrConflict
+	}
+	defer uc.release(path)
+
+	received := fileSize(path)
+	if cr.First != received {
+		return received, ErrUploadOffset{Received: received}
+	}
+	if received == 0 {
+		uc.removeStale()
+	}
+	f, err := openPartFile(path, received == 0)
+	if err != nil {
+		return received, err
+	}
+	defer f.Close()
+	n, err := io.Copy(f, io.LimitReader(r, cr.Last-cr.First+1))
+	received += n
+	if err != nil || received < cr.Total {
+		uc.log.Debug().Zid(zid).Int("received", received).Int("total", cr.Total).Err(err).Msg("Upload chunk")
+		return received, err
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return received, err
+	}
+	err = uc.Run(ctx, zid, f)
+	f.Close()
+	os.Remove(path)
+	return received, err
+}
+
+// Received returns the number of bytes received so far for an incomplete
+// upload.
+func (uc *UploadContent) Received(ctx context.Context, zid id.Zid, total int64) int64 {
+	if uc.dir == "" {
+		return 0
+	}
+	return fileSize(uc.partPath(ctx, zid, total))
+}
+
+// partPath returns the file name of an incomplete upload. It depends on the
+// current user too, so that users cannot continue the uploads of each other.
+func (uc *UploadContent) partPath(ctx context.Context, zid id.Zid, total int64) string {
+	userZid := id.Invalid
+	if user := uc.up.GetUser(ctx); user != nil {
+		userZid = user.Zid
+	}
+	return filepath.Join(uc.dir, fmt.Sprintf("%v-%v-%d.part", userZid, zid, total))
+}
+
+func (uc *UploadContent) acquire(path string) bool {
+	uc.mx.Lock()
+	defer uc.mx.Unlock()
+	if uc.active[path] {
+		return false
+	}
+	uc.active[path] = true
+	return true
+}
+
+func (uc *UploadContent) release(path string) {
+	uc.mx.Lock()
+	delete(uc.active, path)
+	uc.mx.Unlock()
+}
+
+// removeStale removes all incomplete uploads that were not continued for a
+// longer time.
+func (uc *UploadContent) removeStale() {
+	entries, err := os.ReadDir(uc.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if fi, errInfo := entry.Info(); errInfo == nil && time.Since(fi.ModTime()) > maxUploadAge {
+			path := filepath.Join(uc.dir, entry.Name())
+			uc.log.Debug().Str("path", path).Msg("Remove stale upload")
+			os.Remove(path)
+		}
+	}
+}
+
+func fileSize(path string) int64 {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode().IsRegular() {
+		return fi.Size()
+	}
+	return 0
+}
+
+// openPartFile opens the file of an incomplete upload for appending. A new
+// file is created exclusively. An existing file must be a regular file, so
+// that a symbolic link placed by someone else is never followed.
+func openPartFile(path string, create bool) (*os.File, error) {
+	if create {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrNotExist) {
+			// The directory was removed, e.g. by cleaning up temporary files.
+			if err = os.Mkdir(filepath.Dir(path), 0700); err == nil {
+				f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+			}
+		}
+		return f, err
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+	if fiOpen, errStat := f.Stat(); errStat != nil || !os.SameFile(fi, fiOpen) {
+		f.Close()
+		return nil, fmt.Errorf("%s was replaced while opening", path)
+	}
+	return f, nil
+}
@@ -0,0 +1,136 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package usecase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zettelstore.de/z/box"
+	"zettelstore.de/z/zettel"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+// uploadBox stores the content of one zettel.
+type uploadBox struct {
+	m       *meta.Meta
+	content string
+}
+
+func (ub *uploadBox) GetZettelStream(_ context.Context, zid id.Zid) (*meta.Meta, *box.ContentStream, error) {
+	if zid != ub.m.Zid {
+		return nil, nil, box.ErrZettelNotFound{Zid: zid}
+	}
+	return ub.m.Clone(), box.NewContentStream(zettel.NewContent([]byte(ub.content))), nil
+}
+
+func (ub *uploadBox) UpdateZettelStream(_ context.Context, m *meta.Meta, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err == nil {
+		ub.m, ub.content = m, string(data)
+	}
+	return err
+}
+
+func TestUploadChunks(t *testing.T) {
+	t.Parallel()
+	const zid = id.Zid(20241019100000)
+	ub := &uploadBox{m: meta.New(zid)}
+	dir := t.TempDir()
+	uc := NewUploadContent(nil, ub, shareUser{meta.New(1)}, nil, dir, 10)
+	other := NewUploadContent(nil, ub, shareUser{meta.New(2)}, nil, dir, 10)
+	ctx := context.Background()
+
+	received, err := uc.RunChunk(ctx, zid, strings.NewReader("abcd"), ContentRange{First: 0, Last: 3, Total: 8})
+	if err != nil || received != 4 {
+		t.Fatalf("first chunk: expected 4 bytes received, but got %d / %v", received, err)
+	}
+	if got := other.Received(ctx, zid, 8); got != 0 {
+		t.Errorf("other user must not see the upload, but got %d bytes", got)
+	}
+	if _, err = other.RunChunk(ctx, zid, strings.NewReader("efgh"), ContentRange{First: 4, Last: 7, Total: 8}); !errors.As(err, &ErrUploadOffset{}) {
+		t.Errorf("other user must not continue the upload, but got %v", err)
+	}
+	received, err = uc.RunChunk(ctx, zid, strings.NewReader("efgh"), ContentRange{First: 4, Last: 7, Total: 8})
+	if err != nil || received != 8 {
+		t.Fatalf("last chunk: expected 8 bytes received, but got %d / %v", received, err)
+	}
+	if ub.content != "abcdefgh" {
+		t.Errorf("expected content %q, but got %q", "abcdefgh", ub.content)
+	}
+
+	if _, err = uc.RunChunk(ctx, zid, strings.NewReader("a"), ContentRange{First: 0, Last: 0, Total: 11}); !errors.As(err, &ErrUploadTooLarge{}) {
+		t.Errorf("upload larger than maximum size must be rejected, but got %v", err)
+	}
+}
+
+func TestUploadNoSymlink(t *testing.T) {
+	t.Parallel()
+	const zid = id.Zid(20241019100000)
+	dir := t.TempDir()
+	uc := NewUploadContent(nil, &uploadBox{m: meta.New(zid)}, shareUser{meta.New(1)}, nil, dir, 10)
+	ctx := context.Background()
+
+	target := filepath.Join(t.TempDir(), "target")
+	if err := os.WriteFile(target, []byte("abcd"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, uc.partPath(ctx, zid, 8)); err != nil {
+		t.Skip("symbolic links not supported:", err)
+	}
+	if got := uc.Received(ctx, zid, 8); got != 0 {
+		t.Errorf("symbolic link must not count as received bytes, but got %d", got)
+	}
+	if _, err := uc.RunChunk(ctx, zid, strings.NewReader("efgh"), ContentRange{First: 0, Last: 3, Total: 8}); err == nil {
+		t.Error("symbolic link must not be followed")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "abcd" {
+		t.Errorf("target of symbolic link must not be changed, but got %q", data)
+	}
+}
+
+func TestUploadRemoveStale(t *testing.T) {
+	t.Parallel()
+	const zid = id.Zid(20241019100000)
+	dir := t.TempDir()
+	uc := NewUploadContent(nil, &uploadBox{m: meta.New(zid)}, shareUser{meta.New(1)}, nil, dir, 10)
+	ctx := context.Background()
+	if _, err := uc.RunChunk(ctx, zid, strings.NewReader("abcd"), ContentRange{First: 0, Last: 3, Total: 8}); err != nil {
+		t.Fatal(err)
+	}
+	stale := uc.partPath(ctx, zid, 9)
+	if err := os.WriteFile(stale, []byte("abcd"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-maxUploadAge - time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart, the recent upload can be continued.
+	uc = NewUploadContent(nil, &uploadBox{m: meta.New(zid)}, shareUser{meta.New(1)}, nil, dir, 10)
+	if got := uc.Received(ctx, zid, 8); got != 4 {
+		t.Errorf("recent upload must be kept, but got %d bytes", got)
+	}
+	if _, err := os.Lstat(stale); err == nil {
+		t.Error("stale upload must be removed")
+	}
+}
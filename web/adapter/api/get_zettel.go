@@ -36,6 +36,7 @@ import (
 // MakeGetZettelHandler creates a new HTTP handler to return a zettel in various encodings.
 func (a *API) MakeGetZettelHandler(
 	getZettel usecase.GetZettel,
+	getZettelStream usecase.GetZettelStream,
 	parseZettel usecase.ParseZettel,
 	evaluate usecase.Evaluate,
 ) http.Handler {
@@ -51,7 +52,11 @@ func (a *API) MakeGetZettelHandler(
 		ctx := r.Context()
 		switch enc, encStr := getEncoding(r, q); enc {
 		case api.EncoderPlain:
-			a.writePlainData(w, ctx, zid, part, getZettel)
+			if part == partContent {
+				a.writePlainContent(w, r, zid, getZettelStream)
+			} else {
+				a.writePlainData(w, ctx, zid, part, getZettel)
+			}
 
 		case api.EncoderData:
 			a.writeSzData(w, ctx, zid, part, getZettel)
@@ -101,10 +106,6 @@ func (a *API) writePlainData(w http.ResponseWriter, ctx context.Context, zid id.
 	case partMeta:
 		contentType = content.PlainText
 		_, err = z.Meta.Write(&buf)
-
-	case partContent:
-		contentType = content.MIMEFromSyntax(z.Meta.GetDefault(api.KeySyntax, meta.DefaultSyntax))
-		_, err = z.Content.Write(&buf)
 	}
 
 	if err != nil {
@@ -117,6 +118,19 @@ func (a *API) writePlainData(w http.ResponseWriter, ctx context.Context, zid id.
 	}
 }
 
+// writePlainContent writes the content of a zettel as a stream. A client
+// may retrieve only parts of the content by using a HTTP Range header.
+func (a *API) writePlainContent(w http.ResponseWriter, r *http.Request, zid id.Zid, getZettelStream usecase.GetZettelStream) {
+	m, cs, err := getZettelStream.Run(box.NoEnrichContext(r.Context()), zid)
+	if err != nil {
+		a.reportUsecaseError(w, err)
+		return
+	}
+	defer cs.Close()
+	adapter.PrepareHeader(w, content.MIMEFromSyntax(m.GetDefault(api.KeySyntax, meta.DefaultSyntax)))
+	http.ServeContent(w, r, "", cs.ModTime, cs)
+}
+
 func (a *API) writeSzData(w http.ResponseWriter, ctx context.Context, zid id.Zid, part partType, getZettel usecase.GetZettel) {
 	z, err := getZettel.Run(ctx, zid)
 	if err != nil {
@@ -15,6 +15,7 @@ package api
 
 import (
 	"bytes"
+	"encoding/csv"
 	"fmt"
 	"io"
 	"net/http"
@@ -54,6 +55,11 @@ func (a *API) MakeQueryHandler(
 			return
 		}
 
+		if plan := sq.Explain(); plan != nil {
+			a.writePlan(w, r, urlQuery, plan)
+			return
+		}
+
 		actions, err := adapter.TryReIndex(ctx, sq.Actions(), metaSeq, reIndex)
 		if err != nil {
 			a.reportUsecaseError(w, err)
@@ -78,6 +84,9 @@ func (a *API) MakeQueryHandler(
 		case api.EncoderPlain:
 			encoder = &plainZettelEncoder{}
 			contentType = content.PlainText
+			if isTabularAction(actions) {
+				contentType = content.CSV
+			}
 
 		case api.EncoderData:
 			encoder = &dataZettelEncoder{
@@ -91,19 +100,67 @@ func (a *API) MakeQueryHandler(
 			return
 		}
 
-		var buf bytes.Buffer
-		err = queryAction(&buf, encoder, metaSeq, actions)
+		if cursor := sq.Cursor(metaSeq); cursor != "" {
+			w.Header().Set(headerCursor, cursor)
+		}
+		sw := streamWriter{w: w, contentType: contentType}
+		dups, _ := queryMeta.Duplicates(ctx, sq, metaSeq)
+		err = queryAction(&sw, encoder, sq, metaSeq, dups, actions)
 		if err != nil {
 			a.log.Error().Err(err).Str("query", sq.String()).Msg("execute query action")
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
-
-		if err = writeBuffer(w, &buf, contentType); err != nil {
-			a.log.Error().Err(err).Msg("write result buffer")
+			if !sw.started {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
 		}
+		sw.finish()
 	})
 }
-func queryAction(w io.Writer, enc zettelEncoder, ml []*meta.Meta, actions []string) error {
+
+// headerCursor is the HTTP header that contains the cursor to retrieve the
+// next part of a limited query result.
+const headerCursor = "Zettelstore-Cursor"
+
+// streamWriter writes the result of a query directly to the HTTP response,
+// without buffering it completely. The HTTP header is written on first use.
+type streamWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if !sw.started {
+		adapter.PrepareHeader(sw.w, sw.contentType)
+		sw.w.WriteHeader(http.StatusOK)
+		sw.started = true
+	}
+	return sw.w.Write(p)
+}
+
+// finish completes the response. If nothing was written, there was no content.
+func (sw *streamWriter) finish() {
+	if !sw.started {
+		sw.w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if f, ok := sw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+func queryAction(w io.Writer, enc zettelEncoder, sq *query.Query, ml []*meta.Meta, dups []query.DuplicateGroup, actions []string) error {
+	if paths, isPath := sq.Paths(ml); isPath && len(actions) == 0 {
+		return enc.writePaths(w, paths)
+	}
+	if _, isDuplicates := query.DuplicatesSpecFromActions(sq.Actions()); isDuplicates {
+		return enc.writeDuplicates(w, dups)
+	}
+	if spec, isGroup := query.GroupSpecFromActions(actions); isGroup {
+		return enc.writeGroup(w, spec, spec.Apply(ml))
+	}
+	if keys, isTable := query.TableKeys(actions); isTable {
+		return enc.writeTable(w, keys, ml)
+	}
 	min, max := -1, -1
 	if len(actions) > 0 {
 		acts := make([]string, 0, len(actions))
@@ -135,6 +192,14 @@ func queryAction(w io.Writer, enc zettelEncoder, ml []*meta.Meta, actions []stri
 	return enc.writeMetaList(w, ml)
 }
 
+func isTabularAction(actions []string) bool {
+	if _, isGroup := query.GroupSpecFromActions(actions); isGroup {
+		return true
+	}
+	_, isTable := query.TableKeys(actions)
+	return isTable
+}
+
 func encodeKeysArrangement(w io.Writer, enc zettelEncoder, ml []*meta.Meta, act string) error {
 	arr := make(meta.Arrangement, 128)
 	for _, m := range ml {
@@ -160,6 +225,10 @@ func encodeMetaKeyArrangement(w io.Writer, enc zettelEncoder, ml []*meta.Meta, k
 type zettelEncoder interface {
 	writeMetaList(w io.Writer, ml []*meta.Meta) error
 	writeArrangement(w io.Writer, act string, arr meta.Arrangement) error
+	writeTable(w io.Writer, keys []string, ml []*meta.Meta) error
+	writeGroup(w io.Writer, spec *query.GroupSpec, rows [][]string) error
+	writePaths(w io.Writer, paths [][]*meta.Meta) error
+	writeDuplicates(w io.Writer, groups []query.DuplicateGroup) error
 }
 
 type plainZettelEncoder struct{}
@@ -201,30 +270,118 @@ func (*plainZettelEncoder) writeArrangement(w io.Writer, _ string, arr meta.Arra
 	return nil
 }
 
+func (*plainZettelEncoder) writeTable(w io.Writer, keys []string, ml []*meta.Meta) error {
+	rows := make([][]string, len(ml))
+	for i, m := range ml {
+		rows[i] = tableRow(keys, m)
+	}
+	return writeCSV(w, keys, rows)
+}
+func (*plainZettelEncoder) writeGroup(w io.Writer, spec *query.GroupSpec, rows [][]string) error {
+	return writeCSV(w, spec.Columns(), rows)
+}
+
+func (*plainZettelEncoder) writePaths(w io.Writer, paths [][]*meta.Meta) error {
+	for _, path := range paths {
+		for i, m := range path {
+			if i > 0 {
+				if _, err := io.WriteString(w, " "); err != nil {
+					return err
+				}
+			}
+			if _, err := io.WriteString(w, m.Zid.String()); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*plainZettelEncoder) writeDuplicates(w io.Writer, groups []query.DuplicateGroup) error {
+	for _, g := range groups {
+		if _, err := io.WriteString(w, strconv.Itoa(g.Similarity)); err != nil {
+			return err
+		}
+		for _, m := range g.Zettel {
+			if _, err := io.WriteString(w, " "+m.Zid.String()); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	return cw.WriteAll(rows)
+}
+
+func tableRow(keys []string, m *meta.Meta) []string {
+	row := make([]string, len(keys))
+	for i, key := range keys {
+		row[i], _ = m.Get(key)
+	}
+	return row
+}
+
 type dataZettelEncoder struct {
 	sq        *query.Query
 	getRights func(*meta.Meta) api.ZettelRights
 }
 
+// writeMetaList writes the list of metadata incrementally, to allow streaming
+// of large results.
 func (dze *dataZettelEncoder) writeMetaList(w io.Writer, ml []*meta.Meta) error {
-	result := make(sx.Vector, len(ml)+1)
-	result[0] = sx.SymbolList
+	if _, err := io.WriteString(w, "(meta-list "); err != nil {
+		return err
+	}
+	if _, err := sx.Print(w, sx.MakeList(sx.MakeSymbol("query"), sx.MakeString(dze.sq.String()))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, " "); err != nil {
+		return err
+	}
+	if _, err := sx.Print(w, sx.MakeList(sx.MakeSymbol("human"), sx.MakeString(dze.sq.Human()))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, " (list"); err != nil {
+		return err
+	}
 	symID, symZettel := sx.MakeSymbol("id"), sx.MakeSymbol("zettel")
-	for i, m := range ml {
+	for _, m := range ml {
 		msz := sexp.EncodeMetaRights(api.MetaRights{
 			Meta:   m.Map(),
 			Rights: dze.getRights(m),
 		})
 		msz = sx.Cons(sx.MakeList(symID, sx.Int64(m.Zid)), msz.Cdr()).Cons(symZettel)
-		result[i+1] = msz
+		if _, err := io.WriteString(w, " "); err != nil {
+			return err
+		}
+		if _, err := sx.Print(w, msz); err != nil {
+			return err
+		}
 	}
-
-	_, err := sx.Print(w, sx.MakeList(
-		sx.MakeSymbol("meta-list"),
-		sx.MakeList(sx.MakeSymbol("query"), sx.MakeString(dze.sq.String())),
-		sx.MakeList(sx.MakeSymbol("human"), sx.MakeString(dze.sq.Human())),
-		sx.MakeList(result...),
-	))
+	if _, err := io.WriteString(w, ")"); err != nil {
+		return err
+	}
+	if cursor := dze.sq.Cursor(ml); cursor != "" {
+		if _, err := io.WriteString(w, " "); err != nil {
+			return err
+		}
+		if _, err := sx.Print(w, sx.MakeList(sx.MakeSymbol("cursor"), sx.MakeString(cursor))); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, ")")
 	return err
 }
 func (dze *dataZettelEncoder) writeArrangement(w io.Writer, act string, arr meta.Arrangement) error {
@@ -247,6 +404,159 @@ func (dze *dataZettelEncoder) writeArrangement(w io.Writer, act string, arr meta
 	return err
 }
 
+func (dze *dataZettelEncoder) writeTable(w io.Writer, keys []string, ml []*meta.Meta) error {
+	columns := make(sx.Vector, len(keys)+1)
+	columns[0] = sx.MakeSymbol("columns")
+	for i, key := range keys {
+		columns[i+1] = sx.MakeString(key)
+	}
+	rows := make(sx.Vector, len(ml)+1)
+	rows[0] = sx.MakeSymbol("rows")
+	for i, m := range ml {
+		row := tableRow(keys, m)
+		cells := make(sx.Vector, len(row)+1)
+		cells[0] = sx.Int64(m.Zid)
+		for j, val := range row {
+			cells[j+1] = sx.MakeString(val)
+		}
+		rows[i+1] = sx.MakeList(cells...)
+	}
+	_, err := sx.Print(w, sx.MakeList(
+		sx.MakeSymbol("table"),
+		sx.MakeList(sx.MakeSymbol("query"), sx.MakeString(dze.sq.String())),
+		sx.MakeList(sx.MakeSymbol("human"), sx.MakeString(dze.sq.Human())),
+		sx.MakeList(columns...),
+		sx.MakeList(rows...),
+	))
+	return err
+}
+
+func (dze *dataZettelEncoder) writeGroup(w io.Writer, spec *query.GroupSpec, rows [][]string) error {
+	sxRows := make(sx.Vector, len(rows)+1)
+	sxRows[0] = sx.MakeSymbol("rows")
+	for i, row := range rows {
+		sxRows[i+1] = makeStringList(row)
+	}
+	_, err := sx.Print(w, sx.MakeList(
+		sx.MakeSymbol("group"),
+		sx.MakeString(spec.Key),
+		sx.MakeList(sx.MakeSymbol("query"), sx.MakeString(dze.sq.String())),
+		sx.MakeList(sx.MakeSymbol("human"), sx.MakeString(dze.sq.Human())),
+		makeStringList(spec.Columns()).Cons(sx.MakeSymbol("columns")),
+		sx.MakeList(sxRows...),
+	))
+	return err
+}
+
+func (dze *dataZettelEncoder) writePaths(w io.Writer, paths [][]*meta.Meta) error {
+	result := make(sx.Vector, len(paths)+1)
+	result[0] = sx.SymbolList
+	symPath := sx.MakeSymbol("path")
+	for i, path := range paths {
+		sxPath := sx.Nil()
+		for j := len(path) - 1; j >= 0; j-- {
+			sxPath = sxPath.Cons(sx.Int64(path[j].Zid))
+		}
+		result[i+1] = sxPath.Cons(symPath)
+	}
+	_, err := sx.Print(w, sx.MakeList(
+		sx.MakeSymbol("path-list"),
+		sx.MakeList(sx.MakeSymbol("query"), sx.MakeString(dze.sq.String())),
+		sx.MakeList(sx.MakeSymbol("human"), sx.MakeString(dze.sq.Human())),
+		sx.MakeList(result...),
+	))
+	return err
+}
+
+func (dze *dataZettelEncoder) writeDuplicates(w io.Writer, groups []query.DuplicateGroup) error {
+	result := make(sx.Vector, len(groups)+1)
+	result[0] = sx.SymbolList
+	symDuplicates := sx.MakeSymbol("duplicates")
+	for i, g := range groups {
+		sxGroup := sx.Nil()
+		for j := len(g.Zettel) - 1; j >= 0; j-- {
+			sxGroup = sxGroup.Cons(sx.Int64(g.Zettel[j].Zid))
+		}
+		result[i+1] = sxGroup.Cons(sx.Int64(g.Similarity)).Cons(symDuplicates)
+	}
+	_, err := sx.Print(w, sx.MakeList(
+		sx.MakeSymbol("duplicates-list"),
+		sx.MakeList(sx.MakeSymbol("query"), sx.MakeString(dze.sq.String())),
+		sx.MakeList(sx.MakeSymbol("human"), sx.MakeString(dze.sq.Human())),
+		sx.MakeList(result...),
+	))
+	return err
+}
+
+func makeStringList(sl []string) *sx.Pair {
+	result := sx.Nil()
+	for i := len(sl) - 1; i >= 0; i-- {
+		result = result.Cons(sx.MakeString(sl[i]))
+	}
+	return result
+}
+
+func (a *API) writePlan(w http.ResponseWriter, r *http.Request, urlQuery url.Values, plan *query.Plan) {
+	var buf bytes.Buffer
+	var contentType string
+	switch enc, _ := getEncoding(r, urlQuery); enc {
+	case api.EncoderPlain:
+		plan.Print(&buf)
+		contentType = content.PlainText
+	case api.EncoderData:
+		if _, err := sx.Print(&buf, planToSx(plan)); err != nil {
+			a.log.Error().Err(err).Msg("encode query plan")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		contentType = content.SXPF
+	default:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if err := writeBuffer(w, &buf, contentType); err != nil {
+		a.log.Error().Err(err).Msg("write query plan")
+	}
+}
+
+func planToSx(plan *query.Plan) *sx.Pair {
+	terms := make(sx.Vector, 0, len(plan.Terms)+1)
+	terms = append(terms, sx.MakeSymbol("terms"))
+	for _, tp := range plan.Terms {
+		terms = append(terms, sx.MakeList(
+			sx.MakeSymbol("term"),
+			makeStringList(tp.Index).Cons(sx.MakeSymbol("index")),
+			sx.MakeList(sx.MakeSymbol("candidates"), sx.MakeString(tp.Candidates), sx.Int64(tp.Count)),
+			makeStringList(tp.Match).Cons(sx.MakeSymbol("match")),
+			sx.MakeList(sx.MakeSymbol("groups"), sx.Int64(tp.Groups)),
+		))
+	}
+	phases := make(sx.Vector, 0, len(plan.Phases)+1)
+	phases = append(phases, sx.MakeSymbol("phases"))
+	for _, phase := range plan.Phases {
+		phases = append(phases, sx.MakeList(
+			sx.MakeString(phase.Name),
+			sx.Int64(phase.Duration.Nanoseconds()),
+			sx.Int64(phase.Count),
+		))
+	}
+	preMatch := sx.Nil()
+	if plan.PreMatch {
+		preMatch = sx.Cons(sx.MakeString("access policy"), preMatch)
+	}
+	return sx.MakeList(
+		sx.MakeSymbol("explain"),
+		sx.MakeList(sx.MakeSymbol("query"), sx.MakeString(plan.Query)),
+		preMatch.Cons(sx.MakeSymbol("pre-match")),
+		sx.MakeList(terms...),
+		sx.MakeList(sx.MakeSymbol("order"), sx.MakeString(plan.Order)),
+		sx.MakeList(sx.MakeSymbol("pick"), sx.Int64(plan.Pick)),
+		sx.MakeList(sx.MakeSymbol("offset"), sx.Int64(plan.Offset)),
+		sx.MakeList(sx.MakeSymbol("limit"), sx.Int64(plan.Limit)),
+		sx.MakeList(phases...),
+	)
+}
+
 func (a *API) handleTagZettel(w http.ResponseWriter, r *http.Request, tagZettel *usecase.TagZettel, vals url.Values) bool {
 	tag := vals.Get(api.QueryKeyTag)
 	if tag == "" {
@@ -14,14 +14,18 @@
 package api
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"t73f.de/r/sx/sxreader"
 	"t73f.de/r/zsc/api"
 	"t73f.de/r/zsc/input"
 	"t73f.de/r/zsc/sexp"
+	"zettelstore.de/z/usecase"
 	"zettelstore.de/z/zettel"
 	"zettelstore.de/z/zettel/id"
 	"zettelstore.de/z/zettel/meta"
@@ -147,3 +151,41 @@ func buildZettelFromData(r *http.Request, zid id.Zid) (zettel.Zettel, error) {
 		Content: content,
 	}, nil
 }
+
+var errContentRange = errors.New("invalid Content-Range header")
+
+// parseContentRange parses the value of a Content-Range header of an upload,
+// i.e. "bytes FIRST-LAST/TOTAL". The value "bytes */TOTAL" queries the state
+// of an upload. In this case, the returned boolean value is true.
+func parseContentRange(val string) (usecase.ContentRange, bool, error) {
+	var cr usecase.ContentRange
+	spec, found := strings.CutPrefix(val, "bytes ")
+	if !found {
+		return cr, false, errContentRange
+	}
+	positions, total, found := strings.Cut(strings.TrimSpace(spec), "/")
+	if !found {
+		return cr, false, errContentRange
+	}
+	var err error
+	if cr.Total, err = strconv.ParseInt(total, 10, 64); err != nil || cr.Total <= 0 {
+		return cr, false, errContentRange
+	}
+	if positions == "*" {
+		return cr, true, nil
+	}
+	first, last, found := strings.Cut(positions, "-")
+	if !found {
+		return cr, false, errContentRange
+	}
+	if cr.First, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return cr, false, errContentRange
+	}
+	if cr.Last, err = strconv.ParseInt(last, 10, 64); err != nil {
+		return cr, false, errContentRange
+	}
+	if cr.First < 0 || cr.Last < cr.First || cr.Last >= cr.Total {
+		return cr, false, errContentRange
+	}
+	return cr, false, nil
+}
@@ -0,0 +1,101 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/usecase"
+	"zettelstore.de/z/web/adapter"
+	"zettelstore.de/z/web/content"
+	"zettelstore.de/z/zettel/id"
+)
+
+// Query parameters to create a share.
+const (
+	queryKeyExpire = "expire"
+	queryKeyViews  = "views"
+)
+
+// defaultShareDuration is the validity of a share, if no other value is given.
+const defaultShareDuration = 7 * 24 * time.Hour
+
+// MakePostShareHandler creates a new HTTP handler to share a zettel or a query result.
+func (a *API) MakePostShareHandler(createShare *usecase.CreateShare) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zid := id.Invalid
+		if zidS := r.URL.Path[1:]; zidS != "" {
+			var err error
+			if zid, err = id.Parse(zidS); err != nil {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		vals := r.URL.Query()
+		q := vals.Get(api.QueryKeyQuery)
+		if !zid.IsValid() && q == "" {
+			a.reportUsecaseError(w, adapter.NewErrBadRequest("Neither zettel nor query given"))
+			return
+		}
+
+		d := defaultShareDuration
+		if val := vals.Get(queryKeyExpire); val != "" {
+			var err error
+			if d, err = time.ParseDuration(val); err != nil || d <= 0 {
+				a.reportUsecaseError(w, adapter.NewErrBadRequest("Invalid expire duration: "+val))
+				return
+			}
+		}
+		maxViews := 0
+		if val := vals.Get(queryKeyViews); val != "" {
+			var err error
+			if maxViews, err = strconv.Atoi(val); err != nil || maxViews < 0 {
+				a.reportUsecaseError(w, adapter.NewErrBadRequest("Invalid number of views: "+val))
+				return
+			}
+		}
+
+		shareZid, token, err := createShare.Run(r.Context(), zid, q, d, maxViews)
+		if err != nil {
+			a.reportUsecaseError(w, err)
+			return
+		}
+		h := adapter.PrepareHeader(w, content.PlainText)
+		h.Set(api.HeaderLocation, a.NewURLBuilder('z').SetZid(shareZid.ZettelID()).String())
+		w.WriteHeader(http.StatusCreated)
+		if _, err = w.Write(token); err != nil {
+			a.log.Error().Err(err).Zid(shareZid).Msg("Create share")
+		}
+	})
+}
+
+// MakeDeleteShareHandler creates a new HTTP handler to revoke a share.
+func (a *API) MakeDeleteShareHandler(revokeShare *usecase.RevokeShare) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zid, err := id.Parse(r.URL.Path[1:])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err = revokeShare.Run(r.Context(), zid); err != nil {
+			a.reportUsecaseError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
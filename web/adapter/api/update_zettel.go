@@ -14,17 +14,25 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/box"
 	"zettelstore.de/z/usecase"
 	"zettelstore.de/z/web/adapter"
+	"zettelstore.de/z/web/server"
 	"zettelstore.de/z/zettel"
 	"zettelstore.de/z/zettel/id"
 )
 
 // MakeUpdateZettelHandler creates a new HTTP handler to update a zettel.
-func (a *API) MakeUpdateZettelHandler(updateZettel *usecase.UpdateZettel) http.Handler {
+func (a *API) MakeUpdateZettelHandler(
+	updateZettel *usecase.UpdateZettel,
+	getZettelStream usecase.GetZettelStream,
+	uploadContent *usecase.UploadContent,
+) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		zid, err := id.Parse(r.URL.Path[1:])
 		if err != nil {
@@ -33,6 +41,10 @@ func (a *API) MakeUpdateZettelHandler(updateZettel *usecase.UpdateZettel) http.H
 		}
 
 		q := r.URL.Query()
+		if getPart(q, partZettel) == partContent {
+			a.updateContent(w, r, zid, getZettelStream, uploadContent)
+			return
+		}
 		var zettel zettel.Zettel
 		switch enc, _ := getEncoding(r, q); enc {
 		case api.EncoderPlain:
@@ -55,3 +67,77 @@ func (a *API) MakeUpdateZettelHandler(updateZettel *usecase.UpdateZettel) http.H
 		w.WriteHeader(http.StatusNoContent)
 	})
 }
+
+// updateContent replaces the content of a zettel with the request body, which
+// is not read into memory. If the request contains a Content-Range header,
+// the body is just one chunk of the content. An interrupted upload may be
+// resumed later.
+func (a *API) updateContent(
+	w http.ResponseWriter, r *http.Request, zid id.Zid,
+	getZettelStream usecase.GetZettelStream, uploadContent *usecase.UploadContent,
+) {
+	defer r.Body.Close()
+	ctx := r.Context()
+	m, cs, err := getZettelStream.Run(box.NoEnrichContext(ctx), zid)
+	if err != nil {
+		a.reportUsecaseError(w, err)
+		return
+	}
+	cs.Close()
+	// Check early, so that chunks of unauthorized users are not stored.
+	if user := server.GetUser(ctx); !a.policy.CanWrite(user, m, m) {
+		a.reportUsecaseError(w, box.NewErrNotAllowed("Write", user, zid))
+		return
+	}
+
+	crVal := r.Header.Get("Content-Range")
+	if crVal == "" {
+		if err = uploadContent.Run(ctx, zid, r.Body); err != nil {
+			a.reportUsecaseError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	cr, isQuery, err := parseContentRange(crVal)
+	if err != nil {
+		a.reportUsecaseError(w, adapter.NewErrBadRequest(err.Error()))
+		return
+	}
+	if isQuery {
+		setReceivedRange(w, uploadContent.Received(ctx, zid, cr.Total))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	received, err := uploadContent.RunChunk(ctx, zid, r.Body, cr)
+	setReceivedRange(w, received)
+	if err != nil {
+		var errOffset usecase.ErrUploadOffset
+		var errTooLarge usecase.ErrUploadTooLarge
+		var errMaxBytes *http.MaxBytesError
+		switch {
+		case errors.As(err, &errOffset):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.As(err, &errTooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.As(err, &errMaxBytes):
+			http.Error(w, "Chunk is larger than the maximum request size", http.StatusRequestEntityTooLarge)
+		default:
+			a.reportUsecaseError(w, err)
+		}
+		return
+	}
+	if received < cr.Total {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setReceivedRange tells the client which bytes of an upload were received.
+func setReceivedRange(w http.ResponseWriter, received int64) {
+	if received > 0 {
+		w.Header().Set("Range", "bytes=0-"+strconv.FormatInt(received-1, 10))
+	}
+}
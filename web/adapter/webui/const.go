@@ -22,6 +22,7 @@ const (
 	valueActionChild   = "child"
 	valueActionCopy    = "copy"
 	valueActionFolge   = "folge"
+	valueActionKeep    = "keep"
 	valueActionNew     = "new"
 	valueActionVersion = "version"
 )
@@ -33,6 +34,7 @@ const (
 	actionChild createAction = iota
 	actionCopy
 	actionFolge
+	actionKeep
 	actionNew
 	actionVersion
 )
@@ -41,6 +43,7 @@ var createActionMap = map[string]createAction{
 	valueActionChild:   actionChild,
 	valueActionCopy:    actionCopy,
 	valueActionFolge:   actionFolge,
+	valueActionKeep:    actionKeep,
 	valueActionNew:     actionNew,
 	valueActionVersion: actionVersion,
 }
@@ -65,6 +65,8 @@ func (wui *WebUI) MakeGetCreateZettelHandler(
 			wui.renderZettelForm(ctx, w, createZettel.PrepareCopy(origZettel), "Copy Zettel", "", roleData, syntaxData)
 		case actionFolge:
 			wui.renderZettelForm(ctx, w, createZettel.PrepareFolge(origZettel), "Folge Zettel", "", roleData, syntaxData)
+		case actionKeep:
+			wui.renderZettelForm(ctx, w, createZettel.PrepareKeep(origZettel), "Keep Zettel", "", roleData, syntaxData)
 		case actionNew:
 			title := parser.NormalizedSpacedText(origZettel.Meta.GetTitle())
 			newTitle := parser.NormalizedSpacedText(q.Get(api.KeyTitle))
@@ -173,7 +175,8 @@ func (wui *WebUI) MakeGetZettelFromListHandler(
 			wui.reportError(ctx, w, err)
 			return
 		}
-		entries, _ := evaluator.QueryAction(ctx, q, metaSeq, wui.rtConfig)
+		dups, _ := queryMeta.Duplicates(ctx, q, metaSeq)
+		entries, _ := evaluator.QueryAction(ctx, q, metaSeq, dups, wui.rtConfig)
 		bns := evaluate.RunBlockNode(ctx, entries)
 		enc := zmkenc.Create()
 		var zmkContent bytes.Buffer
@@ -16,6 +16,7 @@ package webui
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"t73f.de/r/sx"
@@ -24,6 +25,7 @@ import (
 	"zettelstore.de/z/box"
 	"zettelstore.de/z/config"
 	"zettelstore.de/z/parser"
+	"zettelstore.de/z/query"
 	"zettelstore.de/z/usecase"
 	"zettelstore.de/z/web/server"
 	"zettelstore.de/z/zettel/id"
@@ -34,6 +36,7 @@ import (
 func (wui *WebUI) MakeGetHTMLZettelHandler(
 	evaluate *usecase.Evaluate,
 	getZettel usecase.GetZettel,
+	queryMeta *usecase.Query,
 ) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -83,6 +86,7 @@ func (wui *WebUI) MakeGetHTMLZettelHandler(
 		wui.bindLinks(ctx, &rb, "subordinate", zn.InhMeta, api.KeySubordinates, config.KeyShowSubordinateLinks, getTextTitle)
 		wui.bindLinks(ctx, &rb, "back", zn.InhMeta, api.KeyBack, config.KeyShowBackLinks, getTextTitle)
 		wui.bindLinks(ctx, &rb, "successor", zn.InhMeta, api.KeySuccessors, config.KeyShowSuccessorLinks, getTextTitle)
+		wui.bindRelatedLinks(ctx, &rb, queryMeta, zn.InhMeta, getTextTitle)
 		if role, found := zn.InhMeta.Get(api.KeyRole); found && role != "" {
 			for _, part := range []string{"meta", "actions", "heading"} {
 				rb.rebindResolved("ROLE-"+role+"-"+part, "ROLE-DEFAULT-"+part)
@@ -121,14 +125,10 @@ func metaURLAssoc(m *meta.Meta) *sx.Pair {
 
 func (wui *WebUI) bindLinks(ctx context.Context, rb *renderBinder, varPrefix string, m *meta.Meta, key, configKey string, getTextTitle getTextTitleFunc) {
 	varLinks := varPrefix + "-links"
-	var symOpen *sx.Symbol
-	switch wui.rtConfig.Get(ctx, m, configKey) {
-	case "false":
+	symOpen, show := wui.getLinksOpen(ctx, m, configKey)
+	if !show {
 		rb.bindString(varLinks, sx.Nil())
 		return
-	case "close":
-	default:
-		symOpen = shtml.SymAttrOpen
 	}
 	lstLinks := wui.zettelLinksSxn(m, key, getTextTitle)
 	rb.bindString(varLinks, lstLinks)
@@ -138,6 +138,63 @@ func (wui *WebUI) bindLinks(ctx context.Context, rb *renderBinder, varPrefix str
 	rb.bindString(varPrefix+"-open", symOpen)
 }
 
+func (wui *WebUI) getLinksOpen(ctx context.Context, m *meta.Meta, configKey string) (*sx.Symbol, bool) {
+	switch wui.rtConfig.Get(ctx, m, configKey) {
+	case "false":
+		return nil, false
+	case "close":
+		return nil, true
+	default:
+		return shtml.SymAttrOpen, true
+	}
+}
+
+// maxRelatedLinks is the maximum number of related zettel on a zettel page.
+const maxRelatedLinks = 7
+
+// bindRelatedLinks binds a list of zettel that are similar to the given
+// zettel, but which are not linked with it. They might be candidates for
+// missing links.
+func (wui *WebUI) bindRelatedLinks(ctx context.Context, rb *renderBinder, queryMeta *usecase.Query, m *meta.Meta, getTextTitle getTextTitleFunc) {
+	symOpen, show := wui.getLinksOpen(ctx, m, config.KeyShowRelatedLinks)
+	if !show {
+		rb.bindString("related-links", sx.Nil())
+		return
+	}
+	q := query.Parse(m.Zid.String() + " " + query.SimilarDirective + " " + api.MaxDirective + " " + strconv.Itoa(3*maxRelatedLinks))
+	ml, err := queryMeta.Run(ctx, q)
+	if err != nil {
+		wui.log.Info().Err(err).Zid(m.Zid).Msg("unable to retrieve related zettel")
+		rb.bindString("related-links", sx.Nil())
+		return
+	}
+	linked := id.NewSet()
+	for _, p := range m.ComputedPairsRest() {
+		switch meta.Type(p.Key) {
+		case meta.TypeID, meta.TypeIDSet:
+			for _, val := range meta.ListFromValue(p.Value) {
+				if zid, errParse := id.Parse(val); errParse == nil {
+					linked.Add(zid)
+				}
+			}
+		}
+	}
+	values := make([]string, 0, maxRelatedLinks)
+	for _, rm := range ml {
+		if len(values) >= maxRelatedLinks {
+			break
+		}
+		if !linked.Contains(rm.Zid) {
+			values = append(values, rm.Zid.String())
+		}
+	}
+	lstLinks := wui.zidLinksSxn(values, getTextTitle)
+	rb.bindString("related-links", lstLinks)
+	if !sx.IsNil(lstLinks) {
+		rb.bindString("related-open", symOpen)
+	}
+}
+
 func (wui *WebUI) zettelLinksSxn(m *meta.Meta, key string, getTextTitle getTextTitleFunc) *sx.Pair {
 	values, ok := m.GetList(key)
 	if !ok || len(values) == 0 {
@@ -64,7 +64,7 @@ func (wui *WebUI) MakeListHTMLMetaHandler(
 			wui.reportError(ctx, w, err)
 			return
 		}
-		if len(actions) > 0 {
+		if len(actions) > 0 && q.Explain() == nil {
 			if len(metaSeq) > 0 {
 				for _, act := range actions {
 					if act == api.RedirectAction {
@@ -86,7 +86,8 @@ func (wui *WebUI) MakeListHTMLMetaHandler(
 
 		var content, endnotes *sx.Pair
 		numEntries := 0
-		if bn, cnt := evaluator.QueryAction(ctx, q, metaSeq, wui.rtConfig); bn != nil {
+		dups, _ := queryMeta.Duplicates(ctx, q, metaSeq)
+		if bn, cnt := evaluator.QueryAction(ctx, q, metaSeq, dups, wui.rtConfig); bn != nil {
 			enc := wui.getSimpleHTMLEncoder(wui.rtConfig.Get(ctx, nil, api.KeyLang))
 			content, endnotes, err = enc.BlocksSxn(&ast.BlockSlice{bn})
 			if err != nil {
@@ -26,6 +26,7 @@ import (
 
 const (
 	UnknownMIME  = "application/octet-stream"
+	CSV          = "text/csv; charset=utf-8"
 	mimeGIF      = "image/gif"
 	mimeHTML     = "text/html; charset=utf-8"
 	mimeJPEG     = "image/jpeg"
@@ -17,6 +17,7 @@ package impl
 import (
 	"context"
 	"net/http"
+	"net/netip"
 	"time"
 
 	"t73f.de/r/zsc/api"
@@ -36,14 +37,14 @@ type myServer struct {
 }
 
 // New creates a new web server.
-func New(log *logger.Logger, listenAddr, baseURL, urlPrefix string, persistentCookie, secureCookie bool, maxRequestSize int64, auth auth.TokenManager) server.Server {
+func New(log *logger.Logger, listenAddr, baseURL, urlPrefix string, persistentCookie, secureCookie bool, maxRequestSize int64, trusted []netip.Prefix, auth auth.TokenManager) server.Server {
 	srv := myServer{
 		log:              log,
 		baseURL:          baseURL,
 		persistentCookie: persistentCookie,
 		secureCookie:     secureCookie,
 	}
-	srv.router.initializeRouter(log, urlPrefix, maxRequestSize, auth)
+	srv.router.initializeRouter(log, urlPrefix, maxRequestSize, trusted, auth)
 	srv.server.initializeHTTPServer(listenAddr, &srv.router)
 	return &srv
 }
@@ -60,6 +61,13 @@ func (srv *myServer) AddZettelRoute(key byte, method server.Method, handler http
 func (srv *myServer) SetUserRetriever(ur server.UserRetriever) {
 	srv.router.ur = ur
 }
+func (srv *myServer) SetProxyAuth(header string, ir server.IdentRetriever) {
+	srv.router.proxyHeader = http.CanonicalHeaderKey(header)
+	srv.router.ir = ir
+}
+func (srv *myServer) SetShareRetriever(sr server.ShareRetriever) {
+	srv.router.sr = sr
+}
 
 func (srv *myServer) GetURLPrefix() string {
 	return srv.router.urlPrefix
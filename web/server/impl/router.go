@@ -14,15 +14,21 @@
 package impl
 
 import (
+	"context"
 	"io"
 	"net/http"
+	"net/netip"
 	"regexp"
 	"strings"
 
+	"t73f.de/r/zsc/api"
 	"zettelstore.de/z/auth"
 	"zettelstore.de/z/kernel"
 	"zettelstore.de/z/logger"
+	"zettelstore.de/z/query"
 	"zettelstore.de/z/web/server"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
 )
 
 type (
@@ -49,13 +55,19 @@ type httpRouter struct {
 	listTable   routingTable
 	zettelTable routingTable
 	ur          server.UserRetriever
+	sr          server.ShareRetriever
 	mux         *http.ServeMux
 	maxReqSize  int64
+
+	proxyHeader  string
+	proxyTrusted []netip.Prefix
+	ir           server.IdentRetriever
 }
 
 // initializeRouter creates a new, empty router with the given root handler.
-func (rt *httpRouter) initializeRouter(log *logger.Logger, urlPrefix string, maxRequestSize int64, auth auth.TokenManager) {
+func (rt *httpRouter) initializeRouter(log *logger.Logger, urlPrefix string, maxRequestSize int64, trusted []netip.Prefix, auth auth.TokenManager) {
 	rt.log = log
+	rt.proxyTrusted = trusted
 	rt.urlPrefix = urlPrefix
 	rt.auth = auth
 	rt.minKey = 255
@@ -133,6 +145,7 @@ func (rt *httpRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.URL.Path = r.URL.Path[prefixLen-1:]
 	}
 	r.Body = http.MaxBytesReader(w, r.Body, rt.maxReqSize)
+	r = r.WithContext(context.WithValue(r.Context(), server.CtxKeyClient, rt.getClientAddr(r)))
 	match := rt.reURL.FindStringSubmatch(r.URL.Path)
 	if len(match) != 3 {
 		rt.mux.ServeHTTP(w, rt.addUserContext(r))
@@ -156,6 +169,16 @@ func (rt *httpRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if ok && mh != nil {
 		if handler := mh[method]; handler != nil {
 			r.URL.Path = "/" + match[2]
+			if method == server.MethodGet && r.URL.Query().Has(server.QueryKeyShare) {
+				var shareOK bool
+				if r, shareOK = rt.addShareContext(r, key, match[2]); !shareOK {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					if withDebug {
+						rt.log.Debug().Int("sc", int64(w.(*traceResponseWriter).statusCode)).Msg("invalid share")
+					}
+					return
+				}
+			}
 			handler.ServeHTTP(w, rt.addUserContext(r))
 			if withDebug {
 				rt.log.Debug().Int("sc", int64(w.(*traceResponseWriter).statusCode)).Msg("/ServeHTTP")
@@ -174,6 +197,9 @@ func (rt *httpRouter) addUserContext(r *http.Request) *http.Request {
 		// No auth needed
 		return r
 	}
+	if rt.proxyHeader != "" && rt.isTrustedProxy(r) {
+		return rt.addProxyUserContext(r)
+	}
 	k := auth.KindAPI
 	t := getHeaderToken(r)
 	if len(t) == 0 {
@@ -199,6 +225,105 @@ func (rt *httpRouter) addUserContext(r *http.Request) *http.Request {
 	return r.WithContext(updateContext(ctx, user, &tokenData))
 }
 
+// addShareContext validates the share token of the request and stores the
+// share data in the context of the request. Only the shared zettel or the
+// shared query result can be retrieved with a share token.
+func (rt *httpRouter) addShareContext(r *http.Request, key byte, zidS string) (*http.Request, bool) {
+	if rt.sr == nil || (key != 'h' && key != 'z') {
+		return r, false
+	}
+	vals := r.URL.Query()
+	shareZid, err := rt.auth.CheckShareToken([]byte(vals.Get(server.QueryKeyShare)))
+	if err != nil {
+		rt.log.Info().Err(err).HTTPIP(r).Msg("invalid share token")
+		return r, false
+	}
+	ctx := r.Context()
+	share, creator, err := rt.sr.UseShare(ctx, shareZid)
+	if err != nil {
+		rt.log.Info().Zid(shareZid).Err(err).HTTPIP(r).Msg("share not usable")
+		return r, false
+	}
+	data := server.ShareData{Share: share, Creator: creator, Zid: id.Invalid}
+	if zidS == "" {
+		q, found := share.Get(meta.KeyShareQuery)
+		if !found {
+			return r, false
+		}
+		data.Query = q
+		data.Zids = query.Parse(q).GetZids()
+		vals.Set(api.QueryKeyQuery, q)
+		r.URL.RawQuery = vals.Encode()
+	} else {
+		zid, err := id.Parse(zidS)
+		if err != nil || share.GetDefault(meta.KeyShareZettel, "") != zidS {
+			return r, false
+		}
+		data.Zid = zid
+	}
+	return r.WithContext(context.WithValue(ctx, server.CtxKeyShare, &data)), true
+}
+
+// isTrustedProxy returns true, if the request was sent by a trusted reverse proxy.
+func (rt *httpRouter) isTrustedProxy(r *http.Request) bool {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return rt.isTrustedAddr(ap.Addr())
+}
+
+func (rt *httpRouter) isTrustedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range rt.proxyTrusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// addProxyUserContext uses the user identification, sent by a trusted
+// reverse proxy, to determine the user. Auth tokens are not used.
+func (rt *httpRouter) addProxyUserContext(r *http.Request) *http.Request {
+	ident := r.Header.Get(rt.proxyHeader)
+	if ident == "" {
+		rt.log.Debug().Str("header", rt.proxyHeader).Msg("no user identification from proxy")
+		return r
+	}
+	ctx := r.Context()
+	user, err := rt.ir(ctx, ident)
+	if err != nil || user == nil {
+		rt.log.Info().Str("ident", ident).Err(err).HTTPIP(r).Msg("proxy user not found")
+		return r
+	}
+	return r.WithContext(updateContext(ctx, user, nil))
+}
+
+// getClientAddr returns the network address of the client. The header
+// X-Forwarded-For is only used, if the request was sent by a trusted proxy.
+// Since every proxy appends the address of its client, the right-most address
+// that does not belong to a trusted proxy is the address of the client.
+func (rt *httpRouter) getClientAddr(r *http.Request) string {
+	if !rt.isTrustedProxy(r) {
+		return r.RemoteAddr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	result := r.RemoteAddr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(hop)
+		if err != nil || !rt.isTrustedAddr(addr) {
+			return hop
+		}
+		result = hop
+	}
+	return result
+}
+
 func getSessionToken(r *http.Request) []byte {
 	cookie, err := r.Cookie(sessionName)
 	if err != nil {
@@ -0,0 +1,118 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2024-present Detlef Stern
+//
+// This file is part of Zettelstore.
+//
+// Zettelstore is licensed under the latest version of the EUPL (European Union
+// Public License). Please see file LICENSE.txt for your rights and obligations
+// under this license.
+//
+// SPDX-License-Identifier: EUPL-1.2
+// SPDX-FileCopyrightText: 2024-present Detlef Stern
+//-----------------------------------------------------------------------------
+
+package impl
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"t73f.de/r/zsc/api"
+	"zettelstore.de/z/web/server"
+	"zettelstore.de/z/zettel/id"
+	"zettelstore.de/z/zettel/meta"
+)
+
+func TestGetClientAddr(t *testing.T) {
+	t.Parallel()
+	rt := httpRouter{proxyTrusted: []netip.Prefix{
+		netip.MustParsePrefix("127.0.0.1/32"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+	}}
+	testcases := []struct {
+		remote    string
+		forwarded []string
+		exp       string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1:1234"},
+		{"192.0.2.1:1234", []string{"198.51.100.7"}, "192.0.2.1:1234"},
+		{"127.0.0.1:1234", nil, "127.0.0.1:1234"},
+		{"127.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"127.0.0.1:1234", []string{"1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"127.0.0.1:1234", []string{"1.2.3.4, 198.51.100.7, 10.1.1.1"}, "198.51.100.7"},
+		{"127.0.0.1:1234", []string{"1.2.3.4", "198.51.100.7 , 10.1.1.1"}, "198.51.100.7"},
+		{"127.0.0.1:1234", []string{"10.2.2.2, 10.1.1.1"}, "10.2.2.2"},
+		{"127.0.0.1:1234", []string{"1.2.3.4, unknown"}, "unknown"},
+		{"127.0.0.1:1234", []string{""}, "127.0.0.1:1234"},
+		{"[::ffff:127.0.0.1]:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+	}
+	for i, tc := range testcases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remote
+		for _, val := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", val)
+		}
+		if got := rt.getClientAddr(r); got != tc.exp {
+			t.Errorf("%d: %q / %v: expected %q, but got %q", i, tc.remote, tc.forwarded, tc.exp, got)
+		}
+	}
+}
+
+type testUserRetriever struct{}
+
+func (testUserRetriever) GetUser(context.Context, id.Zid, string) (*meta.Meta, error) {
+	return nil, errors.New("no token based user expected")
+}
+
+func TestProxyAuth(t *testing.T) {
+	t.Parallel()
+	const header = "X-Remote-User"
+	alice := meta.New(id.Zid(1))
+	alice.Set(api.KeyUserID, "alice")
+	rt := httpRouter{
+		ur:          testUserRetriever{},
+		proxyHeader: header,
+		proxyTrusted: []netip.Prefix{
+			netip.MustParsePrefix("127.0.0.1/32"),
+			netip.MustParsePrefix("fd00::/8"),
+		},
+		ir: func(_ context.Context, ident string) (*meta.Meta, error) {
+			if ident == "alice" {
+				return alice, nil
+			}
+			return nil, errors.New("unknown user")
+		},
+	}
+	testcases := []struct {
+		name    string
+		remote  string
+		ident   string
+		trusted bool
+		user    *meta.Meta
+	}{
+		{"trusted", "127.0.0.1:4711", "alice", true, alice},
+		{"trusted-ipv6", "[fd00::1]:4711", "alice", true, alice},
+		{"trusted-mapped", "[::ffff:127.0.0.1]:4711", "alice", true, alice},
+		{"untrusted", "192.0.2.1:4711", "alice", false, nil},
+		{"untrusted-ipv6", "[2001:db8::1]:4711", "alice", false, nil},
+		{"invalid-remote", "localhost", "alice", false, nil},
+		{"missing-header", "127.0.0.1:4711", "", true, nil},
+		{"unknown-user", "127.0.0.1:4711", "bob", true, nil},
+	}
+	for _, tc := range testcases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.ident != "" {
+			r.Header.Set(header, tc.ident)
+		}
+		if got := rt.isTrustedProxy(r); got != tc.trusted {
+			t.Errorf("%s: expected trusted=%v, but got %v", tc.name, tc.trusted, got)
+		}
+		if got := server.GetUser(rt.addUserContext(r).Context()); got != tc.user {
+			t.Errorf("%s: expected user %v, but got %v", tc.name, tc.user, got)
+		}
+	}
+}
@@ -29,6 +29,17 @@ type UserRetriever interface {
 	GetUser(ctx context.Context, zid id.Zid, ident string) (*meta.Meta, error)
 }
 
+// IdentRetriever allows to retrieve user data based on the user identification.
+type IdentRetriever func(ctx context.Context, ident string) (*meta.Meta, error)
+
+// ShareRetriever allows to retrieve the data of a share zettel, which grants
+// read access to a zettel or a query result without authentication.
+type ShareRetriever interface {
+	// UseShare returns the share zettel and the user that created it. Each
+	// successful call counts as one view of the share.
+	UseShare(ctx context.Context, zid id.Zid) (share, creator *meta.Meta, err error)
+}
+
 // Method enumerates the allowed HTTP methods.
 type Method uint8
 
@@ -48,6 +59,11 @@ type Router interface {
 	AddListRoute(key byte, method Method, handler http.Handler)
 	AddZettelRoute(key byte, method Method, handler http.Handler)
 	SetUserRetriever(ur UserRetriever)
+	SetShareRetriever(sr ShareRetriever)
+
+	// SetProxyAuth trusts the given header to contain the user identification,
+	// if the request was sent from one of the trusted networks.
+	SetProxyAuth(header string, ir IdentRetriever)
 }
 
 // Builder allows to build new URLs for the web service.
@@ -100,6 +116,51 @@ type CtxKeyTypeSession struct{}
 // CtxKeySession is the key value to retrieve Authdata
 var CtxKeySession CtxKeyTypeSession
 
+// QueryKeyShare is the name of the URL query parameter that contains a share token.
+const QueryKeyShare = "share"
+
+// ShareData stores the data of a share, which grants read access to a zettel
+// or to a query result.
+type ShareData struct {
+	Share   *meta.Meta // Metadata of share zettel
+	Creator *meta.Meta // User that created the share
+	Zid     id.Zid     // Shared zettel, or id.Invalid if a query is shared
+	Query   string     // Shared query, if Zid is not valid
+	Zids    []id.Zid   // Zettel identifiers the shared query starts with
+}
+
+// GetShare returns the share data of the current request, or nil if there is none.
+func GetShare(ctx context.Context) *ShareData {
+	if ctx != nil {
+		if data, ok := ctx.Value(CtxKeyShare).(*ShareData); ok {
+			return data
+		}
+	}
+	return nil
+}
+
+// CtxKeyTypeShare is just an additional type to make context value retrieval unambiguous.
+type CtxKeyTypeShare struct{}
+
+// CtxKeyShare is the key value to retrieve share data.
+var CtxKeyShare CtxKeyTypeShare
+
+// GetClient returns the network address of the client that sent the current request.
+func GetClient(ctx context.Context) string {
+	if ctx != nil {
+		if client, ok := ctx.Value(CtxKeyClient).(string); ok {
+			return client
+		}
+	}
+	return ""
+}
+
+// CtxKeyTypeClient is just an additional type to make context value retrieval unambiguous.
+type CtxKeyTypeClient struct{}
+
+// CtxKeyClient is the key value to retrieve the client address.
+var CtxKeyClient CtxKeyTypeClient
+
 // AuthBuilder is a Builder that also allows to execute authentication functions.
 type AuthBuilder interface {
 	Auth
@@ -121,6 +121,22 @@ func GetSortedKeyDescriptions() []*DescriptionKey {
 // It is not an "official" key to be designed to last long.
 const KeyCreatedMissing = "created-missing"
 
+// KeyDuplicates lists the zettel that have the same content as a zettel.
+const KeyDuplicates = "duplicates"
+
+// KeyEncrypt marks a zettel whose content must be stored encrypted.
+const KeyEncrypt = "encrypt"
+
+// Keys of a share zettel.
+const (
+	KeyShareCreator  = "share-creator"
+	KeyShareMaxViews = "share-max-views"
+	KeyShareQuery    = "share-query"
+	KeyShareRevoked  = "share-revoked"
+	KeyShareViews    = "share-views"
+	KeyShareZettel   = "share-zettel"
+)
+
 // Supported keys.
 func init() {
 	registerKey(api.KeyID, TypeID, usageComputed, "")
@@ -143,7 +159,9 @@ func init() {
 	registerKey(api.KeyCreated, TypeTimestamp, usageComputed, "")
 	registerKey(api.KeyCredential, TypeCredential, usageUser, "")
 	registerKey(KeyCreatedMissing, TypeWord, usageProperty, "")
+	registerKey(KeyEncrypt, TypeWord, usageUser, "")
 	registerKey(api.KeyDead, TypeIDSet, usageProperty, "")
+	registerKey(KeyDuplicates, TypeIDSet, usageProperty, "")
 	registerKey(api.KeyExpire, TypeTimestamp, usageUser, "")
 	registerKey(api.KeyFolgeRole, TypeWord, usageUser, "")
 	registerKey(api.KeyForward, TypeIDSet, usageProperty, "")
@@ -155,6 +173,12 @@ func init() {
 	registerKey(api.KeyPublished, TypeTimestamp, usageProperty, "")
 	registerKey(api.KeyQuery, TypeEmpty, usageUser, "")
 	registerKey(api.KeyReadOnly, TypeWord, usageUser, "")
+	registerKey(KeyShareCreator, TypeID, usageUser, "")
+	registerKey(KeyShareMaxViews, TypeNumber, usageUser, "")
+	registerKey(KeyShareQuery, TypeEmpty, usageUser, "")
+	registerKey(KeyShareRevoked, TypeWord, usageUser, "")
+	registerKey(KeyShareViews, TypeNumber, usageUser, "")
+	registerKey(KeyShareZettel, TypeID, usageUser, "")
 	registerKey(api.KeySummary, TypeZettelmarkup, usageUser, "")
 	registerKey(api.KeySuperior, TypeIDSet, usageUser, api.KeySubordinates)
 	registerKey(api.KeyURL, TypeURL, usageUser, "")
@@ -96,13 +96,19 @@ const (
 	UserRoleCreator
 	UserRoleReader
 	UserRoleWriter
+	UserRoleAdmin
 	UserRoleOwner
 )
 
+// ValueUserRoleAdmin is the value of meta key 'user-role' for a user that
+// has owner rights, delegated by an owner.
+const ValueUserRoleAdmin = "admin"
+
 var urMap = map[string]UserRole{
 	api.ValueUserRoleCreator: UserRoleCreator,
 	api.ValueUserRoleReader:  UserRoleReader,
 	api.ValueUserRoleWriter:  UserRoleWriter,
+	ValueUserRoleAdmin:       UserRoleAdmin,
 	api.ValueUserRoleOwner:   UserRoleOwner,
 }
 